@@ -0,0 +1,110 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metric names recorded by anthropic:generate.
+const (
+	MetricGenerations        = "anthropic.generations"
+	MetricGenerationDuration = "anthropic.generation.duration"
+	MetricInputTokens        = "anthropic.tokens.input"
+	MetricOutputTokens       = "anthropic.tokens.output"
+)
+
+// Values of the outcome attribute on MetricGenerations and
+// MetricGenerationDuration.
+const (
+	OutcomeSuccess           = "success"
+	OutcomeValidationFailure = "validation_failure"
+	OutcomeError             = "error"
+)
+
+// errInvalidToolCall marks tool_use blocks that could not be turned into an
+// event, which are recorded as validation failures.
+var errInvalidToolCall = errors.New("invalid tool call")
+
+// generationMetrics holds the instruments shared by a loader's namespaces.
+// Instruments that fail to be created are left nil and skipped; a nil
+// *generationMetrics records nothing.
+type generationMetrics struct {
+	generations  metric.Int64Counter
+	duration     metric.Float64Histogram
+	inputTokens  metric.Int64Counter
+	outputTokens metric.Int64Counter
+}
+
+func newGenerationMetrics(mp metric.MeterProvider) *generationMetrics {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter("anthropic")
+	m := &generationMetrics{}
+	var err error
+	if m.generations, err = meter.Int64Counter(MetricGenerations,
+		metric.WithDescription("Generations attempted, by model and outcome"),
+		metric.WithUnit("{generation}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.duration, err = meter.Float64Histogram(MetricGenerationDuration,
+		metric.WithDescription("Latency of a generation, including tool use"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	if m.inputTokens, err = meter.Int64Counter(MetricInputTokens,
+		metric.WithDescription("Input tokens reported by the Messages API, by model"),
+		metric.WithUnit("{token}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.outputTokens, err = meter.Int64Counter(MetricOutputTokens,
+		metric.WithDescription("Output tokens reported by the Messages API, by model"),
+		metric.WithUnit("{token}")); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+// recordGeneration records one generation against model that started at
+// start and finished with err.
+func (m *generationMetrics) recordGeneration(ctx context.Context, model string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	outcome := OutcomeSuccess
+	if errors.Is(err, errInvalidToolCall) {
+		outcome = OutcomeValidationFailure
+	} else if err != nil {
+		outcome = OutcomeError
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("outcome", outcome),
+	)
+	if m.generations != nil {
+		m.generations.Add(ctx, 1, attrs)
+	}
+	if m.duration != nil {
+		m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	}
+}
+
+// recordUsage adds the token usage of one Messages API call against model.
+func (m *generationMetrics) recordUsage(ctx context.Context, model string, usage llm.Usage) {
+	if m == nil {
+		return
+	}
+	attrs := metric.WithAttributes(attribute.String("model", model))
+	if m.inputTokens != nil && usage.InputTokens > 0 {
+		m.inputTokens.Add(ctx, usage.InputTokens, attrs)
+	}
+	if m.outputTokens != nil && usage.OutputTokens > 0 {
+		m.outputTokens.Add(ctx, usage.OutputTokens, attrs)
+	}
+}
@@ -0,0 +1,319 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/llm"
+	"github.com/agentflare-ai/agentml-go/prompt"
+	"github.com/agentflare-ai/go-xmldom"
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AnthropicNamespaceURI is the XML namespace URI used for Anthropic executable elements.
+const AnthropicNamespaceURI = "github.com/agentflare-ai/agentml-go/anthropic"
+
+// DefaultMaxTokens is used when max-tokens is not set; the Messages API
+// requires an explicit limit.
+const DefaultMaxTokens = 1024
+
+// Options configures the namespaces created by LoaderWithOptions.
+type Options struct {
+	// MeterProvider receives the generation metrics (see MetricGenerations).
+	// When nil, the global MeterProvider is used.
+	MeterProvider metric.MeterProvider
+}
+
+// Loader returns a NamespaceLoader for the Anthropic namespace.
+func Loader() agentml.NamespaceLoader {
+	return LoaderWithOptions(Options{})
+}
+
+// LoaderWithOptions returns a NamespaceLoader for the Anthropic namespace
+// configured by opts.
+func LoaderWithOptions(opts Options) agentml.NamespaceLoader {
+	metrics := newGenerationMetrics(opts.MeterProvider)
+	return func(ctx context.Context, itp agentml.Interpreter, doc xmldom.Document) (agentml.Namespace, error) {
+		httpClient := &http.Client{
+			Timeout: 90 * time.Second,
+			Transport: &http.Transport{
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+		}
+
+		clientOpts := []option.RequestOption{option.WithHTTPClient(httpClient)}
+		if apiKey := os.Getenv("ANTHROPIC_API_KEY"); apiKey != "" {
+			clientOpts = append(clientOpts, option.WithAPIKey(apiKey))
+		}
+		if baseURL := os.Getenv("ANTHROPIC_BASE_URL"); baseURL != "" {
+			slog.Info("Using custom base URL", "baseURL", baseURL)
+			clientOpts = append(clientOpts, option.WithBaseURL(baseURL))
+		}
+
+		client := anthropic.NewClient(clientOpts...)
+		slog.Info("anthropic: client created")
+		return &ns{itp: itp, provider: NewProvider(client), metrics: metrics}, nil
+	}
+}
+
+type ns struct {
+	itp      agentml.Interpreter
+	provider llm.Provider
+	metrics  *generationMetrics
+}
+
+var _ agentml.Namespace = (*ns)(nil)
+
+func (n *ns) URI() string { return AnthropicNamespaceURI }
+
+func (n *ns) Unload(ctx context.Context) error { return nil }
+
+func (n *ns) Handle(ctx context.Context, el xmldom.Element) (bool, error) {
+	if el == nil {
+		return false, fmt.Errorf("anthropic: element cannot be nil")
+	}
+	switch string(el.LocalName()) {
+	case "generate":
+		return true, executeGenerate(ctx, n.itp, n.provider, n.metrics, el)
+	default:
+		return false, nil
+	}
+}
+
+// executeGenerate handles <anthropic:generate> element execution, sending the
+// request to p. Once p is called the generation is recorded to metrics, which
+// may be nil.
+func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, p llm.Provider, metrics *generationMetrics, el xmldom.Element) error {
+	model := string(el.GetAttribute("model"))
+	modelExpr := strings.TrimSpace(string(el.GetAttribute("modelexpr")))
+	promptAttr := string(el.GetAttribute("prompt"))
+	promptExpr := strings.TrimSpace(string(el.GetAttribute("promptexpr")))
+	location := string(el.GetAttribute("location"))
+	maxTokensStr := strings.TrimSpace(string(el.GetAttribute("max-tokens")))
+	temperatureStr := strings.TrimSpace(string(el.GetAttribute("temperature")))
+
+	if model == "" && modelExpr == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "Generate element missing required 'model' or 'modelexpr' attribute",
+			Data:      map[string]any{"element": "anthropic:generate", "line": 0},
+			Cause:     fmt.Errorf("generate element missing required 'model' or 'modelexpr' attribute"),
+		}
+	}
+
+	maxTokens := int64(DefaultMaxTokens)
+	if maxTokensStr != "" {
+		n, err := strconv.ParseInt(maxTokensStr, 10, 64)
+		if err != nil || n <= 0 {
+			if err == nil {
+				err = fmt.Errorf("max-tokens must be positive, got %q", maxTokensStr)
+			}
+			return invalidAttribute("max-tokens", maxTokensStr, err)
+		}
+		maxTokens = n
+	}
+
+	var temperature *float64
+	if temperatureStr != "" {
+		t, err := strconv.ParseFloat(temperatureStr, 64)
+		if err != nil || t < 0 || t > 1 {
+			if err == nil {
+				err = fmt.Errorf("temperature must be between 0 and 1, got %q", temperatureStr)
+			}
+			return invalidAttribute("temperature", temperatureStr, err)
+		}
+		temperature = &t
+	}
+
+	dataModel := interpreter.DataModel()
+	if dataModel == nil {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "No data model available for Anthropic generation",
+			Data:      map[string]any{"element": "anthropic:generate", "line": 0},
+			Cause:     fmt.Errorf("no data model available for anthropic generation"),
+		}
+	}
+
+	modelName := model
+	if modelExpr != "" {
+		if v, err := dataModel.EvaluateValue(ctx, modelExpr); err == nil {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				modelName = s
+			}
+		}
+	}
+
+	tracer := otel.Tracer("anthropic")
+	ctx, span := tracer.Start(ctx, "anthropic.generate.execute",
+		trace.WithAttributes(
+			attribute.String("anthropic.model", modelName),
+			attribute.String("anthropic.location", location),
+		),
+	)
+	defer span.End()
+
+	promptText := evaluatePrompt(ctx, dataModel, promptAttr)
+	if promptExpr != "" {
+		if v, err := dataModel.EvaluateValue(ctx, promptExpr); err == nil {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				if promptText != "" {
+					promptText += "\n"
+				}
+				promptText += s
+			}
+		}
+	}
+	if promptText == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "Generate element requires a non-empty 'prompt' or 'promptexpr'",
+			Data:      map[string]any{"element": "anthropic:generate", "line": 0, "attribute": "prompt"},
+			Cause:     fmt.Errorf("empty prompt"),
+		}
+	}
+
+	// Build the system prompt and send_* tools from the runtime snapshot
+	var systemPrompt string
+	var tools []llm.Tool
+	var eventNameMapping map[string]string
+	if doc, err := interpreter.Snapshot(ctx, agentml.SnapshotConfig{ExcludeData: true}); err == nil {
+		sendFunctions := prompt.BuildSendFunctions(llm.ExtractTransitions(doc))
+		tools = llm.BuildTools(sendFunctions, false)
+		eventNameMapping = llm.ToolMapping(tools)
+		prompt.PruneSnapshot(doc)
+		if b, err := xmldom.MarshalIndentWithOptions(doc, "", "  ", true); err == nil {
+			systemPrompt = prompt.CompressXML(string(b))
+		}
+	}
+
+	if location == "" && len(tools) == 0 {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "Generate element requires a 'location' attribute when no events are available",
+			Data:      map[string]any{"element": "anthropic:generate", "line": 0, "attribute": "location"},
+			Cause:     fmt.Errorf("no tools and no location"),
+		}
+	}
+
+	req := llm.Request{
+		Model:           modelName,
+		Messages:        []llm.Message{{Role: llm.RoleUser, Content: promptText}},
+		Tools:           tools,
+		MaxOutputTokens: int(maxTokens),
+		Temperature:     temperature,
+	}
+	if systemPrompt != "" {
+		req.Messages = append([]llm.Message{{Role: llm.RoleSystem, Content: systemPrompt}}, req.Messages...)
+	}
+	if len(tools) > 0 {
+		req.ToolChoice = llm.ToolChoiceAuto
+		if location == "" {
+			// Without a location the only useful outcome is an event
+			req.ToolChoice = llm.ToolChoiceRequired
+		}
+	}
+
+	slog.DebugContext(ctx, "anthropic: calling Messages API", "model", modelName, "num_tools", len(tools))
+	start := time.Now()
+	finish := func(err error) error {
+		metrics.recordGeneration(ctx, modelName, start, err)
+		return err
+	}
+	resp, err := p.Generate(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		return finish(&agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("Failed to generate content: %v", err),
+			Data:      map[string]any{"element": "anthropic:generate", "line": 0},
+			Cause:     err,
+		})
+	}
+	metrics.recordUsage(ctx, modelName, resp.Usage)
+	span.SetAttributes(
+		attribute.String("anthropic.stop_reason", resp.StopReason),
+		attribute.Int64("anthropic.input_tokens", resp.Usage.InputTokens),
+		attribute.Int64("anthropic.output_tokens", resp.Usage.OutputTokens),
+	)
+
+	for _, call := range resp.ToolCalls {
+		if err := processToolCall(ctx, interpreter, call, eventNameMapping); err != nil {
+			span.RecordError(err)
+			return finish(&agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to process tool call '%s': %v", call.Name, err),
+				Data:      map[string]any{"element": "anthropic:generate", "line": 0, "tool": call.Name},
+				Cause:     err,
+			})
+		}
+	}
+
+	if location != "" {
+		if err := dataModel.Assign(ctx, location, resp.Content); err != nil {
+			span.RecordError(err)
+			return finish(&agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to assign result to location '%s': %v", location, err),
+				Data:      map[string]any{"element": "anthropic:generate", "line": 0},
+				Cause:     err,
+			})
+		}
+	}
+	return finish(nil)
+}
+
+func invalidAttribute(name, value string, err error) error {
+	return &agentml.PlatformError{
+		EventName: "error.execution",
+		Message:   fmt.Sprintf("Invalid %s '%s': %v", name, value, err),
+		Data:      map[string]any{"element": "anthropic:generate", "line": 0, "attribute": name},
+		Cause:     err,
+	}
+}
+
+// evaluatePrompt evaluates prompt text that contains an expression, returning
+// it unchanged when it is plain text or fails to evaluate.
+func evaluatePrompt(ctx context.Context, dataModel agentml.DataModel, promptText string) string {
+	if !strings.Contains(promptText, "${") && !strings.Contains(promptText, "{{") {
+		return promptText
+	}
+	result, err := dataModel.EvaluateValue(ctx, promptText)
+	if err != nil {
+		return promptText
+	}
+	if s, ok := result.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", result)
+}
+
+// processToolCall sends the event named by a send_* tool call. Calls that
+// cannot be turned into an event are marked with errInvalidToolCall.
+func processToolCall(ctx context.Context, it agentml.Interpreter, call llm.ToolCall, eventNameMapping map[string]string) error {
+	if !strings.HasPrefix(call.Name, "send_") {
+		return fmt.Errorf("%w: unsupported function: %s (only send_* allowed)", errInvalidToolCall, call.Name)
+	}
+	var args map[string]any
+	if call.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			return fmt.Errorf("%w: failed to parse tool call arguments: %w", errInvalidToolCall, err)
+		}
+	}
+	return llm.SendEvent(ctx, it, llm.EventName(eventNameMapping, call.Name), args)
+}
@@ -0,0 +1,305 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/llm"
+	"github.com/agentflare-ai/go-xmldom"
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+type fakeDM struct{ store map[string]any }
+
+func newFakeDM() *fakeDM { return &fakeDM{store: map[string]any{}} }
+
+func (f *fakeDM) Initialize(ctx context.Context, dataElements []agentml.Data) error { return nil }
+func (f *fakeDM) EvaluateValue(ctx context.Context, expression string) (any, error) {
+	if v, ok := f.store[expression]; ok {
+		return v, nil
+	}
+	return expression, nil
+}
+func (f *fakeDM) EvaluateCondition(ctx context.Context, expression string) (bool, error) {
+	return false, nil
+}
+func (f *fakeDM) EvaluateLocation(ctx context.Context, location string) (any, error) {
+	return f.store[location], nil
+}
+func (f *fakeDM) Assign(ctx context.Context, location string, value any) error {
+	f.store[location] = value
+	return nil
+}
+func (f *fakeDM) GetVariable(ctx context.Context, id string) (any, error) { return f.store[id], nil }
+func (f *fakeDM) SetVariable(ctx context.Context, id string, value any) error {
+	f.store[id] = value
+	return nil
+}
+func (f *fakeDM) GetSystemVariable(ctx context.Context, name string) (any, error)     { return nil, nil }
+func (f *fakeDM) SetSystemVariable(ctx context.Context, name string, value any) error { return nil }
+func (f *fakeDM) SetCurrentEvent(ctx context.Context, event any) error                { return nil }
+func (f *fakeDM) ExecuteScript(ctx context.Context, script string) error              { return nil }
+func (f *fakeDM) Clone(ctx context.Context) (agentml.DataModel, error)                { return newFakeDM(), nil }
+func (f *fakeDM) ValidateExpression(ctx context.Context, expression string, exprType agentml.ExpressionType) error {
+	return nil
+}
+
+// fakeInterp is a minimal interpreter. When snapshot is set, Snapshot parses
+// it so generation offers send_* tools.
+type fakeInterp struct {
+	dm       *fakeDM
+	snapshot string
+	sent     []*agentml.Event
+}
+
+func (fi *fakeInterp) Handle(ctx context.Context, event *agentml.Event) error { return nil }
+func (fi *fakeInterp) Location(ctx context.Context) (string, error)           { return "", nil }
+func (fi *fakeInterp) Type() string                                           { return "test" }
+func (fi *fakeInterp) Shutdown(ctx context.Context) error                     { return nil }
+func (fi *fakeInterp) SessionID() string                                      { return "" }
+func (fi *fakeInterp) Configuration() []string                                { return nil }
+func (fi *fakeInterp) In(ctx context.Context, stateId string) bool            { return false }
+func (fi *fakeInterp) Raise(ctx context.Context, event *agentml.Event)        {}
+func (fi *fakeInterp) Send(ctx context.Context, event *agentml.Event) error {
+	fi.sent = append(fi.sent, event)
+	return nil
+}
+func (fi *fakeInterp) Cancel(ctx context.Context, sendId string) error                  { return nil }
+func (fi *fakeInterp) Log(ctx context.Context, label, message string)                   {}
+func (fi *fakeInterp) Context() context.Context                                         { return context.Background() }
+func (fi *fakeInterp) Clock() agentml.Clock                                             { return nil }
+func (fi *fakeInterp) DataModel() agentml.DataModel                                     { return fi.dm }
+func (fi *fakeInterp) ExecuteElement(ctx context.Context, element xmldom.Element) error { return nil }
+func (fi *fakeInterp) SendMessage(ctx context.Context, data agentml.SendData) error     { return nil }
+func (fi *fakeInterp) ScheduleMessage(ctx context.Context, data agentml.SendData) (string, error) {
+	return "", nil
+}
+func (fi *fakeInterp) InvokedSessions() map[string]agentml.Interpreter { return nil }
+func (fi *fakeInterp) Tracer() agentml.Tracer                          { return nil }
+func (fi *fakeInterp) Snapshot(ctx context.Context, maybeConfig ...agentml.SnapshotConfig) (xmldom.Document, error) {
+	if fi.snapshot == "" {
+		return nil, errors.New("no snapshot")
+	}
+	return xmldom.NewDecoder(strings.NewReader(fi.snapshot)).Decode()
+}
+func (fi *fakeInterp) Root() agentml.Filesystem { return nil }
+func (fi *fakeInterp) AfterFunc(ctx context.Context, fn func()) func() bool {
+	return context.AfterFunc(ctx, fn)
+}
+
+const toolSnapshot = `<agentml xmlns="github.com/agentflare-ai/agentml">
+  <state id="idle">
+    <transition event="user.done" target="idle"/>
+  </state>
+</agentml>`
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// stubClient returns a client whose transport records each request body and
+// answers with the given Messages API response.
+func stubClient(t *testing.T, response string) (anthropic.Client, *[]map[string]any) {
+	t.Helper()
+	var bodies []map[string]any
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(response)),
+			Request:    r,
+		}, nil
+	})
+	client := anthropic.NewClient(
+		option.WithHTTPClient(&http.Client{Transport: transport}),
+		option.WithBaseURL("http://anthropic.test/"),
+		option.WithAPIKey("test"),
+		option.WithMaxRetries(0),
+	)
+	return client, &bodies
+}
+
+func parseElement(t *testing.T, src string) xmldom.Element {
+	t.Helper()
+	doc, err := xmldom.NewDecoder(strings.NewReader(src)).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return doc.DocumentElement()
+}
+
+func TestGenerateToolUseSendsEvent(t *testing.T) {
+	client, bodies := stubClient(t, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test",
+		"content":[{"type":"tool_use","id":"toolu_1","name":"send_user_done","input":{"data":{"ok":true}}}],
+		"stop_reason":"tool_use","usage":{"input_tokens":12,"output_tokens":4}}`)
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+	el := parseElement(t, `<generate xmlns="`+AnthropicNamespaceURI+`" model="claude-test" prompt="finish up"/>`)
+	if err := executeGenerate(context.Background(), itp, NewProvider(client), nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	if len(itp.sent) != 1 || itp.sent[0].Name != "user.done" {
+		t.Fatalf("expected user.done to be sent, got %v", itp.sent)
+	}
+	if data, _ := itp.sent[0].Data.(map[string]any); data["ok"] != true {
+		t.Errorf("event data = %v", itp.sent[0].Data)
+	}
+
+	if len(*bodies) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*bodies))
+	}
+	body := (*bodies)[0]
+	if body["model"] != "claude-test" || body["max_tokens"] != float64(DefaultMaxTokens) {
+		t.Errorf("model/max_tokens = %v/%v", body["model"], body["max_tokens"])
+	}
+	tools, _ := body["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["name"] != "send_user_done" {
+		t.Errorf("tools = %v", body["tools"])
+	}
+	if choice, _ := body["tool_choice"].(map[string]any); choice["type"] != "any" {
+		t.Errorf("expected tool_choice any without location, got %v", body["tool_choice"])
+	}
+	system, _ := body["system"].([]any)
+	if len(system) != 1 || !strings.Contains(system[0].(map[string]any)["text"].(string), "user.done") {
+		t.Errorf("system prompt missing snapshot: %v", body["system"])
+	}
+}
+
+func TestGenerateToolUseNormalizesDelay(t *testing.T) {
+	tests := []struct{ delay, want string }{
+		{"PT5S", "5s"},
+		{"PT1M30S", "90s"},
+		{"500ms", "500ms"},
+		{"0s", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.delay, func(t *testing.T) {
+			client, _ := stubClient(t, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test",
+				"content":[{"type":"tool_use","id":"toolu_1","name":"send_user_done","input":{"delay":"`+tt.delay+`"}}],
+				"stop_reason":"tool_use","usage":{"input_tokens":12,"output_tokens":4}}`)
+			itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+			el := parseElement(t, `<generate xmlns="`+AnthropicNamespaceURI+`" model="claude-test" prompt="later"/>`)
+			if err := executeGenerate(context.Background(), itp, NewProvider(client), nil, el); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if len(itp.sent) != 1 {
+				t.Fatalf("expected one event, got %d", len(itp.sent))
+			}
+			if got := itp.sent[0].Delay; got != tt.want {
+				t.Errorf("delay = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTextToLocation(t *testing.T) {
+	client, bodies := stubClient(t, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test",
+		"content":[{"type":"text","text":"forty-two"}],
+		"stop_reason":"end_turn","usage":{"input_tokens":8,"output_tokens":2}}`)
+	itp := &fakeInterp{dm: newFakeDM()}
+	el := parseElement(t, `<generate xmlns="`+AnthropicNamespaceURI+`" model="claude-test" prompt="meaning of life?" location="answer" max-tokens="256" temperature="0.2"/>`)
+	if err := executeGenerate(context.Background(), itp, NewProvider(client), nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if itp.dm.store["answer"] != "forty-two" {
+		t.Errorf("answer = %v", itp.dm.store["answer"])
+	}
+	body := (*bodies)[0]
+	if body["max_tokens"] != float64(256) || body["temperature"] != 0.2 {
+		t.Errorf("max_tokens/temperature = %v/%v", body["max_tokens"], body["temperature"])
+	}
+	if _, ok := body["tools"]; ok {
+		t.Errorf("expected no tools without a snapshot, got %v", body["tools"])
+	}
+}
+
+func TestGenerateInvalidAttributes(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs string
+		attr  string
+	}{
+		{"temperature", `location="out" temperature="hot"`, "temperature"},
+		{"max-tokens", `location="out" max-tokens="0"`, "max-tokens"},
+		{"no location or tools", ``, "location"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, bodies := stubClient(t, `{}`)
+			itp := &fakeInterp{dm: newFakeDM()}
+			el := parseElement(t, `<generate xmlns="`+AnthropicNamespaceURI+`" model="claude-test" prompt="hi" `+tt.attrs+`/>`)
+			err := executeGenerate(context.Background(), itp, NewProvider(client), nil, el)
+			var pe *agentml.PlatformError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected PlatformError, got %v", err)
+			}
+			if pe.Data["attribute"] != tt.attr {
+				t.Errorf("attribute = %v, want %s", pe.Data["attribute"], tt.attr)
+			}
+			if len(*bodies) != 0 {
+				t.Errorf("expected no API call, got %d", len(*bodies))
+			}
+		})
+	}
+}
+
+func TestProviderConvertsConversation(t *testing.T) {
+	client, bodies := stubClient(t, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test",
+		"content":[{"type":"text","text":"done"}],
+		"stop_reason":"end_turn","usage":{"input_tokens":8,"output_tokens":2}}`)
+	var chunks []string
+	resp, err := NewProvider(client).Generate(context.Background(), llm.Request{
+		Model: "claude-test",
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: "be brief"},
+			{Role: llm.RoleUser, Content: "finish up"},
+			{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "toolu_1", Name: "send_user_done", Arguments: `{"data":{}}`}}},
+			{Role: llm.RoleTool, ToolCallID: "toolu_1", Content: "sent"},
+		},
+		Tools:      []llm.Tool{{Name: "send_user_done", Parameters: map[string]any{"type": "object", "properties": map[string]any{}}}},
+		ToolChoice: llm.ToolChoiceNone,
+		Stop:       []string{"END"},
+		OnChunk:    func(text string) error { chunks = append(chunks, text); return nil },
+	})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if resp.Content != "done" || resp.Usage.InputTokens != 8 || len(chunks) != 1 {
+		t.Errorf("response = %+v, chunks = %v", resp, chunks)
+	}
+
+	body := (*bodies)[0]
+	if system, _ := body["system"].([]any); len(system) != 1 {
+		t.Errorf("system = %v", body["system"])
+	}
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 3 {
+		t.Fatalf("messages = %v", body["messages"])
+	}
+	roles := []string{"user", "assistant", "user"}
+	types := []string{"text", "tool_use", "tool_result"}
+	for i, m := range messages {
+		msg := m.(map[string]any)
+		block := msg["content"].([]any)[0].(map[string]any)
+		if msg["role"] != roles[i] || block["type"] != types[i] {
+			t.Errorf("message %d = %v", i, msg)
+		}
+	}
+	if choice, _ := body["tool_choice"].(map[string]any); choice["type"] != "none" {
+		t.Errorf("tool_choice = %v", body["tool_choice"])
+	}
+	if stop, _ := body["stop_sequences"].([]any); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("stop_sequences = %v", body["stop_sequences"])
+	}
+}
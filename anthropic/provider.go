@@ -0,0 +1,160 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go/llm"
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// provider adapts an Anthropic client to llm.Provider using the Messages API.
+// Requests are never streamed; the callbacks are invoked once the response has
+// arrived, in output order.
+type provider struct {
+	client anthropic.Client
+}
+
+// errEmbeddingsNotSupported is returned by Embed: the Messages API has no
+// embeddings endpoint.
+var errEmbeddingsNotSupported = errors.New("anthropic: embeddings are not supported")
+
+// NewProvider returns an llm.Provider backed by client.
+func NewProvider(client anthropic.Client) llm.Provider {
+	return &provider{client: client}
+}
+
+func (p *provider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	maxTokens := int64(req.MaxOutputTokens)
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	system, messages := convertMessages(req.Messages)
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(req.Model),
+		MaxTokens: maxTokens,
+		Messages:  messages,
+		System:    system,
+	}
+	// The Messages API has no seed, prompt cache key or reasoning effort, so
+	// those fields are ignored
+	if req.Temperature != nil {
+		params.Temperature = anthropic.Float(*req.Temperature)
+	}
+	if len(req.Stop) > 0 {
+		params.StopSequences = req.Stop
+	}
+	if len(req.Tools) > 0 {
+		params.Tools = convertTools(req.Tools)
+		switch req.ToolChoice {
+		case llm.ToolChoiceRequired:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+		case llm.ToolChoiceNone:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+		case llm.ToolChoiceAuto:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{}}
+		}
+	}
+
+	message, err := p.client.Messages.New(ctx, params)
+	if err != nil {
+		return llm.Response{}, err
+	}
+	resp := llm.Response{
+		StopReason: string(message.StopReason),
+		Usage: llm.Usage{
+			InputTokens:       message.Usage.InputTokens,
+			OutputTokens:      message.Usage.OutputTokens,
+			CachedInputTokens: message.Usage.CacheReadInputTokens,
+		},
+	}
+	var text strings.Builder
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			resp.ToolCalls = append(resp.ToolCalls, llm.ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	resp.Content = text.String()
+	return resp, replayResponse(req, resp)
+}
+
+func (p *provider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	return nil, errEmbeddingsNotSupported
+}
+
+// convertMessages splits messages into the system prompt and the
+// conversation. Tool calls become tool_use blocks on the assistant turn and
+// tool results tool_result blocks on the following user turn.
+func convertMessages(messages []llm.Message) ([]anthropic.TextBlockParam, []anthropic.MessageParam) {
+	var system []anthropic.TextBlockParam
+	var params []anthropic.MessageParam
+	for _, msg := range messages {
+		switch msg.Role {
+		case llm.RoleSystem:
+			if msg.Content != "" {
+				system = append(system, anthropic.TextBlockParam{Text: msg.Content})
+			}
+		case llm.RoleAssistant:
+			var blocks []anthropic.ContentBlockParamUnion
+			if msg.Content != "" {
+				blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
+			}
+			for _, call := range msg.ToolCalls {
+				var input any = map[string]any{}
+				if call.Arguments != "" {
+					input = json.RawMessage(call.Arguments)
+				}
+				blocks = append(blocks, anthropic.NewToolUseBlock(call.ID, input, call.Name))
+			}
+			params = append(params, anthropic.NewAssistantMessage(blocks...))
+		case llm.RoleTool:
+			params = append(params, anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)))
+		default:
+			params = append(params, anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)))
+		}
+	}
+	return system, params
+}
+
+// convertTools converts shared tools to Messages API tools.
+func convertTools(tools []llm.Tool) []anthropic.ToolUnionParam {
+	params := make([]anthropic.ToolUnionParam, 0, len(tools))
+	for _, t := range tools {
+		schema := anthropic.ToolInputSchemaParam{Properties: t.Parameters["properties"]}
+		if required, ok := t.Parameters["required"].([]string); ok {
+			schema.Required = required
+		}
+		params = append(params, anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+			Name:        t.Name,
+			Description: anthropic.String(t.Description),
+			InputSchema: schema,
+		}})
+	}
+	return params
+}
+
+// replayResponse passes a complete response through the callbacks a
+// streamed one would have reached, stopping at the first error.
+func replayResponse(req llm.Request, resp llm.Response) error {
+	if req.OnChunk != nil && resp.Content != "" {
+		if err := req.OnChunk(resp.Content); err != nil {
+			return err
+		}
+	}
+	for _, call := range resp.ToolCalls {
+		if req.OnToolCallStart != nil {
+			req.OnToolCallStart(llm.ToolCall{ID: call.ID, Name: call.Name})
+		}
+		if req.OnToolCall != nil {
+			if err := req.OnToolCall(call); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package bubbletea
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/agentflare-ai/agentml-go"
@@ -22,6 +25,8 @@ const (
 	flagChanged updateFlags = 1 << iota
 	flagSubmitted
 	flagCursor
+	flagError
+	flagRejected
 )
 
 type componentEvents struct {
@@ -29,6 +34,11 @@ type componentEvents struct {
 	ChangeEvent string
 	SubmitEvent string
 	QuitEvent   string
+	ErrorEvent  string
+	ResizeEvent string
+	RejectEvent string
+	// KeyEvents maps tea.KeyMsg names to events emitted on that key.
+	KeyEvents map[string]string
 }
 
 type componentAdapter interface {
@@ -41,6 +51,30 @@ type componentAdapter interface {
 	CursorPayload() (map[string]any, bool)
 }
 
+// errorPayloader is implemented by adapters whose underlying model can fail.
+// ErrorPayload describes the most recent failure reported via flagError.
+type errorPayloader interface {
+	ErrorPayload() (map[string]any, bool)
+}
+
+// rejectPayloader is implemented by adapters that validate input.
+// RejectPayload describes the most recent edit reverted via flagRejected.
+type rejectPayloader interface {
+	RejectPayload() (map[string]any, bool)
+}
+
+// settledViewer is implemented by adapters that animate towards a target.
+// SettledView renders the component as it looks once the animation ends.
+type settledViewer interface {
+	SettledView() string
+}
+
+// componentErrorMsg carries a failure detected on behalf of a component's
+// underlying Bubbles model, which may otherwise swallow it.
+type componentErrorMsg struct {
+	err error
+}
+
 type baseModel struct {
 	ctx        context.Context
 	dispatcher eventDispatcher
@@ -78,8 +112,21 @@ func (m *baseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if key, event, ok := keyEvent(msg, m.events.KeyEvents); ok {
+		payload := m.adapter.Payload("key")
+		payload["key"] = key
+		m.emitEvent(event, payload)
+	}
+
 	cmd, flags := m.adapter.Update(msg)
 
+	if size, ok := msg.(tea.WindowSizeMsg); ok && m.events.ResizeEvent != "" {
+		payload := m.adapter.Payload("resize")
+		payload["width"] = size.Width
+		payload["height"] = size.Height
+		m.emitEvent(m.events.ResizeEvent, payload)
+	}
+
 	if flags&flagCursor != 0 && m.events.CursorEvent != "" {
 		if payload, ok := m.adapter.CursorPayload(); ok {
 			m.emitEvent(m.events.CursorEvent, payload)
@@ -90,6 +137,22 @@ func (m *baseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if flags&flagChanged != 0 && m.events.ChangeEvent != "" {
 		m.emitEvent(m.events.ChangeEvent, m.adapter.Payload("change"))
 	}
+	if flags&flagError != 0 && m.events.ErrorEvent != "" {
+		if reporter, ok := m.adapter.(errorPayloader); ok {
+			if payload, ok := reporter.ErrorPayload(); ok {
+				m.emitEvent(m.events.ErrorEvent, payload)
+			}
+		} else {
+			m.emitEvent(m.events.ErrorEvent, m.adapter.Payload("error"))
+		}
+	}
+	if flags&flagRejected != 0 && m.events.RejectEvent != "" {
+		if reporter, ok := m.adapter.(rejectPayloader); ok {
+			if payload, ok := reporter.RejectPayload(); ok {
+				m.emitEvent(m.events.RejectEvent, payload)
+			}
+		}
+	}
 	if flags&flagSubmitted != 0 {
 		if m.events.SubmitEvent != "" {
 			m.emitEvent(m.events.SubmitEvent, m.adapter.Payload("submit"))
@@ -103,6 +166,67 @@ func (m *baseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// windowSize reports the dimensions a component should adopt from msg. A
+// configured (non-zero) width or height is kept; zero values follow the
+// terminal. ok is false when msg is not a tea.WindowSizeMsg.
+func windowSize(msg tea.Msg, width, height int) (w, h int, ok bool) {
+	size, ok := msg.(tea.WindowSizeMsg)
+	if !ok {
+		return width, height, false
+	}
+	if width == 0 {
+		width = size.Width
+	}
+	if height == 0 {
+		height = size.Height
+	}
+	return width, height, true
+}
+
+// setValue returns the value carried by msg when it is the component's
+// set-event, delivered through Manager.Send with a {value} payload.
+func setValue(msg tea.Msg, setEvent string) (any, bool) {
+	event, ok := msg.(*agentml.Event)
+	if !ok || setEvent == "" || event.Name != setEvent {
+		return nil, false
+	}
+	data, ok := event.Data.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	value, ok := data["value"]
+	return value, ok
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func floatValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
 func (m *baseModel) View() string {
 	if m.adapter == nil {
 		return ""
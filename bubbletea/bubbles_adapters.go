@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -56,6 +58,9 @@ func normalizeEvents(cfg componentEvents) componentEvents {
 	if cfg.QuitEvent == "" {
 		cfg.QuitEvent = defaultQuitEvent
 	}
+	if cfg.ErrorEvent == "" {
+		cfg.ErrorEvent = defaultErrorEvent
+	}
 	return cfg
 }
 
@@ -66,6 +71,7 @@ type spinnerConfig struct {
 	ChangeEvent string `attr:"change-event"`
 	SubmitEvent string `attr:"submit-event"`
 	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
 }
 
 func parseSpinnerConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (spinnerConfig, error) {
@@ -91,6 +97,7 @@ func (cfg spinnerConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -160,6 +167,8 @@ type progressConfig struct {
 	ChangeEvent string  `attr:"change-event"`
 	SubmitEvent string  `attr:"submit-event"`
 	QuitEvent   string  `attr:"quit-event"`
+	ResizeEvent string  `attr:"resize-event"`
+	SetEvent    string  `attr:"set-event"`
 }
 
 func parseProgressConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (progressConfig, error) {
@@ -186,6 +195,7 @@ func (cfg progressConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -220,6 +230,18 @@ func (m *progressAdapter) Init() tea.Cmd {
 	return nil
 }
 func (m *progressAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if w, _, ok := windowSize(msg, m.config.Width, 0); ok {
+		m.model.Width = w
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		pct, ok := floatValue(value)
+		if !ok {
+			return nil, 0
+		}
+		cmd := m.model.SetPercent(pct)
+		m.lastPct = m.model.Percent()
+		return cmd, 0
+	}
 	prev := m.lastPct
 	var cmd tea.Cmd
 	updated, cmd := m.model.Update(msg)
@@ -233,6 +255,10 @@ func (m *progressAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
 	return cmd, 0
 }
 func (m *progressAdapter) View() string { return m.model.View() }
+
+// SettledView renders the bar at its target percent; View shows the value the
+// spring animation has reached so far.
+func (m *progressAdapter) SettledView() string { return m.model.ViewAs(m.model.Percent()) }
 func (m *progressAdapter) Payload(reason string) map[string]any {
 	return map[string]any{
 		"component":   "progress",
@@ -253,6 +279,7 @@ type paginatorConfig struct {
 	ChangeEvent string `attr:"change-event"`
 	SubmitEvent string `attr:"submit-event"`
 	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
 }
 
 func parsePaginatorConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (paginatorConfig, error) {
@@ -281,6 +308,7 @@ func (cfg paginatorConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -358,6 +386,8 @@ type viewportConfig struct {
 	ChangeEvent string `attr:"change-event"`
 	SubmitEvent string `attr:"submit-event"`
 	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
+	SetEvent    string `attr:"set-event"`
 }
 
 func parseViewportConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (viewportConfig, error) {
@@ -388,6 +418,7 @@ func (cfg viewportConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -425,14 +456,13 @@ func (m *viewportAdapter) Init() tea.Cmd {
 	return nil
 }
 func (m *viewportAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
-	switch size := msg.(type) {
-	case tea.WindowSizeMsg:
-		if m.config.Width == 0 {
-			m.model.Width = size.Width
-		}
-		if m.config.Height == 0 {
-			m.model.Height = size.Height
-		}
+	if w, h, ok := windowSize(msg, m.config.Width, m.config.Height); ok {
+		m.model.Width = w
+		m.model.Height = h
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		m.model.SetContent(stringValue(value))
+		return nil, 0
 	}
 	var cmd tea.Cmd
 	m.model, cmd = m.model.Update(msg)
@@ -469,19 +499,25 @@ func (m *viewportAdapter) CursorPayload() (map[string]any, bool) {
 }
 
 type textInputConfig struct {
-	ID          string   `attr:"id"`
-	Placeholder string   `attr:"placeholder"`
-	Prompt      string   `attr:"prompt"`
-	Value       string   `attr:"value"`
-	Width       int      `attr:"width"`
-	CharLimit   int      `attr:"char-limit"`
-	EchoMode    string   `attr:"echo-mode"`
-	Focused     bool     `attr:"focused"`
-	Suggestions []string `attr:"suggestions"`
-	CursorEvent string   `attr:"cursor-event"`
-	ChangeEvent string   `attr:"change-event"`
-	SubmitEvent string   `attr:"submit-event"`
-	QuitEvent   string   `attr:"quit-event"`
+	ID                string   `attr:"id"`
+	Placeholder       string   `attr:"placeholder"`
+	Prompt            string   `attr:"prompt"`
+	Value             string   `attr:"value"`
+	Width             int      `attr:"width"`
+	CharLimit         int      `attr:"char-limit"`
+	EchoMode          string   `attr:"echo-mode"`
+	Focused           bool     `attr:"focused"`
+	Suggestions       []string `attr:"suggestions"`
+	Validate          string   `attr:"validate"`
+	ValidationMessage string   `attr:"validation-message"`
+	CursorEvent       string   `attr:"cursor-event"`
+	ChangeEvent       string   `attr:"change-event"`
+	SubmitEvent       string   `attr:"submit-event"`
+	QuitEvent         string   `attr:"quit-event"`
+	ResizeEvent       string   `attr:"resize-event"`
+	SetEvent          string   `attr:"set-event"`
+	RejectEvent       string   `attr:"reject-event"`
+	pattern           *regexp.Regexp
 }
 
 func parseTextInputConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (textInputConfig, error) {
@@ -492,6 +528,22 @@ func parseTextInputConfig(ctx context.Context, el xmldom.Element, displayName st
 	if cfg.Value == "" && !hasExprAttribute(el, "value") {
 		cfg.Value = strings.TrimSpace(string(el.TextContent()))
 	}
+	if cfg.Validate != "" {
+		pattern, err := regexp.Compile(cfg.Validate)
+		if err != nil {
+			return cfg, &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("%s has an invalid validate pattern: %v", displayName, err),
+				Data: map[string]any{
+					"element":   displayName,
+					"attribute": "validate",
+					"value":     cfg.Validate,
+				},
+				Cause: err,
+			}
+		}
+		cfg.pattern = pattern
+	}
 	return cfg, nil
 }
 
@@ -512,6 +564,8 @@ func (cfg textInputConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
+		RejectEvent: cfg.RejectEvent,
 	})
 }
 
@@ -519,6 +573,7 @@ type textInputAdapter struct {
 	programID string
 	config    textInputConfig
 	model     textinput.Model
+	rejected  string
 }
 
 func newTextInputAdapter(programID string, cfg textInputConfig) *textInputAdapter {
@@ -566,12 +621,25 @@ func (m *textInputAdapter) Init() tea.Cmd {
 	return nil
 }
 func (m *textInputAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if w, _, ok := windowSize(msg, m.config.Width, 0); ok {
+		m.model.Width = w
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		m.model.SetValue(stringValue(value))
+		return nil, 0
+	}
 	prevValue := m.model.Value()
 	prevCursor := m.model.Position()
 	var cmd tea.Cmd
 	m.model, cmd = m.model.Update(msg)
 
 	flags := updateFlags(0)
+	if value := m.model.Value(); value != prevValue && !m.accepts(value) {
+		m.rejected = value
+		m.model.SetValue(prevValue)
+		m.model.SetCursor(prevCursor)
+		flags |= flagRejected
+	}
 	if m.model.Value() != prevValue {
 		flags |= flagChanged
 	}
@@ -583,6 +651,24 @@ func (m *textInputAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
 	}
 	return cmd, flags
 }
+
+// accepts reports whether value satisfies the validate pattern. An empty
+// value is always accepted so the field can be cleared.
+func (m *textInputAdapter) accepts(value string) bool {
+	return m.config.pattern == nil || value == "" || m.config.pattern.MatchString(value)
+}
+
+func (m *textInputAdapter) RejectPayload() (map[string]any, bool) {
+	return map[string]any{
+		"component":   "textinput",
+		"programId":   m.programID,
+		"componentId": m.config.ID,
+		"value":       m.model.Value(),
+		"rejected":    m.rejected,
+		"message":     m.config.ValidationMessage,
+		"reason":      "reject",
+	}, true
+}
 func (m *textInputAdapter) View() string { return m.model.View() }
 func (m *textInputAdapter) Payload(reason string) map[string]any {
 	return map[string]any{
@@ -617,6 +703,8 @@ type textAreaConfig struct {
 	ChangeEvent     string `attr:"change-event"`
 	SubmitEvent     string `attr:"submit-event"`
 	QuitEvent       string `attr:"quit-event"`
+	ResizeEvent     string `attr:"resize-event"`
+	SetEvent        string `attr:"set-event"`
 }
 
 func parseTextAreaConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (textAreaConfig, error) {
@@ -647,6 +735,7 @@ func (cfg textAreaConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -695,6 +784,14 @@ func (m *textAreaAdapter) Init() tea.Cmd {
 	return nil
 }
 func (m *textAreaAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if w, h, ok := windowSize(msg, m.config.Width, m.config.Height); ok {
+		m.model.SetWidth(w)
+		m.model.SetHeight(h)
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		m.model.SetValue(stringValue(value))
+		return nil, 0
+	}
 	prevValue := m.model.Value()
 	prevCursor := m.model.LineInfo()
 	var cmd tea.Cmd
@@ -749,6 +846,8 @@ type tableConfig struct {
 	ChangeEvent string `attr:"change-event"`
 	SubmitEvent string `attr:"submit-event"`
 	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
+	SetEvent    string `attr:"set-event"`
 	Columns     []table.Column
 	Rows        []table.Row
 }
@@ -936,6 +1035,7 @@ func (cfg tableConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -973,6 +1073,16 @@ func (m *tableAdapter) Init() tea.Cmd {
 	return nil
 }
 func (m *tableAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if w, h, ok := windowSize(msg, m.config.Width, m.config.Height); ok {
+		m.model.SetWidth(w)
+		m.model.SetHeight(h)
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		if rows, ok := tableRows(value); ok {
+			m.model.SetRows(rows)
+		}
+		return nil, 0
+	}
 	prev := m.model.Cursor()
 	var cmd tea.Cmd
 	m.model, cmd = m.model.Update(msg)
@@ -987,6 +1097,34 @@ func (m *tableAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
 	return cmd, flags
 }
 func (m *tableAdapter) View() string { return m.model.View() }
+
+// tableRows converts a set-event value (a list of rows, each a list of
+// cells) into table rows.
+func tableRows(value any) ([]table.Row, bool) {
+	list, ok := value.([]any)
+	if !ok {
+		if rows, ok := value.([]table.Row); ok {
+			return rows, true
+		}
+		return nil, false
+	}
+	rows := make([]table.Row, 0, len(list))
+	for _, item := range list {
+		switch cells := item.(type) {
+		case []string:
+			rows = append(rows, table.Row(cells))
+		case []any:
+			row := make(table.Row, len(cells))
+			for i, cell := range cells {
+				row[i] = stringValue(cell)
+			}
+			rows = append(rows, row)
+		default:
+			return nil, false
+		}
+	}
+	return rows, true
+}
 func (m *tableAdapter) Payload(reason string) map[string]any {
 	row := m.model.SelectedRow()
 	return map[string]any{
@@ -1024,6 +1162,8 @@ type filePickerConfig struct {
 	ChangeEvent      string   `attr:"change-event"`
 	SubmitEvent      string   `attr:"submit-event"`
 	QuitEvent        string   `attr:"quit-event"`
+	ResizeEvent      string   `attr:"resize-event"`
+	ErrorEvent       string   `attr:"error-event"`
 }
 
 func parseFilePickerConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (filePickerConfig, error) {
@@ -1050,6 +1190,8 @@ func (cfg filePickerConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
+		ErrorEvent:  cfg.ErrorEvent,
 	})
 }
 
@@ -1059,6 +1201,7 @@ type filePickerAdapter struct {
 	model     filepicker.Model
 	lastDir   string
 	lastPath  string
+	lastErr   error
 }
 
 func newFilePickerAdapter(programID string, cfg filePickerConfig) *filePickerAdapter {
@@ -1093,14 +1236,27 @@ func newFilePickerAdapter(programID string, cfg filePickerConfig) *filePickerAda
 func (m *filePickerAdapter) Type() string { return "filepicker" }
 func (m *filePickerAdapter) ID() string   { return m.config.ID }
 func (m *filePickerAdapter) Init() tea.Cmd {
-	return m.model.Init()
+	return tea.Batch(checkDirCmd(m.model.CurrentDirectory), m.model.Init())
 }
 func (m *filePickerAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if errMsg, ok := msg.(componentErrorMsg); ok {
+		m.lastErr = errMsg.err
+		return nil, flagError
+	}
+
+	if _, h, ok := windowSize(msg, 0, m.config.Height); ok && !m.config.AutoHeight {
+		m.model.SetHeight(h)
+	}
+
 	var cmd tea.Cmd
 	m.model, cmd = m.model.Update(msg)
 
 	flags := updateFlags(0)
 	if m.model.CurrentDirectory != m.lastDir || m.model.Path != m.lastPath {
+		// The filepicker drops read errors, so probe directories it enters.
+		if m.model.CurrentDirectory != m.lastDir {
+			cmd = tea.Batch(cmd, checkDirCmd(m.model.CurrentDirectory))
+		}
 		m.lastDir = m.model.CurrentDirectory
 		m.lastPath = m.model.Path
 		flags |= flagChanged
@@ -1122,6 +1278,29 @@ func (m *filePickerAdapter) Payload(reason string) map[string]any {
 	}
 }
 func (m *filePickerAdapter) CursorPayload() (map[string]any, bool) { return nil, false }
+func (m *filePickerAdapter) ErrorPayload() (map[string]any, bool) {
+	if m.lastErr == nil {
+		return nil, false
+	}
+	return map[string]any{
+		"component":        "filepicker",
+		"programId":        m.programID,
+		"componentId":      m.config.ID,
+		"currentDirectory": m.model.CurrentDirectory,
+		"error":            m.lastErr.Error(),
+		"reason":           "error",
+	}, true
+}
+
+// checkDirCmd reports a componentErrorMsg when dir cannot be read.
+func checkDirCmd(dir string) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := os.ReadDir(dir); err != nil {
+			return componentErrorMsg{err: err}
+		}
+		return nil
+	}
+}
 
 type timerConfig struct {
 	ID          string        `attr:"id"`
@@ -1131,6 +1310,7 @@ type timerConfig struct {
 	ChangeEvent string        `attr:"change-event"`
 	SubmitEvent string        `attr:"submit-event"`
 	QuitEvent   string        `attr:"quit-event"`
+	ResizeEvent string        `attr:"resize-event"`
 }
 
 func parseTimerConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (timerConfig, error) {
@@ -1166,6 +1346,7 @@ func (cfg timerConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
@@ -1228,6 +1409,7 @@ type stopwatchConfig struct {
 	ChangeEvent string        `attr:"change-event"`
 	SubmitEvent string        `attr:"submit-event"`
 	QuitEvent   string        `attr:"quit-event"`
+	ResizeEvent string        `attr:"resize-event"`
 }
 
 func parseStopwatchConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (stopwatchConfig, error) {
@@ -1253,6 +1435,7 @@ func (cfg stopwatchConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	})
 }
 
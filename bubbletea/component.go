@@ -48,7 +48,10 @@ func lookupComponent(name string) (componentParser, bool) {
 	return parser, ok
 }
 
-func registeredComponentNames() []string {
+// RegisteredComponents returns the sorted names of the registered
+// components. Each name is the local name of its element in the bubbletea
+// namespace, e.g. "list" for <bubbletea:list>.
+func RegisteredComponents() []string {
 	componentMu.RLock()
 	defer componentMu.RUnlock()
 	names := make([]string, 0, len(componentRegistry))
@@ -59,6 +62,13 @@ func registeredComponentNames() []string {
 	return names
 }
 
+// IsRegistered reports whether name, compared case-insensitively, is a
+// registered component.
+func IsRegistered(name string) bool {
+	_, ok := lookupComponent(name)
+	return ok
+}
+
 func resolveComponentType(el xmldom.Element) (componentType string, displayName string, err error) {
 	local := strings.ToLower(strings.TrimSpace(string(el.LocalName())))
 	if local == "" {
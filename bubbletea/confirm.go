@@ -0,0 +1,152 @@
+package bubbletea
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type confirmConfig struct {
+	ID          string `attr:"id"`
+	Prompt      string `attr:"prompt"`
+	Default     bool   `attr:"default" default:"true"`
+	Affirmative string `attr:"affirmative" default:"Yes"`
+	Negative    string `attr:"negative" default:"No"`
+	SubmitEvent string `attr:"submit-event"`
+	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
+}
+
+func parseConfirmConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (confirmConfig, error) {
+	cfg := confirmConfig{}
+	if err := bindComponentConfig(ctx, el, displayName, itp, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Prompt == "" && !hasExprAttribute(el, "prompt") {
+		cfg.Prompt = strings.TrimSpace(string(el.TextContent()))
+	}
+	return cfg, nil
+}
+
+func (cfg confirmConfig) componentType() string { return "confirm" }
+func (cfg confirmConfig) componentID() string   { return cfg.ID }
+func (cfg confirmConfig) newAdapter(programID string) componentAdapter {
+	return newConfirmAdapter(programID, cfg)
+}
+func (cfg confirmConfig) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Bool("bubbletea.confirm.default", cfg.Default),
+	}
+}
+func (cfg confirmConfig) events() componentEvents {
+	return normalizeEvents(componentEvents{
+		SubmitEvent: cfg.SubmitEvent,
+		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
+	})
+}
+
+// confirmAdapter renders a yes/no prompt. y or the affirmative label's first
+// letter confirms, n or the negative label's first letter declines, and enter
+// accepts the default.
+type confirmAdapter struct {
+	programID string
+	config    confirmConfig
+	confirmed bool
+	answered  bool
+}
+
+func newConfirmAdapter(programID string, cfg confirmConfig) *confirmAdapter {
+	return &confirmAdapter{
+		programID: programID,
+		config:    cfg,
+		confirmed: cfg.Default,
+	}
+}
+
+func (m *confirmAdapter) Type() string  { return "confirm" }
+func (m *confirmAdapter) ID() string    { return m.config.ID }
+func (m *confirmAdapter) Init() tea.Cmd { return nil }
+func (m *confirmAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok || m.answered {
+		return nil, 0
+	}
+	if isEnterKey(msg) {
+		m.confirmed = m.config.Default
+		m.answered = true
+		return nil, flagSubmitted
+	}
+	switch r := key.String(); {
+	case r == "y" || r == "Y" || matchesLabelKey(r, m.config.Affirmative):
+		m.confirmed = true
+	case r == "n" || r == "N" || matchesLabelKey(r, m.config.Negative):
+		m.confirmed = false
+	default:
+		return nil, 0
+	}
+	m.answered = true
+	return nil, flagSubmitted
+}
+func (m *confirmAdapter) View() string {
+	yes, no := labelKey(m.config.Affirmative, 'y'), labelKey(m.config.Negative, 'n')
+	if m.config.Default {
+		yes = unicode.ToUpper(yes)
+	} else {
+		no = unicode.ToUpper(no)
+	}
+	var b strings.Builder
+	if m.config.Prompt != "" {
+		fmt.Fprintf(&b, "%s ", m.config.Prompt)
+	}
+	fmt.Fprintf(&b, "[%c/%c]", yes, no)
+	if m.answered {
+		answer := m.config.Negative
+		if m.confirmed {
+			answer = m.config.Affirmative
+		}
+		fmt.Fprintf(&b, " %s", answer)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+func (m *confirmAdapter) Payload(reason string) map[string]any {
+	return map[string]any{
+		"component":   "confirm",
+		"programId":   m.programID,
+		"componentId": m.config.ID,
+		"confirmed":   m.confirmed,
+		"reason":      reason,
+	}
+}
+func (m *confirmAdapter) CursorPayload() (map[string]any, bool) { return nil, false }
+
+// labelKey returns the lowercase first letter of label, or fallback.
+func labelKey(label string, fallback rune) rune {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(label))
+	if r == utf8.RuneError || !unicode.IsLetter(r) {
+		return fallback
+	}
+	return unicode.ToLower(r)
+}
+
+func matchesLabelKey(key, label string) bool {
+	r, size := utf8.DecodeRuneInString(key)
+	if size != len(key) || strings.TrimSpace(label) == "" {
+		return false
+	}
+	return unicode.ToLower(r) == labelKey(label, 0)
+}
+
+func init() {
+	registerComponent("confirm", func(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (componentConfig, error) {
+		return parseConfirmConfig(ctx, el, displayName, itp)
+	})
+}
@@ -0,0 +1,232 @@
+package bubbletea
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultFileViewerMaxSize caps the files bubbletea:file-viewer loads.
+const defaultFileViewerMaxSize = 1 << 20
+
+type fileViewerConfig struct {
+	ID          string `attr:"id"`
+	Width       int    `attr:"width"`
+	Height      int    `attr:"height"`
+	Highlight   bool   `attr:"highlight" default:"true"`
+	MaxSize     int64  `attr:"max-size"`
+	CursorEvent string `attr:"cursor-event"`
+	SubmitEvent string `attr:"submit-event"`
+	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
+	ErrorEvent  string `attr:"error-event"`
+	SetEvent    string `attr:"set-event"`
+}
+
+func parseFileViewerConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (fileViewerConfig, error) {
+	cfg := fileViewerConfig{}
+	if err := bindComponentConfig(ctx, el, displayName, itp, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultFileViewerMaxSize
+	}
+	return cfg, nil
+}
+
+func (cfg fileViewerConfig) componentType() string { return "file-viewer" }
+func (cfg fileViewerConfig) componentID() string   { return cfg.ID }
+func (cfg fileViewerConfig) newAdapter(programID string) componentAdapter {
+	return newFileViewerAdapter(programID, cfg)
+}
+func (cfg fileViewerConfig) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("bubbletea.file_viewer.width", cfg.Width),
+		attribute.Bool("bubbletea.file_viewer.highlight", cfg.Highlight),
+		attribute.Int64("bubbletea.file_viewer.max_size", cfg.MaxSize),
+	}
+}
+func (cfg fileViewerConfig) events() componentEvents {
+	return normalizeEvents(componentEvents{
+		CursorEvent: cfg.CursorEvent,
+		SubmitEvent: cfg.SubmitEvent,
+		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
+		ErrorEvent:  cfg.ErrorEvent,
+	})
+}
+
+// fileViewerAdapter shows a file in a scrollable viewport. Its set-event
+// carries the path to open, either as a string or as a filepicker payload
+// with a path field, so a filepicker's submit event can be forwarded with
+// <bubbletea:send valueexpr="_event.data">. A file that cannot be read or is
+// larger than max-size is reported via error-event and the previous file
+// stays shown.
+type fileViewerAdapter struct {
+	programID string
+	config    fileViewerConfig
+	model     viewport.Model
+	path      string
+	size      int64
+	lastY     float64
+	lastErr   error
+	errPath   string
+}
+
+func newFileViewerAdapter(programID string, cfg fileViewerConfig) *fileViewerAdapter {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultFileViewerMaxSize
+	}
+	return &fileViewerAdapter{
+		programID: programID,
+		config:    cfg,
+		model:     viewport.New(cfg.Width, cfg.Height),
+	}
+}
+
+func (m *fileViewerAdapter) Type() string  { return "file-viewer" }
+func (m *fileViewerAdapter) ID() string    { return m.config.ID }
+func (m *fileViewerAdapter) Init() tea.Cmd { return nil }
+func (m *fileViewerAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if w, h, ok := windowSize(msg, m.config.Width, m.config.Height); ok {
+		m.model.Width = w
+		m.model.Height = h
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		if err := m.open(fileViewerPath(value)); err != nil {
+			m.lastErr = err
+			return nil, flagError
+		}
+		return nil, 0
+	}
+	var cmd tea.Cmd
+	m.model, cmd = m.model.Update(msg)
+	if curr := m.model.ScrollPercent(); curr != m.lastY {
+		m.lastY = curr
+		return cmd, flagCursor
+	}
+	return cmd, 0
+}
+
+// open loads path into the viewport, refusing files over the size cap.
+func (m *fileViewerAdapter) open(path string) error {
+	m.errPath = path
+	if path == "" {
+		return fmt.Errorf("no file path given")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	// Read one byte past the cap so a file that grew since Stat is caught.
+	data, err := io.ReadAll(io.LimitReader(f, m.config.MaxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > m.config.MaxSize {
+		return fmt.Errorf("%s exceeds the %d byte limit", path, m.config.MaxSize)
+	}
+
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if m.config.Highlight {
+		content = highlightSource(content, path)
+	}
+	m.path = path
+	m.size = int64(len(data))
+	m.model.SetContent(content)
+	m.model.GotoTop()
+	m.lastY = m.model.ScrollPercent()
+	return nil
+}
+
+// fileViewerPath extracts the path from a set-event value.
+func fileViewerPath(value any) string {
+	if data, ok := value.(map[string]any); ok {
+		value = data["path"]
+	}
+	return strings.TrimSpace(stringValue(value))
+}
+
+func (m *fileViewerAdapter) View() string { return m.model.View() }
+func (m *fileViewerAdapter) Payload(reason string) map[string]any {
+	return map[string]any{
+		"component":     "file-viewer",
+		"programId":     m.programID,
+		"componentId":   m.config.ID,
+		"path":          m.path,
+		"size":          m.size,
+		"scrollPercent": m.model.ScrollPercent(),
+		"reason":        reason,
+	}
+}
+func (m *fileViewerAdapter) CursorPayload() (map[string]any, bool) {
+	return map[string]any{
+		"component":     "file-viewer",
+		"programId":     m.programID,
+		"componentId":   m.config.ID,
+		"path":          m.path,
+		"scrollPercent": m.model.ScrollPercent(),
+	}, true
+}
+func (m *fileViewerAdapter) ErrorPayload() (map[string]any, bool) {
+	if m.lastErr == nil {
+		return nil, false
+	}
+	return map[string]any{
+		"component":   "file-viewer",
+		"programId":   m.programID,
+		"componentId": m.config.ID,
+		"path":        m.errPath,
+		"error":       m.lastErr.Error(),
+		"reason":      "error",
+	}, true
+}
+
+// fileViewerStyle is the chroma style files are highlighted with.
+const fileViewerStyle = "monokai"
+
+// highlightSource highlights source with chroma, using the lexer that
+// matches the file name in path and a 256-colour terminal formatter. Files
+// no lexer matches, or that fail to tokenise, are returned unchanged.
+func highlightSource(source, path string) string {
+	lexer := lexers.Match(filepath.Base(path))
+	if lexer == nil {
+		return source
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, source)
+	if err != nil {
+		return source
+	}
+	var b strings.Builder
+	if err := formatters.TTY256.Format(&b, styles.Get(fileViewerStyle), iterator); err != nil {
+		return source
+	}
+	return b.String()
+}
+
+func init() {
+	registerComponent("file-viewer", func(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (componentConfig, error) {
+		return parseFileViewerConfig(ctx, el, displayName, itp)
+	})
+}
@@ -1,6 +1,13 @@
 package bubbletea
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 func isEnterKey(msg tea.Msg) bool {
 	key, ok := msg.(tea.KeyMsg)
@@ -14,3 +21,42 @@ func isEnterKey(msg tea.Msg) bool {
 		return false
 	}
 }
+
+// parseKeyEvents reads the key-events attribute of a component element, a
+// comma-separated list of key:event pairs such as "r:ui.refresh, ctrl+s:ui.save".
+// Keys use Bubble Tea's tea.KeyMsg.String() names.
+func parseKeyEvents(el xmldom.Element, displayName string) (map[string]string, error) {
+	raw := strings.TrimSpace(string(el.GetAttribute("key-events")))
+	if raw == "" {
+		return nil, nil
+	}
+	bindings := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		key, event, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		key, event = strings.TrimSpace(key), strings.TrimSpace(event)
+		if !ok || key == "" || event == "" {
+			return nil, &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("%s key-events entry %q must be key:event", displayName, strings.TrimSpace(pair)),
+				Data: map[string]any{
+					"element":   displayName,
+					"attribute": "key-events",
+					"value":     raw,
+				},
+			}
+		}
+		bindings[key] = event
+	}
+	return bindings, nil
+}
+
+// keyEvent returns the event bound to the key in msg, if any.
+func keyEvent(msg tea.Msg, bindings map[string]string) (key, event string, ok bool) {
+	keyMsg, isKey := msg.(tea.KeyMsg)
+	if !isKey || len(bindings) == 0 {
+		return "", "", false
+	}
+	key = keyMsg.String()
+	event, ok = bindings[key]
+	return key, event, ok
+}
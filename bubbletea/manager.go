@@ -50,7 +50,9 @@ func (m *Manager) Start(ctx context.Context, cfg ProgramConfig, itp agentml.Inte
 
 	modelCtx, cancel := context.WithCancel(ctx)
 	adapter := cfg.component.newAdapter(cfg.ProgramID)
-	model := newBaseModel(modelCtx, cfg.ProgramID, adapter, cfg.component.events(), itp)
+	events := cfg.component.events()
+	events.KeyEvents = cfg.keyEvents
+	model := &programModel{baseModel: newBaseModel(modelCtx, cfg.ProgramID, adapter, events, itp)}
 	options := []tea.ProgramOption{tea.WithContext(modelCtx)}
 	if !isTTY() {
 		options = append(options, tea.WithoutRenderer())
@@ -73,16 +75,77 @@ func (m *Manager) Start(ctx context.Context, cfg ProgramConfig, itp agentml.Inte
 			}
 			m.mu.Unlock()
 		}()
-		if _, err := program.Run(); err != nil {
-			slog.ErrorContext(ctx, "bubbletea: program run failed",
-				"program_id", id,
-				"error", err)
-		}
+		runProgram(ctx, program, model)
 	}(cfg.ProgramID)
 
 	return cfg.ProgramID, nil
 }
 
+// programReadyMsg is delivered once the program has rendered its first frame.
+type programReadyMsg struct{}
+
+// programModel adds the program lifecycle events to a component model:
+// program-ready after the first render and program-quit when Run returns.
+type programModel struct {
+	*baseModel
+}
+
+// Init schedules programReadyMsg. Bubble Tea renders the initial view before
+// running Init commands, so the message arrives after the first render.
+func (m *programModel) Init() tea.Cmd {
+	ready := func() tea.Msg { return programReadyMsg{} }
+	if cmd := m.baseModel.Init(); cmd != nil {
+		return tea.Batch(cmd, ready)
+	}
+	return ready
+}
+
+func (m *programModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(programReadyMsg); ok {
+		m.emitEvent(programReadyEvent, m.lifecyclePayload())
+		return m, nil
+	}
+	_, cmd := m.baseModel.Update(msg)
+	return m, cmd
+}
+
+func (m *programModel) lifecyclePayload() map[string]any {
+	return map[string]any{
+		"component":   m.adapter.Type(),
+		"programId":   m.programID,
+		"componentId": m.adapter.ID(),
+	}
+}
+
+// runProgram runs program to completion and then emits program-quit, however
+// the program ended (quit key, submit or cancellation).
+func runProgram(ctx context.Context, program *tea.Program, model *programModel) {
+	payload := model.lifecyclePayload()
+	if _, err := program.Run(); err != nil {
+		slog.ErrorContext(ctx, "bubbletea: program run failed",
+			"program_id", model.programID,
+			"error", err)
+		payload["error"] = err.Error()
+	}
+	// The program's context may already be cancelled; the quit event must
+	// still reach the interpreter.
+	model.ctx = context.WithoutCancel(model.ctx)
+	model.emitEvent(programQuitEvent, payload)
+}
+
+// Send delivers event to the running program programID. Components apply
+// events named by their set-event attribute.
+func (m *Manager) Send(programID string, event *agentml.Event) error {
+	m.mu.Lock()
+	program, ok := m.programs[programID]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("bubbletea: program %q is not running", programID)
+	}
+	program.Send(event)
+	return nil
+}
+
 func isTTY() bool {
 	if force := strings.TrimSpace(os.Getenv("BUBBLETEA_FORCE_RENDER")); force != "" {
 		switch strings.ToLower(force) {
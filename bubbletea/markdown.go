@@ -0,0 +1,164 @@
+package bubbletea
+
+import (
+	"context"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type markdownConfig struct {
+	ID          string `attr:"id"`
+	Width       int    `attr:"width"`
+	Height      int    `attr:"height"`
+	Content     string `attr:"content"`
+	Theme       string `attr:"theme" default:"dark"`
+	CursorEvent string `attr:"cursor-event"`
+	SubmitEvent string `attr:"submit-event"`
+	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
+	SetEvent    string `attr:"set-event"`
+}
+
+func parseMarkdownConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (markdownConfig, error) {
+	cfg := markdownConfig{}
+	if err := bindComponentConfig(ctx, el, displayName, itp, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Content == "" && !hasExprAttribute(el, "content") {
+		cfg.Content = strings.TrimSpace(string(el.TextContent()))
+	}
+	return cfg, nil
+}
+
+func (cfg markdownConfig) componentType() string { return "markdown" }
+func (cfg markdownConfig) componentID() string   { return cfg.ID }
+func (cfg markdownConfig) newAdapter(programID string) componentAdapter {
+	return newMarkdownAdapter(programID, cfg)
+}
+func (cfg markdownConfig) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("bubbletea.markdown.width", cfg.Width),
+		attribute.String("bubbletea.markdown.theme", cfg.Theme),
+	}
+}
+func (cfg markdownConfig) events() componentEvents {
+	return normalizeEvents(componentEvents{
+		CursorEvent: cfg.CursorEvent,
+		SubmitEvent: cfg.SubmitEvent,
+		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
+	})
+}
+
+// markdownAdapter renders Markdown into a scrollable viewport. The source is
+// kept so the content can be re-rendered when the width changes.
+type markdownAdapter struct {
+	programID string
+	config    markdownConfig
+	source    string
+	model     viewport.Model
+	lastY     float64
+}
+
+func newMarkdownAdapter(programID string, cfg markdownConfig) *markdownAdapter {
+	m := &markdownAdapter{
+		programID: programID,
+		config:    cfg,
+		source:    cfg.Content,
+		model:     viewport.New(cfg.Width, cfg.Height),
+	}
+	m.render()
+	m.lastY = m.model.ScrollPercent()
+	return m
+}
+
+func (m *markdownAdapter) render() {
+	m.model.SetContent(renderMarkdown(m.source, m.model.Width, m.config.Theme))
+}
+
+func (m *markdownAdapter) Type() string  { return "markdown" }
+func (m *markdownAdapter) ID() string    { return m.config.ID }
+func (m *markdownAdapter) Init() tea.Cmd { return nil }
+func (m *markdownAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	if w, h, ok := windowSize(msg, m.config.Width, m.config.Height); ok {
+		resized := w != m.model.Width
+		m.model.Width = w
+		m.model.Height = h
+		if resized {
+			m.render()
+		}
+	}
+	if value, ok := setValue(msg, m.config.SetEvent); ok {
+		m.source = stringValue(value)
+		m.render()
+		m.model.GotoTop()
+		m.lastY = m.model.ScrollPercent()
+		return nil, 0
+	}
+	var cmd tea.Cmd
+	m.model, cmd = m.model.Update(msg)
+	if curr := m.model.ScrollPercent(); curr != m.lastY {
+		m.lastY = curr
+		return cmd, flagCursor
+	}
+	return cmd, 0
+}
+func (m *markdownAdapter) View() string { return m.model.View() }
+func (m *markdownAdapter) Payload(reason string) map[string]any {
+	return map[string]any{
+		"component":     "markdown",
+		"programId":     m.programID,
+		"componentId":   m.config.ID,
+		"scrollPercent": m.model.ScrollPercent(),
+		"atTop":         m.model.AtTop(),
+		"atBottom":      m.model.AtBottom(),
+		"reason":        reason,
+	}
+}
+func (m *markdownAdapter) CursorPayload() (map[string]any, bool) {
+	return map[string]any{
+		"component":     "markdown",
+		"programId":     m.programID,
+		"componentId":   m.config.ID,
+		"scrollPercent": m.model.ScrollPercent(),
+	}, true
+}
+
+// markdownThemes are the glamour standard styles the theme attribute may
+// name.
+var markdownThemes = map[string]bool{"dark": true, "light": true, "notty": true}
+
+// renderMarkdown renders source with glamour, word-wrapping to width when it
+// is positive. Unknown themes fall back to dark; "notty" renders without
+// styling. Source that fails to render is shown as written.
+func renderMarkdown(source string, width int, theme string) string {
+	theme = strings.ToLower(strings.TrimSpace(theme))
+	if !markdownThemes[theme] {
+		theme = "dark"
+	}
+	opts := []glamour.TermRendererOption{glamour.WithStandardStyle(theme)}
+	if width > 0 {
+		opts = append(opts, glamour.WithWordWrap(width))
+	}
+	renderer, err := glamour.NewTermRenderer(opts...)
+	if err != nil {
+		return source
+	}
+	out, err := renderer.Render(source)
+	if err != nil {
+		return source
+	}
+	return strings.Trim(out, "\n")
+}
+
+func init() {
+	registerComponent("markdown", func(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (componentConfig, error) {
+		return parseMarkdownConfig(ctx, el, displayName, itp)
+	})
+}
@@ -2,11 +2,76 @@ package bubbletea
 
 import (
 	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
 )
 
+func TestRegisteredComponents(t *testing.T) {
+	builtin := []string{
+		"confirm", "file-viewer", "filepicker", "list", "markdown", "paginator", "progress",
+		"spinner", "stopwatch", "table", "tabs", "textarea", "textinput", "timer", "viewport",
+	}
+	names := RegisteredComponents()
+	if !slices.IsSorted(names) {
+		t.Errorf("RegisteredComponents() = %v, want sorted names", names)
+	}
+	for _, name := range builtin {
+		if !slices.Contains(names, name) {
+			t.Errorf("RegisteredComponents() is missing %q", name)
+		}
+		if !IsRegistered(name) {
+			t.Errorf("IsRegistered(%q) = false", name)
+		}
+	}
+	if !IsRegistered(" List ") {
+		t.Error(`IsRegistered(" List ") = false, want case-insensitive match`)
+	}
+	for _, name := range []string{"", "foo", "component", "program"} {
+		if IsRegistered(name) {
+			t.Errorf("IsRegistered(%q) = true", name)
+		}
+	}
+}
+
+func TestRenderOnce(t *testing.T) {
+	programXML := `<bubbletea:program xmlns:bubbletea="` + NamespaceURI + `" id="status">
+  <bubbletea:tabs>
+    <bubbletea:tab title="Work">
+      <bubbletea:spinner id="busy" spinner="line" start="true"/>
+      <bubbletea:progress id="done" percent="0.5" width="20"/>
+    </bubbletea:tab>
+    <bubbletea:tab title="Help">Press q to quit.</bubbletea:tab>
+  </bubbletea:tabs>
+</bubbletea:program>`
+	want := " Work  Help \n\n|                   \n████████░░░░░░░  50%"
+	for i := 0; i < 2; i++ {
+		got, err := RenderOnce(context.Background(), programXML, 40, 10)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if got != want {
+			t.Fatalf("render %d = %q, want %q", i, got, want)
+		}
+	}
+
+	if _, err := RenderOnce(context.Background(), `<bubbletea:spinner xmlns:bubbletea="`+NamespaceURI+`"/>`, 40, 10); err == nil {
+		t.Error("expected an error for a root other than bubbletea:program")
+	}
+}
+
 func TestListModelEmitsEvents(t *testing.T) {
 	listCfg := listConfig{
 		ID:          "choices",
@@ -50,3 +115,489 @@ func TestListModelEmitsEvents(t *testing.T) {
 		t.Fatalf("expected quit event, got %+v", dispatcher.events)
 	}
 }
+
+// drain runs cmd and feeds the resulting messages back into model, following
+// batches, so Init-time commands take effect synchronously in tests.
+func drain(model tea.Model, cmd tea.Cmd) {
+	for depth := 0; cmd != nil && depth < 8; depth++ {
+		msg := cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for _, c := range batch {
+				drain(model, c)
+			}
+			return
+		}
+		if msg == nil {
+			return
+		}
+		_, cmd = model.Update(msg)
+	}
+}
+
+func TestFilePickerEmitsErrorEvent(t *testing.T) {
+	cfg := filePickerConfig{
+		ID:               "files",
+		CurrentDirectory: filepath.Join(t.TempDir(), "missing"),
+		DirAllowed:       true,
+		FileAllowed:      true,
+	}
+
+	dispatcher := newFakeDispatcher()
+	adapter := newFilePickerAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), dispatcher)
+	drain(model, model.Init())
+
+	if len(dispatcher.events) != 1 {
+		t.Fatalf("expected one error event, got %+v", dispatcher.events)
+	}
+	ev := dispatcher.events[0]
+	if ev.Name != defaultErrorEvent {
+		t.Fatalf("expected %s, got %s", defaultErrorEvent, ev.Name)
+	}
+	data, ok := ev.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("expected map payload, got %T", ev.Data)
+	}
+	if msg, _ := data["error"].(string); msg == "" || data["reason"] != "error" {
+		t.Fatalf("expected error message payload, got %+v", data)
+	}
+}
+
+func TestConfirmSubmitsDecision(t *testing.T) {
+	tests := []struct {
+		name string
+		def  bool
+		key  tea.KeyMsg
+		want bool
+	}{
+		{name: "y confirms", def: false, key: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}}, want: true},
+		{name: "n declines", def: true, key: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}}, want: false},
+		{name: "enter uses default yes", def: true, key: tea.KeyMsg{Type: tea.KeyEnter}, want: true},
+		{name: "enter uses default no", def: false, key: tea.KeyMsg{Type: tea.KeyEnter}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := confirmConfig{ID: "delete", Prompt: "Delete?", Default: tt.def, Affirmative: "Yes", Negative: "No", SubmitEvent: "ui.confirm"}
+			dispatcher := newFakeDispatcher()
+			model := newBaseModel(context.Background(), "p", newConfirmAdapter("p", cfg), cfg.events(), dispatcher)
+
+			// Unrelated keys are ignored.
+			model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+			if len(dispatcher.events) != 0 {
+				t.Fatalf("unexpected events %+v", dispatcher.events)
+			}
+
+			_, cmd := model.Update(tt.key)
+			if cmd == nil {
+				t.Fatal("expected quit command on decision")
+			}
+			if len(dispatcher.events) != 1 || dispatcher.events[0].Name != "ui.confirm" {
+				t.Fatalf("expected submit event, got %+v", dispatcher.events)
+			}
+			data := dispatcher.events[0].Data.(map[string]any)
+			if data["confirmed"] != tt.want {
+				t.Fatalf("confirmed = %v, want %v", data["confirmed"], tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmView(t *testing.T) {
+	adapter := newConfirmAdapter("p", confirmConfig{Prompt: "Proceed?", Default: false, Affirmative: "Yes", Negative: "No"})
+	if got := adapter.View(); got != "Proceed? [y/N]\n" {
+		t.Fatalf("view = %q", got)
+	}
+}
+
+func TestWindowSizePropagatesToTable(t *testing.T) {
+	cfg := tableConfig{
+		ID:          "grid",
+		Height:      5,
+		ResizeEvent: "ui.resize",
+		Columns:     []table.Column{{Title: "Name", Width: 10}},
+		Rows:        []table.Row{{"a"}, {"b"}},
+	}
+
+	dispatcher := newFakeDispatcher()
+	adapter := newTableAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), dispatcher)
+	height := adapter.model.Height()
+	model.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+
+	if got := adapter.model.Width(); got != 80 {
+		t.Fatalf("expected table width 80, got %d", got)
+	}
+	if got := adapter.model.Height(); got != height {
+		t.Fatalf("expected configured height %d to be kept, got %d", height, got)
+	}
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Name != "ui.resize" {
+		t.Fatalf("expected one resize event, got %+v", dispatcher.events)
+	}
+	data := dispatcher.events[0].Data.(map[string]any)
+	if data["width"] != 80 || data["height"] != 24 || data["reason"] != "resize" {
+		t.Fatalf("unexpected resize payload %+v", data)
+	}
+}
+
+func TestTextInputValidateRejectsEdits(t *testing.T) {
+	cfg := textInputConfig{
+		ID:                "age",
+		Validate:          "^[0-9]+$",
+		ValidationMessage: "Digits only",
+		Focused:           true,
+		RejectEvent:       "ui.rejected",
+		ChangeEvent:       "ui.changed",
+	}
+	cfg.pattern = regexp.MustCompile(cfg.Validate)
+
+	dispatcher := newFakeDispatcher()
+	adapter := newTextInputAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), dispatcher)
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'4'}})
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'2'}})
+
+	if got := adapter.model.Value(); got != "42" {
+		t.Fatalf("expected value 42, got %q", got)
+	}
+	var names []string
+	for _, ev := range dispatcher.events {
+		names = append(names, ev.Name)
+	}
+	if want := []string{"ui.changed", "ui.rejected", "ui.changed"}; !slices.Equal(names, want) {
+		t.Fatalf("expected events %v, got %v", want, names)
+	}
+	data := dispatcher.events[1].Data.(map[string]any)
+	if data["rejected"] != "4x" || data["value"] != "4" || data["message"] != "Digits only" {
+		t.Fatalf("unexpected reject payload %+v", data)
+	}
+}
+
+func TestSetEventUpdatesComponents(t *testing.T) {
+	set := func(name string, value any) *agentml.Event {
+		return &agentml.Event{Name: name, Data: map[string]any{"value": value}}
+	}
+
+	t.Run("textinput", func(t *testing.T) {
+		cfg := textInputConfig{ID: "name", SetEvent: "ui.name.set"}
+		adapter := newTextInputAdapter("p", cfg)
+		model := newBaseModel(context.Background(), "p", adapter, cfg.events(), newFakeDispatcher())
+		model.Update(set("ui.other", "ignored"))
+		model.Update(set("ui.name.set", "Ada"))
+		if got := adapter.model.Value(); got != "Ada" {
+			t.Fatalf("expected value Ada, got %q", got)
+		}
+	})
+
+	t.Run("viewport", func(t *testing.T) {
+		cfg := viewportConfig{ID: "log", Width: 20, Height: 2, SetEvent: "ui.log.set"}
+		adapter := newViewportAdapter("p", cfg)
+		model := newBaseModel(context.Background(), "p", adapter, cfg.events(), newFakeDispatcher())
+		model.Update(set("ui.log.set", "first\nsecond\nthird"))
+		if got := adapter.model.TotalLineCount(); got != 3 {
+			t.Fatalf("expected 3 lines of content, got %d", got)
+		}
+		if view := model.View(); !strings.Contains(view, "first") {
+			t.Fatalf("expected content in view, got %q", view)
+		}
+	})
+}
+
+func TestMarkdownRendersContent(t *testing.T) {
+	cfg := markdownConfig{
+		ID:      "doc",
+		Width:   40,
+		Height:  20,
+		Theme:   "dark",
+		Content: "# Title\n\nSome **bold** text with `code`.\n\n- first\n- second",
+	}
+	adapter := newMarkdownAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), newFakeDispatcher())
+
+	view := ansi.Strip(model.View())
+	for _, want := range []string{"Title", "Some bold text with", "code", "• first", "• second"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected %q in view, got:\n%s", want, view)
+		}
+	}
+	for _, raw := range []string{"# ", "**", "`"} {
+		if strings.Contains(view, raw) {
+			t.Errorf("expected markup %q to be rendered, got:\n%s", raw, view)
+		}
+	}
+}
+
+func TestMarkdownSetEventAndScroll(t *testing.T) {
+	cfg := markdownConfig{
+		ID:          "doc",
+		Width:       40,
+		Height:      2,
+		Theme:       "notty",
+		Content:     "old",
+		SetEvent:    "ui.doc.set",
+		CursorEvent: "ui.doc.scroll",
+	}
+	dispatcher := newFakeDispatcher()
+	adapter := newMarkdownAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), dispatcher)
+
+	model.Update(&agentml.Event{Name: "ui.doc.set", Data: map[string]any{"value": "# New\n\n1. one\n2. two\n3. three"}})
+	view := model.View()
+	if strings.Contains(view, "old") || !strings.Contains(view, "New") {
+		t.Fatalf("expected updated content in view, got:\n%s", view)
+	}
+	if len(dispatcher.events) != 0 {
+		t.Fatalf("expected set-event to emit nothing, got %d events", len(dispatcher.events))
+	}
+
+	model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Name != "ui.doc.scroll" {
+		t.Fatalf("expected one scroll event, got %+v", dispatcher.events)
+	}
+	data := dispatcher.events[0].Data.(map[string]any)
+	if data["component"] != "markdown" || data["scrollPercent"].(float64) <= 0 {
+		t.Fatalf("unexpected scroll payload %+v", data)
+	}
+}
+
+// hookDispatcher records events and calls onSend after each one.
+type hookDispatcher struct {
+	fakeDispatcher
+	onSend func(*agentml.Event)
+}
+
+func (h *hookDispatcher) Send(ctx context.Context, ev *agentml.Event) error {
+	h.events = append(h.events, ev)
+	if h.onSend != nil {
+		h.onSend(ev)
+	}
+	return nil
+}
+
+func TestProgramLifecycleEvents(t *testing.T) {
+	cfg := confirmConfig{ID: "gate", Prompt: "Continue?", Affirmative: "Yes", Negative: "No"}
+	dispatcher := &hookDispatcher{}
+	model := &programModel{baseModel: newBaseModel(context.Background(), "p", newConfirmAdapter("p", cfg), cfg.events(), dispatcher)}
+	program := tea.NewProgram(model, tea.WithInput(nil), tea.WithOutput(io.Discard), tea.WithoutRenderer())
+	dispatcher.onSend = func(ev *agentml.Event) {
+		if ev.Name == programReadyEvent {
+			go program.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runProgram(context.Background(), program, model)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		program.Kill()
+		t.Fatal("program did not quit")
+	}
+
+	var names []string
+	for _, ev := range dispatcher.events {
+		names = append(names, ev.Name)
+	}
+	if want := []string{programReadyEvent, defaultQuitEvent, programQuitEvent}; !slices.Equal(names, want) {
+		t.Fatalf("expected events %v, got %v", want, names)
+	}
+	for _, ev := range []*agentml.Event{dispatcher.events[0], dispatcher.events[2]} {
+		if data := ev.Data.(map[string]any); data["programId"] != "p" || data["componentId"] != "gate" {
+			t.Fatalf("unexpected %s payload %+v", ev.Name, data)
+		}
+	}
+}
+
+func TestKeyEventsEmitBoundEvents(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<bubbletea:program xmlns:bubbletea="github.com/agentflare-ai/agentml-go/bubbletea" id="p">
+  <bubbletea:confirm id="gate" key-events="r:ui.refresh, ctrl+s:ui.save">Continue?</bubbletea:confirm>
+</bubbletea:program>`)).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	cfg, err := parseProgramConfig(context.Background(), doc.DocumentElement(), nil)
+	if err != nil {
+		t.Fatalf("parseProgramConfig: %v", err)
+	}
+
+	events := cfg.component.events()
+	events.KeyEvents = cfg.keyEvents
+	dispatcher := newFakeDispatcher()
+	model := newBaseModel(context.Background(), "p", cfg.component.newAdapter("p"), events, dispatcher)
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Name != "ui.refresh" {
+		t.Fatalf("expected one ui.refresh event, got %+v", dispatcher.events)
+	}
+	data := dispatcher.events[0].Data.(map[string]any)
+	if data["key"] != "r" || data["reason"] != "key" || data["componentId"] != "gate" {
+		t.Fatalf("unexpected key payload %+v", data)
+	}
+}
+
+func TestKeyEventsRejectsMalformedPairs(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<bubbletea:program xmlns:bubbletea="github.com/agentflare-ai/agentml-go/bubbletea">
+  <bubbletea:confirm key-events="r">Continue?</bubbletea:confirm>
+</bubbletea:program>`)).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	_, err = parseProgramConfig(context.Background(), doc.DocumentElement(), nil)
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || perr.Data["attribute"] != "key-events" {
+		t.Fatalf("expected key-events PlatformError, got %v", err)
+	}
+}
+
+func TestTabsSwitchAndRouteInput(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<bubbletea:program xmlns:bubbletea="github.com/agentflare-ai/agentml-go/bubbletea" id="p">
+  <bubbletea:tabs id="panes" change-event="ui.tab">
+    <bubbletea:tab title="Search"><bubbletea:textinput id="query" focused="true"/></bubbletea:tab>
+    <bubbletea:tab title="Notes"><bubbletea:textinput id="note" focused="true"/></bubbletea:tab>
+    <bubbletea:tab title="Help">Press left and right to switch tabs.</bubbletea:tab>
+  </bubbletea:tabs>
+</bubbletea:program>`)).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	cfg, err := parseProgramConfig(context.Background(), doc.DocumentElement(), nil)
+	if err != nil {
+		t.Fatalf("parseProgramConfig: %v", err)
+	}
+	dispatcher := newFakeDispatcher()
+	adapter := cfg.component.newAdapter("p").(*tabsAdapter)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.component.events(), dispatcher)
+	value := func(tab int) string {
+		return adapter.children[tab][0].(*textInputAdapter).model.Value()
+	}
+	typeText := func(s string) {
+		for _, r := range s {
+			model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	typeText("go")
+	model.Update(tea.KeyMsg{Type: tea.KeyRight})
+	typeText("todo")
+	if value(0) != "go" || value(1) != "todo" {
+		t.Fatalf("expected input routed to the active tab only, got %q and %q", value(0), value(1))
+	}
+
+	// Two edits, the switch, then four edits in the new tab.
+	if len(dispatcher.events) != 7 {
+		t.Fatalf("expected seven ui.tab events, got %+v", dispatcher.events)
+	}
+	data := dispatcher.events[2].Data.(map[string]any)
+	if dispatcher.events[2].Name != "ui.tab" || data["index"] != 1 || data["title"] != "Notes" {
+		t.Fatalf("unexpected change payload %+v", data)
+	}
+	data = dispatcher.events[6].Data.(map[string]any)
+	if child := data["children"].([]any)[0].(map[string]any); data["index"] != 1 || child["value"] != "todo" {
+		t.Fatalf("expected the edit reported with the active tab's values, got %+v", data)
+	}
+
+	model.Update(tea.KeyMsg{Type: tea.KeyRight})
+	model.Update(tea.KeyMsg{Type: tea.KeyRight}) // already on the last tab
+	if len(dispatcher.events) != 8 {
+		t.Fatalf("expected no event when switching past the last tab, got %+v", dispatcher.events)
+	}
+	view := model.View()
+	for _, want := range []string{"Search", "Notes", "Help", "Press left and right"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected %q in view, got:\n%s", want, view)
+		}
+	}
+	if strings.Contains(view, "todo") {
+		t.Errorf("expected inactive tab content hidden, got:\n%s", view)
+	}
+}
+
+func TestTabsReportChildRejects(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<bubbletea:program xmlns:bubbletea="github.com/agentflare-ai/agentml-go/bubbletea" id="p">
+  <bubbletea:tabs id="panes" reject-event="ui.rejected">
+    <bubbletea:tab title="Age"><bubbletea:textinput id="age" focused="true" validate="^[0-9]+$"/></bubbletea:tab>
+  </bubbletea:tabs>
+</bubbletea:program>`)).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	cfg, err := parseProgramConfig(context.Background(), doc.DocumentElement(), nil)
+	if err != nil {
+		t.Fatalf("parseProgramConfig: %v", err)
+	}
+	dispatcher := newFakeDispatcher()
+	model := newBaseModel(context.Background(), "p", cfg.component.newAdapter("p"), cfg.component.events(), dispatcher)
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Name != "ui.rejected" {
+		t.Fatalf("expected one ui.rejected event, got %+v", dispatcher.events)
+	}
+	data := dispatcher.events[0].Data.(map[string]any)
+	if data["componentId"] != "age" || data["rejected"] != "x" {
+		t.Fatalf("expected the textinput's reject payload, got %+v", data)
+	}
+}
+
+func TestFileViewerOpensSubmittedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := fileViewerConfig{ID: "viewer", Width: 40, Height: 5, Highlight: true, SetEvent: "ui.file.open"}
+	dispatcher := newFakeDispatcher()
+	adapter := newFileViewerAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), dispatcher)
+
+	// The value is a filepicker submit payload forwarded with bubbletea:send.
+	model.Update(&agentml.Event{Name: "ui.file.open", Data: map[string]any{
+		"value": map[string]any{"component": "filepicker", "path": path, "reason": "submit"},
+	}})
+	if len(dispatcher.events) != 0 {
+		t.Fatalf("expected opening a file to emit nothing, got %+v", dispatcher.events)
+	}
+	view := model.View()
+	if ansi.Strip(view) == view {
+		t.Errorf("expected main.go to be highlighted, got:\n%s", view)
+	}
+	for _, want := range []string{"package main", "func main() {}"} {
+		if !strings.Contains(ansi.Strip(view), want) {
+			t.Errorf("expected %q in view, got:\n%s", want, view)
+		}
+	}
+	if data := adapter.Payload("submit"); data["path"] != path || data["size"] != int64(29) {
+		t.Fatalf("unexpected payload %+v", data)
+	}
+}
+
+func TestFileViewerRejectsLargeFile(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	large := filepath.Join(dir, "large.txt")
+	if err := os.WriteFile(small, []byte("small"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(large, []byte(strings.Repeat("x", 64)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := fileViewerConfig{ID: "viewer", Width: 40, Height: 5, MaxSize: 16, SetEvent: "ui.file.open"}
+	dispatcher := newFakeDispatcher()
+	adapter := newFileViewerAdapter("p", cfg)
+	model := newBaseModel(context.Background(), "p", adapter, cfg.events(), dispatcher)
+
+	model.Update(&agentml.Event{Name: "ui.file.open", Data: map[string]any{"value": small}})
+	model.Update(&agentml.Event{Name: "ui.file.open", Data: map[string]any{"value": large}})
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Name != defaultErrorEvent {
+		t.Fatalf("expected one error event, got %+v", dispatcher.events)
+	}
+	data := dispatcher.events[0].Data.(map[string]any)
+	if data["path"] != large || !strings.Contains(data["error"].(string), "16 byte limit") {
+		t.Fatalf("unexpected error payload %+v", data)
+	}
+	if view := model.View(); !strings.Contains(view, "small") || strings.Contains(view, "xxx") {
+		t.Fatalf("expected the previous file to stay shown, got:\n%s", view)
+	}
+}
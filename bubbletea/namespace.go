@@ -34,6 +34,8 @@ func (n *Namespace) Handle(ctx context.Context, el xmldom.Element) (bool, error)
 			return true, err
 		}
 		return true, exec.Execute(ctx, n.itp)
+	case "send":
+		return true, sendToProgram(ctx, el, n.manager, n.itp)
 	default:
 		return false, nil
 	}
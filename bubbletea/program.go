@@ -15,6 +15,10 @@ import (
 const (
 	defaultSubmitEvent = "bubbletea.submit"
 	defaultQuitEvent   = "bubbletea.quit"
+	defaultErrorEvent  = "bubbletea.error"
+
+	programReadyEvent = "bubbletea.program-ready"
+	programQuitEvent  = "bubbletea.program-quit"
 )
 
 type programExecutable struct {
@@ -27,6 +31,7 @@ type programExecutable struct {
 type ProgramConfig struct {
 	ProgramID string
 	component componentConfig
+	keyEvents map[string]string
 }
 
 type listConfig struct {
@@ -37,6 +42,7 @@ type listConfig struct {
 	ChangeEvent string `attr:"change-event"`
 	SubmitEvent string `attr:"submit-event"`
 	QuitEvent   string `attr:"quit-event"`
+	ResizeEvent string `attr:"resize-event"`
 	Items       []listItemConfig
 }
 
@@ -89,18 +95,41 @@ func parseProgramConfig(ctx context.Context, el xmldom.Element, itp agentml.Inte
 			Message:   "bubbletea:program requires a bubbletea component child (e.g., bubbletea:list)",
 			Data: map[string]any{
 				"element":   "bubbletea:program",
-				"supported": registeredComponentNames(),
+				"supported": RegisteredComponents(),
 			},
 		}
 	}
 
+	componentCfg, displayName, err := parseComponent(ctx, componentEl, "bubbletea:program", itp)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.component = componentCfg
+
+	keyEvents, err := parseKeyEvents(componentEl, displayName)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.keyEvents = keyEvents
+
+	if cfg.ProgramID == "" {
+		// ID derived from muid.String().
+		cfg.ProgramID = muid.MakeString()
+	}
+
+	return cfg, nil
+}
+
+// parseComponent parses componentEl with its registered component parser.
+// parent names the enclosing element in errors.
+func parseComponent(ctx context.Context, componentEl xmldom.Element, parent string, itp agentml.Interpreter) (componentConfig, string, error) {
 	componentType, displayName, err := resolveComponentType(componentEl)
 	if err != nil {
-		return cfg, &agentml.PlatformError{
+		return nil, "", &agentml.PlatformError{
 			EventName: "error.execution",
 			Message:   err.Error(),
 			Data: map[string]any{
-				"element": "bubbletea:program",
+				"element": parent,
 			},
 			Cause: err,
 		}
@@ -108,28 +137,21 @@ func parseProgramConfig(ctx context.Context, el xmldom.Element, itp agentml.Inte
 
 	parser, ok := lookupComponent(componentType)
 	if !ok {
-		return cfg, &agentml.PlatformError{
+		return nil, "", &agentml.PlatformError{
 			EventName: "error.execution",
 			Message:   fmt.Sprintf("bubbletea component %q is not supported", componentType),
 			Data: map[string]any{
 				"element":   displayName,
-				"supported": registeredComponentNames(),
+				"supported": RegisteredComponents(),
 			},
 		}
 	}
 
 	componentCfg, err := parser(ctx, componentEl, displayName, itp)
 	if err != nil {
-		return cfg, err
-	}
-	cfg.component = componentCfg
-
-	if cfg.ProgramID == "" {
-		// ID derived from muid.String().
-		cfg.ProgramID = muid.MakeString()
+		return nil, "", err
 	}
-
-	return cfg, nil
+	return componentCfg, displayName, nil
 }
 
 func parseListConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (listConfig, error) {
@@ -225,6 +247,7 @@ func (cfg listConfig) events() componentEvents {
 		ChangeEvent: cfg.ChangeEvent,
 		SubmitEvent: cfg.SubmitEvent,
 		QuitEvent:   cfg.QuitEvent,
+		ResizeEvent: cfg.ResizeEvent,
 	}
 }
 
@@ -0,0 +1,54 @@
+package bubbletea
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// RenderOnce renders the <bubbletea:program> in programXML without a
+// terminal, for snapshot tests of layouts. The component tree is built, Init
+// runs and a single tea.WindowSizeMsg of width by height is delivered before
+// the composed view is returned. Commands returned along the way are not run,
+// so spinners show their first frame, while animated components such as
+// progress bars are drawn at their target; events the components emit are
+// discarded. Expression attributes are not available, as
+// there is no data model to evaluate them against.
+func RenderOnce(ctx context.Context, programXML string, width, height int) (string, error) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(programXML)).Decode()
+	if err != nil {
+		return "", fmt.Errorf("bubbletea: parse program: %w", err)
+	}
+	el := doc.DocumentElement()
+	if el == nil || string(el.NamespaceURI()) != NamespaceURI || !equalsLocalName(el, "program") {
+		return "", fmt.Errorf("bubbletea: RenderOnce requires a bubbletea:program root element")
+	}
+	cfg, err := parseProgramConfig(ctx, el, nil)
+	if err != nil {
+		return "", err
+	}
+
+	events := cfg.component.events()
+	events.KeyEvents = cfg.keyEvents
+	model := newBaseModel(ctx, cfg.ProgramID, cfg.component.newAdapter(cfg.ProgramID), events, discardDispatcher{})
+	model.Init()
+	model.Update(tea.WindowSizeMsg{Width: width, Height: height})
+	return settledView(model.adapter), nil
+}
+
+// settledView renders a, settling any animation it is running.
+func settledView(a componentAdapter) string {
+	if s, ok := a.(settledViewer); ok {
+		return s.SettledView()
+	}
+	return a.View()
+}
+
+// discardDispatcher drops the events of a program rendered by RenderOnce.
+type discardDispatcher struct{}
+
+func (discardDispatcher) Send(context.Context, *agentml.Event) error { return nil }
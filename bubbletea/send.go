@@ -0,0 +1,92 @@
+package bubbletea
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-muid"
+	"github.com/agentflare-ai/go-xmldom"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const sendDisplayName = "bubbletea:send"
+
+type sendConfig struct {
+	Program string `attr:"program"`
+	Event   string `attr:"event"`
+}
+
+// sendToProgram handles <bubbletea:send>, delivering {value} to a running
+// program under the given event name so that a component whose set-event
+// matches can apply it.
+func sendToProgram(ctx context.Context, el xmldom.Element, mgr *Manager, itp agentml.Interpreter) error {
+	cfg := sendConfig{}
+	if err := bindComponentConfig(ctx, el, sendDisplayName, itp, &cfg); err != nil {
+		return err
+	}
+	if cfg.Program == "" || cfg.Event == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("%s requires program and event attributes", sendDisplayName),
+			Data: map[string]any{
+				"element": sendDisplayName,
+			},
+		}
+	}
+
+	value, err := resolveSendValue(ctx, el, itp)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := tracer.Start(ctx, "bubbletea.send",
+		trace.WithAttributes(
+			attribute.String("bubbletea.program.id", cfg.Program),
+			attribute.String("bubbletea.event.name", cfg.Event),
+		))
+	defer span.End()
+
+	event := &agentml.Event{
+		ID:        muid.MakeString(),
+		Name:      cfg.Event,
+		Type:      agentml.EventTypeExternal,
+		Timestamp: time.Now().UTC(),
+		Data:      map[string]any{"value": value},
+	}
+	if err := mgr.Send(cfg.Program, event); err != nil {
+		span.RecordError(err)
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   err.Error(),
+			Data: map[string]any{
+				"element": sendDisplayName,
+				"program": cfg.Program,
+			},
+			Cause: err,
+		}
+	}
+	return nil
+}
+
+// resolveSendValue evaluates valueexpr without stringifying it, so lists and
+// numbers reach the component intact; otherwise value or the element text.
+func resolveSendValue(ctx context.Context, el xmldom.Element, itp agentml.Interpreter) (any, error) {
+	if exprAttr, expr := lookupExprAttribute(el, "value"); exprAttr != "" {
+		if itp == nil || itp.DataModel() == nil {
+			return nil, newAttrEvalError(sendDisplayName, exprAttr, expr, errNoDataModel)
+		}
+		val, err := itp.DataModel().EvaluateValue(ctx, expr)
+		if err != nil {
+			return nil, newAttrEvalError(sendDisplayName, exprAttr, expr, err)
+		}
+		return val, nil
+	}
+	if el.HasAttribute("value") {
+		return string(el.GetAttribute("value")), nil
+	}
+	return strings.TrimSpace(string(el.TextContent())), nil
+}
@@ -0,0 +1,288 @@
+package bubbletea
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type tabsConfig struct {
+	ID          string `attr:"id"`
+	Active      int    `attr:"active"`
+	ChangeEvent string `attr:"change-event"`
+	CursorEvent string `attr:"cursor-event"`
+	SubmitEvent string `attr:"submit-event"`
+	QuitEvent   string `attr:"quit-event"`
+	ErrorEvent  string `attr:"error-event"`
+	RejectEvent string `attr:"reject-event"`
+	ResizeEvent string `attr:"resize-event"`
+	Tabs        []tabConfig
+}
+
+// tabConfig is one <bubbletea:tab>: either child components or, when it has
+// none, its text content.
+type tabConfig struct {
+	Title      string
+	Content    string
+	Components []componentConfig
+}
+
+func parseTabsConfig(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (tabsConfig, error) {
+	cfg := tabsConfig{}
+	if err := bindComponentConfig(ctx, el, displayName, itp, &cfg); err != nil {
+		return cfg, err
+	}
+
+	childNodes := el.ChildNodes()
+	for i := uint(0); i < childNodes.Length(); i++ {
+		tabEl, ok := childNodes.Item(i).(xmldom.Element)
+		if !ok || !equalsLocalName(tabEl, "tab") {
+			continue
+		}
+		tab := tabConfig{Title: strings.TrimSpace(string(tabEl.GetAttribute("title")))}
+		if tab.Title == "" {
+			return cfg, &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("%s: bubbletea:tab %d requires a title", displayName, len(cfg.Tabs)+1),
+				Data: map[string]any{
+					"element":   "bubbletea:tab",
+					"attribute": "title",
+				},
+			}
+		}
+		tabChildren := tabEl.ChildNodes()
+		for j := uint(0); j < tabChildren.Length(); j++ {
+			componentEl, ok := tabChildren.Item(j).(xmldom.Element)
+			if !ok {
+				continue
+			}
+			component, _, err := parseComponent(ctx, componentEl, "bubbletea:tab", itp)
+			if err != nil {
+				return cfg, err
+			}
+			tab.Components = append(tab.Components, component)
+		}
+		if len(tab.Components) == 0 {
+			tab.Content = strings.TrimSpace(string(tabEl.TextContent()))
+		}
+		cfg.Tabs = append(cfg.Tabs, tab)
+	}
+
+	if len(cfg.Tabs) == 0 {
+		return cfg, &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("%s requires at least one bubbletea:tab child", displayName),
+			Data: map[string]any{
+				"element": displayName,
+			},
+		}
+	}
+	cfg.Active = min(max(cfg.Active, 0), len(cfg.Tabs)-1)
+	return cfg, nil
+}
+
+func (cfg tabsConfig) componentType() string { return "tabs" }
+func (cfg tabsConfig) componentID() string   { return cfg.ID }
+func (cfg tabsConfig) newAdapter(programID string) componentAdapter {
+	return newTabsAdapter(programID, cfg)
+}
+func (cfg tabsConfig) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("bubbletea.tabs.count", len(cfg.Tabs)),
+	}
+}
+func (cfg tabsConfig) events() componentEvents {
+	return normalizeEvents(componentEvents{
+		ChangeEvent: cfg.ChangeEvent,
+		CursorEvent: cfg.CursorEvent,
+		SubmitEvent: cfg.SubmitEvent,
+		QuitEvent:   cfg.QuitEvent,
+		ErrorEvent:  cfg.ErrorEvent,
+		RejectEvent: cfg.RejectEvent,
+		ResizeEvent: cfg.ResizeEvent,
+	})
+}
+
+var (
+	tabActiveStyle   = lipgloss.NewStyle().Bold(true).Underline(true).Padding(0, 1)
+	tabInactiveStyle = lipgloss.NewStyle().Faint(true).Padding(0, 1)
+)
+
+// tabsAdapter shows one tab at a time below a tab bar. Left and right switch
+// tabs. Key and mouse input reaches only the active tab's components; other
+// messages (window sizes, ticks, set-events) reach every tab so inactive
+// components stay current. The active tab's components report their flags
+// through the tabs, so a submit from one of them submits the program and
+// their cursor, error and reject events are emitted with their own payloads.
+type tabsAdapter struct {
+	programID string
+	config    tabsConfig
+	active    int
+	children  [][]componentAdapter
+	// reporter is the component whose cursor, error or reject flag was
+	// reported last.
+	reporter componentAdapter
+}
+
+func newTabsAdapter(programID string, cfg tabsConfig) *tabsAdapter {
+	m := &tabsAdapter{
+		programID: programID,
+		config:    cfg,
+		active:    cfg.Active,
+		children:  make([][]componentAdapter, len(cfg.Tabs)),
+	}
+	for i, tab := range cfg.Tabs {
+		for _, component := range tab.Components {
+			m.children[i] = append(m.children[i], component.newAdapter(programID))
+		}
+	}
+	return m
+}
+
+func (m *tabsAdapter) Type() string { return "tabs" }
+func (m *tabsAdapter) ID() string   { return m.config.ID }
+func (m *tabsAdapter) Init() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, tab := range m.children {
+		for _, child := range tab {
+			cmds = append(cmds, child.Init())
+		}
+	}
+	return tea.Batch(cmds...)
+}
+func (m *tabsAdapter) Update(msg tea.Msg) (tea.Cmd, updateFlags) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "left":
+			return nil, m.switchTo(m.active - 1)
+		case "right":
+			return nil, m.switchTo(m.active + 1)
+		}
+		return m.updateTab(m.active, msg)
+	case tea.MouseMsg:
+		return m.updateTab(m.active, msg)
+	}
+	var cmds []tea.Cmd
+	var flags updateFlags
+	for i := range m.children {
+		cmd, f := m.updateTab(i, msg)
+		cmds = append(cmds, cmd)
+		if i == m.active {
+			flags = f
+		}
+	}
+	return tea.Batch(cmds...), flags
+}
+
+// switchTo activates tab i, reporting flagChanged when the active tab moves.
+func (m *tabsAdapter) switchTo(i int) updateFlags {
+	i = min(max(i, 0), len(m.children)-1)
+	if i == m.active {
+		return 0
+	}
+	m.active = i
+	return flagChanged
+}
+
+// updateTab passes msg to the components of tab i and reports their combined
+// flags. Only the active tab's flags reach the program.
+func (m *tabsAdapter) updateTab(i int, msg tea.Msg) (tea.Cmd, updateFlags) {
+	var cmds []tea.Cmd
+	var flags updateFlags
+	for _, child := range m.children[i] {
+		cmd, f := child.Update(msg)
+		cmds = append(cmds, cmd)
+		if i == m.active && f&(flagCursor|flagError|flagRejected) != 0 {
+			m.reporter = child
+		}
+		flags |= f
+	}
+	return tea.Batch(cmds...), flags
+}
+
+func (m *tabsAdapter) View() string {
+	return m.view(componentAdapter.View)
+}
+
+// SettledView is View with the components of the active tab settled.
+func (m *tabsAdapter) SettledView() string {
+	return m.view(settledView)
+}
+
+// view renders the tab bar and the active tab, with render drawing each of
+// its components.
+func (m *tabsAdapter) view(render func(componentAdapter) string) string {
+	titles := make([]string, len(m.config.Tabs))
+	for i, tab := range m.config.Tabs {
+		if i == m.active {
+			titles[i] = tabActiveStyle.Render(tab.Title)
+		} else {
+			titles[i] = tabInactiveStyle.Render(tab.Title)
+		}
+	}
+	body := m.config.Tabs[m.active].Content
+	if children := m.children[m.active]; len(children) > 0 {
+		views := make([]string, len(children))
+		for i, child := range children {
+			views[i] = render(child)
+		}
+		body = lipgloss.JoinVertical(lipgloss.Left, views...)
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, titles...) + "\n\n" + body
+}
+func (m *tabsAdapter) Payload(reason string) map[string]any {
+	children := make([]any, 0, len(m.children[m.active]))
+	for _, child := range m.children[m.active] {
+		children = append(children, child.Payload(reason))
+	}
+	return map[string]any{
+		"component":   "tabs",
+		"programId":   m.programID,
+		"componentId": m.config.ID,
+		"index":       m.active,
+		"title":       m.config.Tabs[m.active].Title,
+		"children":    children,
+		"reason":      reason,
+	}
+}
+func (m *tabsAdapter) CursorPayload() (map[string]any, bool) {
+	if m.reporter == nil {
+		return nil, false
+	}
+	if payload, ok := m.reporter.CursorPayload(); ok {
+		return payload, true
+	}
+	return m.reporter.Payload("cursor"), true
+}
+
+// ErrorPayload describes the last failure of an active tab's component.
+func (m *tabsAdapter) ErrorPayload() (map[string]any, bool) {
+	if m.reporter == nil {
+		return nil, false
+	}
+	if reporter, ok := m.reporter.(errorPayloader); ok {
+		return reporter.ErrorPayload()
+	}
+	return m.reporter.Payload("error"), true
+}
+
+// RejectPayload describes the last edit an active tab's component reverted.
+func (m *tabsAdapter) RejectPayload() (map[string]any, bool) {
+	if reporter, ok := m.reporter.(rejectPayloader); ok {
+		return reporter.RejectPayload()
+	}
+	return nil, false
+}
+
+func init() {
+	registerComponent("tabs", func(ctx context.Context, el xmldom.Element, displayName string, itp agentml.Interpreter) (componentConfig, error) {
+		return parseTabsConfig(ctx, el, displayName, itp)
+	})
+}
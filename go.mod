@@ -3,36 +3,42 @@ module github.com/agentflare-ai/agentml-go
 go 1.24.5
 
 require (
-	github.com/agentflare-ai/agentmlx v0.1.1-beta.7
 	github.com/agentflare-ai/go-jsonpointer v0.0.0-20251007203221-d033231435df
 	github.com/agentflare-ai/go-jsonschema v0.0.0-20251023153407-8013a2f0a2bd
 	github.com/agentflare-ai/go-pipeline v0.1.1
 	github.com/agentflare-ai/go-xmldom v0.1.1
 	github.com/agentflare-ai/go-xsd v0.1.5
+	github.com/anthropics/anthropic-sdk-go v1.75.0
 	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/ollama/ollama v0.12.7
 	github.com/openai/openai-go v1.12.0
 	github.com/stretchr/testify v1.11.1
 	go.opentelemetry.io/otel v1.38.0
+	go.opentelemetry.io/otel/metric v1.38.0
 	go.opentelemetry.io/otel/trace v1.38.0
+	golang.org/x/sync v0.17.0
 )
 
 require (
 	github.com/agentflare-ai/go-jsonpatch v0.0.0-20251007202521-03a28775fba1 // indirect
+	github.com/bahlo/generic-list-go v0.2.0 // indirect
+	github.com/buger/jsonparser v1.1.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-logr/logr v1.4.3 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/golang/groupcache v0.0.0-20241129210726-2c02b8208cf8 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/invopop/jsonschema v0.14.0 // indirect
+	github.com/pb33f/ordered-map/v2 v2.3.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/tidwall/gjson v1.14.4 // indirect
+	github.com/standard-webhooks/standard-webhooks/libraries v0.0.1 // indirect
+	github.com/tidwall/gjson v1.18.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
 	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
-	go.opentelemetry.io/otel/metric v1.38.0 // indirect
-	golang.org/x/crypto v0.36.0 // indirect
-	golang.org/x/sync v0.17.0 // indirect
+	go.yaml.in/yaml/v4 v4.0.0-rc.2 // indirect
+	golang.org/x/crypto v0.40.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,22 @@
+// Package memoryspec lists the elements of the memory namespace. It is
+// shared by the memory package, which executes them, and the validator,
+// which checks where they are placed, so the two cannot drift apart.
+package memoryspec
+
+// NamespaceURI is the namespace of the memory elements.
+const NamespaceURI = "github.com/agentflare-ai/agentml-go/memory"
+
+// Executable lists the memory elements that run as executable content.
+// "graph" is the legacy single-element form of the graph operations.
+var Executable = []string{
+	"close", "put", "get", "getorset", "increment", "append", "pop", "delete", "copy", "move", "query",
+	"kvtruncate", "vacuum", "migrate", "exec", "begin", "commit", "rollback", "savepoint", "release",
+	"sql", "embed", "upsertvector", "search", "similarkeys", "deletevector", "deletevectors", "vectortruncate", "reembed", "vectorindex",
+	"addnode", "addedge", "getnode", "getnodes", "getedge", "deletenode", "deleteedge",
+	"neighbors", "getneighbors", "graphpath", "subgraph", "graphtruncate", "graphindex", "graphquery",
+	"transaction", "use", "watch", "graph",
+}
+
+// Containers lists the memory elements whose children run as executable
+// content.
+var Containers = []string{"transaction", "use"}
@@ -0,0 +1,167 @@
+// Package retry runs an operation until it succeeds, retrying failures with
+// exponential backoff. It is shared by the namespaces that retry provider
+// calls so they agree on backoff, cancellation and tracing.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Clock waits between attempts. agentml.Clock satisfies it, so an
+// interpreter's clock can drive retries in simulations and tests.
+type Clock interface {
+	// Sleep waits for d, returning early with an error when ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Policy configures Do. The zero value makes a single attempt.
+type Policy struct {
+	// Name identifies the operation in attempt spans.
+	Name string
+	// Attempts is the total number of attempts, including the first.
+	// Values below 1 mean 1.
+	Attempts int
+	// Backoff is the delay before the second attempt. Zero retries
+	// immediately.
+	Backoff time.Duration
+	// Multiplier scales the delay after each retry. Zero means 2.
+	Multiplier float64
+	// MaxBackoff caps the delay between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Jitter randomizes each delay by up to this fraction in either
+	// direction, so 0.2 gives delays between 80% and 120% of the nominal
+	// value. Zero disables jitter.
+	Jitter float64
+	// Retryable reports whether a failure is worth retrying. Nil retries
+	// every failure.
+	Retryable func(error) bool
+	// OnRetry, when set, is called after a failed attempt with the attempt
+	// number (starting at 1), its error and the delay before the next one.
+	OnRetry func(attempt int, err error, delay time.Duration)
+	// Clock waits between attempts. Nil uses real time.
+	Clock Clock
+
+	// random returns a value in [0, 1) for jitter; nil uses math/rand.
+	random func() float64
+}
+
+// CanceledError is returned by Do when ctx ends while waiting to retry. It
+// unwraps to both the last attempt's error and the context error.
+type CanceledError struct {
+	// Err is the error of the last attempt.
+	Err error
+	// Cause is the error that ended the wait, usually ctx.Err().
+	Cause error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("canceled while retrying: %v", e.Err)
+}
+
+func (e *CanceledError) Unwrap() []error { return []error{e.Err, e.Cause} }
+
+// Do calls fn until it succeeds, the attempts run out, the failure is not
+// retryable or ctx is done, and returns the last error. Each attempt runs in
+// its own span. When ctx ends during a backoff wait, Do returns a
+// *CanceledError.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	attempts := max(p.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := p.try(ctx, attempt, fn)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || (p.Retryable != nil && !p.Retryable(err)) {
+			return err
+		}
+		delay := p.Delay(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		if delay <= 0 {
+			continue
+		}
+		if serr := p.clock().Sleep(ctx, delay); serr != nil {
+			return &CanceledError{Err: err, Cause: serr}
+		}
+	}
+}
+
+// try runs one attempt of fn in a span.
+func (p Policy) try(ctx context.Context, attempt int, fn func(ctx context.Context) error) error {
+	name := p.Name
+	if name == "" {
+		name = "retry"
+	}
+	ctx, span := otel.Tracer("retry").Start(ctx, name+".attempt",
+		trace.WithAttributes(
+			attribute.String("retry.name", name),
+			attribute.Int("retry.attempt", attempt),
+		))
+	defer span.End()
+	err := fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Delay returns the wait after failed attempt number attempt (starting at
+// 1): Backoff grown by Multiplier per earlier retry, capped at MaxBackoff,
+// then jittered.
+func (p Policy) Delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(p.Backoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 {
+		delay = min(delay, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		random := p.random
+		if random == nil {
+			random = rand.Float64
+		}
+		delay *= 1 - p.Jitter + 2*p.Jitter*random()
+	}
+	return time.Duration(delay)
+}
+
+func (p Policy) clock() Clock {
+	if p.Clock != nil {
+		return p.Clock
+	}
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeClock records requested sleeps without waiting, failing with err when
+// set.
+type fakeClock struct {
+	sleeps []time.Duration
+	err    error
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	return c.err
+}
+
+var errTransient = errors.New("transient")
+
+func failing(n int, err error, calls *int) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestDoBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []time.Duration
+	}{
+		{
+			name:   "doubling by default",
+			policy: Policy{Attempts: 4, Backoff: 100 * time.Millisecond},
+			want:   []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+		},
+		{
+			name:   "multiplier and cap",
+			policy: Policy{Attempts: 4, Backoff: 100 * time.Millisecond, Multiplier: 3, MaxBackoff: 500 * time.Millisecond},
+			want:   []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:   "no backoff",
+			policy: Policy{Attempts: 4},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{}
+			tt.policy.Clock = clock
+			calls := 0
+			if err := Do(context.Background(), tt.policy, failing(3, errTransient, &calls)); err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			if calls != 4 {
+				t.Errorf("calls = %d, want 4", calls)
+			}
+			if !slices.Equal(clock.sleeps, tt.want) {
+				t.Errorf("sleeps = %v, want %v", clock.sleeps, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	p := Policy{Backoff: 100 * time.Millisecond, Jitter: 0.5}
+	for _, tt := range []struct {
+		random float64
+		want   time.Duration
+	}{
+		{0, 50 * time.Millisecond},
+		{0.5, 100 * time.Millisecond},
+		{0.75, 125 * time.Millisecond},
+	} {
+		p.random = func() float64 { return tt.random }
+		if got := p.Delay(1); got != tt.want {
+			t.Errorf("Delay with random %v = %v, want %v", tt.random, got, tt.want)
+		}
+	}
+}
+
+func TestDoRetryable(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	var retried []int
+	p := Policy{
+		Attempts:  5,
+		Clock:     &fakeClock{},
+		Retryable: func(err error) bool { return errors.Is(err, errTransient) },
+		OnRetry:   func(attempt int, err error, delay time.Duration) { retried = append(retried, attempt) },
+	}
+
+	calls := 0
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errTransient
+		}
+		return errPermanent
+	})
+	if !errors.Is(err, errPermanent) || calls != 2 {
+		t.Fatalf("err = %v after %d calls, want permanent after 2", err, calls)
+	}
+	if !slices.Equal(retried, []int{1}) {
+		t.Errorf("OnRetry attempts = %v, want [1]", retried)
+	}
+
+	// Retryable failures stop once the attempts run out.
+	calls = 0
+	if err := Do(context.Background(), p, failing(10, errTransient, &calls)); !errors.Is(err, errTransient) || calls != 5 {
+		t.Fatalf("err = %v after %d calls, want transient after 5", err, calls)
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	clock := &fakeClock{err: context.Canceled}
+	calls := 0
+	err := Do(context.Background(), Policy{Attempts: 3, Backoff: time.Second, Clock: clock}, failing(3, errTransient, &calls))
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || !errors.Is(err, errTransient) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want a CanceledError wrapping both errors", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	// A context that is already done stops without waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	clock = &fakeClock{}
+	err = Do(ctx, Policy{Attempts: 3, Backoff: time.Second, Clock: clock}, failing(3, errTransient, &calls))
+	if !errors.Is(err, errTransient) || calls != 1 || len(clock.sleeps) != 0 {
+		t.Fatalf("err = %v after %d calls and %d sleeps, want one call and no sleep", err, calls, len(clock.sleeps))
+	}
+}
@@ -0,0 +1,133 @@
+// Package llm defines the provider-neutral request and response types shared
+// by the generate elements of the LLM namespaces, along with the helpers that
+// turn a runtime snapshot into send_* tools and tool calls back into events.
+//
+// A backend only needs to implement Provider; prompt assembly, snapshot
+// pruning and event dispatch stay the same across providers.
+package llm
+
+import "context"
+
+// Role identifies the author of a message.
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	RoleTool      Role = "tool"
+)
+
+// ToolChoice controls whether the model may or must call a tool.
+type ToolChoice string
+
+const (
+	ToolChoiceAuto     ToolChoice = "auto"
+	ToolChoiceRequired ToolChoice = "required"
+	ToolChoiceNone     ToolChoice = "none"
+)
+
+// Message is one turn of a conversation. Assistant messages may carry the
+// tool calls the model made; tool messages carry the result of one call,
+// identified by ToolCallID.
+type Message struct {
+	Role       Role
+	Content    string
+	ToolCalls  []ToolCall
+	ToolCallID string
+}
+
+// Tool is a function the model may call. Name is the provider-safe function
+// name; EventName is the SCXML event it sends.
+type Tool struct {
+	Name        string
+	EventName   string
+	Description string
+	Parameters  map[string]any
+}
+
+// ToolCall is a function call made by the model. Arguments is the raw JSON
+// object the model produced.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Request is a single generation request.
+type Request struct {
+	Model    string
+	Messages []Message
+	Tools    []Tool
+	// ToolChoice is ignored when Tools is empty. The zero value leaves the
+	// choice to the provider.
+	ToolChoice ToolChoice
+	// MaxOutputTokens caps the response length; zero uses the provider default.
+	MaxOutputTokens int
+	// Reasoning is a reasoning effort hint ("low", "medium", "high") for
+	// models that support it. Other providers ignore it.
+	Reasoning string
+	// Temperature is the sampling temperature; nil uses the provider default.
+	Temperature *float64
+	// Seed requests reproducible sampling from providers that support it.
+	// Other providers ignore it.
+	Seed *int64
+	// PromptCacheKey groups requests that share a stable prompt prefix so
+	// providers with prompt caching route them to the same cache. Other
+	// providers ignore it.
+	PromptCacheKey string
+	// Stop lists sequences that end the generation when the model produces
+	// them. Providers without stop sequences ignore it.
+	Stop []string
+	// ReasoningSummary asks reasoning models for a summary of their
+	// reasoning, returned in Response.Reasoning. Other providers ignore it.
+	ReasoningSummary bool
+	// Params holds additional provider parameters, such as top_p or
+	// logit_bias, sent with the request as written. Providers that cannot
+	// pass parameters through ignore it.
+	Params map[string]any
+
+	// DisableStreaming asks for the complete response in a single call even
+	// when tools or callbacks are set. The callbacks are then invoked once
+	// the response has arrived, in output order. Providers that never
+	// stream ignore it.
+	DisableStreaming bool
+
+	// OnChunk, when set, receives text as it streams in.
+	OnChunk func(text string) error
+	// OnToolCall, when set, receives each tool call as soon as it is
+	// complete. Returning an error stops the generation and is returned from
+	// Generate.
+	OnToolCall func(call ToolCall) error
+	// OnToolCallStart, when set, receives each tool call as soon as the
+	// model starts emitting it, before its arguments arrive; Arguments may be
+	// empty. Providers that cannot report this ignore it.
+	OnToolCallStart func(call ToolCall)
+}
+
+// Usage reports token counts for a generation, when the provider returns them.
+type Usage struct {
+	InputTokens  int64
+	OutputTokens int64
+	// CachedInputTokens is the part of InputTokens served from the
+	// provider's prompt cache.
+	CachedInputTokens int64
+}
+
+// Response is the result of a generation.
+type Response struct {
+	Content    string
+	ToolCalls  []ToolCall
+	StopReason string
+	Usage      Usage
+	// Reasoning is the reasoning summary text, when the provider returns
+	// one.
+	Reasoning string
+}
+
+// Provider is an LLM backend. Errors from the backend's client are returned
+// unwrapped, or wrapped with %w, so callers can inspect provider error types.
+type Provider interface {
+	Generate(ctx context.Context, req Request) (Response, error)
+	Embed(ctx context.Context, model string, input []string) ([][]float32, error)
+}
@@ -0,0 +1,336 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/prompt"
+	"github.com/agentflare-ai/go-jsonschema"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// ExtractTransitions returns the transitions in a runtime snapshot that the
+// model may trigger: runtime:transition elements under runtime:send. Documents
+// without them fall back to plain transition and send elements.
+func ExtractTransitions(doc xmldom.Document) []xmldom.Element {
+	if doc == nil {
+		return nil
+	}
+
+	root := doc.DocumentElement()
+	if root == nil {
+		return nil
+	}
+
+	var transitions []xmldom.Element
+
+	// Runtime transitions are already scoped to the current configuration
+	runtimeTransitions := root.GetElementsByTagNameNS(agentml.RuntimeNamespaceURI, "transition")
+	for i := uint(0); i < runtimeTransitions.Length(); i++ {
+		elem, ok := runtimeTransitions.Item(i).(xmldom.Element)
+		if !ok {
+			continue
+		}
+		// Only transitions under runtime:send are external events
+		if parent, ok := elem.ParentNode().(xmldom.Element); ok &&
+			string(parent.LocalName()) == "send" &&
+			parent.NamespaceURI() == xmldom.DOMString(agentml.RuntimeNamespaceURI) {
+			transitions = append(transitions, elem)
+		}
+	}
+	if len(transitions) > 0 {
+		return transitions
+	}
+
+	// For testing and compatibility, fall back to regular transitions and
+	// send elements
+	regularTransitions := root.GetElementsByTagName("transition")
+	for i := uint(0); i < regularTransitions.Length(); i++ {
+		if elem, ok := regularTransitions.Item(i).(xmldom.Element); ok {
+			transitions = append(transitions, elem)
+		}
+	}
+	runtimeSends := root.GetElementsByTagName("send")
+	for i := uint(0); i < runtimeSends.Length(); i++ {
+		if elem, ok := runtimeSends.Item(i).(xmldom.Element); ok {
+			transitions = append(transitions, elem)
+		}
+	}
+
+	return transitions
+}
+
+// SanitizeName replaces characters that function-calling APIs reject (such
+// as the dots in event names) with underscores.
+func SanitizeName(name string) string {
+	result := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			result = append(result, c)
+		} else {
+			result = append(result, '_')
+		}
+	}
+	return string(result)
+}
+
+// BuildTools builds one tool per send function. Every tool takes optional
+// target and delay parameters, plus data when the event declares a schema.
+// With strictTargets, target is restricted to the event's transition targets.
+func BuildTools(sendFunctions []prompt.SendFunction, strictTargets bool) []Tool {
+	tools := make([]Tool, 0, len(sendFunctions))
+	for _, fn := range sendFunctions {
+		target := map[string]any{
+			"type":        "string",
+			"description": "Target destination for the event (optional)",
+		}
+		if strictTargets && len(fn.Targets) > 0 {
+			target["enum"] = fn.Targets
+		}
+		props := map[string]any{
+			"target": target,
+			"delay": map[string]any{
+				"type":        "string",
+				"description": "Delay before sending the event in CSS2 format (optional)",
+			},
+		}
+
+		if fn.Schema != nil && len(fn.Schema.Properties) > 0 {
+			if dataSchema, ok := fn.Schema.Properties["data"]; ok {
+				props["data"] = SchemaToMap(dataSchema)
+			} else {
+				props["data"] = map[string]any{
+					"type":        "object",
+					"description": "Event-specific data payload",
+				}
+			}
+		}
+
+		tools = append(tools, Tool{
+			Name:        SanitizeName(fn.Name),
+			EventName:   fn.EventName,
+			Description: fn.Description,
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": props,
+			},
+		})
+	}
+	return tools
+}
+
+// ToolMapping maps each tool's name to the event it sends.
+func ToolMapping(tools []Tool) map[string]string {
+	mapping := make(map[string]string, len(tools))
+	for _, t := range tools {
+		mapping[t.Name] = t.EventName
+	}
+	return mapping
+}
+
+// EventName resolves a tool name to its event. Names missing from mapping
+// fall back to stripping send_ and turning underscores back into dots.
+func EventName(mapping map[string]string, toolName string) string {
+	if ev, ok := mapping[toolName]; ok {
+		return ev
+	}
+	ev := strings.TrimPrefix(toolName, "send_")
+	return strings.ReplaceAll(ev, "_", ".")
+}
+
+// DispatchToolCalls sends one event per send_* tool call, resolving names
+// through mapping. Calls to any other function are rejected.
+func DispatchToolCalls(ctx context.Context, it agentml.Interpreter, calls []ToolCall, mapping map[string]string) error {
+	for _, call := range calls {
+		if !strings.HasPrefix(call.Name, "send_") {
+			return fmt.Errorf("unsupported function: %s (only send_* allowed)", call.Name)
+		}
+		var args map[string]any
+		if call.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+				return fmt.Errorf("failed to parse tool call arguments: %w", err)
+			}
+		}
+		if err := SendEvent(ctx, it, EventName(mapping, call.Name), args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendEvent sends an external event built from send_* tool arguments: data
+// (or the remaining arguments) becomes the payload, target the origin and
+// delay the send delay.
+func SendEvent(ctx context.Context, it agentml.Interpreter, eventName string, args map[string]any) error {
+	var data any
+	if d, ok := args["data"]; ok {
+		data = d
+	} else if len(args) > 0 {
+		filtered := make(map[string]any)
+		for k, v := range args {
+			if k != "target" && k != "delay" {
+				filtered[k] = v
+			}
+		}
+		if len(filtered) > 0 {
+			data = filtered
+		}
+	}
+
+	ev := &agentml.Event{
+		Name: eventName,
+		Type: agentml.EventTypeExternal,
+		Data: data,
+	}
+	if target, _ := args["target"].(string); target != "" {
+		ev.Origin = target
+	}
+	if delay, _ := args["delay"].(string); delay != "" {
+		// Zero delays become an immediate send
+		normalized := normalizeDelay(delay)
+		if normalized != delay {
+			slog.WarnContext(ctx, "Normalized delay format",
+				"original", delay, "normalized", normalized)
+		}
+		ev.Delay = normalized
+	}
+	return it.Send(ctx, ev)
+}
+
+// normalizeDelay converts the delays models produce into the CSS2 form the
+// interpreter expects: whole seconds as "<n>s", anything finer as "<n>ms".
+// ISO 8601 durations (PnYnMnWnDTnHnMnS, with years as 365 days and months
+// as 30) and Go durations ("1m30s", "500ms") are accepted. Zero and
+// negative durations map to the empty string, meaning send immediately.
+// Delays in neither form are returned trimmed but otherwise unchanged.
+func normalizeDelay(delay string) string {
+	delay = strings.TrimSpace(delay)
+	if delay == "" || delay == "0" {
+		return ""
+	}
+	d, ok := parseISO8601Duration(delay)
+	if !ok {
+		var err error
+		if d, err = time.ParseDuration(delay); err != nil {
+			return delay
+		}
+	}
+	switch {
+	case d <= 0:
+		return ""
+	case d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	default:
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64) + "ms"
+	}
+}
+
+// iso8601Duration matches PnYnMnWnDTnHnMnS, where each component is optional
+// and may have a fraction.
+var iso8601Duration = regexp.MustCompile(`^(?i)P(?:([\d.,]+)Y)?(?:([\d.,]+)M)?(?:([\d.,]+)W)?(?:([\d.,]+)D)?(?:T(?:([\d.,]+)H)?(?:([\d.,]+)M)?(?:([\d.,]+)S)?)?$`)
+
+// iso8601Units are the lengths of the components iso8601Duration captures,
+// in order.
+var iso8601Units = []time.Duration{
+	365 * 24 * time.Hour, 30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour,
+	time.Hour, time.Minute, time.Second,
+}
+
+// parseISO8601Duration parses an ISO 8601 duration such as PT1M30S. It
+// reports false for anything else, including a bare P or PT.
+func parseISO8601Duration(s string) (time.Duration, bool) {
+	m := iso8601Duration.FindStringSubmatch(s)
+	if m == nil || strings.HasSuffix(strings.ToUpper(s), "T") {
+		return 0, false
+	}
+	var total float64
+	matched := false
+	for i, part := range m[1:] {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.Replace(part, ",", ".", 1), 64)
+		if err != nil {
+			return 0, false
+		}
+		total += n * float64(iso8601Units[i])
+		matched = true
+	}
+	if !matched || total > math.MaxInt64 {
+		return 0, false
+	}
+	return time.Duration(total), true
+}
+
+// SchemaToMap converts a schema to the JSON Schema object form that
+// function-calling APIs accept. Arrays always get items, since some
+// providers reject arrays without them.
+func SchemaToMap(schema *jsonschema.Schema) map[string]any {
+	if schema == nil {
+		return map[string]any{"type": "object"}
+	}
+
+	result := map[string]any{}
+
+	typeStr := string(schema.Type)
+	if typeStr != "" {
+		result["type"] = typeStr
+	}
+	if schema.Description != "" {
+		result["description"] = schema.Description
+	}
+	if len(schema.Properties) > 0 {
+		props := make(map[string]any)
+		for key, propSchema := range schema.Properties {
+			props[key] = SchemaToMap(propSchema)
+		}
+		result["properties"] = props
+	}
+	if len(schema.Required) > 0 {
+		result["required"] = schema.Required
+	}
+	if typeStr == "array" {
+		if schema.Items != nil {
+			result["items"] = SchemaToMap(schema.Items)
+		} else {
+			result["items"] = map[string]any{"type": "object"}
+		}
+	}
+	if len(schema.Enum) > 0 {
+		result["enum"] = schema.Enum
+	}
+	if schema.Format != "" {
+		result["format"] = schema.Format
+	}
+
+	// Validation constraints
+	if schema.MinLength != nil && *schema.MinLength > 0 {
+		result["minLength"] = *schema.MinLength
+	}
+	if schema.MaxLength != nil && *schema.MaxLength > 0 {
+		result["maxLength"] = *schema.MaxLength
+	}
+	if schema.Minimum != nil {
+		result["minimum"] = schema.Minimum
+	}
+	if schema.Maximum != nil {
+		result["maximum"] = schema.Maximum
+	}
+	if schema.MinItems != nil && *schema.MinItems > 0 {
+		result["minItems"] = *schema.MinItems
+	}
+	if schema.MaxItems != nil && *schema.MaxItems > 0 {
+		result["maxItems"] = *schema.MaxItems
+	}
+
+	return result
+}
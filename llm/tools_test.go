@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/prompt"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// sendRecorder records sent events; every other Interpreter method panics.
+type sendRecorder struct {
+	agentml.Interpreter
+	sent []*agentml.Event
+}
+
+func (r *sendRecorder) Send(ctx context.Context, event *agentml.Event) error {
+	r.sent = append(r.sent, event)
+	return nil
+}
+
+func TestBuildToolsFromSnapshot(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<agentml xmlns="github.com/agentflare-ai/agentml">
+  <state id="idle">
+    <transition event="user.done" target="done"/>
+    <transition event="user.retry" target="idle"/>
+  </state>
+</agentml>`)).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	tools := BuildTools(prompt.BuildSendFunctions(ExtractTransitions(doc)), true)
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if want := []string{"send_user_done", "send_user_retry"}; !slices.Equal(names, want) {
+		t.Fatalf("tool names = %v, want %v", names, want)
+	}
+
+	target := tools[0].Parameters["properties"].(map[string]any)["target"].(map[string]any)
+	if enum, _ := target["enum"].([]string); !slices.Equal(enum, []string{"done"}) {
+		t.Errorf("target enum = %v, want [done]", target["enum"])
+	}
+	if got := ToolMapping(tools)["send_user_retry"]; got != "user.retry" {
+		t.Errorf("mapping = %q, want user.retry", got)
+	}
+}
+
+func TestDispatchToolCalls(t *testing.T) {
+	it := &sendRecorder{}
+	calls := []ToolCall{
+		{ID: "1", Name: "send_user_done", Arguments: `{"data":{"ok":true},"target":"#parent","delay":"0s"}`},
+		{ID: "2", Name: "send_order_placed", Arguments: `{"sku":"A1","delay":"2s"}`},
+	}
+	if err := DispatchToolCalls(context.Background(), it, calls, map[string]string{"send_user_done": "user.done"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if len(it.sent) != 2 {
+		t.Fatalf("sent %d events, want 2", len(it.sent))
+	}
+
+	done := it.sent[0]
+	if done.Name != "user.done" || done.Origin != "#parent" || done.Delay != "" {
+		t.Errorf("unexpected first event: %+v", done)
+	}
+	if data, _ := done.Data.(map[string]any); data["ok"] != true {
+		t.Errorf("first event data = %v", done.Data)
+	}
+
+	// Unmapped names fall back to the dotted event name
+	placed := it.sent[1]
+	if placed.Name != "order.placed" || placed.Delay != "2s" {
+		t.Errorf("unexpected second event: %+v", placed)
+	}
+	if data, _ := placed.Data.(map[string]any); data["sku"] != "A1" || data["delay"] != nil {
+		t.Errorf("second event data = %v", placed.Data)
+	}
+
+	if err := DispatchToolCalls(context.Background(), it, []ToolCall{{Name: "delete_everything"}}, nil); err == nil {
+		t.Error("expected an error for a non-send function")
+	}
+}
+
+func TestNormalizeDelay(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"PT5S", "5s"},
+		{"PT1M30S", "90s"},
+		{"pt0.5s", "500ms"},
+		{"P1DT2H", "93600s"},
+		{"P1W", "604800s"},
+		{"500ms", "500ms"},
+		{"1m30s", "90s"},
+		{"1.5s", "1500ms"},
+		{" 2s ", "2s"},
+		{"0", ""},
+		{"0s", ""},
+		{"0ms", ""},
+		{"PT0S", ""},
+		{"P0D", ""},
+		{"-5s", ""},
+		{"", ""},
+		// Not a duration in either form: left for the interpreter to reject
+		{"P", "P"},
+		{"PT", "PT"},
+		{"soon", "soon"},
+	} {
+		if got := normalizeDelay(tc.in); got != tc.want {
+			t.Errorf("normalizeDelay(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -11,12 +11,17 @@ import "C"
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/mattn/go-sqlite3"
@@ -90,94 +95,208 @@ func loadExtension(db *sql.DB, extensionData []byte, filename, entryPoint string
 
 var registerOnce sync.Once
 
-func NewDB(ctx context.Context, dsn string) (db *sql.DB, err error) {
-	// Register the custom SQLite driver only once
-	registerOnce.Do(func() {
-		sql.Register("sqlite3_with_extensions", &sqlite3.SQLiteDriver{
-			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
-				// Enable extension loading first
-				if _, err := conn.Exec("PRAGMA load_extension = 1", nil); err != nil {
-					wrappedErr := fmt.Errorf("store.NewDB: failed to enable extension loading: %w", err)
-					slog.Error(wrappedErr.Error())
-					return wrappedErr
-				}
+// DBOptions configures NewDBWithOptions.
+type DBOptions struct {
+	// Pragmas are applied with PRAGMA name = value on every new connection,
+	// e.g. {"journal_mode": "WAL", "synchronous": "NORMAL"}. Names must be in
+	// allowedPragmas and values must be plain words or numbers.
+	Pragmas map[string]string
+}
 
-				// Create temporary files for the extensions
-				// SQLite automatically appends the appropriate extension, so don't include it in the filename
-				graphName := "graph_extension_*"
-				graphTmpFile, err := writeExtensionToTemp(GraphExtension, graphName)
-				if err != nil {
-					wrappedErr := fmt.Errorf("store.NewDB: failed to write graph extension: %w", err)
-					slog.Error(wrappedErr.Error())
-					return wrappedErr
-				}
-				// Rename the file to have the correct extension
-				graphTmpFileWithExt := graphTmpFile
-				if runtime.GOOS == "darwin" {
-					graphTmpFileWithExt += ".dylib"
-				} else {
-					graphTmpFileWithExt += ".so"
-				}
-				if err := os.Rename(graphTmpFile, graphTmpFileWithExt); err != nil {
-					wrappedErr := fmt.Errorf("store.NewDB: failed to rename graph extension: %w", err)
-					slog.Error(wrappedErr.Error())
-					return wrappedErr
-				}
-				defer os.Remove(graphTmpFileWithExt)
+// allowedPragmas lists the pragmas DBOptions may set.
+var allowedPragmas = map[string]bool{
+	"auto_vacuum":        true,
+	"busy_timeout":       true,
+	"cache_size":         true,
+	"foreign_keys":       true,
+	"journal_mode":       true,
+	"journal_size_limit": true,
+	"locking_mode":       true,
+	"mmap_size":          true,
+	"secure_delete":      true,
+	"synchronous":        true,
+	"temp_store":         true,
+	"wal_autocheckpoint": true,
+}
 
-				// SQLite automatically appends the shared library extension, so pass path without extension
-				graphLoadPath := graphTmpFile
+var pragmaValue = regexp.MustCompile(`^-?[A-Za-z0-9_]+$`)
 
-				vecName := "vec_extension_*"
-				vecTmpFile, err := writeExtensionToTemp(VecExtension, vecName)
-				if err != nil {
-					wrappedErr := fmt.Errorf("store.NewDB: failed to write vec extension: %w", err)
-					slog.Error(wrappedErr.Error())
-					return wrappedErr
-				}
-				// Rename the file to have the correct extension
-				vecTmpFileWithExt := vecTmpFile
-				if runtime.GOOS == "darwin" {
-					vecTmpFileWithExt += ".dylib"
-				} else {
-					vecTmpFileWithExt += ".so"
-				}
-				if err := os.Rename(vecTmpFile, vecTmpFileWithExt); err != nil {
-					wrappedErr := fmt.Errorf("store.NewDB: failed to rename vec extension: %w", err)
-					slog.Error(wrappedErr.Error())
-					return wrappedErr
-				}
-				defer os.Remove(vecTmpFileWithExt)
+// pragmaStatements validates pragmas and returns the statements that apply
+// them, sorted by name.
+func pragmaStatements(pragmas map[string]string) ([]string, error) {
+	names := make([]string, 0, len(pragmas))
+	for name := range pragmas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stmts := make([]string, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if !allowedPragmas[key] {
+			return nil, fmt.Errorf("store.NewDB: pragma %q is not allowed", name)
+		}
+		value := strings.TrimSpace(pragmas[name])
+		if !pragmaValue.MatchString(value) {
+			return nil, fmt.Errorf("store.NewDB: invalid value %q for pragma %s", pragmas[name], key)
+		}
+		stmts = append(stmts, fmt.Sprintf("PRAGMA %s = %s", key, value))
+	}
+	return stmts, nil
+}
 
-				// SQLite automatically appends the shared library extension, so pass path without extension
-				vecLoadPath := vecTmpFile
+// parsePragmas reads the pragmas attribute of memory:db, a space-separated
+// list of name=value pairs, and validates them like NewDBWithOptions.
+func parsePragmas(attr string) (map[string]string, error) {
+	fields := strings.Fields(attr)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	pragmas := make(map[string]string, len(fields))
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid pragma %q, want name=value", field)
+		}
+		pragmas[name] = value
+	}
+	if _, err := pragmaStatements(pragmas); err != nil {
+		return nil, err
+	}
+	return pragmas, nil
+}
 
-				// Load the extensions (best-effort). If unavailable on this platform, continue.
-				if err := conn.LoadExtension(graphLoadPath, "sqlite3_graph_init"); err != nil {
-					slog.Warn("store.NewDB: graph extension unavailable; continuing without it", "err", err)
-				} else {
-					slog.Debug("store.NewDB: graph extension loaded")
-				}
+// loadExtensions is the connect hook shared by every connection: it enables
+// extension loading and loads the embedded graph and vec extensions.
+func loadExtensions(conn *sqlite3.SQLiteConn) error {
+	// Enable extension loading first
+	if _, err := conn.Exec("PRAGMA load_extension = 1", nil); err != nil {
+		wrappedErr := fmt.Errorf("store.NewDB: failed to enable extension loading: %w", err)
+		slog.Error(wrappedErr.Error())
+		return wrappedErr
+	}
 
-				if err := conn.LoadExtension(vecLoadPath, "sqlite3_vec_init"); err != nil {
-					slog.Warn("store.NewDB: vec extension unavailable; continuing without it", "err", err)
-				} else {
-					slog.Debug("store.NewDB: vec extension loaded")
-				}
+	// Create temporary files for the extensions
+	// SQLite automatically appends the appropriate extension, so don't include it in the filename
+	graphName := "graph_extension_*"
+	graphTmpFile, err := writeExtensionToTemp(GraphExtension, graphName)
+	if err != nil {
+		wrappedErr := fmt.Errorf("store.NewDB: failed to write graph extension: %w", err)
+		slog.Error(wrappedErr.Error())
+		return wrappedErr
+	}
+	// Rename the file to have the correct extension
+	graphTmpFileWithExt := graphTmpFile
+	if runtime.GOOS == "darwin" {
+		graphTmpFileWithExt += ".dylib"
+	} else {
+		graphTmpFileWithExt += ".so"
+	}
+	if err := os.Rename(graphTmpFile, graphTmpFileWithExt); err != nil {
+		wrappedErr := fmt.Errorf("store.NewDB: failed to rename graph extension: %w", err)
+		slog.Error(wrappedErr.Error())
+		return wrappedErr
+	}
+	defer os.Remove(graphTmpFileWithExt)
 
-				return nil
-			},
-		})
-	})
+	// SQLite automatically appends the shared library extension, so pass path without extension
+	graphLoadPath := graphTmpFile
 
-	// Open the database with the custom driver
-	db, err = sql.Open("sqlite3_with_extensions", dsn)
+	vecName := "vec_extension_*"
+	vecTmpFile, err := writeExtensionToTemp(VecExtension, vecName)
 	if err != nil {
-		wrappedErr := fmt.Errorf("store.NewDB: failed to open database: %w", err)
+		wrappedErr := fmt.Errorf("store.NewDB: failed to write vec extension: %w", err)
 		slog.Error(wrappedErr.Error())
-		return nil, wrappedErr
+		return wrappedErr
+	}
+	// Rename the file to have the correct extension
+	vecTmpFileWithExt := vecTmpFile
+	if runtime.GOOS == "darwin" {
+		vecTmpFileWithExt += ".dylib"
+	} else {
+		vecTmpFileWithExt += ".so"
+	}
+	if err := os.Rename(vecTmpFile, vecTmpFileWithExt); err != nil {
+		wrappedErr := fmt.Errorf("store.NewDB: failed to rename vec extension: %w", err)
+		slog.Error(wrappedErr.Error())
+		return wrappedErr
+	}
+	defer os.Remove(vecTmpFileWithExt)
+
+	// SQLite automatically appends the shared library extension, so pass path without extension
+	vecLoadPath := vecTmpFile
+
+	// Load the extensions (best-effort). If unavailable on this platform, continue.
+	if err := conn.LoadExtension(graphLoadPath, "sqlite3_graph_init"); err != nil {
+		slog.Warn("store.NewDB: graph extension unavailable; continuing without it", "err", err)
+	} else {
+		slog.Debug("store.NewDB: graph extension loaded")
+	}
+
+	if err := conn.LoadExtension(vecLoadPath, "sqlite3_vec_init"); err != nil {
+		slog.Warn("store.NewDB: vec extension unavailable; continuing without it", "err", err)
+	} else {
+		slog.Debug("store.NewDB: vec extension loaded")
+	}
+
+	return nil
+}
+
+func NewDB(ctx context.Context, dsn string) (db *sql.DB, err error) {
+	return NewDBWithOptions(ctx, dsn, DBOptions{})
+}
+
+// NewDBWithOptions opens dsn like NewDB and applies opts to every connection.
+// Private in-memory and temporary databases (":memory:", "file::memory:",
+// mode=memory or an empty file name, without cache=shared) exist only on the
+// connection that created them, so later operations on another pooled
+// connection would see a fresh, empty database. For them the pool is pinned
+// to a single connection that is never closed while idle, which keeps the
+// database alive for the lifetime of db.
+func NewDBWithOptions(ctx context.Context, dsn string, opts DBOptions) (db *sql.DB, err error) {
+	stmts, err := pragmaStatements(opts.Pragmas)
+	if err != nil {
+		slog.Error(err.Error())
+		return nil, err
+	}
+
+	if len(stmts) == 0 {
+		// Register the custom SQLite driver only once
+		registerOnce.Do(func() {
+			sql.Register("sqlite3_with_extensions", &sqlite3.SQLiteDriver{ConnectHook: loadExtensions})
+		})
+		// Open the database with the custom driver
+		db, err = sql.Open("sqlite3_with_extensions", dsn)
+		if err != nil {
+			wrappedErr := fmt.Errorf("store.NewDB: failed to open database: %w", err)
+			slog.Error(wrappedErr.Error())
+			return nil, wrappedErr
+		}
+	} else {
+		// Pragmas are per connection, so they run in the connect hook of a
+		// driver dedicated to this database.
+		drv := &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := loadExtensions(conn); err != nil {
+					return err
+				}
+				for _, stmt := range stmts {
+					if _, err := conn.Exec(stmt, nil); err != nil {
+						return fmt.Errorf("store.NewDB: failed to apply %q: %w", stmt, err)
+					}
+				}
+				return nil
+			},
+		}
+		db = sql.OpenDB(dsnConnector{driver: drv, dsn: dsn})
+	}
+	if privateMemoryDSN(dsn) {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxIdleTime(0)
+		db.SetConnMaxLifetime(0)
 	}
 	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
 		wrappedErr := fmt.Errorf("store.NewDB: failed to ping database: %w", err)
 		slog.Error(wrappedErr.Error())
 		return nil, wrappedErr
@@ -185,6 +304,28 @@ func NewDB(ctx context.Context, dsn string) (db *sql.DB, err error) {
 	return db, nil
 }
 
+// privateMemoryDSN reports whether dsn names a database that each connection
+// gets its own copy of: an in-memory or temporary database not opened with
+// cache=shared.
+func privateMemoryDSN(dsn string) bool {
+	name, query, _ := strings.Cut(dsn, "?")
+	name = strings.TrimPrefix(name, "file:")
+	params, err := url.ParseQuery(query)
+	if err != nil || params.Get("cache") == "shared" {
+		return false
+	}
+	return name == "" || name == ":memory:" || params.Get("mode") == "memory"
+}
+
+// dsnConnector opens dsn with an unregistered driver.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
 // writeExtensionToTemp writes extension data to a temporary file and returns the path
 func writeExtensionToTemp(extensionData []byte, pattern string) (string, error) {
 	// Create temp file with the given pattern
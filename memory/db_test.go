@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestNewDBWithOptionsAppliesPragmas(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "memory.db")
+	db, err := NewDBWithOptions(ctx, dsn, DBOptions{Pragmas: map[string]string{
+		"journal_mode": "WAL",
+		"synchronous":  "NORMAL",
+		"cache_size":   "-4000",
+	}})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	// Force a second connection so the pragmas are known to be per connection
+	db.SetMaxIdleConns(0)
+
+	var mode string
+	if err := db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Fatalf("journal_mode = %q, want wal", mode)
+	}
+	var sync, cache int
+	if err := db.QueryRowContext(ctx, "PRAGMA synchronous").Scan(&sync); err != nil {
+		t.Fatalf("synchronous: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA cache_size").Scan(&cache); err != nil {
+		t.Fatalf("cache_size: %v", err)
+	}
+	if sync != 1 || cache != -4000 {
+		t.Fatalf("synchronous = %d, cache_size = %d, want 1 and -4000", sync, cache)
+	}
+}
+
+func TestDeclaredDBAppliesPragmas(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	dsn := filepath.Join(t.TempDir(), "declared.db")
+	doc, _ := xmldom.NewDecoder(strings.NewReader(`<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="main" dsn="` + dsn + `" pragmas="journal_mode=WAL busy_timeout=2500"/>
+</agentml>`)).Decode()
+	dm := newFakeDM()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	deps, err := loaded.(*ns).ensureOpen(ctx, dm, "main")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var mode string
+	var timeout int
+	if err := deps.DB.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("journal_mode: %v", err)
+	}
+	if err := deps.DB.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatalf("busy_timeout: %v", err)
+	}
+	if mode != "wal" || timeout != 2500 {
+		t.Fatalf("journal_mode = %q, busy_timeout = %d, want wal and 2500", mode, timeout)
+	}
+
+	for _, attr := range []string{"writable_schema=1", "journal_mode", "synchronous=OFF;"} {
+		bad, _ := xmldom.NewDecoder(strings.NewReader(`<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="main" pragmas="` + attr + `"/>
+</agentml>`)).Decode()
+		if _, err := Loader()(ctx, &fakeInterp{dm: dm}, bad); err == nil {
+			t.Errorf("pragmas=%q loaded, want an error", attr)
+		}
+	}
+}
+
+func TestNewDBWithOptionsRejectsUnsafePragmas(t *testing.T) {
+	tests := map[string]map[string]string{
+		"unknown name":   {"writable_schema": "1"},
+		"injected value": {"synchronous": "OFF; DROP TABLE kv"},
+		"injected name":  {"cache_size = 1; PRAGMA writable_schema": "1"},
+		"empty value":    {"journal_mode": ""},
+	}
+	for name, pragmas := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewDBWithOptions(context.Background(), ":memory:", DBOptions{Pragmas: pragmas})
+			if err == nil || !strings.Contains(err.Error(), "pragma") {
+				t.Fatalf("expected pragma validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewDBMemoryReadsOwnWrites(t *testing.T) {
+	ctx := context.Background()
+	for _, dsn := range []string{":memory:", ":memory:?_foreign_keys=on", "file::memory:", "file:scratch?mode=memory"} {
+		t.Run(dsn, func(t *testing.T) {
+			db, err := NewDB(ctx, dsn)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer db.Close()
+			if _, err := db.ExecContext(ctx, "CREATE TABLE kv(key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if _, err := db.ExecContext(ctx, "INSERT INTO kv(key, value) VALUES('k', '\"v\"')"); err != nil {
+				t.Fatalf("put: %v", err)
+			}
+
+			// Overlapping reads would each open a connection, which would see
+			// an empty database were the pool not pinned; the counting
+			// subquery keeps each read busy long enough to overlap
+			var wg sync.WaitGroup
+			errs := make(chan error, 8)
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var value string
+					if err := db.QueryRowContext(ctx, `SELECT value FROM kv, (WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 20000) SELECT max(i) FROM n) WHERE key='k'`).Scan(&value); err != nil {
+						errs <- err
+					} else if value != `"v"` {
+						errs <- fmt.Errorf("value = %s", value)
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Errorf("get: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrivateMemoryDSN(t *testing.T) {
+	for _, dsn := range []string{":memory:", ":memory:?_foreign_keys=on", "file::memory:", "file:scratch?mode=memory", ""} {
+		if !privateMemoryDSN(dsn) {
+			t.Errorf("privateMemoryDSN(%q) = false, want true", dsn)
+		}
+	}
+	for _, dsn := range []string{"file::memory:?cache=shared", "file:memdb?mode=memory&cache=shared", "app.db", "file:app.db?mode=ro"} {
+		if privateMemoryDSN(dsn) {
+			t.Errorf("privateMemoryDSN(%q) = true, want false", dsn)
+		}
+	}
+}
+
+func TestNewDBMemoryPinsOneConnection(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDBWithOptions(ctx, ":memory:", DBOptions{Pragmas: map[string]string{"foreign_keys": "ON"}})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE kv(key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 1 {
+		t.Fatalf("MaxOpenConnections = %d, want 1", got)
+	}
+	// An idle pool must keep its connection, or the database goes with it
+	time.Sleep(10 * time.Millisecond)
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM kv").Scan(&n); err != nil {
+		t.Fatalf("database lost while idle: %v", err)
+	}
+	if got := db.Stats().OpenConnections; got != 1 {
+		t.Errorf("OpenConnections = %d, want 1", got)
+	}
+}
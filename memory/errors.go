@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Sentinel errors for the failure kinds Go callers commonly branch on. Errors
+// returned by the package wrap them, so test with errors.Is. Errors raised by
+// memory elements are PlatformErrors whose Cause wraps the same sentinels.
+var (
+	// ErrNoDatabase means the KV, vector or graph store an operation needs
+	// is not configured.
+	ErrNoDatabase = errors.New("memory: store not configured")
+	// ErrReadOnly means a write was rejected because the database is
+	// read-only, for example when opened with mode=ro.
+	ErrReadOnly = errors.New("memory: database is read-only")
+	// ErrDimensionMismatch means a vector's length differs from the
+	// dimensions of the vector store.
+	ErrDimensionMismatch = errors.New("memory: vector dimension mismatch")
+	// ErrNoEmbedder means an operation needs embeddings but no embedder is
+	// configured.
+	ErrNoEmbedder = errors.New("memory: no embedder configured")
+	// ErrKeyNotFound means an operation required a key that is not stored.
+	ErrKeyNotFound = errors.New("memory: key not found")
+	// ErrNotInteger means memory:increment found a stored value that is not
+	// an integer.
+	ErrNotInteger = errors.New("memory: value is not an integer")
+	// ErrNotList means memory:append or memory:pop found a stored value that
+	// is not a JSON array.
+	ErrNotList = errors.New("memory: value is not a list")
+	// ErrInTransaction means an operation SQLite cannot run inside a
+	// transaction, such as memory:vacuum, was attempted while one is open.
+	ErrInTransaction = errors.New("memory: not allowed inside a transaction")
+	// ErrMigrationFailed means a schema migration failed and was rolled
+	// back, leaving the recorded schema version unchanged.
+	ErrMigrationFailed = errors.New("memory: migration failed")
+)
+
+// notConfigured reports that the named store is missing.
+func notConfigured(store string) error {
+	return fmt.Errorf("%w: %s", ErrNoDatabase, store)
+}
+
+// inTransaction reports that op was attempted inside an open transaction.
+func inTransaction(op string) error {
+	return fmt.Errorf("%w: %s", ErrInTransaction, op)
+}
+
+// dimensionMismatch reports a vector of got dimensions against a store of
+// expected dimensions.
+func dimensionMismatch(expected, got int) error {
+	return fmt.Errorf("%w: expected %d, got %d", ErrDimensionMismatch, expected, got)
+}
+
+// elementError converts err from the element local into the PlatformError
+// raised to the document. SQLite read-only failures are tagged with
+// ErrReadOnly; existing PlatformErrors pass through unchanged.
+func elementError(local string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var perr *agentml.PlatformError
+	if errors.As(err, &perr) {
+		return err
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly {
+		err = fmt.Errorf("%w: %w", ErrReadOnly, err)
+	}
+	return &agentml.PlatformError{
+		EventName: "error.execution",
+		Message:   fmt.Sprintf("memory:%s failed: %v", local, err),
+		Data:      map[string]any{"element": local},
+		Cause:     err,
+	}
+}
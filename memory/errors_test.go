@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:copy src="missing" dst="copy"/>
+  <memory:upsertvector key="v" vectorexpr="vec"/>
+  <memory:search text="q" model="m" location="hits"/>
+  <memory:addnode labels="Person"/>
+  <memory:put key="k" value="1"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "sentinel_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.Graph = nil
+	dm.store["vec"] = []any{1.0, 2.0, 3.0}
+
+	children := []xmldom.Element{}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		children = append(children, child)
+	}
+	for i, want := range []error{ErrKeyNotFound, ErrDimensionMismatch, ErrNoEmbedder, ErrNoDatabase} {
+		_, err := inst.Handle(ctx, children[i])
+		var perr *agentml.PlatformError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%s: expected PlatformError, got %v", children[i].LocalName(), err)
+		}
+		if !errors.Is(err, want) {
+			t.Errorf("%s: errors.Is(%v, %v) = false", children[i].LocalName(), err, want)
+		}
+	}
+
+	// Writes to a database opened read-only are tagged ErrReadOnly.
+	path := filepath.Join(t.TempDir(), "ro.db")
+	rw, err := NewDB(ctx, path)
+	if err != nil {
+		t.Fatalf("open rw: %v", err)
+	}
+	if _, err := rw.ExecContext(ctx, "CREATE TABLE kv(key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+		t.Fatalf("create kv: %v", err)
+	}
+	rw.Close()
+	ro, err := NewDB(ctx, "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatalf("open ro: %v", err)
+	}
+	defer ro.Close()
+	deps.DB = ro
+	if _, err := inst.Handle(ctx, children[4]); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("put on read-only database: got %v, want ErrReadOnly", err)
+	}
+}
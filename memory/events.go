@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// resultRecorder captures the value an operation assigns to its location
+// attribute, so completion events can carry it without each operation
+// reporting its result separately.
+type resultRecorder struct {
+	agentml.DataModel
+	location string
+	result   any
+	assigned bool
+}
+
+func (r *resultRecorder) SetVariable(ctx context.Context, id string, value any) error {
+	if err := r.DataModel.SetVariable(ctx, id, value); err != nil {
+		return err
+	}
+	if id == r.location {
+		r.result, r.assigned = value, true
+	}
+	return nil
+}
+
+// completionEvents returns the raise-event and send-event attributes of el.
+func completionEvents(el xmldom.Element) (raiseEvent, sendEvent string) {
+	return string(el.GetAttribute("raise-event")), string(el.GetAttribute("send-event"))
+}
+
+// notifyCompletion raises raiseEvent internally and sends sendEvent
+// externally after op succeeds, each with {op, db} and, when the operation
+// assigned its location, the assigned value as result.
+func (n *ns) notifyCompletion(ctx context.Context, op, raiseEvent, sendEvent string, rec *resultRecorder) error {
+	data := func() map[string]any {
+		d := map[string]any{"op": op, "db": n.dbID(n.deps)}
+		if rec.assigned {
+			d["result"] = rec.result
+		}
+		return d
+	}
+	raise(ctx, n.itp, raiseEvent, data())
+	if sendEvent == "" {
+		return nil
+	}
+	return n.itp.Send(ctx, &agentml.Event{
+		Name: sendEvent,
+		Data: data(),
+		Type: agentml.EventTypeExternal,
+	})
+}
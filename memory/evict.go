@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// EvictPolicy selects which vectors a capped store removes first.
+type EvictPolicy string
+
+const (
+	// EvictOldest removes the vectors written longest ago. It is the default
+	// when a store has a maximum count.
+	EvictOldest EvictPolicy = "oldest"
+	// EvictLRU removes the vectors least recently returned by a search, or
+	// written when never returned.
+	EvictLRU EvictPolicy = "lru"
+)
+
+// ParseEvictPolicy parses a vector-evict attribute value. An empty value is
+// EvictOldest.
+func ParseEvictPolicy(s string) (EvictPolicy, error) {
+	switch p := EvictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return EvictOldest, nil
+	case EvictOldest, EvictLRU:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown vector eviction policy %q (want lru or oldest)", s)
+	}
+}
+
+// SetEviction caps the store at maxCount vectors. Once an insert takes the
+// store past the cap, vectors are removed per policy until it is back at
+// maxCount; their keys, texts and norms go with them. A maxCount <= 0
+// removes the cap.
+//
+// While capped, write and access times are tracked per vector, so searches
+// also write to the database. Vectors stored before the cap was set count as
+// the oldest.
+func (vs *VectorDB) SetEviction(maxCount int, policy EvictPolicy) {
+	if policy == "" {
+		policy = EvictOldest
+	}
+	vs.maxCount = maxCount
+	vs.evict = policy
+}
+
+// Evict removes vectors per the eviction policy until the store holds at
+// most its maximum count, returning how many were removed. An uncapped store
+// is left unchanged.
+func (vs *VectorDB) Evict(ctx context.Context) (int64, error) {
+	if vs.maxCount <= 0 {
+		return 0, nil
+	}
+	var evicted int64
+	err := inTx(ctx, vs.db, func(tx DBTX) error {
+		var err error
+		evicted, err = vs.evictIn(ctx, tx)
+		return err
+	})
+	return evicted, err
+}
+
+// evictIn is Evict within tx.
+func (vs *VectorDB) evictIn(ctx context.Context, tx DBTX) (int64, error) {
+	var count int64
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", vs.tableName)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count vectors: %w", err)
+	}
+	excess := count - int64(vs.maxCount)
+	if excess <= 0 {
+		return 0, nil
+	}
+
+	order := "a.written"
+	if vs.evict == EvictLRU {
+		order = "a.accessed"
+	}
+	query := fmt.Sprintf("SELECT v.rowid FROM %s v LEFT JOIN %s a ON a.id = v.rowid ORDER BY COALESCE(%s, 0), v.rowid LIMIT ?", vs.tableName, vs.accessTable, order)
+	rows, err := tx.QueryContext(ctx, query, excess)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select vectors to evict: %w", err)
+	}
+	var ids []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan vector to evict: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to select vectors to evict: %w", err)
+	}
+
+	var evicted int64
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		batch := ids[start:min(start+deleteBatchSize, len(ids))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid IN (%s)", vs.tableName, placeholders), batch...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to evict vectors: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to count evicted vectors: %w", err)
+		}
+		evicted += n
+		// Texts are keyed by key, so they go before the key mappings
+		for _, query := range []string{
+			fmt.Sprintf("DELETE FROM %s WHERE key IN (SELECT key FROM %s WHERE id IN (%s))", vs.textTable, vs.keysTable, placeholders),
+			fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", vs.keysTable, placeholders),
+			fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", vs.normsTable, placeholders),
+			fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", vs.accessTable, placeholders),
+		} {
+			if _, err := tx.ExecContext(ctx, query, batch...); err != nil {
+				return 0, fmt.Errorf("failed to evict vector metadata: %w", err)
+			}
+		}
+	}
+	return evicted, nil
+}
+
+// written records that the vector id was just written and, when that takes
+// a capped store past its cap, evicts. The new vector is the most recent, so
+// it is never the one evicted.
+func (vs *VectorDB) written(ctx context.Context, q DBTX, id int64) error {
+	if vs.maxCount <= 0 {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	query := fmt.Sprintf("INSERT INTO %s(id, written, accessed) VALUES (?, ?, ?) ON CONFLICT(id) DO UPDATE SET written=excluded.written, accessed=excluded.accessed", vs.accessTable)
+	if _, err := q.ExecContext(ctx, query, id, now, now); err != nil {
+		return fmt.Errorf("failed to record vector write: %w", err)
+	}
+	_, err := vs.evictIn(ctx, q)
+	return err
+}
+
+// accessed records that results were just returned by a search. Failures
+// are logged rather than failing the search.
+func (vs *VectorDB) accessed(ctx context.Context, q DBTX, results []VectorResult) {
+	if vs.maxCount <= 0 || len(results) == 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	args := make([]any, 0, 2*len(results))
+	for _, r := range results {
+		args = append(args, r.ID, now)
+	}
+	values := strings.TrimSuffix(strings.Repeat("(?, 0, ?),", len(results)), ",")
+	query := fmt.Sprintf("INSERT INTO %s(id, written, accessed) VALUES %s ON CONFLICT(id) DO UPDATE SET accessed=excluded.accessed", vs.accessTable, values)
+	if _, err := q.ExecContext(ctx, query, args...); err != nil {
+		slog.WarnContext(ctx, "memory: failed to record vector access", "table", vs.tableName, "error", err)
+	}
+}
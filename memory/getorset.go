@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// GetOrSet returns the value stored at key, or calls compute and stores its
+// result when key is missing. computed reports whether the returned value
+// came from compute. When another connection stores key between the lookup
+// and the write, its value wins and is returned instead, so every caller
+// sees the same cached value.
+func (d *Deps) GetOrSet(ctx context.Context, key string, compute func() (any, error)) (value any, computed bool, err error) {
+	if d == nil || d.DB == nil {
+		return nil, false, notConfigured("KV database")
+	}
+	if _, err := d.dbtx().ExecContext(ctx, "CREATE TABLE IF NOT EXISTS kv(key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+		return nil, false, err
+	}
+	return getOrSetKV(ctx, d.dbtx(), key, compute)
+}
+
+// getOrSetKV implements GetOrSet. The write only inserts, so a concurrent
+// writer's value is never overwritten; losing the race re-reads it.
+func getOrSetKV(ctx context.Context, q DBTX, key string, compute func() (any, error)) (any, bool, error) {
+	if v, ok, err := lookupKV(ctx, q, key); err != nil || ok {
+		return v, false, err
+	}
+	v, err := compute()
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := q.ExecContext(ctx, "INSERT INTO kv(key,value) VALUES(?,?) ON CONFLICT(key) DO NOTHING", key, string(data))
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		stored, _, err := lookupKV(ctx, q, key)
+		return stored, false, err
+	}
+	return v, true, nil
+}
+
+// lookupKV reads the value stored at key; ok is false when key is missing.
+func lookupKV(ctx context.Context, q DBTX, key string) (v any, ok bool, err error) {
+	var s string
+	err = q.QueryRowContext(ctx, "SELECT value FROM kv WHERE key=?", key).Scan(&s)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	_ = json.Unmarshal([]byte(s), &v)
+	return v, true, nil
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// countingDM counts the evaluations of each expression.
+type countingDM struct {
+	*fakeDM
+	evals map[string]int
+}
+
+func (c *countingDM) EvaluateValue(ctx context.Context, expression string) (any, error) {
+	c.evals[expression]++
+	return c.fakeDM.EvaluateValue(ctx, expression)
+}
+
+// countingInterp serves a countingDM as its data model.
+type countingInterp struct {
+	*fakeInterp
+	dm *countingDM
+}
+
+func (c *countingInterp) DataModel() agentml.DataModel { return c.dm }
+
+func TestGetOrSet(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:getorset key="profile" valueexpr="compute" location="first"/>
+  <memory:getorset key="profile" valueexpr="compute" location="second"/>
+  <memory:put key="cached" value="old"/>
+  <memory:getorset key="cached" valueexpr="fresh" location="hit"/>
+  <memory:get key="profile" location="stored"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := &countingDM{fakeDM: newFakeDM(), evals: map[string]int{}}
+	dm.store["compute"] = map[string]any{"name": "ada"}
+	dm.store["fresh"] = "new"
+	ns, err := Loader()(ctx, &countingInterp{fakeInterp: &fakeInterp{dm: dm.fakeDM}, dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := doc.DocumentElement().Children()
+	for i := uint(0); i < children.Length(); i++ {
+		if ok, err := ns.Handle(ctx, children.Item(i)); !ok || err != nil {
+			t.Fatalf("%s: ok=%v err=%v", children.Item(i).LocalName(), ok, err)
+		}
+	}
+
+	if dm.evals["compute"] != 1 {
+		t.Errorf("valueexpr evaluated %d times, want once on the miss only", dm.evals["compute"])
+	}
+	for _, loc := range []string{"first", "second", "stored"} {
+		if got, _ := dm.store[loc].(map[string]any); got["name"] != "ada" {
+			t.Errorf("%s = %v, want the computed profile", loc, dm.store[loc])
+		}
+	}
+	if dm.evals["fresh"] != 0 {
+		t.Errorf("valueexpr evaluated on a hit")
+	}
+	if got := dm.store["hit"]; got != "old" {
+		t.Errorf("hit = %v, want the stored value old", got)
+	}
+}
+
+func TestDepsGetOrSet(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	db, err := NewDBWithOptions(ctx, filepath.Join(t.TempDir(), "cache.db"), DBOptions{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	deps := &Deps{DB: db}
+
+	v, computed, err := deps.GetOrSet(ctx, "answer", func() (any, error) { return 42, nil })
+	if err != nil || !computed || v != 42 {
+		t.Fatalf("miss = %v, %v, %v; want 42, true, nil", v, computed, err)
+	}
+	v, computed, err = deps.GetOrSet(ctx, "answer", func() (any, error) {
+		t.Fatal("compute called on a hit")
+		return nil, nil
+	})
+	if err != nil || computed || v != float64(42) {
+		t.Fatalf("hit = %v, %v, %v; want 42, false, nil", v, computed, err)
+	}
+
+	boom := errors.New("boom")
+	if _, _, err := deps.GetOrSet(ctx, "broken", func() (any, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("compute error = %v, want boom", err)
+	}
+	if _, ok, _ := lookupKV(ctx, db, "broken"); ok {
+		t.Errorf("failed compute stored a value")
+	}
+}
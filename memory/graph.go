@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/agentflare-ai/go-jsonschema"
@@ -126,26 +128,28 @@ type Node struct {
 	Properties map[string]any `json:"properties,omitempty"`
 }
 
-// Relationship represents an edge/relationship in the graph
-type Relationship struct {
+// Edge represents an edge/relationship in the graph. It is also the value
+// memory elements assign for an edge, mirroring Node: memory:getedge and
+// memory:addedge (with a location) both assign *Edge.
+type Edge struct {
 	ID         int64          `json:"id"`
-	StartNode  int64          `json:"start_node"`
-	EndNode    int64          `json:"end_node"`
+	Src        int64          `json:"src"`
+	Dst        int64          `json:"dst"`
 	Type       string         `json:"type"`
 	Properties map[string]any `json:"properties,omitempty"`
 }
 
 // Path represents a path through the graph
 type Path struct {
-	Nodes         []*Node         `json:"nodes"`
-	Relationships []*Relationship `json:"relationships"`
+	Nodes         []*Node `json:"nodes"`
+	Relationships []*Edge `json:"relationships"`
 }
 
 // GraphUpdate represents an update operation for the graph
 type GraphUpdate struct {
 	Operation  string         `json:"operation"` // "create_node", "create_relationship", "update_node", "update_relationship"
 	NodeData   *Node          `json:"node_data,omitempty"`
-	RelData    *Relationship  `json:"rel_data,omitempty"`
+	RelData    *Edge          `json:"rel_data,omitempty"`
 	Labels     []string       `json:"labels,omitempty"`
 	Properties map[string]any `json:"properties,omitempty"`
 }
@@ -204,6 +208,10 @@ func NewGraphDB(ctx context.Context, db *sql.DB, tableName string) (*GraphDB, er
 
 // CreateNode creates a new node with optional labels and properties
 func (g *GraphDB) CreateNode(ctx context.Context, labels []string, properties map[string]any) (*Node, error) {
+	return g.createNode(ctx, g.db, labels, properties)
+}
+
+func (g *GraphDB) createNode(ctx context.Context, q DBTX, labels []string, properties map[string]any) (*Node, error) {
 	// Prepare labels as JSON array
 	labelsJSON := "[]"
 	if len(labels) > 0 {
@@ -223,7 +231,7 @@ func (g *GraphDB) CreateNode(ctx context.Context, labels []string, properties ma
 	if g.vtAvailable {
 		// Insert through the virtual table interface
 		query := fmt.Sprintf("INSERT INTO %s (type, labels, properties) VALUES (?, ?, ?)", g.tableName)
-		result, err := g.db.ExecContext(ctx, query, "node", labelsJSON, propertiesJSON)
+		result, err := q.ExecContext(ctx, query, "node", labelsJSON, propertiesJSON)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create node: %w", err)
 		}
@@ -236,7 +244,7 @@ func (g *GraphDB) CreateNode(ctx context.Context, labels []string, properties ma
 	}
 	// Fallback: insert directly into backing table
 	query := fmt.Sprintf("INSERT INTO %s (labels, properties) VALUES (?, ?)", g.nodesTable)
-	result, err := g.db.ExecContext(ctx, query, labelsJSON, propertiesJSON)
+	result, err := q.ExecContext(ctx, query, labelsJSON, propertiesJSON)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create node: %w", err)
 	}
@@ -252,8 +260,57 @@ func (g *GraphDB) CreateNode(ctx context.Context, labels []string, properties ma
 	}, nil
 }
 
+// UpsertNode returns the existing node whose properties[dedupKey] equals
+// properties[dedupKey], or creates a new node when none matches. An empty
+// dedupKey always creates a node.
+func (g *GraphDB) UpsertNode(ctx context.Context, labels []string, properties map[string]any, dedupKey string) (*Node, error) {
+	return g.upsertNode(ctx, g.db, labels, properties, dedupKey)
+}
+
+func (g *GraphDB) upsertNode(ctx context.Context, q DBTX, labels []string, properties map[string]any, dedupKey string) (*Node, error) {
+	if dedupKey == "" {
+		return g.createNode(ctx, q, labels, properties)
+	}
+	value, ok := properties[dedupKey]
+	if !ok {
+		return nil, fmt.Errorf("failed to upsert node: dedup key %q missing from properties", dedupKey)
+	}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert node: %w", err)
+	}
+	path, err := json.Marshal(dedupKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert node: %w", err)
+	}
+
+	query := fmt.Sprintf("SELECT id, labels, properties FROM %s WHERE json_extract(properties, ?) = json_extract(?, '$') ORDER BY id LIMIT 1", g.nodesTable)
+	var id int64
+	var labelsJSON, propertiesJSON string
+	err = q.QueryRowContext(ctx, query, "$."+string(path), string(valueJSON)).Scan(&id, &labelsJSON, &propertiesJSON)
+	if err == sql.ErrNoRows {
+		return g.createNode(ctx, q, labels, properties)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert node: %w", err)
+	}
+
+	node := &Node{ID: id}
+	if labelsJSON != "" && labelsJSON != "[]" {
+		_ = json.Unmarshal([]byte(labelsJSON), &node.Labels)
+	}
+	if propertiesJSON != "" {
+		_ = json.Unmarshal([]byte(propertiesJSON), &node.Properties)
+	}
+	return node, nil
+}
+
 // CreateRelationship creates a relationship between two nodes
-func (g *GraphDB) CreateRelationship(ctx context.Context, startNodeID, endNodeID int64, relType string, properties map[string]interface{}) (*Relationship, error) {
+func (g *GraphDB) CreateRelationship(ctx context.Context, startNodeID, endNodeID int64, relType string, properties map[string]interface{}) (*Edge, error) {
+	return g.createRelationship(ctx, g.db, startNodeID, endNodeID, relType, properties)
+}
+
+func (g *GraphDB) createRelationship(ctx context.Context, q DBTX, startNodeID, endNodeID int64, relType string, properties map[string]interface{}) (*Edge, error) {
 	// Prepare properties as JSON string
 	propertiesJSON := "{}"
 	if len(properties) > 0 {
@@ -265,7 +322,7 @@ func (g *GraphDB) CreateRelationship(ctx context.Context, startNodeID, endNodeID
 	if g.vtAvailable {
 		// Insert through the virtual table interface with relationship validation
 		query := fmt.Sprintf("INSERT INTO %s (type, from_id, to_id, rel_type, weight, properties) VALUES (?, ?, ?, ?, ?, ?)", g.tableName)
-		result, err := g.db.ExecContext(ctx, query, "edge", startNodeID, endNodeID, relType, 1.0, propertiesJSON)
+		result, err := q.ExecContext(ctx, query, "edge", startNodeID, endNodeID, relType, 1.0, propertiesJSON)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create relationship: %w", err)
 		}
@@ -276,22 +333,22 @@ func (g *GraphDB) CreateRelationship(ctx context.Context, startNodeID, endNodeID
 		}
 		// Extract actual edge ID from encoded rowid (remove the edge bit flag)
 		actualRelID := relID & ^(1 << 62)
-		return &Relationship{ID: actualRelID, StartNode: startNodeID, EndNode: endNodeID, Type: relType, Properties: properties}, nil
+		return &Edge{ID: actualRelID, Src: startNodeID, Dst: endNodeID, Type: relType, Properties: properties}, nil
 	}
 	// Fallback: insert directly into backing edges table, with manual validation
 	// Validate start node
 	var exists int
-	if err := g.db.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE id=?", g.nodesTable), startNodeID).Scan(&exists); err != nil {
+	if err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE id=?", g.nodesTable), startNodeID).Scan(&exists); err != nil {
 		return nil, fmt.Errorf("failed to create relationship: start node %d not found", startNodeID)
 	}
 	// Validate end node
 	exists = 0
-	if err := g.db.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE id=?", g.nodesTable), endNodeID).Scan(&exists); err != nil {
+	if err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE id=?", g.nodesTable), endNodeID).Scan(&exists); err != nil {
 		return nil, fmt.Errorf("failed to create relationship: end node %d not found", endNodeID)
 	}
 
 	query := fmt.Sprintf("INSERT INTO %s (source, target, edge_type, weight, properties) VALUES (?, ?, ?, ?, ?)", g.edgesTable)
-	result, err := g.db.ExecContext(ctx, query, startNodeID, endNodeID, relType, 1.0, propertiesJSON)
+	result, err := q.ExecContext(ctx, query, startNodeID, endNodeID, relType, 1.0, propertiesJSON)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create relationship: %w", err)
 	}
@@ -299,15 +356,42 @@ func (g *GraphDB) CreateRelationship(ctx context.Context, startNodeID, endNodeID
 	if err != nil {
 		return nil, fmt.Errorf("failed to get relationship ID: %w", err)
 	}
-	return &Relationship{ID: relID, StartNode: startNodeID, EndNode: endNodeID, Type: relType, Properties: properties}, nil
+	return &Edge{ID: relID, Src: startNodeID, Dst: endNodeID, Type: relType, Properties: properties}, nil
+}
+
+// GetEdge returns the edge with the given ID, or nil if there is none.
+func (g *GraphDB) GetEdge(ctx context.Context, id int64) (*Edge, error) {
+	return g.getEdge(ctx, g.db, id)
+}
+
+// getEdge reads an edge through q, so callers inside a transaction see their
+// own writes.
+func (g *GraphDB) getEdge(ctx context.Context, q DBTX, id int64) (*Edge, error) {
+	row := q.QueryRowContext(ctx, fmt.Sprintf("SELECT id, source, target, edge_type, properties FROM %s WHERE id=?", g.edgesTable), id)
+	var edge Edge
+	var propertiesJSON sql.NullString
+	if err := row.Scan(&edge.ID, &edge.Src, &edge.Dst, &edge.Type, &propertiesJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get edge: %w", err)
+	}
+	if propertiesJSON.String != "" {
+		_ = json.Unmarshal([]byte(propertiesJSON.String), &edge.Properties)
+	}
+	return &edge, nil
 }
 
 // FindNodes finds nodes matching the given criteria
 func (g *GraphDB) FindNodes(ctx context.Context, labels []string, properties map[string]any) ([]*Node, error) {
+	return g.findNodes(ctx, g.db, labels, properties)
+}
+
+func (g *GraphDB) findNodes(ctx context.Context, q DBTX, labels []string, properties map[string]any) ([]*Node, error) {
 	// WORKAROUND: Query backing table directly due to virtual table cursor bug
 	// TODO: Switch back to virtual table once cursor is fixed
 	query := fmt.Sprintf("SELECT id, labels, properties FROM %s", g.nodesTable)
-	rows, err := g.db.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query nodes: %w", err)
 	}
@@ -391,7 +475,7 @@ func (g *GraphDB) FindNodes(ctx context.Context, labels []string, properties map
 }
 
 // FindRelationships finds relationships matching the given criteria
-func (g *GraphDB) FindRelationships(ctx context.Context, relType string, properties map[string]interface{}) ([]*Relationship, error) {
+func (g *GraphDB) FindRelationships(ctx context.Context, relType string, properties map[string]interface{}) ([]*Edge, error) {
 	// WORKAROUND: Query backing table directly due to virtual table cursor bug
 	// TODO: Switch back to virtual table once cursor is fixed
 	query := fmt.Sprintf("SELECT id, source, target, edge_type, weight, properties FROM %s", g.edgesTable)
@@ -401,7 +485,7 @@ func (g *GraphDB) FindRelationships(ctx context.Context, relType string, propert
 	}
 	defer rows.Close()
 
-	var relationships []*Relationship
+	var relationships []*Edge
 	for rows.Next() {
 		var id, fromID, toID int64
 		var edgeType, propertiesJSON string
@@ -429,10 +513,10 @@ func (g *GraphDB) FindRelationships(ctx context.Context, relType string, propert
 		}
 
 		// Create relationship from data
-		rel := &Relationship{
+		rel := &Edge{
 			ID:         id,
-			StartNode:  fromID,
-			EndNode:    toID,
+			Src:        fromID,
+			Dst:        toID,
 			Type:       actualRelType,
 			Properties: allProps,
 		}
@@ -463,20 +547,83 @@ func (g *GraphDB) FindRelationships(ctx context.Context, relType string, propert
 }
 
 func (g *GraphDB) DeleteNode(ctx context.Context, nodeID int64) error {
-	// Also delete relationships connected to this node
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", g.nodesTable)
-	_, err := g.db.ExecContext(ctx, query, nodeID)
-	if err != nil {
-		return fmt.Errorf("failed to delete node: %w", err)
-	}
+	return g.deleteNode(ctx, g.db, nodeID)
+}
 
-	query = fmt.Sprintf("DELETE FROM %s WHERE source = ? OR target = ?", g.edgesTable)
-	_, err = g.db.ExecContext(ctx, query, nodeID, nodeID)
-	if err != nil {
-		return fmt.Errorf("failed to delete relationships for node: %w", err)
-	}
+// deleteNode removes the node and its relationships in q as one unit.
+func (g *GraphDB) deleteNode(ctx context.Context, q DBTX, nodeID int64) error {
+	return inTx(ctx, q, func(q DBTX) error {
+		// Also delete relationships connected to this node
+		query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", g.nodesTable)
+		_, err := q.ExecContext(ctx, query, nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to delete node: %w", err)
+		}
 
-	return nil
+		query = fmt.Sprintf("DELETE FROM %s WHERE source = ? OR target = ?", g.edgesTable)
+		_, err = q.ExecContext(ctx, query, nodeID, nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to delete relationships for node: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// truncate removes every node and relationship in q as one unit.
+func (g *GraphDB) truncate(ctx context.Context, q DBTX) error {
+	return inTx(ctx, q, func(q DBTX) error {
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", g.edgesTable)); err != nil {
+			return err
+		}
+		_, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", g.nodesTable))
+		return err
+	})
+}
+
+// DefaultGraphIndexes are the indexes EnsureIndexes creates when given no
+// targets: the edge columns that neighbor lookups and path searches filter on.
+var DefaultGraphIndexes = []string{"source", "target", "edge_type"}
+
+// graphPropertyKey restricts property index keys to names that are safe to
+// place in a JSON path.
+var graphPropertyKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnsureIndexes creates the indexes named by targets if they do not exist and
+// returns their names. A target is an edge column ("source", "target" or
+// "edge_type"), "labels" for the node labels column, or "property:<key>" for
+// an expression index on json_extract(properties, '$.<key>') of nodes. No
+// targets means DefaultGraphIndexes.
+func (g *GraphDB) EnsureIndexes(ctx context.Context, targets ...string) ([]string, error) {
+	return g.ensureIndexes(ctx, g.db, targets...)
+}
+
+func (g *GraphDB) ensureIndexes(ctx context.Context, q DBTX, targets ...string) ([]string, error) {
+	if len(targets) == 0 {
+		targets = DefaultGraphIndexes
+	}
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		var table, name, expr string
+		switch target = strings.TrimSpace(target); target {
+		case "source", "target", "edge_type":
+			table, name, expr = g.edgesTable, g.edgesTable+"_"+target+"_idx", target
+		case "labels":
+			table, name, expr = g.nodesTable, g.nodesTable+"_labels_idx", "labels"
+		default:
+			key, ok := strings.CutPrefix(target, "property:")
+			if !ok || !graphPropertyKey.MatchString(key) {
+				return names, fmt.Errorf("unsupported graph index %q: want source, target, edge_type, labels or property:<key>", target)
+			}
+			table, name, expr = g.nodesTable, g.nodesTable+"_prop_"+key+"_idx", fmt.Sprintf("json_extract(properties, '$.%s')", key)
+		}
+		query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s(%s)", name, table, expr)
+		if _, err := q.ExecContext(ctx, query); err != nil {
+			return names, fmt.Errorf("failed to create graph index %s: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
 }
 
 // Apply applies a GraphUpdate operation to the graph
@@ -487,7 +634,7 @@ func (g *GraphDB) Apply(ctx context.Context, update GraphUpdate) error {
 		return err
 	case "create_relationship":
 		if update.RelData != nil {
-			_, err := g.CreateRelationship(ctx, update.RelData.StartNode, update.RelData.EndNode, update.RelData.Type, update.RelData.Properties)
+			_, err := g.CreateRelationship(ctx, update.RelData.Src, update.RelData.Dst, update.RelData.Type, update.RelData.Properties)
 			return err
 		}
 		return fmt.Errorf("missing relationship data for create_relationship operation")
@@ -498,10 +645,14 @@ func (g *GraphDB) Apply(ctx context.Context, update GraphUpdate) error {
 
 // Search performs a search query on the graph and returns matching results as strings
 func (g *GraphDB) Search(ctx context.Context, query string) ([]string, error) {
+	return g.search(ctx, g.db, query)
+}
+
+func (g *GraphDB) search(ctx context.Context, q DBTX, query string) ([]string, error) {
 	// For now, perform a simple search on nodes
 	// This is a placeholder implementation - in production you would want
 	// more sophisticated graph traversal/search capabilities
-	nodes, err := g.FindNodes(ctx, nil, nil)
+	nodes, err := g.findNodes(ctx, q, nil, nil)
 	if err != nil {
 		return nil, err
 	}
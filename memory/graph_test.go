@@ -82,9 +82,9 @@ func TestGraphVirtualTableIntegration(t *testing.T) {
 		if rel.ID <= 0 {
 			t.Error("Expected positive relationship ID")
 		}
-		if rel.StartNode != node1.ID || rel.EndNode != node2.ID {
+		if rel.Src != node1.ID || rel.Dst != node2.ID {
 			t.Errorf("Expected relationship from %d to %d, got from %d to %d",
-				node1.ID, node2.ID, rel.StartNode, rel.EndNode)
+				node1.ID, node2.ID, rel.Src, rel.Dst)
 		}
 		if rel.Type != "KNOWS" {
 			t.Errorf("Expected relationship type KNOWS, got %s", rel.Type)
@@ -136,6 +136,26 @@ func TestGraphVirtualTableIntegration(t *testing.T) {
 		}
 	})
 
+	// Test fetching an edge by ID
+	t.Run("GetEdge", func(t *testing.T) {
+		relationships, err := graph.FindRelationships(ctx, "KNOWS", nil)
+		if err != nil || len(relationships) == 0 {
+			t.Fatalf("Failed to find relationships: %v", err)
+		}
+		edge, err := graph.GetEdge(ctx, relationships[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get edge: %v", err)
+		}
+		if edge == nil || edge.Src != node1.ID || edge.Dst != node2.ID || edge.Type != "KNOWS" {
+			t.Errorf("Unexpected edge %+v", edge)
+		}
+
+		missing, err := graph.GetEdge(ctx, 999999)
+		if err != nil || missing != nil {
+			t.Errorf("Expected nil edge for unknown ID, got %+v (err %v)", missing, err)
+		}
+	})
+
 	// Test creating relationship with non-existent nodes (should fail)
 	t.Run("CreateRelationshipInvalidNodes", func(t *testing.T) {
 		_, err := graph.CreateRelationship(ctx, 999, 1000, "INVALID", nil)
@@ -144,3 +164,65 @@ func TestGraphVirtualTableIntegration(t *testing.T) {
 		}
 	})
 }
+
+func TestGraphEnsureIndexes(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDB(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	graph, err := NewGraphDB(ctx, db, "indexed")
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v", err)
+	}
+
+	indexes := func(table string) map[string]bool {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_index_list(?)", table)
+		if err != nil {
+			t.Fatalf("index_list %s: %v", table, err)
+		}
+		defer rows.Close()
+		names := map[string]bool{}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatalf("scan index name: %v", err)
+			}
+			names[name] = true
+		}
+		return names
+	}
+
+	if got := indexes("indexed_edges"); got["indexed_edges_edge_type_idx"] {
+		t.Fatal("edge_type index exists before EnsureIndexes")
+	}
+	// Repeating a target is a no-op rather than an error.
+	names, err := graph.EnsureIndexes(ctx, "edge_type", "property:email", "edge_type")
+	if err != nil {
+		t.Fatalf("EnsureIndexes: %v", err)
+	}
+	if len(names) != 3 || names[0] != "indexed_edges_edge_type_idx" || names[1] != "indexed_nodes_prop_email_idx" {
+		t.Fatalf("names = %v", names)
+	}
+	if got := indexes("indexed_edges"); !got["indexed_edges_edge_type_idx"] {
+		t.Errorf("edge indexes = %v, want indexed_edges_edge_type_idx", got)
+	}
+	if got := indexes("indexed_nodes"); !got["indexed_nodes_prop_email_idx"] {
+		t.Errorf("node indexes = %v, want indexed_nodes_prop_email_idx", got)
+	}
+
+	names, err = graph.EnsureIndexes(ctx)
+	if err != nil || len(names) != len(DefaultGraphIndexes) {
+		t.Fatalf("default EnsureIndexes = %v, %v", names, err)
+	}
+	if got := indexes("indexed_edges"); !got["indexed_edges_source_idx"] || !got["indexed_edges_target_idx"] {
+		t.Errorf("edge indexes = %v, want source and target indexes", got)
+	}
+
+	if _, err := graph.EnsureIndexes(ctx, "property:name'); DROP TABLE x; --"); err == nil {
+		t.Error("expected an unsafe property key to be rejected")
+	}
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Increment atomically adds by to the integer stored at key and returns the
+// new value. A missing key starts from zero. Existing values that are not
+// JSON integers are left unchanged and the call fails with ErrNotInteger.
+// Concurrent increments of the same key, from any connection, never lose an
+// update.
+func (d *Deps) Increment(ctx context.Context, key string, by int64) (int64, error) {
+	if d == nil || d.DB == nil {
+		return 0, notConfigured("KV database")
+	}
+	if _, err := d.dbtx().ExecContext(ctx, "CREATE TABLE IF NOT EXISTS kv(key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+		return 0, err
+	}
+	return incrementKV(ctx, d.dbtx(), key, by)
+}
+
+// incrementKV implements Increment in a single statement, so the read and
+// write cannot interleave with another writer. The WHERE clause skips the
+// update for non-integer values, which then return no row.
+func incrementKV(ctx context.Context, q DBTX, key string, by int64) (int64, error) {
+	var value int64
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO kv(key,value) VALUES(?,?)
+		 ON CONFLICT(key) DO UPDATE SET value = CAST(value AS INTEGER) + ?
+		 WHERE json_valid(value) AND json_type(value) = 'integer'
+		 RETURNING CAST(value AS INTEGER)`,
+		key, by, by).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: key %q", ErrNotInteger, key)
+	}
+	return value, err
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestIncrement(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:increment key="count" location="first"/>
+  <memory:increment key="count" by="4" location="second"/>
+  <memory:increment key="count" byexpr="step" location="third"/>
+  <memory:get key="count" location="stored"/>
+  <memory:put key="name" value="bob"/>
+  <memory:increment key="name" location="bad"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	dm.store["step"] = -2
+	ns, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := doc.DocumentElement().Children()
+	for i := uint(0); i < children.Length()-1; i++ {
+		if ok, err := ns.Handle(ctx, children.Item(i)); !ok || err != nil {
+			t.Fatalf("%s: ok=%v err=%v", children.Item(i).LocalName(), ok, err)
+		}
+	}
+	for loc, want := range map[string]int64{"first": 1, "second": 5, "third": 3} {
+		if got := dm.store[loc]; got != want {
+			t.Errorf("%s = %v (%T), want %d", loc, got, got, want)
+		}
+	}
+	if got := dm.store["stored"]; got != float64(3) {
+		t.Errorf("memory:get after increments = %v, want 3", got)
+	}
+
+	_, err = ns.Handle(ctx, children.Item(children.Length()-1))
+	if !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("expected ErrNotInteger for a string value, got %v", err)
+	}
+	if _, ok := dm.store["bad"]; ok {
+		t.Errorf("location assigned despite the error: %v", dm.store["bad"])
+	}
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	db, err := NewDBWithOptions(ctx, filepath.Join(t.TempDir(), "counter.db"), DBOptions{Pragmas: map[string]string{
+		"journal_mode": "WAL",
+		"busy_timeout": "5000",
+	}})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	deps := &Deps{DB: db}
+
+	const workers, each = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*each)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range each {
+				if _, err := deps.Increment(ctx, "hits", 1); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("increment: %v", err)
+	}
+
+	got, err := deps.Increment(ctx, "hits", 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got != workers*each {
+		t.Fatalf("final count = %d, want %d", got, workers*each)
+	}
+}
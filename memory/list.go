@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// withKVTx runs fn on the active transaction, or on a short-lived one that
+// is committed when fn succeeds.
+func (d *Deps) withKVTx(ctx context.Context, fn func(q DBTX) error) error {
+	if d.tx != nil {
+		return fn(d.tx)
+	}
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appendKV pushes v onto the list stored at key, creating the list when key
+// is missing. When maxLen is positive the oldest entries are dropped so at
+// most maxLen remain. It returns the stored list.
+func appendKV(ctx context.Context, q DBTX, key string, v any, maxLen int64) ([]any, error) {
+	list, err := loadList(ctx, q, key)
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, v)
+	if maxLen > 0 && int64(len(list)) > maxLen {
+		list = list[int64(len(list))-maxLen:]
+	}
+	return list, storeList(ctx, q, key, list)
+}
+
+// popKV removes the first or last entry of the list stored at key and
+// returns it with the remaining list. ok is false, and nothing is written,
+// when the list is empty or key is missing.
+func popKV(ctx context.Context, q DBTX, key string, first bool) (v any, rest []any, ok bool, err error) {
+	list, err := loadList(ctx, q, key)
+	if err != nil || len(list) == 0 {
+		return nil, nil, false, err
+	}
+	if first {
+		v, rest = list[0], list[1:]
+	} else {
+		v, rest = list[len(list)-1], list[:len(list)-1]
+	}
+	return v, rest, true, storeList(ctx, q, key, rest)
+}
+
+// loadList reads the JSON array stored at key for a read-modify-write in q.
+// A missing key is an empty list; any other non-array value fails with
+// ErrNotList.
+func loadList(ctx context.Context, q DBTX, key string) (list []any, err error) {
+	// A no-op write takes SQLite's write lock before the read, so concurrent
+	// writers serialize here instead of failing at commit or losing an update.
+	if _, err := q.ExecContext(ctx, "UPDATE kv SET value=value WHERE key=?", key); err != nil {
+		return nil, err
+	}
+	var raw string
+	err = q.QueryRowContext(ctx, "SELECT value FROM kv WHERE key=?", key).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(raw), &list); err != nil || list == nil {
+		return nil, fmt.Errorf("%w: key %q", ErrNotList, key)
+	}
+	return list, nil
+}
+
+func storeList(ctx context.Context, q DBTX, key string, list []any) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO kv(key,value) VALUES(?,?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", key, string(data))
+	return err
+}
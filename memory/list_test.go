@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// runList handles every child of the document root in order and returns the
+// data model the children assigned to.
+func runList(t *testing.T, body string) *fakeDM {
+	t.Helper()
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">` + body + `</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	dm.store["item"] = map[string]any{"id": float64(7)}
+	ns, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := doc.DocumentElement().Children()
+	for i := uint(0); i < children.Length(); i++ {
+		if ok, err := ns.Handle(ctx, children.Item(i)); !ok || err != nil {
+			t.Fatalf("%s %d: ok=%v err=%v", children.Item(i).LocalName(), i, ok, err)
+		}
+	}
+	return dm
+}
+
+func TestAppend(t *testing.T) {
+	t.Run("growth", func(t *testing.T) {
+		dm := runList(t, `
+  <memory:append key="log" value="a"/>
+  <memory:get key="log" location="one"/>
+  <memory:append key="log" value="b"/>
+  <memory:append key="log" valueexpr="item"/>
+  <memory:get key="log" location="three"/>`)
+		if got, want := dm.store["one"], []any{"a"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("after one append = %#v, want %#v", got, want)
+		}
+		want := []any{"a", "b", map[string]any{"id": float64(7)}}
+		if got := dm.store["three"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("after three appends = %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("maxlen", func(t *testing.T) {
+		dm := runList(t, `
+  <memory:append key="recent" value="1" maxlen="3"/>
+  <memory:append key="recent" value="2" maxlen="3"/>
+  <memory:append key="recent" value="3" maxlen="3"/>
+  <memory:append key="recent" value="4" maxlen="3"/>
+  <memory:append key="recent" value="5" maxlen="3"/>
+  <memory:get key="recent" location="full"/>
+  <memory:append key="recent" value="6" maxlen="1"/>
+  <memory:get key="recent" location="shrunk"/>`)
+		if got, want := dm.store["full"], []any{"3", "4", "5"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ring buffer = %#v, want %#v", got, want)
+		}
+		if got, want := dm.store["shrunk"], []any{"6"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("after lowering maxlen = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestPop(t *testing.T) {
+	dm := runList(t, `
+  <memory:append key="q" value="a"/>
+  <memory:append key="q" value="b"/>
+  <memory:append key="q" value="c"/>
+  <memory:append key="q" value="d"/>
+  <memory:pop key="q" location="last"/>
+  <memory:pop key="q" from="first" location="first"/>
+  <memory:pop key="q" from="last" location="next"/>
+  <memory:get key="q" location="rest"/>
+  <memory:pop key="q" location="final"/>
+  <memory:pop key="q" location="empty"/>
+  <memory:pop key="missing" location="none"/>`)
+	for loc, want := range map[string]any{"last": "d", "first": "a", "next": "c", "final": "b"} {
+		if got := dm.store[loc]; got != want {
+			t.Errorf("%s = %#v, want %#v", loc, got, want)
+		}
+	}
+	if got, want := dm.store["rest"], []any{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining list = %#v, want %#v", got, want)
+	}
+	for _, loc := range []string{"empty", "none"} {
+		if v, ok := dm.store[loc]; !ok || v != nil {
+			t.Errorf("%s = %#v (assigned %v), want nil", loc, v, ok)
+		}
+	}
+}
+
+func TestListNotArray(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:put key="name" value="bob"/>
+  <memory:append key="name" value="x"/>
+  <memory:pop key="name" location="popped"/>
+  <memory:get key="name" location="stored"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	ns, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := doc.DocumentElement().Children()
+	if _, err := ns.Handle(ctx, children.Item(0)); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	for i := uint(1); i <= 2; i++ {
+		if _, err := ns.Handle(ctx, children.Item(i)); !errors.Is(err, ErrNotList) {
+			t.Errorf("%s on a string: expected ErrNotList, got %v", children.Item(i).LocalName(), err)
+		}
+	}
+	if _, err := ns.Handle(ctx, children.Item(3)); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got := dm.store["stored"]; got != "bob" {
+		t.Errorf("stored value = %#v, want unchanged \"bob\"", got)
+	}
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metric names recorded by the memory namespace.
+const (
+	MetricOperations     = "memory.operations"
+	MetricKVSize         = "memory.kv.size"
+	MetricVectorCount    = "memory.vector.count"
+	MetricSearchDuration = "memory.search.duration"
+)
+
+// memoryMetrics holds the instruments for one Deps. Instruments that fail to
+// be created are left nil and skipped.
+type memoryMetrics struct {
+	operations     metric.Int64Counter
+	kvSize         metric.Int64Gauge
+	vectorCount    metric.Int64Gauge
+	searchDuration metric.Float64Histogram
+}
+
+func newMemoryMetrics(mp metric.MeterProvider) *memoryMetrics {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter("memory")
+	m := &memoryMetrics{}
+	var err error
+	if m.operations, err = meter.Int64Counter(MetricOperations,
+		metric.WithDescription("Memory operations executed, by operation"),
+		metric.WithUnit("{operation}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.kvSize, err = meter.Int64Gauge(MetricKVSize,
+		metric.WithDescription("Number of keys in the KV store"),
+		metric.WithUnit("{key}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.vectorCount, err = meter.Int64Gauge(MetricVectorCount,
+		metric.WithDescription("Number of vectors in the vector store"),
+		metric.WithUnit("{vector}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.searchDuration, err = meter.Float64Histogram(MetricSearchDuration,
+		metric.WithDescription("Latency of memory:search and memory:similarkeys"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+// metrics returns the instruments for d, created on first use from
+// d.MeterProvider.
+func (d *Deps) metrics() *memoryMetrics {
+	d.metricsOnce.Do(func() { d.meters = newMemoryMetrics(d.MeterProvider) })
+	return d.meters
+}
+
+// recordOperation records op, run against n.deps since start. Store sizes are
+// refreshed only after operations that change them.
+func (n *ns) recordOperation(ctx context.Context, op string, start time.Time, err error) {
+	if n.deps == nil {
+		return
+	}
+	m := n.deps.metrics()
+	opAttr := attribute.String("memory.operation", op)
+	if m.operations != nil {
+		m.operations.Add(ctx, 1, metric.WithAttributes(opAttr, attribute.Bool("error", err != nil)))
+	}
+	switch op {
+	case "search", "similarkeys":
+		if m.searchDuration != nil {
+			m.searchDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(opAttr))
+		}
+	case "put", "getorset", "increment", "append", "pop", "delete", "copy", "move", "kvtruncate":
+		if m.kvSize != nil && n.deps.DB != nil {
+			var count int64
+			if err := n.deps.dbtx().QueryRowContext(ctx, "SELECT COUNT(*) FROM kv").Scan(&count); err == nil {
+				m.kvSize.Record(ctx, count)
+			}
+		}
+	case "embed", "upsertvector", "deletevector", "deletevectors", "vectortruncate", "reembed":
+		if m.vectorCount != nil && n.deps.Vector != nil {
+			if count, err := n.deps.Vector.count(ctx, n.deps.dbtx()); err == nil {
+				m.vectorCount.Record(ctx, count)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// Migration is one schema change applied by Migrate.
+type Migration struct {
+	// Version orders the migration and records that it ran. Versions must
+	// be positive and unique.
+	Version int64
+	// SQL holds the statements to run, separated by semicolons.
+	SQL string
+}
+
+// Migrate applies, in ascending version order, each migration whose version
+// is not yet recorded in the schema_migrations table. Each migration runs in
+// its own transaction together with its record, so a migration that fails is
+// rolled back, leaves the recorded versions unchanged and stops the later
+// ones; the error wraps ErrMigrationFailed. Already applied versions are
+// skipped, so Migrate can be run at every start. It fails with
+// ErrInTransaction while a transaction opened by memory:begin or
+// memory:transaction is active.
+func (d *Deps) Migrate(ctx context.Context, migrations []Migration) error {
+	if d == nil || d.DB == nil {
+		return notConfigured("KV database")
+	}
+	if d.tx != nil {
+		return inTransaction("migrate")
+	}
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration version must be positive, got %d", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+
+	if _, err := d.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+		return err
+	}
+	applied := map[int64]bool{}
+	rows, err := d.DB.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range sorted {
+		if applied[m.Version] {
+			continue
+		}
+		if err := d.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("%w: version %d: %w", ErrMigrationFailed, m.Version, err)
+		}
+		d.logger().InfoContext(ctx, "memory: applied migration", "version", m.Version)
+	}
+	return nil
+}
+
+// applyMigration runs m and records its version in one transaction.
+func (d *Deps) applyMigration(ctx context.Context, m Migration) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if strings.TrimSpace(m.SQL) != "" {
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations(version) VALUES(?)", m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// execMigrate applies the <memory:migration version="N"> children of el,
+// whose text is the SQL to run.
+func (n *ns) execMigrate(ctx context.Context, el xmldom.Element) error {
+	var migrations []Migration
+	for child := el.FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if strings.ToLower(string(child.LocalName())) != "migration" {
+			return fmt.Errorf("migrate: unexpected child element %s", child.LocalName())
+		}
+		attr := strings.TrimSpace(string(child.GetAttribute("version")))
+		version, err := strconv.ParseInt(attr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate: invalid migration version %q", attr)
+		}
+		migrations = append(migrations, Migration{Version: version, SQL: string(child.TextContent())})
+	}
+	return n.deps.Migrate(ctx, migrations)
+}
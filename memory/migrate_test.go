@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="a" dsn=":memory:"/>
+  <memory:migrate db="a">
+    <memory:migration version="2">
+      ALTER TABLE notes ADD COLUMN tag TEXT;
+      CREATE INDEX notes_tag ON notes(tag);
+    </memory:migration>
+    <memory:migration version="1">CREATE TABLE notes(id INTEGER PRIMARY KEY, body TEXT)</memory:migration>
+  </memory:migrate>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	migrate := doc.DocumentElement().FirstElementChild().NextElementSibling()
+
+	// Re-running skips the applied versions, whose SQL would fail twice
+	for run := 1; run <= 2; run++ {
+		if ok, err := loaded.Handle(ctx, migrate); !ok || err != nil {
+			t.Fatalf("migrate run %d: %v", run, err)
+		}
+	}
+	deps, err := loaded.(*ns).ensureOpen(ctx, dm, "a")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	versions := func() []int64 {
+		rows, err := deps.DB.QueryContext(ctx, "SELECT version FROM schema_migrations ORDER BY version")
+		if err != nil {
+			t.Fatalf("versions: %v", err)
+		}
+		defer rows.Close()
+		var vs []int64
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			vs = append(vs, v)
+		}
+		return vs
+	}
+	if got := versions(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("versions = %v, want [1 2]", got)
+	}
+	if _, err := deps.DB.ExecContext(ctx, "INSERT INTO notes(body, tag) VALUES('a', 'b')"); err != nil {
+		t.Fatalf("migrated schema: %v", err)
+	}
+
+	// A failing migration rolls back its own statements and stops the rest
+	err = deps.Migrate(ctx, []Migration{
+		{Version: 3, SQL: "CREATE TABLE archive(id INTEGER); INSERT INTO missing VALUES(1)"},
+		{Version: 4, SQL: "CREATE TABLE later(id INTEGER)"},
+	})
+	if !errors.Is(err, ErrMigrationFailed) || !strings.Contains(err.Error(), "version 3") {
+		t.Fatalf("err = %v, want ErrMigrationFailed for version 3", err)
+	}
+	if got := versions(); len(got) != 2 {
+		t.Errorf("versions after failure = %v, want [1 2]", got)
+	}
+	for _, table := range []string{"archive", "later"} {
+		var n int
+		if err := deps.DB.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE name=?", table).Scan(&n); err != nil || n != 0 {
+			t.Errorf("table %s exists after failed migration (%v)", table, err)
+		}
+	}
+
+	if err := deps.Migrate(ctx, []Migration{{Version: 5}, {Version: 5}}); err == nil {
+		t.Error("expected an error for duplicate versions")
+	}
+}
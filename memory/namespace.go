@@ -4,16 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/internal/memoryspec"
 	"github.com/agentflare-ai/go-xmldom"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DBTX abstracts *sql.DB and *sql.Tx for Exec/Query operations.
@@ -31,8 +42,52 @@ func (d *Deps) dbtx() DBTX {
 	return d.DB
 }
 
+// logger returns the configured logger, falling back to the package default.
+func (d *Deps) logger() *slog.Logger {
+	if d != nil && d.Logger != nil {
+		return d.Logger
+	}
+	return slog.Default()
+}
+
+// embedder returns the embedder named by the element's provider attribute,
+// or the default Embed when it has none. The result is nil when no default
+// is configured; naming an unregistered provider is an error.
+func (d *Deps) embedder(el xmldom.Element) (EmbedFunc, error) {
+	provider := strings.TrimSpace(string(el.GetAttribute("provider")))
+	if provider == "" {
+		if d == nil {
+			return nil, nil
+		}
+		return d.withRetry(string(el.LocalName()), d.Embed), nil
+	}
+	var fn EmbedFunc
+	if d != nil {
+		fn = d.Embedders[provider]
+	}
+	if fn == nil {
+		var registered []string
+		if d != nil {
+			for name := range d.Embedders {
+				registered = append(registered, name)
+			}
+		}
+		sort.Strings(registered)
+		return nil, &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("memory: embedding provider %q is not registered", provider),
+			Data:      map[string]any{"element": string(el.LocalName()), "provider": provider, "registered": registered},
+			Cause:     fmt.Errorf("unknown embedding provider %q", provider),
+		}
+	}
+	return d.withRetry(string(el.LocalName()), fn), nil
+}
+
 // MemoryNamespaceURI is the XML namespace for memory executables.
-const MemoryNamespaceURI = "github.com/agentflare-ai/agentml-go/memory"
+const MemoryNamespaceURI = memoryspec.NamespaceURI
+
+// EmbedFunc computes the embedding for the provided text using the given model.
+type EmbedFunc func(ctx context.Context, model, text string) ([]float32, error)
 
 // Deps holds dependencies for memory executables.
 type Deps struct {
@@ -40,8 +95,30 @@ type Deps struct {
 	Graph       *GraphDB
 	Vector      *VectorDB
 	DefaultDims int
-	// Embed computes the embedding for the provided text using the given model.
-	Embed func(ctx context.Context, model, text string) ([]float32, error)
+	// Embed is the default embedder, used when an element names no provider.
+	Embed EmbedFunc
+	// Embedders holds additional embedders keyed by provider name, selected
+	// with the provider attribute of memory:embed, memory:search and
+	// memory:similarkeys.
+	Embedders map[string]EmbedFunc
+	// EmbedRetries is how many times a transient embedding failure is
+	// retried. Zero uses DefaultEmbedRetries; a negative value disables
+	// retrying.
+	EmbedRetries int
+	// EmbedBackoff is the delay before the first retry, doubled for each
+	// later one. Zero uses DefaultEmbedBackoff.
+	EmbedBackoff time.Duration
+	// IsTransient classifies embedding errors as retryable. Nil uses
+	// IsTransientEmbedError.
+	IsTransient func(error) bool
+	// Logger receives per-operation messages at Debug and failures at Warn.
+	// Nil uses slog.Default().
+	Logger *slog.Logger
+	// MeterProvider receives the namespace metrics (see MetricOperations).
+	// Nil uses the global provider.
+	MeterProvider metric.MeterProvider
+	metricsOnce   sync.Once
+	meters        *memoryMetrics
 	// internal transaction (single-session convenience). Production code would track tx per store.
 	tx *sql.Tx
 }
@@ -123,6 +200,27 @@ func Loader() agentml.NamespaceLoader {
 						dsn:     string(el.GetAttribute("dsn")),
 						dsnExpr: string(el.GetAttribute("dsnexpr")),
 					}
+					if v := strings.TrimSpace(string(el.GetAttribute("vector-max-count"))); v != "" {
+						maxCount, err := strconv.Atoi(v)
+						if err != nil || maxCount < 0 {
+							return nil, fmt.Errorf("memory:db '%s': invalid vector-max-count %q", id, v)
+						}
+						def.vectorMaxCount = maxCount
+					}
+					evict, err := ParseEvictPolicy(string(el.GetAttribute("vector-evict")))
+					if err != nil {
+						return nil, fmt.Errorf("memory:db '%s': %w", id, err)
+					}
+					def.vectorEvict = evict
+					quantization, err := ParseQuantization(string(el.GetAttribute("vector-quantization")))
+					if err != nil {
+						return nil, fmt.Errorf("memory:db '%s': %w", id, err)
+					}
+					def.vectorQuantization = quantization
+					def.hashKeysInTraces = boolAttr(el, "hash-keys-in-traces")
+					if def.pragmas, err = parsePragmas(string(el.GetAttribute("pragmas"))); err != nil {
+						return nil, fmt.Errorf("memory:db '%s': %w", id, err)
+					}
 					inst.dbDefs[id] = def
 					if inst.defaultDB == "" {
 						inst.defaultDB = id
@@ -145,6 +243,17 @@ func Loader() agentml.NamespaceLoader {
 type dbDef struct {
 	dsn     string
 	dsnExpr string
+	// vectorMaxCount and vectorEvict configure vector eviction (see
+	// VectorDB.SetEviction).
+	vectorMaxCount int
+	vectorEvict    EvictPolicy
+	// vectorQuantization is the vector storage format (see
+	// VectorDB.SetQuantization).
+	vectorQuantization Quantization
+	// hashKeysInTraces records keys on spans as SHA-256 hashes.
+	hashKeysInTraces bool
+	// pragmas are applied to every connection (see DBOptions.Pragmas).
+	pragmas map[string]string
 }
 
 type ns struct {
@@ -153,6 +262,63 @@ type ns struct {
 	dbs       map[string]*Deps       // opened databases by id
 	dbDefs    map[string]dbDef       // declared database definitions by id
 	defaultDB string                 // first declared db id or "default" implicit
+	watchers  []watcher              // registered by memory:watch
+	mu        sync.Mutex             // serializes element handling; see lock
+}
+
+// watcher raises event when a put or delete on db touches key, or any key
+// starting with prefix.
+type watcher struct {
+	db     string
+	key    string
+	prefix string
+	event  string
+}
+
+func (w watcher) matches(db, key string) bool {
+	if w.db != db {
+		return false
+	}
+	if w.key != "" {
+		return w.key == key
+	}
+	return strings.HasPrefix(key, w.prefix)
+}
+
+// errDatabaseClosed is the cause of errors raised when an element is handed
+// Deps whose stores have been closed, e.g. a handle kept after memory:close,
+// instead of dereferencing the nil stores.
+var errDatabaseClosed = errors.New("database closed; reopen required")
+
+func closedError(id string) error {
+	data := map[string]any{}
+	if id != "" {
+		data["db"] = id
+	}
+	return &agentml.PlatformError{
+		EventName: "error.execution",
+		Message:   "memory: " + errDatabaseClosed.Error(),
+		Data:      data,
+		Cause:     errDatabaseClosed,
+	}
+}
+
+// lockHeldKey marks a context whose caller holds the lock of the ns it
+// names, so elements nested in memory:transaction do not deadlock when
+// they are handled again through the interpreter.
+type lockHeldKey struct{}
+
+// lock acquires n.mu unless ctx shows it is already held by n, returning
+// the context to run under and the function that releases the lock.
+// Handling an element swaps n.deps and may drive the active transaction, so
+// elements from parallel regions run concurrently are serialized rather than
+// observing each other's database selection.
+func (n *ns) lock(ctx context.Context) (context.Context, func()) {
+	if held, _ := ctx.Value(lockHeldKey{}).(*ns); held == n {
+		return ctx, func() {}
+	}
+	n.mu.Lock()
+	return context.WithValue(ctx, lockHeldKey{}, n), n.mu.Unlock
 }
 
 var _ agentml.Namespace = (*ns)(nil)
@@ -170,13 +336,9 @@ func (n *ns) Handle(ctx context.Context, el xmldom.Element) (bool, error) {
 	case "db":
 		// Declaration only; handled during Loader
 		return true, nil
-	case "close", "put", "get", "delete", "copy", "move", "query",
-		"kvtruncate", "exec", "begin", "commit", "rollback", "savepoint", "release",
-		"sql", "embed", "upsertvector", "search", "deletevector", "vectorindex",
-		"addnode", "addedge", "getnode", "getedge", "deletenode", "deleteedge",
-		"neighbors", "getneighbors", "graphpath", "graphtruncate", "graphquery":
-		return true, n.execute(ctx, local, el)
 case "graph":
+		ctx, unlock := n.lock(ctx)
+		defer unlock()
 		// Legacy element needs DB selection too
 		dm := n.itp.DataModel()
 		if dm == nil {
@@ -191,7 +353,12 @@ case "graph":
 		defer func() { n.deps = prev }()
 		return true, n.execGraph(ctx, el)
 	default:
-		return false, nil
+		if !slices.Contains(memoryspec.Executable, local) {
+			return false, nil
+		}
+		ctx, unlock := n.lock(ctx)
+		defer unlock()
+		return true, n.execute(ctx, local, el)
 	}
 }
 
@@ -217,11 +384,43 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 		if err != nil {
 			return err
 		}
+		if deps.DB == nil {
+			if local == "close" {
+				// Closing twice is a no-op.
+				return nil
+			}
+			return closedError(n.dbID(deps))
+		}
 		prev := n.deps
 		n.deps = deps
 		defer func() { n.deps = prev }()
 	}
 
+	span.SetAttributes(
+		attribute.String(AttrDatabase, n.dbID(n.deps)),
+		attribute.String(AttrOperation, local),
+		attribute.Bool(AttrTransaction, n.deps != nil && n.deps.tx != nil),
+	)
+
+	raiseEvent, sendEvent := completionEvents(el)
+	rec := &resultRecorder{DataModel: dm, location: string(el.GetAttribute("location"))}
+
+	start := time.Now()
+	err := elementError(local, n.dispatch(ctx, local, el, rec))
+	n.recordOperation(ctx, local, start, err)
+	if count, ok := resultCount(rec); ok {
+		span.SetAttributes(attribute.Int(AttrResultCount, count))
+	}
+	if err != nil {
+		span.RecordError(err)
+	} else if raiseEvent != "" || sendEvent != "" {
+		err = elementError(local, n.notifyCompletion(ctx, local, raiseEvent, sendEvent, rec))
+	}
+	return err
+}
+
+// dispatch runs the operation for local against n.deps.
+func (n *ns) dispatch(ctx context.Context, local string, el xmldom.Element, dm agentml.DataModel) error {
 	switch local {
 	case "close":
 		return n.execClose(ctx, dm)
@@ -229,6 +428,14 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 		return n.execPut(ctx, el, dm)
 	case "get":
 		return n.execGet(ctx, el, dm)
+	case "getorset":
+		return n.execGetOrSet(ctx, el, dm)
+	case "increment":
+		return n.execIncrement(ctx, el, dm)
+	case "append":
+		return n.execAppend(ctx, el, dm)
+	case "pop":
+		return n.execPop(ctx, el, dm)
 	case "delete":
 		return n.execDelete(ctx, el, dm)
 	case "copy":
@@ -239,6 +446,10 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 		return n.execQuery(ctx, el, dm)
 	case "kvtruncate":
 		return n.execKVTruncate(ctx)
+	case "vacuum":
+		return n.deps.vacuum(ctx, boolAttr(el, "optimize"))
+	case "migrate":
+		return n.execMigrate(ctx, el)
 	case "exec":
 		return n.execSQL(ctx, el, dm)
 	case "begin":
@@ -259,8 +470,19 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 		return n.execUpsertVector(ctx, el, dm)
 	case "search":
 		return n.execSearch(ctx, el, dm)
+	case "similarkeys":
+		return n.execSimilarKeys(ctx, el, dm)
 	case "deletevector":
 		return n.execDeleteVector(ctx, el, dm)
+	case "deletevectors":
+		return n.execDeleteVectors(ctx, el, dm)
+	case "vectortruncate":
+		if n.deps == nil || n.deps.Vector == nil {
+			return notConfigured("vector store")
+		}
+		return n.deps.Vector.truncate(ctx, n.deps.dbtx())
+	case "reembed":
+		return n.execReembed(ctx, el, dm)
 	case "vectorindex":
 		// auto-initialized on open; treat as success
 		return nil
@@ -270,6 +492,8 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 		return n.execAddEdge(ctx, el, dm)
 	case "getnode":
 		return n.execGetNode(ctx, el, dm)
+	case "getnodes":
+		return n.execGetNodes(ctx, el, dm)
 	case "getedge":
 		return n.execGetEdge(ctx, el, dm)
 	case "deletenode":
@@ -280,10 +504,20 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 		return n.execNeighbors(ctx, el, dm)
 	case "graphpath":
 		return n.execGraphPath(ctx, el, dm)
+	case "subgraph":
+		return n.execSubgraph(ctx, el, dm)
 	case "graphtruncate":
 		return n.execGraphTruncate(ctx)
+	case "graphindex":
+		return n.execGraphIndex(ctx, el, dm)
 	case "graphquery":
 		return n.execGraphQuery(ctx, el, dm)
+	case "transaction":
+		return n.execTransaction(ctx, el)
+	case "use":
+		return n.execUse(ctx, el)
+	case "watch":
+		return n.execWatch(ctx, el, dm)
 	default:
 		return &agentml.PlatformError{
 			EventName: "error.execution",
@@ -296,6 +530,16 @@ func (n *ns) execute(ctx context.Context, local string, el xmldom.Element) error
 
 // ---- Database selection and lazy initialization ----
 
+// dbID returns the id under which deps is registered, or "".
+func (n *ns) dbID(deps *Deps) string {
+	for id, d := range n.dbs {
+		if d == deps {
+			return id
+		}
+	}
+	return ""
+}
+
 // selectDeps determines which DB to use for this element and lazily opens it if needed.
 func (n *ns) selectDeps(ctx context.Context, el xmldom.Element, dm agentml.DataModel) (*Deps, error) {
 	// 1) db attribute on the element
@@ -309,7 +553,17 @@ func (n *ns) selectDeps(ctx context.Context, el xmldom.Element, dm agentml.DataM
 			if !ok || pe == nil {
 				continue
 			}
-			if strings.ToLower(string(pe.LocalName())) == "db" && string(pe.NamespaceURI()) == MemoryNamespaceURI {
+			if string(pe.NamespaceURI()) != MemoryNamespaceURI {
+				continue
+			}
+			// A memory:transaction or memory:use with a db attribute scopes its children too
+			if local := strings.ToLower(string(pe.LocalName())); local == "transaction" || local == "use" {
+				if id := strings.TrimSpace(string(pe.GetAttribute("db"))); id != "" {
+					return n.ensureOpen(ctx, dm, id)
+				}
+				continue
+			}
+			if strings.ToLower(string(pe.LocalName())) == "db" {
 				id := strings.TrimSpace(string(pe.GetAttribute("id")))
 				if id != "" {
 					return n.ensureOpen(ctx, dm, id)
@@ -346,7 +600,8 @@ func (n *ns) ensureOpen(ctx context.Context, dm agentml.DataModel, id string) (*
 	}
 	// Resolve DSN lazily
 	var dsn string
-	if def, ok := n.dbDefs[id]; ok {
+	def, ok := n.dbDefs[id]
+	if ok {
 		if strings.TrimSpace(def.dsnExpr) != "" {
 			// Evaluate expression via data model
 			var err error
@@ -369,7 +624,7 @@ func (n *ns) ensureOpen(ctx context.Context, dm agentml.DataModel, id string) (*
 	}
 
 	// Open DB and initialize subsystems
-	db, err := NewDB(ctx, dsn)
+	db, err := NewDBWithOptions(ctx, dsn, DBOptions{Pragmas: def.pragmas})
 	if err != nil {
 		return nil, &agentml.PlatformError{
 			EventName: "error.execution",
@@ -408,6 +663,16 @@ func (n *ns) ensureOpen(ctx context.Context, dm agentml.DataModel, id string) (*
 			Cause:     err,
 		}
 	}
+	vector.SetEviction(def.vectorMaxCount, def.vectorEvict)
+	if err := vector.SetQuantization(ctx, def.vectorQuantization); err != nil {
+		_ = db.Close()
+		return nil, &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory: failed to set vector quantization",
+			Data:      map[string]any{"db": id},
+			Cause:     err,
+		}
+	}
 	deps := &Deps{DB: db, Graph: graph, Vector: vector, DefaultDims: 1536}
 	n.dbs[id] = deps
 	slog.InfoContext(ctx, "memory: database opened", "db", id)
@@ -418,7 +683,7 @@ func (n *ns) ensureOpen(ctx context.Context, dm agentml.DataModel, id string) (*
 
 func (n *ns) ensureKV(ctx context.Context) error {
 	if n.deps == nil || n.deps.DB == nil {
-		return fmt.Errorf("memory DB not configured")
+		return notConfigured("KV database")
 	}
 	_, err := n.deps.dbtx().ExecContext(ctx, "CREATE TABLE IF NOT EXISTS kv(key TEXT PRIMARY KEY, value TEXT)")
 	return err
@@ -426,6 +691,10 @@ func (n *ns) ensureKV(ctx context.Context) error {
 
 func (n *ns) execClose(ctx context.Context, dm agentml.DataModel) error {
 	if n.deps != nil {
+		if n.deps.tx != nil {
+			_ = n.deps.tx.Rollback()
+			n.deps.tx = nil
+		}
 		if n.deps.Graph != nil {
 			_ = n.deps.Graph.Close()
 			n.deps.Graph = nil
@@ -457,7 +726,7 @@ func (n *ns) execPut(ctx context.Context, el xmldom.Element, dm agentml.DataMode
 		return err
 	}
 	// Support both key and keyexpr
-	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	key, err := n.spanKey(ctx, dm, el)
 	if err != nil {
 		return err
 	}
@@ -491,8 +760,11 @@ func (n *ns) execPut(ctx context.Context, el xmldom.Element, dm agentml.DataMode
 	if err != nil {
 		return err
 	}
-	_, err = n.deps.dbtx().ExecContext(ctx, "INSERT INTO kv(key,value) VALUES(?,?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", key, string(data))
-	return err
+	if _, err := n.deps.dbtx().ExecContext(ctx, "INSERT INTO kv(key,value) VALUES(?,?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", key, string(data)); err != nil {
+		return err
+	}
+	n.notifyWatchers(ctx, "put", key, v)
+	return nil
 }
 
 func (n *ns) execGet(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
@@ -500,7 +772,7 @@ func (n *ns) execGet(ctx context.Context, el xmldom.Element, dm agentml.DataMode
 		return err
 	}
 	// Support both key and keyexpr
-	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	key, err := n.spanKey(ctx, dm, el)
 	if err != nil {
 		return err
 	}
@@ -509,30 +781,275 @@ func (n *ns) execGet(ctx context.Context, el xmldom.Element, dm agentml.DataMode
 	if loc == "" {
 		loc = string(el.GetAttribute("dataid"))
 	}
-	row := n.deps.dbtx().QueryRowContext(ctx, "SELECT value FROM kv WHERE key=?", key)
-	var s string
-	scanErr := row.Scan(&s)
-	if scanErr != nil {
-		assignIf(ctx, dm, loc, nil)
+	out, ok, err := lookupKV(ctx, n.deps.dbtx(), key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fallback, err := getDefault(ctx, dm, el)
+		if err != nil {
+			return err
+		}
+		assignIf(ctx, dm, loc, fallback)
 		return nil
 	}
-	var out any
-	_ = json.Unmarshal([]byte(s), &out)
 	assignIf(ctx, dm, loc, out)
 	return nil
 }
 
+// execGetOrSet assigns the value stored at key to location, evaluating
+// valueexpr and storing the result only when key is missing.
+func (n *ns) execGetOrSet(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if err := n.ensureKV(ctx); err != nil {
+		return err
+	}
+	key, err := n.spanKey(ctx, dm, el)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(key) == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "missing key or keyexpr",
+			Data:      map[string]any{"element": "getorset"},
+			Cause:     fmt.Errorf("missing key"),
+		}
+	}
+	valueExpr := string(el.GetAttribute("valueexpr"))
+	if valueExpr == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "missing valueexpr",
+			Data:      map[string]any{"element": "getorset"},
+			Cause:     fmt.Errorf("missing valueexpr"),
+		}
+	}
+	value, computed, err := getOrSetKV(ctx, n.deps.dbtx(), key, func() (any, error) {
+		return dm.EvaluateValue(ctx, valueExpr)
+	})
+	if err != nil {
+		return err
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), value)
+	if computed {
+		n.notifyWatchers(ctx, "put", key, value)
+	}
+	return nil
+}
+
+// execIncrement atomically adds by/byexpr (default 1) to the integer at key
+// and assigns the new value to location.
+func (n *ns) execIncrement(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if err := n.ensureKV(ctx); err != nil {
+		return err
+	}
+	key, err := n.spanKey(ctx, dm, el)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(key) == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "missing key or keyexpr",
+			Data:      map[string]any{"element": "increment"},
+			Cause:     fmt.Errorf("missing key"),
+		}
+	}
+	by := int64(1)
+	if el.HasAttribute("by") || el.HasAttribute("byexpr") {
+		if by, err = getIntOrExpr(ctx, dm, el, "by", "byexpr"); err != nil {
+			return err
+		}
+	}
+	value, err := incrementKV(ctx, n.deps.dbtx(), key, by)
+	if err != nil {
+		return err
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), value)
+	n.notifyWatchers(ctx, "put", key, value)
+	return nil
+}
+
+// execAppend pushes value or valueexpr onto the list stored at key. maxlen
+// bounds the list, dropping the oldest entries first.
+func (n *ns) execAppend(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if err := n.ensureKV(ctx); err != nil {
+		return err
+	}
+	key, err := n.spanKey(ctx, dm, el)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(key) == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "missing key or keyexpr",
+			Data:      map[string]any{"element": "append"},
+			Cause:     fmt.Errorf("missing key"),
+		}
+	}
+	var v any
+	if valExpr := string(el.GetAttribute("valueexpr")); valExpr != "" {
+		if v, err = dm.EvaluateValue(ctx, valExpr); err != nil {
+			return err
+		}
+	} else if val := string(el.GetAttribute("value")); val != "" {
+		v = val
+	} else {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "missing value or valueexpr",
+			Data:      map[string]any{"element": "append"},
+			Cause:     fmt.Errorf("missing value"),
+		}
+	}
+	maxLen, err := getIntOrExpr(ctx, dm, el, "maxlen", "maxlenexpr")
+	if err != nil {
+		return err
+	}
+	if maxLen < 0 {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("maxlen must not be negative, got %d", maxLen),
+			Data:      map[string]any{"element": "append", "attribute": "maxlen"},
+			Cause:     fmt.Errorf("negative maxlen"),
+		}
+	}
+	var list []any
+	if err := n.deps.withKVTx(ctx, func(q DBTX) error {
+		list, err = appendKV(ctx, q, key, v, maxLen)
+		return err
+	}); err != nil {
+		return err
+	}
+	n.notifyWatchers(ctx, "put", key, list)
+	return nil
+}
+
+// execPop removes the last entry of the list stored at key, or the first
+// with from="first", and assigns it to location. An empty or missing list
+// assigns null.
+func (n *ns) execPop(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if err := n.ensureKV(ctx); err != nil {
+		return err
+	}
+	key, err := n.spanKey(ctx, dm, el)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(key) == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "missing key or keyexpr",
+			Data:      map[string]any{"element": "pop"},
+			Cause:     fmt.Errorf("missing key"),
+		}
+	}
+	from := strings.TrimSpace(string(el.GetAttribute("from")))
+	if from != "" && from != "first" && from != "last" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("from must be first or last, got %q", from),
+			Data:      map[string]any{"element": "pop", "attribute": "from"},
+			Cause:     fmt.Errorf("invalid from"),
+		}
+	}
+	var (
+		v    any
+		rest []any
+		ok   bool
+	)
+	if err := n.deps.withKVTx(ctx, func(q DBTX) error {
+		v, rest, ok, err = popKV(ctx, q, key, from == "first")
+		return err
+	}); err != nil {
+		return err
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), v)
+	if ok {
+		n.notifyWatchers(ctx, "put", key, rest)
+	}
+	return nil
+}
+
+// getDefault returns the value memory:get assigns for a missing key:
+// defaultexpr evaluated, the literal default string, or nil when neither is
+// set. It is only evaluated when the key is missing.
+func getDefault(ctx context.Context, dm agentml.DataModel, el xmldom.Element) (any, error) {
+	if expr := string(el.GetAttribute("defaultexpr")); expr != "" {
+		return dm.EvaluateValue(ctx, expr)
+	}
+	if el.HasAttribute("default") {
+		return string(el.GetAttribute("default")), nil
+	}
+	return nil, nil
+}
+
 func (n *ns) execDelete(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if err := n.ensureKV(ctx); err != nil {
 		return err
 	}
 	// Support both key and keyexpr
-	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	key, err := n.spanKey(ctx, dm, el)
 	if err != nil {
 		return err
 	}
-	_, err = n.deps.dbtx().ExecContext(ctx, "DELETE FROM kv WHERE key=?", key)
-	return err
+	if _, err := n.deps.dbtx().ExecContext(ctx, "DELETE FROM kv WHERE key=?", key); err != nil {
+		return err
+	}
+	n.notifyWatchers(ctx, "delete", key, nil)
+	return nil
+}
+
+// execWatch registers a watcher on the selected database. Events are raised
+// as soon as the write executes, even inside a transaction that is later
+// rolled back.
+func (n *ns) execWatch(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	event, err := getStringOrExpr(ctx, dm, el, "event", "eventexpr")
+	if err != nil {
+		return err
+	}
+	key, err := n.spanKey(ctx, dm, el)
+	if err != nil {
+		return err
+	}
+	prefix, err := getStringOrExpr(ctx, dm, el, "prefix", "prefixexpr")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(event) == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:watch requires event or eventexpr",
+			Data:      map[string]any{"element": "watch"},
+			Cause:     fmt.Errorf("missing event"),
+		}
+	}
+	if (key == "") == (prefix == "") {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:watch requires exactly one of key or prefix",
+			Data:      map[string]any{"element": "watch", "key": key, "prefix": prefix},
+			Cause:     fmt.Errorf("invalid watch target"),
+		}
+	}
+	n.watchers = append(n.watchers, watcher{db: n.dbID(n.deps), key: key, prefix: prefix, event: event})
+	n.deps.logger().DebugContext(ctx, "memory: watch registered", "key", key, "prefix", prefix, "event", event)
+	return nil
+}
+
+// notifyWatchers raises the event of every watcher matching key with
+// {key, value, op}. value is nil for deletes.
+func (n *ns) notifyWatchers(ctx context.Context, op, key string, value any) {
+	if len(n.watchers) == 0 {
+		return
+	}
+	db := n.dbID(n.deps)
+	for _, w := range n.watchers {
+		if w.matches(db, key) {
+			raise(ctx, n.itp, w.event, map[string]any{"key": key, "value": value, "op": op})
+		}
+	}
 }
 
 func (n *ns) execCopy(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
@@ -564,10 +1081,22 @@ func (n *ns) execCopy(ctx context.Context, el xmldom.Element, dm agentml.DataMod
 	if srcKey == "" || dstKey == "" {
 		return fmt.Errorf("copy requires src/srckey and dst/dstkey attributes")
 	}
-	_, err = n.deps.dbtx().ExecContext(ctx,
+	return copyKV(ctx, n.deps.dbtx(), dstKey, srcKey)
+}
+
+// copyKV copies the value of srcKey to dstKey through q, failing with
+// ErrKeyNotFound when srcKey is not stored.
+func copyKV(ctx context.Context, q DBTX, dstKey, srcKey string) error {
+	res, err := q.ExecContext(ctx,
 		"INSERT INTO kv(key,value) SELECT ?, value FROM kv WHERE key=? ON CONFLICT(key) DO UPDATE SET value=excluded.value",
 		dstKey, srcKey)
-	return err
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, srcKey)
+	}
+	return nil
 }
 
 func (n *ns) execMove(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
@@ -602,9 +1131,7 @@ func (n *ns) execMove(ctx context.Context, el xmldom.Element, dm agentml.DataMod
 	// If a transaction is active, use it; otherwise create a short-lived transaction for atomicity
 	if n.deps != nil && n.deps.tx != nil {
 		// Copy then delete using active tx
-		if _, err := n.deps.tx.ExecContext(ctx,
-			"INSERT INTO kv(key,value) SELECT ?, value FROM kv WHERE key=? ON CONFLICT(key) DO UPDATE SET value=excluded.value",
-			dstKey, srcKey); err != nil {
+		if err := copyKV(ctx, n.deps.tx, dstKey, srcKey); err != nil {
 			return err
 		}
 		if _, err := n.deps.tx.ExecContext(ctx, "DELETE FROM kv WHERE key=?", srcKey); err != nil {
@@ -618,9 +1145,7 @@ func (n *ns) execMove(ctx context.Context, el xmldom.Element, dm agentml.DataMod
 		return err
 	}
 	defer tx.Rollback()
-	if _, err := tx.ExecContext(ctx,
-		"INSERT INTO kv(key,value) SELECT ?, value FROM kv WHERE key=? ON CONFLICT(key) DO UPDATE SET value=excluded.value",
-		dstKey, srcKey); err != nil {
+	if err := copyKV(ctx, tx, dstKey, srcKey); err != nil {
 		return err
 	}
 	if _, err := tx.ExecContext(ctx, "DELETE FROM kv WHERE key=?", srcKey); err != nil {
@@ -649,12 +1174,30 @@ func (n *ns) execQuery(ctx context.Context, el xmldom.Element, dm agentml.DataMo
 	if sqlStr == "" {
 		return fmt.Errorf("query requires sql/query attribute")
 	}
+	if boolAttr(el, "explain") {
+		return n.explain(ctx, dm, el, sqlStr, loc)
+	}
+	shape, _, err := resultShape(el)
+	if err != nil {
+		return err
+	}
 	rows, err := n.deps.dbtx().QueryContext(ctx, sqlStr)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
+	out, cols := scanRows(rows)
+	assignIf(ctx, dm, loc, shapeResult(out, cols, shape))
+	return nil
+}
+
+// scanRows reads all rows into maps keyed by column name. SQLite hands back
+// text as []byte in some cases, so valid UTF-8 byte values of columns that are
+// not declared BLOB are decoded as strings and then coerced to numbers when the
+// column is declared INTEGER or REAL.
+func scanRows(rows *sql.Rows) ([]map[string]any, []string) {
 	cols, _ := rows.Columns()
+	types, _ := rows.ColumnTypes()
 	var out []map[string]any
 	for rows.Next() {
 		scan := make([]any, len(cols))
@@ -667,12 +1210,41 @@ func (n *ns) execQuery(ctx context.Context, el xmldom.Element, dm agentml.DataMo
 		}
 		m := map[string]any{}
 		for i, c := range cols {
-			m[c] = scan[i]
+			declType := ""
+			if i < len(types) {
+				declType = types[i].DatabaseTypeName()
+			}
+			m[c] = coerceColumn(scan[i], declType)
 		}
 		out = append(out, m)
 	}
-	assignIf(ctx, dm, loc, out)
-	return nil
+	return out, cols
+}
+
+func coerceColumn(v any, declType string) any {
+	// SQLite affinity rules: BLOB anywhere in the declared type, or no
+	// declared type, means the value is stored as given; INT means integer;
+	// REAL, FLOA or DOUB mean real.
+	t := strings.ToUpper(declType)
+	s, ok := v.(string)
+	if b, isBytes := v.([]byte); isBytes && t != "" && !strings.Contains(t, "BLOB") && utf8.Valid(b) {
+		s, ok = string(b), true
+		v = s
+	}
+	if !ok {
+		return v
+	}
+	switch {
+	case strings.Contains(t, "INT"):
+		if i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			return i
+		}
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f
+		}
+	}
+	return v
 }
 
 func (n *ns) execKVTruncate(ctx context.Context) error {
@@ -685,7 +1257,7 @@ func (n *ns) execKVTruncate(ctx context.Context) error {
 
 func (n *ns) execBegin(ctx context.Context) error {
 	if n.deps == nil || n.deps.DB == nil {
-		return fmt.Errorf("memory DB not configured")
+		return notConfigured("KV database")
 	}
 	if n.deps.tx != nil {
 		return nil
@@ -716,14 +1288,101 @@ func (n *ns) execRollback(ctx context.Context) error {
 	return err
 }
 
-func (n *ns) execSavepoint(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
-	if n.deps == nil || n.deps.DB == nil {
-		return fmt.Errorf("memory DB not configured")
+// execTransaction runs the element's children inside a transaction that is
+// committed when they all succeed and rolled back on the first error. Nested
+// transactions use a savepoint on the active transaction.
+func (n *ns) execTransaction(ctx context.Context, el xmldom.Element) error {
+	deps := n.deps
+	if deps == nil || deps.DB == nil {
+		return notConfigured("KV database")
 	}
-	// Support both name and nameexpr
-	name, err := getStringOrExpr(ctx, dm, el, "name", "nameexpr")
-	if err != nil {
-		return err
+
+	run := func() error {
+		children := el.ChildNodes()
+		for i := uint(0); i < children.Length(); i++ {
+			child, ok := children.Item(i).(xmldom.Element)
+			if !ok || child == nil {
+				continue
+			}
+			if err := n.itp.ExecuteElement(ctx, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if deps.tx != nil {
+		name := fmt.Sprintf("tx_%d", time.Now().UnixNano())
+		if _, err := deps.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+			return err
+		}
+		if err := run(); err != nil {
+			if deps.tx != nil {
+				_, _ = deps.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+				_, _ = deps.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+			}
+			return err
+		}
+		if deps.tx == nil {
+			return fmt.Errorf("memory:transaction: transaction ended inside nested block")
+		}
+		_, err := deps.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+
+	tx, err := deps.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	deps.tx = tx
+	if err := run(); err != nil {
+		if deps.tx == tx {
+			_ = tx.Rollback()
+			deps.tx = nil
+		}
+		return err
+	}
+	if deps.tx != tx {
+		// A child committed or rolled back explicitly.
+		return nil
+	}
+	deps.tx = nil
+	return tx.Commit()
+}
+
+// execUse runs the element's children with its db as their default database.
+// The children resolve it by finding the element among their ancestors, as
+// with memory:transaction, so a nearer memory:use or db attribute wins.
+func (n *ns) execUse(ctx context.Context, el xmldom.Element) error {
+	if strings.TrimSpace(string(el.GetAttribute("db"))) == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:use requires a db attribute",
+			Data:      map[string]any{"element": "use", "attribute": "db"},
+			Cause:     fmt.Errorf("missing db"),
+		}
+	}
+	children := el.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		child, ok := children.Item(i).(xmldom.Element)
+		if !ok || child == nil {
+			continue
+		}
+		if err := n.itp.ExecuteElement(ctx, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ns) execSavepoint(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if n.deps == nil || n.deps.DB == nil {
+		return notConfigured("KV database")
+	}
+	// Support both name and nameexpr
+	name, err := getStringOrExpr(ctx, dm, el, "name", "nameexpr")
+	if err != nil {
+		return err
 	}
 	if name == "" {
 		name = "sp_" + fmt.Sprintf("%d", time.Now().UnixNano())
@@ -734,7 +1393,7 @@ func (n *ns) execSavepoint(ctx context.Context, el xmldom.Element, dm agentml.Da
 
 func (n *ns) execRelease(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.DB == nil {
-		return fmt.Errorf("memory DB not configured")
+		return notConfigured("KV database")
 	}
 	// Support both name and nameexpr
 	name, err := getStringOrExpr(ctx, dm, el, "name", "nameexpr")
@@ -748,6 +1407,28 @@ func (n *ns) execRelease(ctx context.Context, el xmldom.Element, dm agentml.Data
 	return err
 }
 
+// explain assigns SQLite's plan for sqlStr to loc instead of running it.
+// Each plan row is {id, parent, notused, detail}; detail holds nodes such as
+// "SCAN kv" or "SEARCH kv USING INDEX ...".
+func (n *ns) explain(ctx context.Context, dm agentml.DataModel, el xmldom.Element, sqlStr, loc string) error {
+	if loc == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("memory:%s explain=\"true\" requires location", el.LocalName()),
+			Data:      map[string]any{"element": string(el.LocalName())},
+			Cause:     fmt.Errorf("missing location"),
+		}
+	}
+	rows, err := n.deps.dbtx().QueryContext(ctx, "EXPLAIN QUERY PLAN "+sqlStr)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	plan, _ := scanRows(rows)
+	assignIf(ctx, dm, loc, plan)
+	return nil
+}
+
 func (n *ns) execSQL(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	// Handle both sql and sqlexpr attributes
 	sqlStr := string(el.GetAttribute("sql"))
@@ -767,36 +1448,49 @@ func (n *ns) execSQL(ctx context.Context, el xmldom.Element, dm agentml.DataMode
 	if loc == "" {
 		loc = string(el.GetAttribute("dataid"))
 	}
+	if boolAttr(el, "explain") {
+		return n.explain(ctx, dm, el, sqlStr, loc)
+	}
 	// If there's no location/dataid specified, it's an exec, not a query
 	if loc == "" {
 		// Execute the SQL statement (CREATE TABLE, INSERT, etc.)
-		_, err := n.deps.dbtx().ExecContext(ctx, sqlStr)
-		return err
+		res, err := n.deps.dbtx().ExecContext(ctx, sqlStr)
+		if err != nil {
+			return err
+		}
+		// Optionally report the statement result
+		if affectedLoc := string(el.GetAttribute("rows-affected-location")); affectedLoc != "" {
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			assignIf(ctx, dm, affectedLoc, affected)
+		}
+		if insertIDLoc := string(el.GetAttribute("last-insert-id-location")); insertIDLoc != "" {
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			assignIf(ctx, dm, insertIDLoc, id)
+		}
+		return nil
 	} else {
 		// Query and store results
+		shape, legacy, err := resultShape(el)
+		if err != nil {
+			return err
+		}
 		rows, err := n.deps.dbtx().QueryContext(ctx, sqlStr)
 		if err != nil {
 			return err
 		}
 		defer rows.Close()
-		cols, _ := rows.Columns()
-		var out []map[string]any
-		for rows.Next() {
-			scan := make([]any, len(cols))
-			ptrs := make([]any, len(cols))
-			for i := range scan {
-				ptrs[i] = &scan[i]
-			}
-			if err := rows.Scan(ptrs...); err != nil {
-				continue
-			}
-			m := map[string]any{}
-			for i, c := range cols {
-				m[c] = scan[i]
-			}
-			out = append(out, m)
+		out, cols := scanRows(rows)
+		// scalar="true" only applies to a single-row, single-column result
+		if legacy && (len(cols) != 1 || len(out) > 1) {
+			shape = ShapeRows
 		}
-		assignIf(ctx, dm, loc, out)
+		assignIf(ctx, dm, loc, shapeResult(out, cols, shape))
 		return nil
 	}
 }
@@ -804,11 +1498,16 @@ func (n *ns) execSQL(ctx context.Context, el xmldom.Element, dm agentml.DataMode
 // ---- Embeddings & Vectors ----
 
 func (n *ns) execEmbed(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
-	if n.deps == nil || n.deps.Embed == nil {
+	embed, err := n.deps.embedder(el)
+	if err != nil {
+		return err
+	}
+	if embed == nil {
 		return &agentml.PlatformError{
 			EventName: "error.execution",
 			Message:   "embedder_unavailable",
-			Cause:     fmt.Errorf("no embedder"),
+			Data:      map[string]any{"element": "embed"},
+			Cause:     ErrNoEmbedder,
 		}
 	}
 	// Support both model and modelexpr
@@ -823,19 +1522,24 @@ func (n *ns) execEmbed(ctx context.Context, el xmldom.Element, dm agentml.DataMo
 	}
 	loc := string(el.GetAttribute("location"))
 	// Support both key and keyexpr
-	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	key, err := n.spanKey(ctx, dm, el)
 	if err != nil {
 		return err
 	}
-	vec, err := n.deps.Embed(ctx, model, text)
+	vec, err := embed(ctx, model, text)
 	if err != nil {
 		return err
 	}
 	assignIf(ctx, dm, loc, vec)
 	// Optional upsert
 	if key != "" && n.deps.Vector != nil {
-		id := hashKey(key)
-		if err := n.deps.Vector.InsertVector(ctx, id, vec); err != nil {
+		err := inTx(ctx, n.deps.dbtx(), func(q DBTX) error {
+			if err := n.deps.Vector.upsertVectorByKey(ctx, q, key, vec, n.normalize(el)); err != nil {
+				return err
+			}
+			return n.deps.Vector.storeText(ctx, q, key, text)
+		})
+		if err != nil {
 			return err
 		}
 	}
@@ -844,10 +1548,10 @@ func (n *ns) execEmbed(ctx context.Context, el xmldom.Element, dm agentml.DataMo
 
 func (n *ns) execUpsertVector(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Vector == nil {
-		return fmt.Errorf("vector store not configured")
+		return notConfigured("vector store")
 	}
 	// Support both key and keyexpr
-	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	key, err := n.spanKey(ctx, dm, el)
 	if err != nil {
 		return err
 	}
@@ -870,12 +1574,25 @@ func (n *ns) execUpsertVector(ctx context.Context, el xmldom.Element, dm agentml
 	if !ok {
 		return fmt.Errorf("vector must evaluate to []number")
 	}
-	return n.deps.Vector.InsertVector(ctx, hashKey(key), arr)
+	return n.deps.Vector.upsertVectorByKey(ctx, n.deps.dbtx(), key, arr, n.normalize(el))
+}
+
+// normalize reports whether a vector written by el is L2-normalized, either
+// because el sets normalize="true" or the store normalizes every vector.
+func (n *ns) normalize(el xmldom.Element) bool {
+	return n.deps.Vector.normalize || boolAttr(el, "normalize")
 }
 
 func (n *ns) execSearch(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
-	if n.deps == nil || n.deps.Vector == nil || n.deps.Embed == nil {
-		return fmt.Errorf("vector search not available")
+	embed, err := n.deps.embedder(el)
+	if err != nil {
+		return err
+	}
+	if n.deps == nil || n.deps.Vector == nil {
+		return notConfigured("vector store")
+	}
+	if embed == nil {
+		return ErrNoEmbedder
 	}
 	// Support both model and modelexpr
 	model, err := getStringOrExpr(ctx, dm, el, "model", "modelexpr")
@@ -897,11 +1614,11 @@ func (n *ns) execSearch(ctx context.Context, el xmldom.Element, dm agentml.DataM
 	if strings.TrimSpace(topkStr) != "" {
 		fmt.Sscan(topkStr, &topk)
 	}
-	qvec, err := n.deps.Embed(ctx, model, text)
+	qvec, err := embed(ctx, model, text)
 	if err != nil {
 		return err
 	}
-	res, err := n.deps.Vector.SearchSimilarVectors(ctx, qvec, topk)
+	res, err := n.deps.Vector.searchSimilarVectors(ctx, n.deps.dbtx(), qvec, topk)
 	if err != nil {
 		return err
 	}
@@ -914,24 +1631,209 @@ func (n *ns) execSearch(ctx context.Context, el xmldom.Element, dm agentml.DataM
 	return nil
 }
 
+// execSimilarKeys embeds the query text, searches the vector store and
+// returns the nearest KV entries as {key, value, distance} objects, closest
+// first. It relies on embeddings having been stored under the same keys as
+// their KV values, e.g. with memory:embed key="..."; vectors stored without a
+// key are skipped, and keys whose KV entry is gone have a nil value.
+func (n *ns) execSimilarKeys(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	embed, err := n.deps.embedder(el)
+	if err != nil {
+		return err
+	}
+	if n.deps == nil || n.deps.Vector == nil {
+		return notConfigured("vector store")
+	}
+	if embed == nil {
+		return ErrNoEmbedder
+	}
+	if err := n.ensureKV(ctx); err != nil {
+		return err
+	}
+	// Support both model and modelexpr
+	model, err := getStringOrExpr(ctx, dm, el, "model", "modelexpr")
+	if err != nil {
+		return err
+	}
+	// Support both text and textexpr
+	text, err := getStringOrExpr(ctx, dm, el, "text", "textexpr")
+	if err != nil {
+		return err
+	}
+	loc := string(el.GetAttribute("location"))
+	// Support both topk and topkexpr
+	topkStr, err := getStringOrExpr(ctx, dm, el, "topk", "topkexpr")
+	if err != nil {
+		return err
+	}
+	topk := 5
+	if strings.TrimSpace(topkStr) != "" {
+		fmt.Sscan(topkStr, &topk)
+	}
+	qvec, err := embed(ctx, model, text)
+	if err != nil {
+		return err
+	}
+	res, err := n.deps.Vector.searchSimilarVectors(ctx, n.deps.dbtx(), qvec, topk)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(res))
+	for _, r := range res {
+		ids = append(ids, r.ID)
+	}
+	keys, err := n.deps.Vector.keysForIDs(ctx, n.deps.dbtx(), ids)
+	if err != nil {
+		return err
+	}
+
+	// Fetch all matched values in one query
+	values := make(map[string]any, len(keys))
+	if len(keys) > 0 {
+		args := make([]any, 0, len(keys))
+		for _, k := range keys {
+			args = append(args, k)
+		}
+		query := "SELECT key, value FROM kv WHERE key IN (?" + strings.Repeat(",?", len(args)-1) + ")"
+		rows, err := n.deps.dbtx().QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var k, raw string
+			if err := rows.Scan(&k, &raw); err != nil {
+				return err
+			}
+			var v any
+			_ = json.Unmarshal([]byte(raw), &v)
+			values[k] = v
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	outs := make([]map[string]any, 0, len(res))
+	for _, r := range res {
+		key, ok := keys[r.ID]
+		if !ok {
+			continue
+		}
+		outs = append(outs, map[string]any{"key": key, "value": values[key], "distance": r.Distance})
+	}
+	n.deps.logger().DebugContext(ctx, "memory: similarkeys", "results", len(res), "keyed", len(outs))
+	assignIf(ctx, dm, loc, outs)
+	return nil
+}
+
 func (n *ns) execDeleteVector(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Vector == nil {
-		return fmt.Errorf("vector store not configured")
+		return notConfigured("vector store")
 	}
 	// Support both key and keyexpr
-	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	key, err := n.spanKey(ctx, dm, el)
 	if err != nil {
 		return err
 	}
-	_, err = n.deps.dbtx().ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid=?", n.deps.Vector.tableName), int64(hashKey(key)))
-	return err
+	return n.deps.Vector.deleteVectorByKey(ctx, n.deps.dbtx(), key)
+}
+
+// execDeleteVectors deletes the vectors stored under every key in keysexpr
+// in one transaction and assigns the number deleted to location.
+func (n *ns) execDeleteVectors(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if n.deps == nil || n.deps.Vector == nil {
+		return notConfigured("vector store")
+	}
+	if filter := strings.TrimSpace(string(el.GetAttribute("filterexpr"))); filter != "" {
+		// The vector store keeps only keys and embeddings, so there is no
+		// metadata to match a filter against.
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:deletevectors filterexpr is not supported: vectors have no stored metadata",
+			Data:      map[string]any{"element": "deletevectors", "filterexpr": filter},
+			Cause:     fmt.Errorf("vector metadata not supported"),
+		}
+	}
+	keysExpr := strings.TrimSpace(string(el.GetAttribute("keysexpr")))
+	if keysExpr == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:deletevectors requires keysexpr",
+			Data:      map[string]any{"element": "deletevectors"},
+			Cause:     fmt.Errorf("missing keysexpr"),
+		}
+	}
+	keys, err := evalStrings(ctx, dm, keysExpr)
+	if err != nil {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:deletevectors failed to evaluate keysexpr",
+			Data:      map[string]any{"element": "deletevectors", "keysexpr": keysExpr},
+			Cause:     err,
+		}
+	}
+	deleted, err := n.deps.Vector.deleteVectorsByKeys(ctx, n.deps.dbtx(), keys)
+	if err != nil {
+		return err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("memory.vectors.keys", len(keys)),
+		attribute.Int64("memory.vectors.deleted", deleted),
+	)
+	n.deps.logger().DebugContext(ctx, "memory: vectors deleted", "keys", len(keys), "deleted", deleted)
+	assignIf(ctx, dm, string(el.GetAttribute("location")), deleted)
+	return nil
+}
+
+func (n *ns) execReembed(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if n.deps == nil || n.deps.Vector == nil {
+		return notConfigured("vector store")
+	}
+	embed, err := n.deps.embedder(el)
+	if err != nil {
+		return err
+	}
+	model, err := getStringOrExpr(ctx, dm, el, "model", "modelexpr")
+	if err != nil {
+		return err
+	}
+	batchSize, err := getIntOrExpr(ctx, dm, el, "batchsize", "batchsizeexpr")
+	if err != nil {
+		return err
+	}
+	progressEvent := string(el.GetAttribute("progressevent"))
+	res, err := n.deps.reembed(ctx, embed, model, int(batchSize), func(done, total int) {
+		raise(ctx, n.itp, progressEvent, map[string]any{"done": done, "total": total})
+	})
+	if err != nil {
+		return err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("memory.vectors.reembedded", res.Reembedded),
+		attribute.Int("memory.vectors.skipped", len(res.Skipped)),
+	)
+	if len(res.Skipped) > 0 {
+		n.deps.logger().WarnContext(ctx, "memory: reembed skipped keys without stored text", "count", len(res.Skipped), "keys", res.Skipped)
+	}
+	n.deps.logger().DebugContext(ctx, "memory: vectors reembedded", "model", model, "reembedded", res.Reembedded)
+	skipped := make([]any, len(res.Skipped))
+	for i, key := range res.Skipped {
+		skipped[i] = key
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), map[string]any{
+		"reembedded": res.Reembedded,
+		"skipped":    skipped,
+	})
+	return nil
 }
 
 // ---- Graph helpers ----
 
 func (n *ns) execAddNode(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
 	}
 	// Support both labels and labelsexpr
 	labelsStr, err := getStringOrExpr(ctx, dm, el, "labels", "labelsexpr")
@@ -946,7 +1848,12 @@ func (n *ns) execAddNode(ctx context.Context, el xmldom.Element, dm agentml.Data
 	} else if propsVal := string(el.GetAttribute("props")); propsVal != "" {
 		props, _ = evalMap(ctx, dm, propsVal)
 	}
-	node, err := n.deps.Graph.CreateNode(ctx, labels, props)
+	// Optional dedupkey/dedupkeyexpr: reuse the node whose property matches
+	dedupKey, err := getStringOrExpr(ctx, dm, el, "dedupkey", "dedupkeyexpr")
+	if err != nil {
+		return err
+	}
+	node, err := n.deps.Graph.upsertNode(ctx, n.deps.dbtx(), labels, props, strings.TrimSpace(dedupKey))
 	if err != nil {
 		return err
 	}
@@ -956,7 +1863,7 @@ func (n *ns) execAddNode(ctx context.Context, el xmldom.Element, dm agentml.Data
 
 func (n *ns) execAddEdge(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
 	}
 	// Support both src and srcexpr
 	src, err := getIntOrExpr(ctx, dm, el, "src", "srcexpr")
@@ -980,19 +1887,26 @@ func (n *ns) execAddEdge(ctx context.Context, el xmldom.Element, dm agentml.Data
 	} else if propsVal := string(el.GetAttribute("props")); propsVal != "" {
 		props, _ = evalMap(ctx, dm, propsVal)
 	}
-	slog.InfoContext(ctx, "memory: adding edge", "src", src, "dst", dst, "rel", rel)
-	_, err = n.deps.Graph.CreateRelationship(ctx, src, dst, rel, props)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("memory.edge.src", src),
+		attribute.Int64("memory.edge.dst", dst),
+		attribute.String("memory.edge.rel", rel),
+	)
+	log := n.deps.logger()
+	log.DebugContext(ctx, "memory: adding edge", "src", src, "dst", dst, "rel", rel)
+	created, err := n.deps.Graph.createRelationship(ctx, n.deps.dbtx(), src, dst, rel, props)
 	if err != nil {
-		slog.WarnContext(ctx, "memory: failed to add edge", "error", err)
+		log.WarnContext(ctx, "memory: failed to add edge", "error", err)
 		return err
 	}
-	slog.InfoContext(ctx, "memory: edge added")
+	log.DebugContext(ctx, "memory: edge added")
+	assignIf(ctx, dm, string(el.GetAttribute("location")), created)
 	return nil
 }
 
 func (n *ns) execGetNode(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
 	}
 	// Support both id and idexpr
 	id, err := getIntOrExpr(ctx, dm, el, "id", "idexpr")
@@ -1015,21 +1929,48 @@ func (n *ns) execGetNode(ctx context.Context, el xmldom.Element, dm agentml.Data
 	return nil
 }
 
+// execGetNodes fetches several nodes in one query. The result follows the
+// order of idsexpr; ids with no node yield nil entries.
+func (n *ns) execGetNodes(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if n.deps == nil || n.deps.Graph == nil {
+		return notConfigured("graph")
+	}
+	ids, err := evalInt64s(ctx, dm, string(el.GetAttribute("idsexpr")))
+	if err != nil {
+		return err
+	}
+	loc := string(el.GetAttribute("location"))
+	out := make([]*Node, len(ids))
+	if len(ids) == 0 {
+		assignIf(ctx, dm, loc, out)
+		return nil
+	}
+	byID, err := n.deps.Graph.nodesByID(ctx, n.deps.dbtx(), ids)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		out[i] = byID[id]
+	}
+	assignIf(ctx, dm, loc, out)
+	return nil
+}
+
 func (n *ns) execDeleteNode(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
 	}
 	// Support both id and idexpr
 	id, err := getIntOrExpr(ctx, dm, el, "id", "idexpr")
 	if err != nil {
 		return err
 	}
-	return n.deps.Graph.DeleteNode(ctx, id)
+	return n.deps.Graph.deleteNode(ctx, n.deps.dbtx(), id)
 }
 
 func (n *ns) execDeleteEdge(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
 	}
 	// Support both src and srcexpr
 	src, err := getIntOrExpr(ctx, dm, el, "src", "srcexpr")
@@ -1052,7 +1993,7 @@ func (n *ns) execDeleteEdge(ctx context.Context, el xmldom.Element, dm agentml.D
 
 func (n *ns) execNeighbors(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
 	}
 	// Support both id and idexpr
 	id, err := getIntOrExpr(ctx, dm, el, "id", "idexpr")
@@ -1083,17 +2024,22 @@ func (n *ns) execNeighbors(ctx context.Context, el xmldom.Element, dm agentml.Da
 			out = append(out, nid)
 		}
 	}
-	slog.InfoContext(ctx, "memory: neighbors computed", "count", len(out), "location", loc)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("memory.neighbors.id", id),
+		attribute.String("memory.neighbors.direction", dir),
+		attribute.Int("memory.neighbors.count", len(out)),
+	)
+	n.deps.logger().DebugContext(ctx, "memory: neighbors computed", "count", len(out), "location", loc)
 	assignIf(ctx, dm, loc, out)
 	return nil
 }
 
 func (n *ns) execGetEdge(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph database not configured")
+		return notConfigured("graph")
 	}
 	// Support both id and idexpr
-	id, err := getStringOrExpr(ctx, dm, el, "id", "idexpr")
+	id, err := getIntOrExpr(ctx, dm, el, "id", "idexpr")
 	if err != nil {
 		return err
 	}
@@ -1101,44 +2047,35 @@ func (n *ns) execGetEdge(ctx context.Context, el xmldom.Element, dm agentml.Data
 	if loc == "" {
 		loc = string(el.GetAttribute("dataid"))
 	}
-	// For now, use a simple query to get edge by ID
-	rows, err := n.deps.dbtx().QueryContext(ctx,
-		"SELECT id, source, target, edge_type, properties FROM relationships WHERE id = ?", id)
+	edge, err := n.deps.Graph.getEdge(ctx, n.deps.dbtx(), id)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	if rows.Next() {
-		var edge struct {
-			ID         string
-			Src        int64
-			Dst        int64
-			Rel        string
-			Properties string
-		}
-		err = rows.Scan(&edge.ID, &edge.Src, &edge.Dst, &edge.Rel, &edge.Properties)
-		if err != nil {
-			return err
-		}
-		var props map[string]interface{}
-		_ = json.Unmarshal([]byte(edge.Properties), &props)
-		assignIf(ctx, dm, loc, map[string]interface{}{
-			"id":         edge.ID,
-			"src":        edge.Src,
-			"dst":        edge.Dst,
-			"type":       edge.Rel,
-			"properties": props,
-		})
-	} else {
+	if edge == nil {
 		assignIf(ctx, dm, loc, nil)
+		return nil
 	}
+	assignIf(ctx, dm, loc, edge)
 	return nil
 }
 
+// traversalCheckInterval is how many dequeues a graph traversal performs
+// between context cancellation checks.
+const traversalCheckInterval = 32
+
+// traversalCancelled reports a graph traversal abandoned because ctx ended.
+func traversalCancelled(ctx context.Context, op string, visited int) error {
+	return &agentml.PlatformError{
+		EventName: "error.execution",
+		Message:   "memory: graph traversal cancelled",
+		Data:      map[string]any{"element": op, "visited": visited},
+		Cause:     ctx.Err(),
+	}
+}
+
 func (n *ns) execGraphPath(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph database not configured")
+		return notConfigured("graph")
 	}
 	// Support both src and srcexpr
 	src, err := getIntOrExpr(ctx, dm, el, "src", "srcexpr")
@@ -1165,7 +2102,10 @@ func (n *ns) execGraphPath(ctx context.Context, el xmldom.Element, dm agentml.Da
 	queue := []pathNode{{id: src, path: []int64{src}}}
 	visited[src] = true
 
-	for len(queue) > 0 {
+	for steps := 0; len(queue) > 0; steps++ {
+		if steps%traversalCheckInterval == 0 && ctx.Err() != nil {
+			return traversalCancelled(ctx, "graphpath", len(visited))
+		}
 		current := queue[0]
 		queue = queue[1:]
 
@@ -1178,6 +2118,9 @@ func (n *ns) execGraphPath(ctx context.Context, el xmldom.Element, dm agentml.Da
 		rows, err := n.deps.dbtx().QueryContext(ctx,
 			fmt.Sprintf("SELECT target FROM %s WHERE source=?", n.deps.Graph.edgesTable), current.id)
 		if err != nil {
+			if ctx.Err() != nil {
+				return traversalCancelled(ctx, "graphpath", len(visited))
+			}
 			continue
 		}
 
@@ -1191,35 +2134,115 @@ func (n *ns) execGraphPath(ctx context.Context, el xmldom.Element, dm agentml.Da
 			}
 		}
 		rows.Close()
+		// A cancelled query ends the rows early rather than failing the query
+		if rows.Err() != nil && ctx.Err() != nil {
+			return traversalCancelled(ctx, "graphpath", len(visited))
+		}
 	}
 
 	assignIf(ctx, dm, loc, nil) // No path found
 	return nil
 }
 
-func (n *ns) execGraphTruncate(ctx context.Context) error {
+func (n *ns) execSubgraph(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph database not configured")
+		return notConfigured("graph")
 	}
-	// Clear both nodes and relationships tables
-	_, err := n.deps.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", n.deps.Graph.edgesTable))
+	id, err := getIntOrExpr(ctx, dm, el, "id", "idexpr")
 	if err != nil {
 		return err
 	}
-	_, err = n.deps.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", n.deps.Graph.nodesTable))
-	return err
+	depth := int64(1)
+	if el.HasAttribute("depth") || el.HasAttribute("depthexpr") {
+		if depth, err = getIntOrExpr(ctx, dm, el, "depth", "depthexpr"); err != nil {
+			return err
+		}
+	}
+	dir, err := getStringOrExpr(ctx, dm, el, "direction", "directionexpr")
+	if err != nil {
+		return err
+	}
+	rel, err := getStringOrExpr(ctx, dm, el, "rel", "relexpr")
+	if err != nil {
+		return err
+	}
+	sub, err := n.deps.Graph.subgraph(ctx, n.deps.dbtx(), id, int(depth), SubgraphOptions{Direction: dir, Rel: rel})
+	if err != nil {
+		return err
+	}
+	if sub != nil {
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Int64("memory.subgraph.id", id),
+			attribute.Int64("memory.subgraph.depth", depth),
+			attribute.Int("memory.subgraph.nodes", len(sub.Nodes)),
+			attribute.Int("memory.subgraph.edges", len(sub.Edges)),
+		)
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), sub)
+	return nil
+}
+
+func (n *ns) execGraphIndex(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
+	if n.deps == nil || n.deps.Graph == nil {
+		return notConfigured("graph")
+	}
+	// Support both on and onexpr; targets are comma or space separated
+	on, err := getStringOrExpr(ctx, dm, el, "on", "onexpr")
+	if err != nil {
+		return err
+	}
+	targets := strings.FieldsFunc(on, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	names, err := n.deps.Graph.ensureIndexes(ctx, n.deps.dbtx(), targets...)
+	if err != nil {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "memory:graphindex failed: " + err.Error(),
+			Data:      map[string]any{"element": "graphindex", "on": on},
+			Cause:     err,
+		}
+	}
+	n.deps.logger().DebugContext(ctx, "memory: graph indexes ensured", "indexes", names)
+	out := make([]any, len(names))
+	for i, name := range names {
+		out[i] = name
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), out)
+	return nil
+}
+
+func (n *ns) execGraphTruncate(ctx context.Context) error {
+	if n.deps == nil || n.deps.Graph == nil {
+		return notConfigured("graph")
+	}
+	return n.deps.Graph.truncate(ctx, n.deps.dbtx())
 }
 
 func (n *ns) execGraphQuery(ctx context.Context, el xmldom.Element, dm agentml.DataModel) error {
 	if n.deps == nil || n.deps.Graph == nil {
-		return fmt.Errorf("graph not configured")
+		return notConfigured("graph")
+	}
+	shape, _, err := resultShape(el)
+	if err != nil {
+		return err
 	}
 	q := mustEvalString(ctx, dm, string(el.GetAttribute("pathexpr")))
-	res, err := n.deps.Graph.Search(ctx, q)
+	res, err := n.deps.Graph.search(ctx, n.deps.dbtx(), q)
 	if err != nil {
 		return err
 	}
-	assignIf(ctx, dm, string(el.GetAttribute("location")), res)
+	if shape == ShapeRows {
+		if res == nil {
+			res = []string{}
+		}
+		assignIf(ctx, dm, string(el.GetAttribute("location")), res)
+		return nil
+	}
+	// Other shapes see each match as a row with a single "node" column
+	rows := make([]map[string]any, len(res))
+	for i, r := range res {
+		rows[i] = map[string]any{"node": r}
+	}
+	assignIf(ctx, dm, string(el.GetAttribute("location")), shapeResult(rows, []string{"node"}, shape))
 	return nil
 }
 
@@ -1231,7 +2254,7 @@ func (n *ns) execGraph(ctx context.Context, el xmldom.Element) error {
 	defer span.End()
 
 	if n.deps == nil || n.deps.Graph == nil {
-		err := fmt.Errorf("memory graph dependency not configured")
+		err := notConfigured("graph")
 		span.SetStatus(codes.Error, err.Error())
 		return &agentml.PlatformError{
 			EventName: "error.execution",
@@ -1274,7 +2297,7 @@ func (n *ns) execGraph(ctx context.Context, el xmldom.Element) error {
 	switch op {
 	case "create_node", "add_node", "addnode", "create-node":
 		props, _ := evalMap(ctx, dm, propsExpr)
-		n, err := n.deps.Graph.CreateNode(ctx, labels, props)
+		n, err := n.deps.Graph.createNode(ctx, n.deps.dbtx(), labels, props)
 		if err != nil {
 			return &agentml.PlatformError{
 				EventName: "error.execution",
@@ -1292,11 +2315,15 @@ func (n *ns) execGraph(ctx context.Context, el xmldom.Element) error {
 		startID, _ := evalInt64(ctx, dm, startExpr)
 		endID, _ := evalInt64(ctx, dm, endExpr)
 		props, _ := evalMap(ctx, dm, propsExpr)
-		_, err := n.deps.Graph.CreateRelationship(ctx, startID, endID, relType, props)
-		return err
+		rel, err := n.deps.Graph.createRelationship(ctx, n.deps.dbtx(), startID, endID, relType, props)
+		if err != nil {
+			return err
+		}
+		assignIf(ctx, dm, out, rel)
+		return nil
 	case "find_nodes", "find-nodes":
 		props, _ := evalMap(ctx, dm, propsExpr)
-		nodes, err := n.deps.Graph.FindNodes(ctx, labels, props)
+		nodes, err := n.deps.Graph.findNodes(ctx, n.deps.dbtx(), labels, props)
 		if err != nil {
 			return &agentml.PlatformError{
 				EventName: "error.execution",
@@ -1312,10 +2339,10 @@ func (n *ns) execGraph(ctx context.Context, el xmldom.Element) error {
 		return nil
 	case "delete_node", "delete-node":
 		id, _ := evalInt64(ctx, dm, idExpr)
-		return n.deps.Graph.DeleteNode(ctx, id)
+		return n.deps.Graph.deleteNode(ctx, n.deps.dbtx(), id)
 	case "search", "graph-search":
 		query, _ := evalString(ctx, dm, queryExpr)
-		results, err := n.deps.Graph.Search(ctx, query)
+		results, err := n.deps.Graph.search(ctx, n.deps.dbtx(), query)
 		if err != nil {
 			return &agentml.PlatformError{
 				EventName: "error.execution",
@@ -1382,6 +2409,64 @@ func evalInt64(ctx context.Context, dm agentml.DataModel, expr string) (int64, e
 	if err != nil {
 		return 0, err
 	}
+	return toInt64(v)
+}
+
+// evalInt64s evaluates expr to an array of ids. An empty expression or a
+// null value yields no ids.
+func evalInt64s(ctx context.Context, dm agentml.DataModel, expr string) ([]int64, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	v, err := dm.EvaluateValue(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	switch s := v.(type) {
+	case nil:
+		return nil, nil
+	case []int64:
+		return s, nil
+	case []any:
+		out := make([]int64, len(s))
+		for i, item := range s {
+			if out[i], err = toInt64(item); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("expected array of ids, got %T", v)
+	}
+}
+
+// evalStrings evaluates expr to a list of strings.
+func evalStrings(ctx context.Context, dm agentml.DataModel, expr string) ([]string, error) {
+	v, err := dm.EvaluateValue(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	switch s := v.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return s, nil
+	case []any:
+		out := make([]string, len(s))
+		for i, item := range s {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string key at index %d, got %T", i, item)
+			}
+			out[i] = str
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("expected array of keys, got %T", v)
+	}
+}
+
+func toInt64(v any) (int64, error) {
 	switch n := v.(type) {
 	case int:
 		return int64(n), nil
@@ -1484,6 +2569,11 @@ func assignIf(ctx context.Context, dm agentml.DataModel, loc string, value any)
 	}
 }
 
+// boolAttr reports whether the attribute name is set to "true".
+func boolAttr(el xmldom.Element, name string) bool {
+	return strings.EqualFold(strings.TrimSpace(string(el.GetAttribute(xmldom.DOMString(name)))), "true")
+}
+
 func raise(ctx context.Context, interp agentml.Interpreter, name string, data map[string]any) {
 	if name == "" {
 		return
@@ -1,14 +1,23 @@
 package memory
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/agentflare-ai/agentml-go"
 	"github.com/agentflare-ai/go-xmldom"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
 type fakeDM struct{ store map[string]any }
@@ -41,7 +50,15 @@ func (f *fakeDM) ValidateExpression(ctx context.Context, expression string, expr
 	return nil
 }
 
-type fakeInterp struct{ dm *fakeDM }
+type fakeInterp struct {
+	dm *fakeDM
+	// ns, when set, receives elements passed to ExecuteElement.
+	ns agentml.Namespace
+	// raised records events passed to Raise.
+	raised []*agentml.Event
+	// sent records events passed to Send.
+	sent []*agentml.Event
+}
 
 func (fi *fakeInterp) Handle(ctx context.Context, event *agentml.Event) error { return nil }
 func (fi *fakeInterp) Location(ctx context.Context) (string, error) { return "", nil }
@@ -50,14 +67,23 @@ func (fi *fakeInterp) Shutdown(ctx context.Context) error { return nil }
 func (fi *fakeInterp) SessionID() string { return "" }
 func (fi *fakeInterp) Configuration() []string { return nil }
 func (fi *fakeInterp) In(ctx context.Context, stateId string) bool { return false }
-func (fi *fakeInterp) Raise(ctx context.Context, event *agentml.Event) {}
-func (fi *fakeInterp) Send(ctx context.Context, event *agentml.Event) error { return nil }
+func (fi *fakeInterp) Raise(ctx context.Context, event *agentml.Event) { fi.raised = append(fi.raised, event) }
+func (fi *fakeInterp) Send(ctx context.Context, event *agentml.Event) error {
+	fi.sent = append(fi.sent, event)
+	return nil
+}
 func (fi *fakeInterp) Cancel(ctx context.Context, sendId string) error { return nil }
 func (fi *fakeInterp) Log(ctx context.Context, label, message string) {}
 func (fi *fakeInterp) Context() context.Context { return context.Background() }
 func (fi *fakeInterp) Clock() agentml.Clock { return nil }
 func (fi *fakeInterp) DataModel() agentml.DataModel { return fi.dm }
-func (fi *fakeInterp) ExecuteElement(ctx context.Context, element xmldom.Element) error { return nil }
+func (fi *fakeInterp) ExecuteElement(ctx context.Context, element xmldom.Element) error {
+	if fi.ns == nil {
+		return nil
+	}
+	_, err := fi.ns.Handle(ctx, element)
+	return err
+}
 func (fi *fakeInterp) SendMessage(ctx context.Context, data agentml.SendData) error { return nil }
 func (fi *fakeInterp) ScheduleMessage(ctx context.Context, data agentml.SendData) (string, error) { return "", nil }
 func (fi *fakeInterp) InvokedSessions() map[string]agentml.Interpreter { return nil }
@@ -66,6 +92,11 @@ func (fi *fakeInterp) Snapshot(ctx context.Context, maybeConfig ...agentml.Snaps
 	return nil, nil
 }
 
+func (fi *fakeInterp) Root() agentml.Filesystem { return nil }
+func (fi *fakeInterp) AfterFunc(ctx context.Context, fn func()) func() bool {
+	return context.AfterFunc(ctx, fn)
+}
+
 func withTimeout(tb testing.TB) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), 5*time.Second)
 }
@@ -144,6 +175,62 @@ els = doc.DocumentElement().GetElementsByTagNameNS(xmldom.DOMString(MemoryNamesp
 	if v, _ := dm.GetVariable(ctx, "out"); v != "v" { t.Fatalf("got %v want 'v'", v) }
 }
 
+func TestGetDefault(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:put key="k" value="v"/>
+  <memory:get key="k" location="present" default="unused"/>
+  <memory:get key="missing" location="fromExpr" defaultexpr="emptyList"/>
+  <memory:get key="missing" location="fromLiteral" default="none"/>
+  <memory:get key="missing" location="noDefault"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	dm.store["emptyList"] = []any{}
+	dm.store["noDefault"] = "stale"
+	ns, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := doc.DocumentElement().Children()
+	for i := uint(0); i < children.Length(); i++ {
+		if ok, err := ns.Handle(ctx, children.Item(i)); !ok || err != nil {
+			t.Fatalf("%s: ok=%v err=%v", children.Item(i).LocalName(), ok, err)
+		}
+	}
+	if v := dm.store["present"]; v != "v" {
+		t.Errorf("present = %v, want stored value v", v)
+	}
+	if v, ok := dm.store["fromExpr"].([]any); !ok || len(v) != 0 {
+		t.Errorf("fromExpr = %#v, want empty list", dm.store["fromExpr"])
+	}
+	if v := dm.store["fromLiteral"]; v != "none" {
+		t.Errorf("fromLiteral = %v, want none", v)
+	}
+	if v, ok := dm.store["noDefault"]; !ok || v != nil {
+		t.Errorf("noDefault = %v, want nil", v)
+	}
+
+	// A row that cannot be read is an error, not a miss
+	broken, _ := xmldom.NewDecoder(strings.NewReader(`<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:exec sql="INSERT INTO kv(key, value) VALUES ('broken', NULL)"/>
+  <memory:get key="broken" location="broken" default="none"/>
+</agentml>`)).Decode()
+	exec := broken.DocumentElement().FirstElementChild()
+	if ok, err := ns.Handle(ctx, exec); !ok || err != nil {
+		t.Fatalf("exec: ok=%v err=%v", ok, err)
+	}
+	if _, err := ns.Handle(ctx, exec.NextElementSibling()); err == nil {
+		t.Errorf("get of an unreadable row = nil error, broken = %v", dm.store["broken"])
+	}
+	if _, ok := dm.store["broken"]; ok {
+		t.Errorf("broken = %v, want no default assigned on a read error", dm.store["broken"])
+	}
+}
+
 func TestPerDbIsolation(t *testing.T) {
 	ctx, cancel := withTimeout(t)
 	defer cancel()
@@ -230,4 +317,1422 @@ els := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), xmldom.
 	}
 	if dm.store["out"] != "v" { t.Fatalf("got %v want 'v'", dm.store["out"]) }
 	_ = os.Remove(dbFile)
-}
\ No newline at end of file
+}
+
+func TestClosedDepsReturnsError(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="a"/>
+  <memory:close db="a"/>
+  <memory:get db="a" key="k" location="out"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	deps, err := InitializeMemorySystem(ctx, ":memory:", 3)
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	inst := loaded.(*ns)
+	inst.dbs["a"] = deps
+
+	root := doc.DocumentElement()
+	closeEl, _ := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "close").Item(0).(xmldom.Element)
+	getEl, _ := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "get").Item(0).(xmldom.Element)
+	if ok, err := inst.Handle(ctx, closeEl); !ok || err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// A caller holding on to the closed handle must get an error, not a panic.
+	inst.dbs["a"] = deps
+	_, err = inst.Handle(ctx, getEl)
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || !errors.Is(err, errDatabaseClosed) {
+		t.Fatalf("expected database closed PlatformError, got %v", err)
+	}
+	if perr.Data["db"] != "a" {
+		t.Fatalf("expected db a in error data, got %v", perr.Data)
+	}
+	if ok, err := inst.Handle(ctx, closeEl); !ok || err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestAddNodeDedupKey(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:addnode labels="Person" propsexpr="alice" dedupkey="email" location="first"/>
+  <memory:addnode labels="Person" propsexpr="alice" dedupkey="email" location="second"/>
+  <memory:addnode labels="Person" propsexpr="bob" dedupkey="email" location="third"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	dm.store["alice"] = map[string]any{"email": "alice@example.com", "age": 30}
+	dm.store["bob"] = map[string]any{"email": "bob@example.com"}
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	els := doc.DocumentElement().GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "addnode")
+	for i := uint(0); i < els.Length(); i++ {
+		el, _ := els.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("addnode %d: %v", i, err)
+		}
+	}
+	first, _ := dm.store["first"].(*Node)
+	second, _ := dm.store["second"].(*Node)
+	third, _ := dm.store["third"].(*Node)
+	if first == nil || second == nil || third == nil {
+		t.Fatalf("expected nodes assigned, got %v %v %v", dm.store["first"], dm.store["second"], dm.store["third"])
+	}
+	if second.ID != first.ID {
+		t.Fatalf("expected dedup to return node %d, got %d", first.ID, second.ID)
+	}
+	if second.Properties["email"] != "alice@example.com" {
+		t.Fatalf("expected existing properties, got %v", second.Properties)
+	}
+	if third.ID == first.ID {
+		t.Fatalf("expected a new node for a different dedup value")
+	}
+}
+
+func TestSQLResultTyping(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:sql sql="CREATE TABLE people(name TEXT, age INTEGER, score REAL)"/>
+  <memory:sql sql="INSERT INTO people VALUES (CAST('alice' AS BLOB), CAST('42' AS BLOB), CAST('1.5' AS BLOB))"/>
+  <memory:sql sql="SELECT name, age, score FROM people" location="rows"/>
+  <memory:sql sql="SELECT count(*) AS n FROM people" location="count" scalar="true"/>
+  <memory:sql sql="SELECT name FROM people WHERE 0" location="missing" scalar="true"/>
+  <memory:sql sql="CREATE TABLE files(data BLOB, raw)"/>
+  <memory:sql sql="INSERT INTO files VALUES (CAST('abc' AS BLOB), CAST('42' AS BLOB))"/>
+  <memory:sql sql="SELECT data, raw FROM files" location="files"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	els := doc.DocumentElement().GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "sql")
+	for i := uint(0); i < els.Length(); i++ {
+		el, _ := els.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("sql %d: %v", i, err)
+		}
+	}
+
+	rows, _ := dm.store["rows"].([]map[string]any)
+	if len(rows) != 1 {
+		t.Fatalf("expected one row, got %v", dm.store["rows"])
+	}
+	t.Run("text", func(t *testing.T) {
+		if v, ok := rows[0]["name"].(string); !ok || v != "alice" {
+			t.Fatalf("expected name as string alice, got %T %v", rows[0]["name"], rows[0]["name"])
+		}
+	})
+	t.Run("integer", func(t *testing.T) {
+		if v, ok := rows[0]["age"].(int64); !ok || v != 42 {
+			t.Fatalf("expected age as int64 42, got %T %v", rows[0]["age"], rows[0]["age"])
+		}
+		if v, ok := rows[0]["score"].(float64); !ok || v != 1.5 {
+			t.Fatalf("expected score as float64 1.5, got %T %v", rows[0]["score"], rows[0]["score"])
+		}
+	})
+	t.Run("scalar", func(t *testing.T) {
+		if v, ok := dm.store["count"].(int64); !ok || v != 1 {
+			t.Fatalf("expected scalar count 1, got %T %v", dm.store["count"], dm.store["count"])
+		}
+		if v, ok := dm.store["missing"]; !ok || v != nil {
+			t.Fatalf("expected nil scalar for empty result, got %v (set=%v)", v, ok)
+		}
+	})
+	t.Run("blob", func(t *testing.T) {
+		files, _ := dm.store["files"].([]map[string]any)
+		if len(files) != 1 {
+			t.Fatalf("expected one file row, got %v", dm.store["files"])
+		}
+		for _, col := range []string{"data", "raw"} {
+			if _, ok := files[0][col].([]byte); !ok {
+				t.Errorf("expected %s kept as []byte, got %T %v", col, files[0][col], files[0][col])
+			}
+		}
+	})
+}
+
+func TestResultShapes(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	const query = "SELECT name, age FROM people ORDER BY age"
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:exec sql="CREATE TABLE people(name TEXT, age INTEGER)"/>
+  <memory:exec sql="INSERT INTO people VALUES ('bob', 35), ('alice', 30)"/>
+  <memory:query sql="` + query + `" location="rows"/>
+  <memory:query sql="` + query + `" location="columns" shape="columns"/>
+  <memory:sql sql="` + query + `" location="first" shape="first"/>
+  <memory:sql sql="` + query + `" location="scalar" shape="scalar"/>
+  <memory:query sql="` + query + ` LIMIT 0" location="noRows"/>
+  <memory:sql sql="` + query + ` LIMIT 0" location="noColumns" shape="columns"/>
+  <memory:query sql="` + query + ` LIMIT 0" location="noFirst" shape="first"/>
+  <memory:graphquery pathexpr="'*'" location="graphRows"/>
+  <memory:graphquery pathexpr="'*'" location="graphFirst" shape="first"/>
+  <memory:query sql="` + query + `" location="bad" shape="table"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	ns, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := doc.DocumentElement().Children()
+	for i := uint(0); i < children.Length()-1; i++ {
+		if ok, err := ns.Handle(ctx, children.Item(i)); !ok || err != nil {
+			t.Fatalf("%s %d: ok=%v err=%v", children.Item(i).LocalName(), i, ok, err)
+		}
+	}
+
+	alice := map[string]any{"name": "alice", "age": int64(30)}
+	bob := map[string]any{"name": "bob", "age": int64(35)}
+	for loc, want := range map[string]any{
+		"rows":       []map[string]any{alice, bob},
+		"columns":    map[string]any{"name": []any{"alice", "bob"}, "age": []any{int64(30), int64(35)}},
+		"first":      alice,
+		"scalar":     "alice",
+		"noRows":     []map[string]any{},
+		"noColumns":  map[string]any{"name": []any{}, "age": []any{}},
+		"graphRows":  []string{},
+		"noFirst":    nil,
+		"graphFirst": nil,
+	} {
+		got, ok := dm.store[loc]
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v (assigned %v), want %#v", loc, got, ok, want)
+		}
+	}
+
+	if _, err := ns.Handle(ctx, children.Item(children.Length()-1)); err == nil {
+		t.Error("expected an error for an unknown shape")
+	}
+}
+
+func TestExecReportsResult(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:exec sql="CREATE TABLE tasks(id INTEGER PRIMARY KEY, title TEXT, done INTEGER DEFAULT 0)"/>
+  <memory:exec sql="INSERT INTO tasks(title) VALUES ('a'), ('b')"/>
+  <memory:exec sql="INSERT INTO tasks(title) VALUES ('c')" last-insert-id-location="taskId"/>
+  <memory:exec sql="UPDATE tasks SET done = 1 WHERE title != 'b'" rows-affected-location="updated"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	els := doc.DocumentElement().GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "exec")
+	for i := uint(0); i < els.Length(); i++ {
+		el, _ := els.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("exec %d: %v", i, err)
+		}
+	}
+	if v, ok := dm.store["taskId"].(int64); !ok || v != 3 {
+		t.Fatalf("expected last insert id 3, got %T %v", dm.store["taskId"], dm.store["taskId"])
+	}
+	if v, ok := dm.store["updated"].(int64); !ok || v != 2 {
+		t.Fatalf("expected 2 rows affected, got %T %v", dm.store["updated"], dm.store["updated"])
+	}
+}
+
+func TestTransactionElement(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="a" dsn=":memory:?_foreign_keys=on"/>
+  <memory:db id="b" dsn=":memory:?_foreign_keys=on"/>
+  <memory:transaction id="failing" db="a">
+    <memory:put key="k1" value="v1"/>
+    <memory:sql sql="INSERT INTO missing_table VALUES (1)"/>
+  </memory:transaction>
+  <memory:transaction id="succeeding" db="a">
+    <memory:put key="k2" value="v2"/>
+    <memory:put key="k3" value="v3"/>
+  </memory:transaction>
+  <memory:get db="a" key="k1" location="out1"/>
+  <memory:get db="a" key="k2" location="out2"/>
+  <memory:get db="a" key="k3" location="out3"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	it.ns = ns
+
+	root := doc.DocumentElement()
+	txs := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "transaction")
+	failing, _ := txs.Item(0).(xmldom.Element)
+	succeeding, _ := txs.Item(1).(xmldom.Element)
+	if _, err := ns.Handle(ctx, failing); err == nil {
+		t.Fatalf("expected failing transaction to return the child error")
+	}
+	if ok, err := ns.Handle(ctx, succeeding); !ok || err != nil {
+		t.Fatalf("succeeding transaction: %v", err)
+	}
+	gets := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "get")
+	for i := uint(0); i < gets.Length(); i++ {
+		el, _ := gets.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("get: %v", err)
+		}
+	}
+	if v, ok := dm.store["out1"]; !ok || v != nil {
+		t.Fatalf("expected k1 rolled back, got %v", v)
+	}
+	if dm.store["out2"] != "v2" || dm.store["out3"] != "v3" {
+		t.Fatalf("expected committed values, got out2=%v out3=%v", dm.store["out2"], dm.store["out3"])
+	}
+}
+
+func TestUseElement(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="a" dsn=":memory:?_foreign_keys=on"/>
+  <memory:db id="b" dsn=":memory:?_foreign_keys=on"/>
+  <memory:use db="a">
+    <memory:put key="k" value="in-a"/>
+    <memory:put db="b" key="k" value="in-b"/>
+    <memory:use db="b">
+      <memory:put key="nested" value="in-b"/>
+    </memory:use>
+  </memory:use>
+  <memory:use db="b">
+    <memory:get key="k" location="fromB"/>
+    <memory:get key="nested" location="nestedB"/>
+  </memory:use>
+  <memory:get db="a" key="k" location="fromA"/>
+  <memory:get db="a" key="nested" location="nestedA"/>
+  <memory:use>
+    <memory:put key="k" value="nowhere"/>
+  </memory:use>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	it.ns = ns
+
+	root := doc.DocumentElement()
+	children := root.Children()
+	for i := uint(0); i < children.Length(); i++ {
+		child := children.Item(i)
+		if string(child.LocalName()) == "db" {
+			continue
+		}
+		_, err := ns.Handle(ctx, child)
+		if string(child.LocalName()) == "use" && child.GetAttribute("db") == "" {
+			if err == nil {
+				t.Errorf("expected memory:use without db to fail")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+	want := map[string]any{"fromA": "in-a", "fromB": "in-b", "nestedA": nil, "nestedB": "in-b"}
+	for loc, v := range want {
+		if got, ok := dm.store[loc]; !ok || got != v {
+			t.Errorf("%s = %v, want %v", loc, got, v)
+		}
+	}
+}
+
+func TestConcurrentHandle(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	const workers = 8
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="a" dsn=":memory:?_foreign_keys=on"/>
+  <memory:db id="b" dsn=":memory:?_foreign_keys=on"/>
+`)
+	for i := range workers {
+		db := []string{"a", "b"}[i%2]
+		fmt.Fprintf(&b, `  <memory:transaction db="%[1]s"><memory:put key="k%[2]d" value="v%[2]d"/></memory:transaction>
+  <memory:get db="%[1]s" key="k%[2]d" location="out%[2]d"/>
+`, db, i)
+	}
+	b.WriteString(`</agentml>`)
+	doc, err := xmldom.NewDecoder(strings.NewReader(b.String())).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	it.ns = ns
+
+	root := doc.DocumentElement()
+	txs := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "transaction")
+	gets := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "get")
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		tx, _ := txs.Item(uint(i)).(xmldom.Element)
+		get, _ := gets.Item(uint(i)).(xmldom.Element)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				for _, el := range []xmldom.Element{tx, get} {
+					if _, err := ns.Handle(ctx, el); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("handle: %v", err)
+	}
+	for i := range workers {
+		if got, want := dm.store[fmt.Sprintf("out%d", i)], fmt.Sprintf("v%d", i); got != want {
+			t.Errorf("out%d = %v, want %q", i, got, want)
+		}
+	}
+}
+
+func TestGraphWritesInTransaction(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:transaction>
+    <memory:addnode labels="Person" location="a"/>
+    <memory:sql sql="INSERT INTO missing_table VALUES (1)"/>
+  </memory:transaction>
+  <memory:begin/>
+  <memory:addnode labels="Person" location="b"/>
+  <memory:addnode labels="Person" location="c"/>
+  <memory:commit/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	it.ns = loaded
+	inst := loaded.(*ns)
+
+	children := []xmldom.Element{}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		children = append(children, child)
+	}
+	if _, err := inst.Handle(ctx, children[0]); err == nil {
+		t.Fatalf("expected failing transaction to return the child error")
+	}
+	for _, child := range children[1:4] {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+	dm.store["b"] = dm.store["b"].(*Node).ID
+	dm.store["c"] = dm.store["c"].(*Node).ID
+	edge, _ := xmldom.NewDecoder(strings.NewReader(`<memory:addedge xmlns:memory="github.com/agentflare-ai/agentml-go/memory" srcexpr="b" dstexpr="c" rel="KNOWS" location="edge"/>`)).Decode()
+	for _, el := range []xmldom.Element{edge.DocumentElement(), children[4]} {
+		if ok, err := inst.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("%s: %v", el.LocalName(), err)
+		}
+	}
+
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	nodes, err := deps.Graph.FindNodes(ctx, nil, nil)
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("nodes = %d (err %v), want b and c only", len(nodes), err)
+	}
+	rels, err := deps.Graph.FindRelationships(ctx, "KNOWS", nil)
+	if err != nil || len(rels) != 1 {
+		t.Fatalf("relationships = %d (err %v), want the committed edge", len(rels), err)
+	}
+}
+
+func TestAddEdgeLogsAtDebug(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:addnode labels="Person" location="a"/>
+  <memory:addnode labels="Person" location="b"/>
+  <memory:addedge srcexpr="a" dstexpr="b" rel="KNOWS"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	root := doc.DocumentElement()
+	nodes := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "addnode")
+	for i := uint(0); i < nodes.Length(); i++ {
+		el, _ := nodes.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("addnode %d: %v", i, err)
+		}
+	}
+	dm.store["a"] = dm.store["a"].(*Node).ID
+	dm.store["b"] = dm.store["b"].(*Node).ID
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(prev)
+
+	edge, _ := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "addedge").Item(0).(xmldom.Element)
+	if ok, err := ns.Handle(ctx, edge); !ok || err != nil {
+		t.Fatalf("addedge: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "level=INFO") {
+		t.Fatalf("expected no Info logs for addedge, got:\n%s", out)
+	}
+	if !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "memory: edge added") {
+		t.Fatalf("expected Debug log for addedge, got:\n%s", out)
+	}
+}
+
+func TestGetNodesPreservesOrder(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:addnode labels="Person" props="{}" location="a"/>
+  <memory:addnode labels="Person" props="{}" location="b"/>
+  <memory:addnode labels="Person" props="{}" location="c"/>
+  <memory:getnodes idsexpr="ids" location="out"/>
+  <memory:getnodes idsexpr="none" location="empty"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	ns, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	root := doc.DocumentElement()
+	adds := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "addnode")
+	for i := uint(0); i < adds.Length(); i++ {
+		el, _ := adds.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("addnode %d: %v", i, err)
+		}
+	}
+	a, b, c := dm.store["a"].(*Node), dm.store["b"].(*Node), dm.store["c"].(*Node)
+	dm.store["ids"] = []any{c.ID, a.ID, b.ID}
+	dm.store["none"] = []any{}
+	gets := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "getnodes")
+	for i := uint(0); i < gets.Length(); i++ {
+		el, _ := gets.Item(i).(xmldom.Element)
+		if ok, err := ns.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("getnodes %d: %v", i, err)
+		}
+	}
+	out, _ := dm.store["out"].([]*Node)
+	if len(out) != 3 {
+		t.Fatalf("expected 3 nodes, got %v", dm.store["out"])
+	}
+	for i, want := range []int64{c.ID, a.ID, b.ID} {
+		if out[i] == nil || out[i].ID != want {
+			t.Fatalf("position %d: expected node %d, got %v", i, want, out[i])
+		}
+	}
+	if empty, ok := dm.store["empty"].([]*Node); !ok || len(empty) != 0 {
+		t.Fatalf("expected empty result, got %v", dm.store["empty"])
+	}
+}
+
+// expiringCtx cancels its context once Err has been called more than limit
+// times, standing in for a context cancelled mid-traversal. Err is also called
+// from database/sql's goroutines, so the count is atomic.
+type expiringCtx struct {
+	context.Context
+	cancel context.CancelFunc
+	calls  atomic.Int32
+	limit  int32
+}
+
+func newExpiringCtx(parent context.Context, limit int32) *expiringCtx {
+	ctx, cancel := context.WithCancel(parent)
+	return &expiringCtx{Context: ctx, cancel: cancel, limit: limit}
+}
+
+func (c *expiringCtx) Err() error {
+	if c.calls.Add(1) > c.limit {
+		c.cancel()
+	}
+	return c.Context.Err()
+}
+
+func TestGraphPathHonorsCancellation(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:addnode labels="Start" location="start"/>
+  <memory:graphpath srcexpr="src" dstexpr="dst" location="path"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	root := doc.DocumentElement()
+	add, _ := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "addnode").Item(0).(xmldom.Element)
+	if ok, err := loaded.Handle(ctx, add); !ok || err != nil {
+		t.Fatalf("addnode: %v", err)
+	}
+	deps := loaded.(*ns).dbs["default"]
+	if deps == nil {
+		t.Fatalf("expected default db to be open")
+	}
+
+	// A long chain whose far end is unreachable keeps the BFS busy.
+	const chain = 2000
+	prev := dm.store["start"].(*Node)
+	for i := 0; i < chain; i++ {
+		next, err := deps.Graph.CreateNode(ctx, []string{"Step"}, nil)
+		if err != nil {
+			t.Fatalf("create node: %v", err)
+		}
+		if _, err := deps.Graph.CreateRelationship(ctx, prev.ID, next.ID, "NEXT", nil); err != nil {
+			t.Fatalf("create edge: %v", err)
+		}
+		prev = next
+	}
+	dm.store["src"] = dm.store["start"].(*Node).ID
+	dm.store["dst"] = int64(-1)
+
+	path, _ := root.GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "graphpath").Item(0).(xmldom.Element)
+	cctx := newExpiringCtx(ctx, 3)
+	defer cctx.cancel()
+	_, err = loaded.Handle(cctx, path)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	var pe *agentml.PlatformError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected PlatformError, got %T", err)
+	}
+	if visited, _ := pe.Data["visited"].(int); visited >= chain {
+		t.Fatalf("expected traversal to stop early, visited %d nodes", visited)
+	}
+	if _, ok := dm.store["path"]; ok {
+		t.Fatalf("expected no path assigned after cancellation")
+	}
+}
+
+func TestSimilarKeysReturnsNearestEntries(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:put key="cat" value="a small feline"/>
+  <memory:put key="dog" value="a loyal canine"/>
+  <memory:put key="car" value="a motor vehicle"/>
+  <memory:embed key="cat" text="cat" model="m"/>
+  <memory:embed key="dog" text="dog" model="m"/>
+  <memory:embed key="car" text="car" model="m"/>
+  <memory:similarkeys text="kitten" model="m" topk="2" location="out"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "similar_vectors", 3); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	embeddings := map[string][]float32{
+		"cat":    {1, 0, 0},
+		"dog":    {0, 1, 0},
+		"car":    {0, 0, 1},
+		"kitten": {0.9, 0.3, 0},
+	}
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		return embeddings[text], nil
+	}
+
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	out, _ := dm.store["out"].([]map[string]any)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 results, got %v", dm.store["out"])
+	}
+	if out[0]["key"] != "cat" || out[0]["value"] != "a small feline" {
+		t.Fatalf("expected cat first, got %v", out[0])
+	}
+	if out[1]["key"] != "dog" {
+		t.Fatalf("expected dog second, got %v", out[1])
+	}
+	if out[0]["distance"].(float64) > out[1]["distance"].(float64) {
+		t.Fatalf("results not ordered by distance: %v", out)
+	}
+}
+
+func TestEmbedSelectsProvider(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:embed text="x" model="m" location="byDefault"/>
+  <memory:embed provider="code" text="x" model="m" location="byCode"/>
+  <memory:embed provider="text" text="x" model="m" location="byText"/>
+  <memory:search provider="code" text="x" model="m" topk="1" location="hits"/>
+  <memory:embed provider="audio" text="x" model="m" location="byAudio"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "provider_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	constant := func(v ...float32) EmbedFunc {
+		return func(ctx context.Context, model, text string) ([]float32, error) { return v, nil }
+	}
+	deps.Embed = constant(1, 1)
+	deps.Embedders = map[string]EmbedFunc{"code": constant(1, 0), "text": constant(0, 1)}
+	if err := deps.Vector.UpsertVectorByKey(ctx, "snippet", []float32{1, 0}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	children := []xmldom.Element{}
+	for c := doc.DocumentElement().FirstElementChild(); c != nil; c = c.NextElementSibling() {
+		children = append(children, c)
+	}
+	for _, el := range children[:4] {
+		if ok, err := inst.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("%s: %v", el.GetAttribute("location"), err)
+		}
+	}
+	for loc, want := range map[string][]float32{"byDefault": {1, 1}, "byCode": {1, 0}, "byText": {0, 1}} {
+		got, _ := dm.store[loc].([]float32)
+		if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s = %v, want %v", loc, dm.store[loc], want)
+		}
+	}
+	if hits, _ := dm.store["hits"].([]map[string]any); len(hits) != 1 || hits[0]["distance"].(float64) != 0 {
+		t.Errorf("expected an exact hit via the code provider, got %v", dm.store["hits"])
+	}
+
+	_, err = inst.Handle(ctx, children[4])
+	var pe *agentml.PlatformError
+	if !errors.As(err, &pe) || pe.Data["provider"] != "audio" {
+		t.Fatalf("expected unregistered provider error, got %v", err)
+	}
+}
+
+// recordingMeter captures the measurements memory records.
+type recordingMeter struct {
+	noop.Meter
+	counts  map[string]int64
+	gauges  map[string]int64
+	samples map[string]int
+}
+
+func (m *recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return recordingCounter{m: m}, nil
+}
+
+func (m *recordingMeter) Int64Gauge(name string, _ ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	return recordingGauge{m: m, name: name}, nil
+}
+
+func (m *recordingMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return recordingHistogram{m: m, name: name}, nil
+}
+
+type recordingCounter struct {
+	noop.Int64Counter
+	m *recordingMeter
+}
+
+func (c recordingCounter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	attrs := metric.NewAddConfig(opts).Attributes()
+	op, _ := attrs.Value("memory.operation")
+	c.m.counts[op.AsString()] += incr
+}
+
+type recordingGauge struct {
+	noop.Int64Gauge
+	m    *recordingMeter
+	name string
+}
+
+func (g recordingGauge) Record(ctx context.Context, value int64, _ ...metric.RecordOption) {
+	g.m.gauges[g.name] = value
+}
+
+type recordingHistogram struct {
+	noop.Float64Histogram
+	m    *recordingMeter
+	name string
+}
+
+func (h recordingHistogram) Record(ctx context.Context, value float64, _ ...metric.RecordOption) {
+	h.m.samples[h.name]++
+}
+
+type recordingProvider struct {
+	noop.MeterProvider
+	meter *recordingMeter
+}
+
+func (p recordingProvider) Meter(string, ...metric.MeterOption) metric.Meter { return p.meter }
+
+func TestMetricsRecordOperations(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:put key="a" value="1"/>
+  <memory:put key="b" value="2"/>
+  <memory:get key="a" location="out"/>
+  <memory:delete key="b"/>
+  <memory:embed key="a" text="a" model="m"/>
+  <memory:search text="a" model="m" location="hits"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "metric_vectors", 3); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		return []float32{1, 0, 0}, nil
+	}
+	meter := &recordingMeter{counts: map[string]int64{}, gauges: map[string]int64{}, samples: map[string]int{}}
+	deps.MeterProvider = recordingProvider{meter: meter}
+
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	want := map[string]int64{"put": 2, "get": 1, "delete": 1, "embed": 1, "search": 1}
+	for op, n := range want {
+		if meter.counts[op] != n {
+			t.Errorf("%s count = %d, want %d (all: %v)", op, meter.counts[op], n, meter.counts)
+		}
+	}
+	if got := meter.gauges[MetricKVSize]; got != 1 {
+		t.Errorf("%s = %d, want 1", MetricKVSize, got)
+	}
+	if got := meter.gauges[MetricVectorCount]; got != 1 {
+		t.Errorf("%s = %d, want 1", MetricVectorCount, got)
+	}
+	if got := meter.samples[MetricSearchDuration]; got != 1 {
+		t.Errorf("%s samples = %d, want 1", MetricSearchDuration, got)
+	}
+}
+
+func TestWatchRaisesOnWrite(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:watch key="status" event="status.changed"/>
+  <memory:watch prefix="user:" event="user.changed"/>
+  <memory:put key="other" value="x"/>
+  <memory:put key="status" value="ready"/>
+  <memory:put key="user:1" value="ada"/>
+  <memory:delete key="status"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := loaded.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	want := []struct {
+		name, key, op string
+		value         any
+	}{
+		{"status.changed", "status", "put", "ready"},
+		{"user.changed", "user:1", "put", "ada"},
+		{"status.changed", "status", "delete", nil},
+	}
+	if len(it.raised) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), it.raised)
+	}
+	for i, w := range want {
+		ev := it.raised[i]
+		data := ev.Data.(map[string]any)
+		if ev.Name != w.name || ev.Type != agentml.EventTypeInternal || data["key"] != w.key || data["op"] != w.op || data["value"] != w.value {
+			t.Errorf("event %d = %s %+v, want %s %+v", i, ev.Name, data, w.name, w)
+		}
+	}
+}
+
+func TestCompletionEvents(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:put key="plain" value="x"/>
+  <memory:put key="status" value="ready" raise-event="memory.put.done"/>
+  <memory:get key="status" location="status" send-event="memory.get.done"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := loaded.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	if len(it.raised) != 1 {
+		t.Fatalf("expected one raised event, got %+v", it.raised)
+	}
+	ev := it.raised[0]
+	data := ev.Data.(map[string]any)
+	if ev.Name != "memory.put.done" || ev.Type != agentml.EventTypeInternal || data["op"] != "put" {
+		t.Errorf("raised %s %+v, want memory.put.done for put", ev.Name, data)
+	}
+	if _, ok := data["result"]; ok {
+		t.Errorf("expected no result for an operation without location, got %+v", data)
+	}
+
+	if len(it.sent) != 1 {
+		t.Fatalf("expected one sent event, got %+v", it.sent)
+	}
+	ev = it.sent[0]
+	data = ev.Data.(map[string]any)
+	if ev.Name != "memory.get.done" || ev.Type != agentml.EventTypeExternal || data["op"] != "get" || data["result"] != "ready" {
+		t.Errorf("sent %s %+v, want memory.get.done with result ready", ev.Name, data)
+	}
+}
+
+func TestEdgeResultsAreTyped(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:addnode labels="Person" location="alice"/>
+  <memory:addnode labels="Person" location="bob"/>
+  <memory:addedge srcexpr="aliceID" dstexpr="bobID" rel="KNOWS" propsexpr="props" location="created"/>
+  <memory:getedge idexpr="edgeID" location="fetched"/>
+  <memory:getedge id="999" location="missing"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	dm.store["props"] = map[string]any{"since": "2020"}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		switch child.LocalName() {
+		case "addedge":
+			dm.store["aliceID"] = dm.store["alice"].(*Node).ID
+			dm.store["bobID"] = dm.store["bob"].(*Node).ID
+		case "getedge":
+			if created, ok := dm.store["created"].(*Edge); ok {
+				dm.store["edgeID"] = created.ID
+			}
+		}
+		if ok, err := loaded.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	alice, bob := dm.store["alice"].(*Node), dm.store["bob"].(*Node)
+	for _, loc := range []string{"created", "fetched"} {
+		edge, ok := dm.store[loc].(*Edge)
+		if !ok {
+			t.Fatalf("%s: expected *Edge, got %T", loc, dm.store[loc])
+		}
+		if edge.ID == 0 || edge.Src != alice.ID || edge.Dst != bob.ID || edge.Type != "KNOWS" || edge.Properties["since"] != "2020" {
+			t.Errorf("%s: unexpected edge %+v", loc, edge)
+		}
+	}
+	if v, ok := dm.store["missing"]; !ok || v != nil {
+		t.Errorf("expected nil for a missing edge, got %v", v)
+	}
+}
+
+func TestDeleteVectorsByKeys(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:embed key="user:1:a" text="a" model="m"/>
+  <memory:embed key="user:1:b" text="b" model="m"/>
+  <memory:embed key="user:2:a" text="a" model="m"/>
+  <memory:deletevectors keysexpr="forget" location="deleted"/>
+  <memory:deletevectors filterexpr="{user: 2}"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "forget_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		return []float32{1, 0}, nil
+	}
+	dm.store["forget"] = []any{"user:1:a", "user:1:b", "user:9:unknown"}
+
+	children := []xmldom.Element{}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		children = append(children, child)
+	}
+	for _, child := range children[:4] {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	if got := dm.store["deleted"]; got != int64(2) {
+		t.Fatalf("deleted = %v, want 2", got)
+	}
+	for key, want := range map[string]bool{"user:1:a": false, "user:1:b": false, "user:2:a": true} {
+		if _, ok, err := deps.Vector.GetVectorByKey(ctx, key); err != nil || ok != want {
+			t.Errorf("%s present = %v (err %v), want %v", key, ok, err, want)
+		}
+	}
+
+	// Vectors carry no metadata, so filtering is rejected rather than
+	// silently deleting nothing.
+	_, err = inst.Handle(ctx, children[4])
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || perr.Data["filterexpr"] != "{user: 2}" {
+		t.Fatalf("expected filterexpr PlatformError, got %v", err)
+	}
+}
+
+func TestVectorWritesInTransaction(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:transaction>
+    <memory:embed key="a" text="a" model="m"/>
+    <memory:deletevector key="a"/>
+    <memory:embed key="b" text="b" model="m"/>
+  </memory:transaction>
+  <memory:transaction>
+    <memory:embed key="c" text="c" model="m"/>
+    <memory:sql sql="INSERT INTO missing_table VALUES (1)"/>
+  </memory:transaction>
+  <memory:deletevector key="legacy"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	it.ns = loaded
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "tx_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		return []float32{1, 0}, nil
+	}
+	// Stored by hashed id without a key mapping, as before keys were mapped.
+	if err := deps.Vector.InsertVector(ctx, hashKey("legacy"), []float32{0, 1}); err != nil {
+		t.Fatalf("insert legacy vector: %v", err)
+	}
+
+	children := []xmldom.Element{}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		children = append(children, child)
+	}
+	if ok, err := inst.Handle(ctx, children[0]); !ok || err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	if _, err := inst.Handle(ctx, children[1]); err == nil {
+		t.Fatalf("expected failing transaction to return the child error")
+	}
+	if ok, err := inst.Handle(ctx, children[2]); !ok || err != nil {
+		t.Fatalf("deletevector: %v", err)
+	}
+
+	for key, want := range map[string]bool{"a": false, "b": true, "c": false} {
+		if _, ok, err := deps.Vector.GetVectorByKey(ctx, key); err != nil || ok != want {
+			t.Errorf("%s present = %v (err %v), want %v", key, ok, err, want)
+		}
+	}
+	if count, err := deps.Vector.Count(ctx); err != nil || count != 1 {
+		t.Errorf("count = %d (err %v), want only b left", count, err)
+	}
+}
+
+func TestVectorTruncate(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:put key="profile" value="kept"/>
+  <memory:embed key="doc:a" text="a" model="m"/>
+  <memory:embed key="doc:b" text="b" model="m"/>
+  <memory:vectortruncate/>
+  <memory:search text="a" model="m" location="hits"/>
+  <memory:get key="profile" location="profile"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "truncate_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		return []float32{1, 0}, nil
+	}
+
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	if hits, ok := dm.store["hits"].([]map[string]any); !ok || len(hits) != 0 {
+		t.Errorf("hits = %v, want none after truncate", dm.store["hits"])
+	}
+	if got := dm.store["profile"]; got != "kept" {
+		t.Errorf("profile = %v, want the KV entry preserved", got)
+	}
+	for _, table := range []string{"truncate_vectors", "truncate_vectors_keys", "truncate_vectors_text"} {
+		var n int
+		if err := deps.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil || n != 0 {
+			t.Errorf("%s rows = %d (err %v), want 0", table, n, err)
+		}
+	}
+}
+
+func TestReembedReplacesVectors(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:embed key="a" text="alpha" model="old"/>
+  <memory:embed key="b" text="beta" model="old"/>
+  <memory:embed key="c" text="gamma" model="old"/>
+  <memory:upsertvector key="raw" vectorexpr="rawvec"/>
+  <memory:reembed model="new" batchsize="2" progressevent="reembed.progress" location="result"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "reembed_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	// The new model embeds into three dimensions, forcing a resize.
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		if model == "new" {
+			return []float32{float32(len(text)), 0, 1}, nil
+		}
+		return []float32{0, 1}, nil
+	}
+	dm.store["rawvec"] = []any{1.0, 1.0}
+
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	res, ok := dm.store["result"].(map[string]any)
+	if !ok || res["reembedded"] != 3 {
+		t.Fatalf("result = %#v, want 3 reembedded", dm.store["result"])
+	}
+	if skipped, _ := res["skipped"].([]any); len(skipped) != 1 || skipped[0] != "raw" {
+		t.Fatalf("skipped = %#v, want [raw]", res["skipped"])
+	}
+	for key, text := range map[string]string{"a": "alpha", "b": "beta", "c": "gamma"} {
+		vec, ok, err := deps.Vector.GetVectorByKey(ctx, key)
+		if err != nil || !ok {
+			t.Fatalf("%s: present=%v err=%v", key, ok, err)
+		}
+		if len(vec) != 3 || vec[0] != float32(len(text)) {
+			t.Errorf("%s = %v, want re-embedded 3-dim vector", key, vec)
+		}
+	}
+
+	// Reopening with the old configured dimension keeps the new one.
+	reopened, err := NewVectorDB(ctx, deps.DB, "reembed_vectors", 2)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if vec, ok, err := reopened.GetVectorByKey(ctx, "a"); err != nil || !ok || len(vec) != 3 {
+		t.Errorf("reopened a = %v, %v, %v; want the 3-dim vector", vec, ok, err)
+	}
+	if err := reopened.UpsertVectorByKey(ctx, "d", []float32{1, 0, 1}); err != nil {
+		t.Errorf("reopened 3-dim upsert: %v", err)
+	}
+	if err := reopened.UpsertVectorByKey(ctx, "e", []float32{1, 0}); err == nil {
+		t.Errorf("reopened store accepted a 2-dim vector")
+	}
+
+	var progress [][2]any
+	for _, evt := range it.raised {
+		if evt.Name == "reembed.progress" {
+			data := evt.Data.(map[string]any)
+			progress = append(progress, [2]any{data["done"], data["total"]})
+		}
+	}
+	want := [][2]any{{2, 3}, {3, 3}}
+	if !reflect.DeepEqual(progress, want) {
+		t.Fatalf("progress = %v, want %v", progress, want)
+	}
+}
+
+func TestEmbedRetriesTransientFailures(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:embed key="doc" text="hello" model="m" location="vec"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "default")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "retry_vectors", 2); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.EmbedBackoff = time.Millisecond
+	calls := 0
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		calls++
+		if calls <= 2 {
+			return nil, &StatusError{StatusCode: 503}
+		}
+		return []float32{1, 0}, nil
+	}
+	el := doc.DocumentElement().FirstElementChild()
+
+	if ok, err := inst.Handle(ctx, el); !ok || err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("embed called %d times, want 3", calls)
+	}
+	if _, ok := dm.store["vec"].([]float32); !ok {
+		t.Fatalf("vec = %#v, want the embedding", dm.store["vec"])
+	}
+
+	// Once retries run out the failure surfaces as error.embedding.
+	calls = 0
+	deps.EmbedRetries = 1
+	_, err = inst.Handle(ctx, el)
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || perr.EventName != "error.embedding" || perr.Data["attempts"] != 2 {
+		t.Fatalf("expected error.embedding after 2 attempts, got %v", err)
+	}
+}
+
+func TestExplainQueryPlan(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:sql sql="CREATE TABLE people(id INTEGER PRIMARY KEY, email TEXT, name TEXT)"/>
+  <memory:sql sql="CREATE INDEX people_email ON people(email)"/>
+  <memory:sql sql="SELECT * FROM people WHERE email = 'a@example.com'" explain="true" location="indexed"/>
+  <memory:query sql="SELECT * FROM people WHERE name = 'Ada'" explain="true" location="unindexed"/>
+  <memory:sql sql="INSERT INTO people(email, name) VALUES ('b@example.com', 'Bob')" explain="true" location="insertplan"/>
+  <memory:sql sql="SELECT COUNT(*) FROM people" scalar="true" location="count"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	it := &fakeInterp{dm: dm}
+	loaded, err := Loader()(ctx, it, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	detail := func(loc string) string {
+		plan, ok := dm.store[loc].([]map[string]any)
+		if !ok || len(plan) == 0 {
+			t.Fatalf("%s = %#v, want plan rows", loc, dm.store[loc])
+		}
+		var parts []string
+		for _, row := range plan {
+			parts = append(parts, fmt.Sprint(row["detail"]))
+		}
+		return strings.Join(parts, "; ")
+	}
+	if got := detail("indexed"); !strings.Contains(got, "SEARCH people USING") || !strings.Contains(got, "people_email") {
+		t.Errorf("indexed plan = %q, want an index search", got)
+	}
+	if got := detail("unindexed"); !strings.Contains(got, "SCAN people") {
+		t.Errorf("unindexed plan = %q, want a table scan", got)
+	}
+	// Explaining a statement does not run it.
+	if got := dm.store["count"]; got != int64(0) {
+		t.Fatalf("count = %#v, want 0 after explaining an INSERT", got)
+	}
+}
+
+func TestDBVectorEvictionAttributes(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="v" dsn=":memory:?_foreign_keys=on" vector-max-count="10" vector-evict="lru"/>
+  <memory:put key="k" value="v"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: newFakeDM()}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	puts := doc.DocumentElement().GetElementsByTagNameNS(xmldom.DOMString(MemoryNamespaceURI), "put")
+	putEl, _ := puts.Item(0).(xmldom.Element)
+	if ok, err := loaded.Handle(ctx, putEl); !ok || err != nil {
+		t.Fatalf("put: ok=%v err=%v", ok, err)
+	}
+	vector := loaded.(*ns).dbs["v"].Vector
+	if vector.maxCount != 10 || vector.evict != EvictLRU {
+		t.Errorf("eviction = %d/%q, want 10/lru", vector.maxCount, vector.evict)
+	}
+
+	for _, attrs := range []string{`vector-max-count="-1"`, `vector-max-count="many"`, `vector-evict="random"`} {
+		bad := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="v" ` + attrs + `/>
+</agentml>`
+		doc, _ := xmldom.NewDecoder(strings.NewReader(bad)).Decode()
+		if _, err := Loader()(ctx, &fakeInterp{dm: newFakeDM()}, doc); err == nil {
+			t.Errorf("%s: expected loader error", attrs)
+		}
+	}
+}
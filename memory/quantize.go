@@ -0,0 +1,264 @@
+package memory
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Quantization selects how a VectorDB stores vectors.
+type Quantization string
+
+const (
+	// QuantizationNone stores full float32 vectors, 4 bytes per dimension.
+	// It is the default, and the only format the vec index can search.
+	QuantizationNone Quantization = "none"
+	// QuantizationInt8 stores one byte per dimension, scaled between the
+	// vector's minimum and maximum.
+	QuantizationInt8 Quantization = "int8"
+	// QuantizationBinary stores one bit per dimension: whether it is above
+	// the vector's mean.
+	QuantizationBinary Quantization = "binary"
+)
+
+// quantizations lists every storage format, in the order stores are
+// converted from them.
+var quantizations = []Quantization{QuantizationNone, QuantizationInt8, QuantizationBinary}
+
+// quantHeaderSize is the scale and offset, as float32s, that precede the
+// codes of a quantized vector.
+const quantHeaderSize = 8
+
+// ParseQuantization parses a vector-quantization attribute value. An empty
+// value, like float32, is QuantizationNone.
+func ParseQuantization(s string) (Quantization, error) {
+	switch q := Quantization(strings.ToLower(strings.TrimSpace(s))); q {
+	case "", "float32":
+		return QuantizationNone, nil
+	case QuantizationNone, QuantizationInt8, QuantizationBinary:
+		return q, nil
+	default:
+		return "", fmt.Errorf("unknown vector quantization %q (want none, int8 or binary)", s)
+	}
+}
+
+// SetQuantization selects the storage format of vs. Quantized vectors are
+// kept in their own plain table, each with the scale and offset needed to
+// dequantize it, and searches score the float query against the dequantized
+// vectors by scanning the store, since the vec index only holds float32.
+//
+// Vectors already stored in another format are converted in one transaction
+// and their old table is dropped. Quantization is lossy: converting back to
+// QuantizationNone keeps the reduced precision. The format is not recorded
+// in the database, so set it each time the store is opened.
+func (vs *VectorDB) SetQuantization(ctx context.Context, q Quantization) error {
+	q, err := ParseQuantization(string(q))
+	if err != nil {
+		return err
+	}
+	if table := vs.quantizedTable(q); table != vs.tableName {
+		prevTable, prevQuantization := vs.tableName, vs.quantization
+		vs.tableName, vs.quantization = table, q
+		if err := vs.createVectorTable(ctx, vs.db); err != nil {
+			vs.tableName, vs.quantization = prevTable, prevQuantization
+			return err
+		}
+	}
+	for _, from := range quantizations {
+		if from == q {
+			continue
+		}
+		if err := vs.convertVectors(ctx, from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quantizedTable names the table holding vectors stored with q.
+func (vs *VectorDB) quantizedTable(q Quantization) string {
+	if !isQuantized(q) {
+		return vs.baseTable
+	}
+	return vs.baseTable + "_" + string(q)
+}
+
+func isQuantized(q Quantization) bool {
+	return q != "" && q != QuantizationNone
+}
+
+// convertVectors moves the vectors stored with from, if its table exists,
+// into the current table and drops the old one.
+func (vs *VectorDB) convertVectors(ctx context.Context, from Quantization) error {
+	table := vs.quantizedTable(from)
+	var exists int
+	if err := vs.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE name=?)", table).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to inspect vector table %s: %w", table, err)
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	tx, err := vs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin vector conversion: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT rowid, embedding FROM %s", table))
+	if err != nil {
+		return fmt.Errorf("failed to read vectors to convert: %w", err)
+	}
+	blobs := map[int64][]byte{}
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan vector to convert: %w", err)
+		}
+		blobs[id] = blob
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read vectors to convert: %w", err)
+	}
+	for id, blob := range blobs {
+		vec, err := decodeVectorBlob(from, vs.dimensions, blob)
+		if err != nil {
+			return fmt.Errorf("failed to convert vector %d: %w", id, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(rowid, embedding) VALUES (?, ?)", vs.tableName), id, vs.encodeVector(vec)); err != nil {
+			return fmt.Errorf("failed to insert converted vector: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", table)); err != nil {
+		return fmt.Errorf("failed to drop vector table %s: %w", table, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit vector conversion: %w", err)
+	}
+	return nil
+}
+
+// encodeVector converts vector to the blob stored in the embedding column
+// for the store's quantization.
+func (vs *VectorDB) encodeVector(vector []float32) []byte {
+	switch vs.quantization {
+	case QuantizationInt8:
+		return quantizeInt8(vector)
+	case QuantizationBinary:
+		return quantizeBinary(vector)
+	default:
+		return encodeFloat32Blob(vector)
+	}
+}
+
+// decodeVector is the inverse of encodeVector, dequantizing when needed.
+func (vs *VectorDB) decodeVector(b []byte) ([]float32, error) {
+	return decodeVectorBlob(vs.quantization, vs.dimensions, b)
+}
+
+// decodeVectorBlob decodes an embedding blob of dimensions values stored
+// with q.
+func decodeVectorBlob(q Quantization, dimensions int, b []byte) ([]float32, error) {
+	switch q {
+	case QuantizationInt8:
+		return dequantizeInt8(b, dimensions)
+	case QuantizationBinary:
+		return dequantizeBinary(b, dimensions)
+	default:
+		return decodeFloat32Blob(b)
+	}
+}
+
+func putQuantHeader(b []byte, scale, offset float32) {
+	binary.LittleEndian.PutUint32(b, math.Float32bits(scale))
+	binary.LittleEndian.PutUint32(b[4:], math.Float32bits(offset))
+}
+
+func quantHeader(b []byte, codes int) (scale, offset float32, err error) {
+	if len(b) != quantHeaderSize+codes {
+		return 0, 0, fmt.Errorf("invalid quantized vector blob length: %d", len(b))
+	}
+	scale = math.Float32frombits(binary.LittleEndian.Uint32(b))
+	offset = math.Float32frombits(binary.LittleEndian.Uint32(b[4:]))
+	return scale, offset, nil
+}
+
+// quantizeInt8 maps each value of vector linearly onto 0..255 between the
+// vector's minimum (the offset) and maximum.
+func quantizeInt8(vector []float32) []byte {
+	b := make([]byte, quantHeaderSize+len(vector))
+	if len(vector) == 0 {
+		return b
+	}
+	lo, hi := vector[0], vector[0]
+	for _, f := range vector {
+		lo, hi = min(lo, f), max(hi, f)
+	}
+	scale := (hi - lo) / 255
+	putQuantHeader(b, scale, lo)
+	if scale == 0 {
+		return b
+	}
+	for i, f := range vector {
+		b[quantHeaderSize+i] = byte(math.Round(float64((f - lo) / scale)))
+	}
+	return b
+}
+
+func dequantizeInt8(b []byte, dimensions int) ([]float32, error) {
+	scale, offset, err := quantHeader(b, dimensions)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]float32, dimensions)
+	for i, code := range b[quantHeaderSize:] {
+		out[i] = offset + scale*float32(code)
+	}
+	return out, nil
+}
+
+// quantizeBinary records whether each value of vector is above its mean
+// (the offset). The scale is the mean absolute deviation, so a dequantized
+// value is the offset plus or minus the scale.
+func quantizeBinary(vector []float32) []byte {
+	b := make([]byte, quantHeaderSize+(len(vector)+7)/8)
+	if len(vector) == 0 {
+		return b
+	}
+	var mean float64
+	for _, f := range vector {
+		mean += float64(f)
+	}
+	mean /= float64(len(vector))
+	var dev float64
+	for _, f := range vector {
+		dev += math.Abs(float64(f) - mean)
+	}
+	putQuantHeader(b, float32(dev/float64(len(vector))), float32(mean))
+	for i, f := range vector {
+		if float64(f) > mean {
+			b[quantHeaderSize+i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+func dequantizeBinary(b []byte, dimensions int) ([]float32, error) {
+	scale, offset, err := quantHeader(b, (dimensions+7)/8)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]float32, dimensions)
+	for i := range out {
+		if b[quantHeaderSize+i/8]&(1<<(i%8)) != 0 {
+			out[i] = offset + scale
+		} else {
+			out[i] = offset - scale
+		}
+	}
+	return out, nil
+}
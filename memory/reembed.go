@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/agentflare-ai/agentml-go"
+)
+
+// DefaultReembedBatchSize is the number of vectors replaced per transaction
+// when Reembed is given no batch size.
+const DefaultReembedBatchSize = 100
+
+// ReembedResult reports the outcome of a re-embedding run.
+type ReembedResult struct {
+	// Reembedded is the number of keys whose vectors were replaced.
+	Reembedded int `json:"reembedded"`
+	// Skipped lists the keys left untouched because no text was stored for
+	// them, such as vectors written with memory:upsertvector.
+	Skipped []string `json:"skipped"`
+}
+
+// Reembed re-embeds every stored key whose text is known with model, using
+// the default embedder, and replaces its vector. Vectors are replaced
+// batchSize at a time, each batch in its own transaction. Keys without
+// stored text are skipped and logged at Warn.
+//
+// When model produces vectors of a different dimension, the vector store is
+// recreated for the new dimension before the first batch is written, so
+// skipped keys lose their vectors. The new dimension is saved with the store
+// and used when it is next opened, whatever dimension is configured. A run
+// that fails partway can be repeated to finish the migration.
+func (d *Deps) Reembed(ctx context.Context, model string, batchSize int) error {
+	res, err := d.reembed(ctx, d.withRetry("reembed", d.Embed), model, batchSize, nil)
+	if len(res.Skipped) > 0 {
+		d.logger().WarnContext(ctx, "memory: reembed skipped keys without stored text", "count", len(res.Skipped), "keys", res.Skipped)
+	}
+	return err
+}
+
+// reembed implements Reembed with an explicit embedder, calling progress
+// after each committed batch.
+func (d *Deps) reembed(ctx context.Context, embed EmbedFunc, model string, batchSize int, progress func(done, total int)) (ReembedResult, error) {
+	var res ReembedResult
+	if d == nil || d.Vector == nil {
+		return res, notConfigured("vector store")
+	}
+	if embed == nil {
+		return res, &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "embedder_unavailable",
+			Data:      map[string]any{"element": "reembed"},
+			Cause:     ErrNoEmbedder,
+		}
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultReembedBatchSize
+	}
+
+	stored, err := d.Vector.storedTexts(ctx, d.dbtx())
+	if err != nil {
+		return res, err
+	}
+	var pending []storedText
+	for _, st := range stored {
+		if st.hasText {
+			pending = append(pending, st)
+		} else {
+			res.Skipped = append(res.Skipped, st.key)
+		}
+	}
+
+	checked := false
+	for start := 0; start < len(pending); start += batchSize {
+		batch := pending[start:min(start+batchSize, len(pending))]
+		vectors := make(map[int64][]float32, len(batch))
+		for _, st := range batch {
+			vec, err := embed(ctx, model, st.text)
+			if err != nil {
+				var perr *agentml.PlatformError
+				if errors.As(err, &perr) && perr.Data != nil {
+					perr.Data["key"] = st.key
+					return res, perr
+				}
+				return res, fmt.Errorf("failed to re-embed key %q: %w", st.key, err)
+			}
+			vectors[st.id] = vec
+		}
+		if !checked {
+			// Every vector from one model shares a dimension, so only
+			// the first is checked.
+			if dims := len(vectors[batch[0].id]); dims != d.Vector.dimensions {
+				if err := d.Vector.resize(ctx, d.dbtx(), dims); err != nil {
+					return res, err
+				}
+			}
+			checked = true
+		}
+		if err := d.Vector.replaceVectors(ctx, d.dbtx(), vectors); err != nil {
+			return res, err
+		}
+		res.Reembedded += len(batch)
+		if progress != nil {
+			progress(res.Reembedded, len(pending))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/internal/retry"
+)
+
+// Defaults for retrying failed embedding calls (see Deps.EmbedRetries).
+const (
+	DefaultEmbedRetries = 2
+	DefaultEmbedBackoff = 200 * time.Millisecond
+)
+
+// StatusError reports an embedding API response with a non-success HTTP
+// status. Embedders return it (or wrap it) so IsTransientEmbedError can tell
+// rate limiting and server errors apart from bad requests.
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("embedding request failed with status %d: %v", e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("embedding request failed with status %d", e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// IsTransientEmbedError reports whether a failed embedding call is worth
+// retrying: timeouts, and StatusErrors for 429 or any 5xx status.
+func IsTransientEmbedError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// withRetry wraps embed so transient failures are retried with exponential
+// backoff, doubling from EmbedBackoff. The final failure is returned as an
+// error.embedding PlatformError. Retrying stops early once ctx is done.
+func (d *Deps) withRetry(element string, embed EmbedFunc) EmbedFunc {
+	if embed == nil {
+		return nil
+	}
+	retries, backoff, transient := DefaultEmbedRetries, DefaultEmbedBackoff, IsTransientEmbedError
+	if d.EmbedRetries != 0 {
+		retries = max(d.EmbedRetries, 0)
+	}
+	if d.EmbedBackoff > 0 {
+		backoff = d.EmbedBackoff
+	}
+	if d.IsTransient != nil {
+		transient = d.IsTransient
+	}
+	return func(ctx context.Context, model, text string) ([]float32, error) {
+		var vec []float32
+		attempt := 0
+		policy := retry.Policy{
+			Name:      "memory.embed",
+			Attempts:  retries + 1,
+			Backoff:   backoff,
+			Retryable: transient,
+			OnRetry: func(attempt int, err error, delay time.Duration) {
+				d.logger().WarnContext(ctx, "memory: transient embedding failure, retrying", "element", element, "attempt", attempt, "delay", delay, "error", err)
+			},
+		}
+		err := retry.Do(ctx, policy, func(ctx context.Context) error {
+			attempt++
+			var err error
+			vec, err = embed(ctx, model, text)
+			return err
+		})
+		if err == nil {
+			return vec, nil
+		}
+		var canceled *retry.CanceledError
+		if errors.As(err, &canceled) {
+			return nil, &agentml.PlatformError{
+				EventName: "error.embedding",
+				Message:   fmt.Sprintf("memory:%s embedding canceled while retrying: %v", element, canceled.Err),
+				Data:      map[string]any{"element": element, "model": model, "attempts": attempt},
+				Cause:     errors.Join(canceled.Err, canceled.Cause),
+			}
+		}
+		return nil, &agentml.PlatformError{
+			EventName: "error.embedding",
+			Message:   fmt.Sprintf("memory:%s embedding failed after %d attempt(s): %v", element, attempt, err),
+			Data:      map[string]any{"element": element, "model": model, "attempts": attempt},
+			Cause:     err,
+		}
+	}
+}
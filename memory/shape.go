@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// Result shapes accepted by the shape attribute of memory:query, memory:sql,
+// memory:exec and memory:graphquery.
+const (
+	// ShapeRows assigns an array of row objects keyed by column name. It is
+	// the default.
+	ShapeRows = "rows"
+	// ShapeColumns assigns an object mapping each column name to the array
+	// of its values, in row order.
+	ShapeColumns = "columns"
+	// ShapeFirst assigns the first row object, or null when there are none.
+	ShapeFirst = "first"
+	// ShapeScalar assigns the first column of the first row, or null when
+	// there are no rows.
+	ShapeScalar = "scalar"
+)
+
+// resultShape returns the shape el asks for. When shape is unset, the legacy
+// scalar="true" of memory:sql selects ShapeScalar and anything else
+// ShapeRows; legacy reports which.
+func resultShape(el xmldom.Element) (shape string, legacy bool, err error) {
+	shape = strings.ToLower(strings.TrimSpace(string(el.GetAttribute("shape"))))
+	switch shape {
+	case "":
+		if boolAttr(el, "scalar") {
+			return ShapeScalar, true, nil
+		}
+		return ShapeRows, false, nil
+	case ShapeRows, ShapeColumns, ShapeFirst, ShapeScalar:
+		return shape, false, nil
+	}
+	return "", false, &agentml.PlatformError{
+		EventName: "error.execution",
+		Message:   fmt.Sprintf("unknown shape %q (want rows, columns, first or scalar)", shape),
+		Data:      map[string]any{"element": string(el.LocalName()), "attribute": "shape"},
+		Cause:     fmt.Errorf("invalid shape"),
+	}
+}
+
+// shapeResult reshapes query rows, whose columns are cols in select order,
+// into shape. Empty results are an empty array or object rather than nil for
+// ShapeRows and ShapeColumns.
+func shapeResult(rows []map[string]any, cols []string, shape string) any {
+	switch shape {
+	case ShapeColumns:
+		out := make(map[string]any, len(cols))
+		for _, c := range cols {
+			values := make([]any, len(rows))
+			for i, row := range rows {
+				values[i] = row[c]
+			}
+			out[c] = values
+		}
+		return out
+	case ShapeFirst:
+		if len(rows) == 0 {
+			return nil
+		}
+		return rows[0]
+	case ShapeScalar:
+		if len(rows) == 0 || len(cols) == 0 {
+			return nil
+		}
+		return rows[0][cols[0]]
+	}
+	if rows == nil {
+		rows = []map[string]any{}
+	}
+	return rows
+}
@@ -0,0 +1,200 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Directions a subgraph traversal follows edges in.
+const (
+	DirectionOut  = "out"
+	DirectionIn   = "in"
+	DirectionBoth = "both"
+)
+
+// subgraphBatchSize bounds the ids bound into one query. Following both
+// directions binds each id twice, which stays under SQLite's smallest host
+// parameter limit of 999.
+const subgraphBatchSize = 400
+
+// SubgraphOptions restricts the edges GraphDB.Subgraph follows.
+type SubgraphOptions struct {
+	// Direction is DirectionOut, DirectionIn or DirectionBoth (the default).
+	Direction string
+	// Rel, when set, follows only edges of this type.
+	Rel string
+}
+
+// Subgraph is the neighborhood of a node: every node reachable within the
+// requested depth, and the edges followed to reach or link them. Each node
+// and edge appears once.
+type Subgraph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Subgraph returns the nodes within depth hops of root and the edges between
+// them that the traversal followed. Nodes are in breadth-first order, root
+// first, and edges in the order they were found. A depth of 0 returns root
+// alone. It returns nil when root does not exist.
+func (g *GraphDB) Subgraph(ctx context.Context, root int64, depth int, opts SubgraphOptions) (*Subgraph, error) {
+	return g.subgraph(ctx, g.db, root, depth, opts)
+}
+
+// subgraph implements Subgraph, reading through q so callers inside a
+// transaction see their own writes.
+func (g *GraphDB) subgraph(ctx context.Context, q DBTX, root int64, depth int, opts SubgraphOptions) (*Subgraph, error) {
+	if depth < 0 {
+		return nil, fmt.Errorf("subgraph depth must not be negative, got %d", depth)
+	}
+	dir := strings.ToLower(strings.TrimSpace(opts.Direction))
+	switch dir {
+	case "":
+		dir = DirectionBoth
+	case DirectionOut, DirectionIn, DirectionBoth:
+	default:
+		return nil, fmt.Errorf("unknown subgraph direction %q (want out, in or both)", opts.Direction)
+	}
+
+	order := []int64{root}
+	visited := map[int64]bool{root: true}
+	seenEdges := map[int64]bool{}
+	var edges []*Edge
+	frontier := []int64{root}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		if ctx.Err() != nil {
+			return nil, traversalCancelled(ctx, "subgraph", len(visited))
+		}
+		found, err := g.edgesAt(ctx, q, frontier, dir, opts.Rel)
+		if err != nil {
+			return nil, err
+		}
+		var next []int64
+		for _, edge := range found {
+			if seenEdges[edge.ID] {
+				continue
+			}
+			seenEdges[edge.ID] = true
+			edges = append(edges, edge)
+			for _, id := range []int64{edge.Src, edge.Dst} {
+				if !visited[id] {
+					visited[id] = true
+					order = append(order, id)
+					next = append(next, id)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	byID, err := g.nodesByID(ctx, q, order)
+	if err != nil {
+		return nil, err
+	}
+	if byID[root] == nil {
+		return nil, nil
+	}
+	sub := &Subgraph{Nodes: make([]*Node, 0, len(order)), Edges: make([]*Edge, 0, len(edges))}
+	for _, id := range order {
+		if node := byID[id]; node != nil {
+			sub.Nodes = append(sub.Nodes, node)
+		}
+	}
+	for _, edge := range edges {
+		// Edges left dangling by a deleted node are dropped with it
+		if byID[edge.Src] != nil && byID[edge.Dst] != nil {
+			sub.Edges = append(sub.Edges, edge)
+		}
+	}
+	return sub, nil
+}
+
+// edgesAt returns the edges touching ids in direction dir, optionally of type
+// rel only, ordered by id.
+func (g *GraphDB) edgesAt(ctx context.Context, q DBTX, ids []int64, dir, rel string) ([]*Edge, error) {
+	var edges []*Edge
+	for start := 0; start < len(ids); start += subgraphBatchSize {
+		batch := ids[start:min(start+subgraphBatchSize, len(ids))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		var conds []string
+		var args []any
+		if dir != DirectionIn {
+			conds = append(conds, fmt.Sprintf("source IN (%s)", placeholders))
+			for _, id := range batch {
+				args = append(args, id)
+			}
+		}
+		if dir != DirectionOut {
+			conds = append(conds, fmt.Sprintf("target IN (%s)", placeholders))
+			for _, id := range batch {
+				args = append(args, id)
+			}
+		}
+		query := fmt.Sprintf("SELECT id, source, target, edge_type, properties FROM %s WHERE (%s)", g.edgesTable, strings.Join(conds, " OR "))
+		if rel != "" {
+			query += " AND edge_type = ?"
+			args = append(args, rel)
+		}
+		rows, err := q.QueryContext(ctx, query+" ORDER BY id", args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query subgraph edges: %w", err)
+		}
+		for rows.Next() {
+			var edge Edge
+			var edgeType, propertiesJSON sql.NullString
+			if err := rows.Scan(&edge.ID, &edge.Src, &edge.Dst, &edgeType, &propertiesJSON); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan subgraph edge: %w", err)
+			}
+			edge.Type = edgeType.String
+			if propertiesJSON.String != "" {
+				_ = json.Unmarshal([]byte(propertiesJSON.String), &edge.Properties)
+			}
+			edges = append(edges, &edge)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query subgraph edges: %w", err)
+		}
+	}
+	return edges, nil
+}
+
+// nodesByID loads the nodes with the given ids. Ids without a node are
+// absent from the result.
+func (g *GraphDB) nodesByID(ctx context.Context, q DBTX, ids []int64) (map[int64]*Node, error) {
+	byID := make(map[int64]*Node, len(ids))
+	for start := 0; start < len(ids); start += subgraphBatchSize {
+		batch := ids[start:min(start+subgraphBatchSize, len(ids))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT id, labels, properties FROM %s WHERE id IN (%s)", g.nodesTable, placeholders), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var nid int64
+			var labelsJSON, propsJSON string
+			if err := rows.Scan(&nid, &labelsJSON, &propsJSON); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			var labels []string
+			var props map[string]any
+			_ = json.Unmarshal([]byte(labelsJSON), &labels)
+			_ = json.Unmarshal([]byte(propsJSON), &props)
+			byID[nid] = &Node{ID: nid, Labels: labels, Properties: props}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return byID, nil
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestSubgraph(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDB(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	graph, err := NewGraphDB(ctx, db, "sub")
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v", err)
+	}
+
+	// e -LIKES-> a -KNOWS-> b -KNOWS-> c -KNOWS-> d, plus a -WORKS_WITH-> b
+	ids := map[string]int64{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		node, err := graph.CreateNode(ctx, []string{"Person"}, map[string]any{"name": name})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		ids[name] = node.ID
+	}
+	edgeIDs := map[string]int64{}
+	for _, e := range []struct{ src, dst, rel string }{
+		{"a", "b", "KNOWS"}, {"b", "c", "KNOWS"}, {"c", "d", "KNOWS"}, {"e", "a", "LIKES"}, {"a", "b", "WORKS_WITH"},
+	} {
+		rel, err := graph.CreateRelationship(ctx, ids[e.src], ids[e.dst], e.rel, nil)
+		if err != nil {
+			t.Fatalf("relate %s-%s: %v", e.src, e.dst, err)
+		}
+		edgeIDs[e.src+e.dst+e.rel] = rel.ID
+	}
+
+	names := func(sub *Subgraph) []string {
+		var out []string
+		for _, node := range sub.Nodes {
+			out = append(out, node.Properties["name"].(string))
+		}
+		slices.Sort(out)
+		return out
+	}
+	edges := func(sub *Subgraph) []int64 {
+		var out []int64
+		for _, edge := range sub.Edges {
+			out = append(out, edge.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+	sorted := func(ids ...int64) []int64 {
+		slices.Sort(ids)
+		return ids
+	}
+
+	for _, tc := range []struct {
+		name      string
+		depth     int
+		opts      SubgraphOptions
+		wantNodes []string
+		wantEdges []int64
+	}{
+		{"Depth0", 0, SubgraphOptions{}, []string{"a"}, nil},
+		{"Depth1", 1, SubgraphOptions{}, []string{"a", "b", "e"},
+			sorted(edgeIDs["abKNOWS"], edgeIDs["eaLIKES"], edgeIDs["abWORKS_WITH"])},
+		{"Depth2", 2, SubgraphOptions{}, []string{"a", "b", "c", "e"},
+			sorted(edgeIDs["abKNOWS"], edgeIDs["eaLIKES"], edgeIDs["abWORKS_WITH"], edgeIDs["bcKNOWS"])},
+		{"Depth2OutKnows", 2, SubgraphOptions{Direction: DirectionOut, Rel: "KNOWS"}, []string{"a", "b", "c"},
+			sorted(edgeIDs["abKNOWS"], edgeIDs["bcKNOWS"])},
+		{"Depth2In", 2, SubgraphOptions{Direction: DirectionIn}, []string{"a", "e"},
+			sorted(edgeIDs["eaLIKES"])},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sub, err := graph.Subgraph(ctx, ids["a"], tc.depth, tc.opts)
+			if err != nil {
+				t.Fatalf("subgraph: %v", err)
+			}
+			if sub.Nodes[0].ID != ids["a"] {
+				t.Errorf("Expected the root first, got node %d", sub.Nodes[0].ID)
+			}
+			if got := names(sub); !slices.Equal(got, tc.wantNodes) {
+				t.Errorf("nodes = %v, want %v", got, tc.wantNodes)
+			}
+			if got := edges(sub); !slices.Equal(got, tc.wantEdges) {
+				t.Errorf("edges = %v, want %v", got, tc.wantEdges)
+			}
+		})
+	}
+
+	if sub, err := graph.Subgraph(ctx, 9999, 1, SubgraphOptions{}); err != nil || sub != nil {
+		t.Errorf("Expected nil for a missing root, got %+v, %v", sub, err)
+	}
+	if _, err := graph.Subgraph(ctx, ids["a"], 1, SubgraphOptions{Direction: "sideways"}); err == nil {
+		t.Error("Expected an error for an unknown direction")
+	}
+}
+
+func TestSubgraphElement(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:addnode labels="Person" location="alice"/>
+  <memory:addnode labels="Person" location="bob"/>
+  <memory:addnode labels="Person" location="carol"/>
+  <memory:addedge srcexpr="aliceID" dstexpr="bobID" rel="KNOWS"/>
+  <memory:addedge srcexpr="bobID" dstexpr="carolID" rel="KNOWS"/>
+  <memory:subgraph idexpr="aliceID" location="near"/>
+  <memory:subgraph idexpr="aliceID" depth="2" location="far"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := loaded.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+		for _, name := range []string{"alice", "bob", "carol"} {
+			if node, ok := dm.store[name].(*Node); ok {
+				dm.store[name+"ID"] = node.ID
+			}
+		}
+	}
+	for loc, want := range map[string][2]int{"near": {2, 1}, "far": {3, 2}} {
+		sub, ok := dm.store[loc].(*Subgraph)
+		if !ok {
+			t.Fatalf("%s = %T, want *Subgraph", loc, dm.store[loc])
+		}
+		if len(sub.Nodes) != want[0] || len(sub.Edges) != want[1] {
+			t.Errorf("%s has %d nodes and %d edges, want %d and %d", loc, len(sub.Nodes), len(sub.Edges), want[0], want[1])
+		}
+	}
+}
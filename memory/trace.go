@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes set on the memory.<op> spans.
+const (
+	AttrDatabase    = "memory.db"
+	AttrOperation   = "memory.operation"
+	AttrKey         = "memory.key"
+	AttrResultCount = "memory.result_count"
+	AttrTransaction = "memory.transaction"
+)
+
+// spanKey evaluates the key or keyexpr attribute of el and records the key on
+// the operation's span, hashed when the database sets hash-keys-in-traces.
+func (n *ns) spanKey(ctx context.Context, dm agentml.DataModel, el xmldom.Element) (string, error) {
+	key, err := getStringOrExpr(ctx, dm, el, "key", "keyexpr")
+	if err != nil || key == "" {
+		return key, err
+	}
+	traced := key
+	if n.dbDefs[n.dbID(n.deps)].hashKeysInTraces {
+		sum := sha256.Sum256([]byte(key))
+		traced = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(AttrKey, traced))
+	return key, nil
+}
+
+// resultCount returns the length of a list result, or false when the
+// operation assigned no result or a single value.
+func resultCount(rec *resultRecorder) (int, bool) {
+	if !rec.assigned || rec.result == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(rec.result)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0, false
+	}
+	return v.Len(), true
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer keeps the attributes of every span it starts, by span name.
+type recordingTracer struct {
+	embedded.Tracer
+	mu    sync.Mutex
+	spans map[string]map[attribute.Key]attribute.Value
+}
+
+type recordingTracerProvider struct {
+	embedded.TracerProvider
+	tracer *recordingTracer
+}
+
+func (p recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer { return p.tracer }
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordingSpan{attrs: map[attribute.Key]attribute.Value{}}
+	r.mu.Lock()
+	r.spans[name] = span.attrs
+	r.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordingSpan struct {
+	noop.Span
+	attrs map[attribute.Key]attribute.Value
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func TestSpanAttributes(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	tracer := &recordingTracer{spans: map[string]map[attribute.Key]attribute.Value{}}
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(recordingTracerProvider{tracer: tracer})
+	defer otel.SetTracerProvider(prev)
+
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="main" dsn=":memory:" hash-keys-in-traces="true"/>
+  <memory:embed key="doc:1" text="a" model="m"/>
+  <memory:embed key="doc:2" text="b" model="m"/>
+  <memory:search text="a" model="m" location="hits"/>
+  <memory:begin/>
+  <memory:put key="user:42" value="x"/>
+  <memory:commit/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	inst := loaded.(*ns)
+	deps, err := inst.ensureOpen(ctx, dm, "main")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if deps.Vector, err = NewVectorDB(ctx, deps.DB, "trace_vectors", 3); err != nil {
+		t.Fatalf("vector store: %v", err)
+	}
+	deps.Embed = func(ctx context.Context, model, text string) ([]float32, error) {
+		return []float32{1, 0, 0}, nil
+	}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if ok, err := inst.Handle(ctx, child); !ok || err != nil {
+			t.Fatalf("%s: %v", child.LocalName(), err)
+		}
+	}
+
+	search := tracer.spans["memory.search"]
+	if search == nil {
+		t.Fatalf("no memory.search span; spans: %v", tracer.spans)
+	}
+	if got := search[AttrDatabase].AsString(); got != "main" {
+		t.Errorf("%s = %q, want main", AttrDatabase, got)
+	}
+	if got := search[AttrOperation].AsString(); got != "search" {
+		t.Errorf("%s = %q, want search", AttrOperation, got)
+	}
+	if got := search[AttrResultCount].AsInt64(); got != 2 {
+		t.Errorf("%s = %d, want 2", AttrResultCount, got)
+	}
+	if v, ok := search[AttrTransaction]; !ok || v.AsBool() {
+		t.Errorf("%s = %v, want false", AttrTransaction, v.Emit())
+	}
+
+	put := tracer.spans["memory.put"]
+	if !put[AttrTransaction].AsBool() {
+		t.Errorf("put %s = false, want true inside memory:begin", AttrTransaction)
+	}
+	key := put[AttrKey].AsString()
+	if !strings.HasPrefix(key, "sha256:") || strings.Contains(key, "user:42") {
+		t.Errorf("%s = %q, want a sha256 hash of the key", AttrKey, key)
+	}
+}
@@ -0,0 +1,34 @@
+package memory
+
+import "context"
+
+// Vacuum rebuilds the KV database to reclaim the free pages left by deletes,
+// then refreshes the query planner statistics with ANALYZE. VACUUM may
+// rewrite the whole database file and needs up to twice its size in free
+// disk space while it runs. SQLite cannot vacuum inside a transaction, so
+// Vacuum fails with ErrInTransaction while one opened by memory:begin or
+// memory:transaction is active.
+func (d *Deps) Vacuum(ctx context.Context) error {
+	return d.vacuum(ctx, false)
+}
+
+// vacuum implements Vacuum, also running PRAGMA optimize when optimize is
+// set.
+func (d *Deps) vacuum(ctx context.Context, optimize bool) error {
+	if d == nil || d.DB == nil {
+		return notConfigured("KV database")
+	}
+	if d.tx != nil {
+		return inTransaction("vacuum")
+	}
+	stmts := []string{"VACUUM", "ANALYZE"}
+	if optimize {
+		stmts = append(stmts, "PRAGMA optimize")
+	}
+	for _, stmt := range stmts {
+		if _, err := d.DB.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestVacuum(t *testing.T) {
+	ctx, cancel := withTimeout(t)
+	defer cancel()
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:memory="github.com/agentflare-ai/agentml-go/memory">
+  <memory:db id="a" dsnexpr="dsn"/>
+  <memory:put db="a" key="keep" value="kept"/>
+  <memory:vacuum db="a" optimize="true"/>
+  <memory:get db="a" key="keep" location="kept"/>
+  <memory:begin db="a"/>
+  <memory:vacuum db="a"/>
+  <memory:rollback db="a"/>
+</agentml>`
+	doc, _ := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	dm := newFakeDM()
+	dm.store["dsn"] = "file:" + filepath.Join(t.TempDir(), "vacuum.db")
+	loaded, err := Loader()(ctx, &fakeInterp{dm: dm}, doc)
+	if err != nil {
+		t.Fatalf("loader: %v", err)
+	}
+	children := []xmldom.Element{}
+	for child := doc.DocumentElement().FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		children = append(children, child)
+	}
+	if ok, err := loaded.Handle(ctx, children[1]); !ok || err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	deps, err := loaded.(*ns).ensureOpen(ctx, dm, "a")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := deps.DB.ExecContext(ctx, `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 500)
+		INSERT INTO kv(key, value) SELECT 'junk:' || i, json_quote(hex(randomblob(512))) FROM n`); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if _, err := deps.DB.ExecContext(ctx, "DELETE FROM kv WHERE key LIKE 'junk:%'"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	freePages := func() int64 {
+		var n int64
+		if err := deps.DB.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&n); err != nil {
+			t.Fatalf("freelist_count: %v", err)
+		}
+		return n
+	}
+	if freePages() == 0 {
+		t.Fatal("expected free pages after deleting rows")
+	}
+
+	for _, el := range children[2:4] {
+		if ok, err := loaded.Handle(ctx, el); !ok || err != nil {
+			t.Fatalf("%s: %v", el.LocalName(), err)
+		}
+	}
+	if n := freePages(); n != 0 {
+		t.Errorf("freelist_count after vacuum = %d, want 0", n)
+	}
+	if got := dm.store["kept"]; got != "kept" {
+		t.Errorf("kept = %v, want kept", got)
+	}
+	var check string
+	if err := deps.DB.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&check); err != nil || check != "ok" {
+		t.Errorf("integrity_check = %q, %v", check, err)
+	}
+
+	if ok, err := loaded.Handle(ctx, children[4]); !ok || err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := loaded.Handle(ctx, children[5]); !errors.Is(err, ErrInTransaction) {
+		t.Errorf("vacuum inside a transaction: got %v, want ErrInTransaction", err)
+	}
+	if ok, err := loaded.Handle(ctx, children[6]); !ok || err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+}
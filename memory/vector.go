@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"sort"
+	"strings"
 	"unsafe"
 
 	"github.com/agentflare-ai/go-jsonschema"
@@ -122,10 +126,41 @@ var (
 type VectorDB struct {
 	db          *sql.DB
 	tableName   string
+	baseTable   string
+	keysTable   string
+	textTable   string
+	normsTable  string
+	dimsTable   string
 	dimensions  int
 	vtAvailable bool
+	// keyHash derives the candidate rowid for a textual key.
+	keyHash func(string) uint64
+	// distance, when set, replaces the built-in metric in searches.
+	distance        func(a, b []float32) float64
+	forceDistance   bool
+	bruteForceLimit int
+	// normalize L2-normalizes every vector written; normalized is set once
+	// the store holds normalized vectors, switching searches to cosine.
+	normalize  bool
+	normalized bool
+	// maxCount caps the store, evicting per evict once exceeded; see
+	// SetEviction.
+	maxCount    int
+	evict       EvictPolicy
+	accessTable string
+	// quantization is the storage format of the vectors in tableName; see
+	// SetQuantization.
+	quantization Quantization
 }
 
+// DefaultBruteForceLimit is the largest store a custom distance function may
+// scan without forcing.
+const DefaultBruteForceLimit = 10000
+
+// maxKeyRehash bounds how many alternative rowids are probed when a key's
+// hash collides with a different key.
+const maxKeyRehash = 8
+
 // VectorResult represents a vector search result
 type VectorResult struct {
 	ID       int64     `json:"id"`
@@ -133,69 +168,640 @@ type VectorResult struct {
 	Distance float64   `json:"distance"`
 }
 
-// NewVectorDB creates a new vector database instance with the given database and table name
+// NewVectorDB creates a new vector database instance with the given database and table name.
+// A store that already exists keeps the dimension it was created or last
+// re-embedded with (see Deps.Reembed); dimensions applies to new stores.
 func NewVectorDB(ctx context.Context, db *sql.DB, tableName string, dimensions int) (*VectorDB, error) {
 	vs := &VectorDB{
 		db:         db,
 		tableName:  tableName,
 		dimensions: dimensions,
+		keyHash:    hashKey,
+
+		bruteForceLimit: DefaultBruteForceLimit,
+		quantization:    QuantizationNone,
 	}
 
 	if vs.tableName == "" {
 		vs.tableName = "vectors"
 	}
+	vs.baseTable = vs.tableName
+	vs.keysTable = vs.tableName + "_keys"
+	vs.textTable = vs.tableName + "_text"
+	vs.normsTable = vs.tableName + "_norms"
+	vs.accessTable = vs.tableName + "_access"
+	vs.dimsTable = vs.tableName + "_dims"
+
+	// Map textual keys to rowids so hash collisions are detected
+	keysQuery := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(id INTEGER PRIMARY KEY, key TEXT UNIQUE)", vs.keysTable)
+	if _, err := vs.db.ExecContext(ctx, keysQuery); err != nil {
+		return nil, fmt.Errorf("failed to create vector keys table: %w", err)
+	}
+
+	// Keep the text each key was embedded from, so vectors can be rebuilt
+	// with another model (see Deps.Reembed)
+	textQuery := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(key TEXT PRIMARY KEY, text TEXT NOT NULL)", vs.textTable)
+	if _, err := vs.db.ExecContext(ctx, textQuery); err != nil {
+		return nil, fmt.Errorf("failed to create vector text table: %w", err)
+	}
 
+	// Original norms of vectors stored normalized
+	normsQuery := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(id INTEGER PRIMARY KEY, norm REAL NOT NULL)", vs.normsTable)
+	if _, err := vs.db.ExecContext(ctx, normsQuery); err != nil {
+		return nil, fmt.Errorf("failed to create vector norms table: %w", err)
+	}
+	var normalized int
+	if err := vs.db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s)", vs.normsTable)).Scan(&normalized); err != nil {
+		return nil, fmt.Errorf("failed to inspect vector norms: %w", err)
+	}
+	vs.normalized = normalized == 1
+
+	// Write and search times used to pick vectors to evict
+	accessQuery := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(id INTEGER PRIMARY KEY, written INTEGER NOT NULL, accessed INTEGER NOT NULL)", vs.accessTable)
+	if _, err := vs.db.ExecContext(ctx, accessQuery); err != nil {
+		return nil, fmt.Errorf("failed to create vector access table: %w", err)
+	}
+
+	// The dimension of the stored vectors, which survives a resize
+	dimsQuery := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(id INTEGER PRIMARY KEY CHECK (id = 0), dimensions INTEGER NOT NULL)", vs.dimsTable)
+	if _, err := vs.db.ExecContext(ctx, dimsQuery); err != nil {
+		return nil, fmt.Errorf("failed to create vector dimensions table: %w", err)
+	}
+	err := vs.db.QueryRowContext(ctx, fmt.Sprintf("SELECT dimensions FROM %s WHERE id=0", vs.dimsTable)).Scan(&vs.dimensions)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = vs.saveDimensions(ctx, vs.db)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vector dimensions: %w", err)
+	}
+
+	if err := vs.createVectorTable(ctx, vs.db); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// saveDimensions records vs.dimensions as the dimension of the store.
+func (vs *VectorDB) saveDimensions(ctx context.Context, q DBTX) error {
+	query := fmt.Sprintf("INSERT INTO %s(id, dimensions) VALUES (0, ?) ON CONFLICT(id) DO UPDATE SET dimensions=excluded.dimensions", vs.dimsTable)
+	_, err := q.ExecContext(ctx, query, vs.dimensions)
+	return err
+}
+
+// createVectorTable creates the vector table for vs.dimensions in q, using
+// the vec extension when it is loaded and vectors are not quantized.
+func (vs *VectorDB) createVectorTable(ctx context.Context, q DBTX) error {
+	if isQuantized(vs.quantization) {
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(rowid INTEGER PRIMARY KEY, embedding BLOB)", vs.tableName)
+		if _, err := q.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create quantized vector table: %w", err)
+		}
+		vs.vtAvailable = false
+		return nil
+	}
 	// Try to create the virtual table using the vec extension
-	query := fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING vec0(embedding float[%d])", vs.tableName, dimensions)
-	if _, err := vs.db.ExecContext(ctx, query); err != nil {
+	query := fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING vec0(embedding float[%d])", vs.tableName, vs.dimensions)
+	if _, err := q.ExecContext(ctx, query); err != nil {
 		// Fallback: use a regular table with BLOB storage if vec extension is unavailable
 		fallback := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(rowid INTEGER PRIMARY KEY, embedding BLOB)", vs.tableName)
-		if _, err2 := vs.db.ExecContext(ctx, fallback); err2 != nil {
-			return nil, fmt.Errorf("failed to create vector table (fallback): %w (original: %v)", err2, err)
+		if _, err2 := q.ExecContext(ctx, fallback); err2 != nil {
+			return fmt.Errorf("failed to create vector table (fallback): %w (original: %v)", err2, err)
 		}
 		vs.vtAvailable = false
-		return vs, nil
+		return nil
 	}
 	vs.vtAvailable = true
-	return vs, nil
+	return nil
 }
 
 // InsertVector inserts a vector with the given ID
 func (vs *VectorDB) InsertVector(ctx context.Context, id uint64, vector []float32) error {
+	return inTx(ctx, vs.db, func(q DBTX) error {
+		return vs.insertVector(ctx, q, id, vector, vs.normalize)
+	})
+}
+
+func (vs *VectorDB) insertVector(ctx context.Context, q DBTX, id uint64, vector []float32, normalize bool) error {
 	if len(vector) != vs.dimensions {
-		return fmt.Errorf("vector dimension mismatch: expected %d, got %d", vs.dimensions, len(vector))
+		return dimensionMismatch(vs.dimensions, len(vector))
 	}
 
-	// Convert float32 slice to byte slice
-	vectorBytes := make([]byte, len(vector)*4) // 4 bytes per float32
-	for i, f := range vector {
-		bits := *(*uint32)(unsafe.Pointer(&f))
-		vectorBytes[i*4] = byte(bits)
-		vectorBytes[i*4+1] = byte(bits >> 8)
-		vectorBytes[i*4+2] = byte(bits >> 16)
-		vectorBytes[i*4+3] = byte(bits >> 24)
+	rowid := int64(id)
+	if normalize {
+		var err error
+		if vector, err = vs.normalizeVector(ctx, q, rowid, vector); err != nil {
+			return err
+		}
 	}
+	vectorBytes := vs.encodeVector(vector)
 
-	rowid := int64(id)
 	if vs.vtAvailable {
 		query := fmt.Sprintf("INSERT INTO %s(rowid, embedding) VALUES (?, ?)", vs.tableName)
-		if _, err := vs.db.ExecContext(ctx, query, rowid, vectorBytes); err != nil {
+		if _, err := q.ExecContext(ctx, query, rowid, vectorBytes); err != nil {
 			return fmt.Errorf("failed to insert vector: %w", err)
 		}
-		return nil
+		return vs.written(ctx, q, rowid)
 	}
 	// Fallback: use INSERT OR REPLACE on regular table
 	query := fmt.Sprintf("INSERT OR REPLACE INTO %s(rowid, embedding) VALUES (?, ?)", vs.tableName)
-	if _, err := vs.db.ExecContext(ctx, query, rowid, vectorBytes); err != nil {
+	if _, err := q.ExecContext(ctx, query, rowid, vectorBytes); err != nil {
 		return fmt.Errorf("failed to insert vector (fallback): %w", err)
 	}
+	return vs.written(ctx, q, rowid)
+}
+
+// UpsertVectorByKey stores vector under a textual key, replacing any vector
+// previously stored for the same key.
+func (vs *VectorDB) UpsertVectorByKey(ctx context.Context, key string, vector []float32) error {
+	return vs.upsertVectorByKey(ctx, vs.db, key, vector, vs.normalize)
+}
+
+// upsertVectorByKey is UpsertVectorByKey on q, normalizing vector when
+// normalize is set regardless of the store option. The key mapping, vector
+// and its norm and write time are stored as one unit.
+func (vs *VectorDB) upsertVectorByKey(ctx context.Context, q DBTX, key string, vector []float32, normalize bool) error {
+	if len(vector) != vs.dimensions {
+		return dimensionMismatch(vs.dimensions, len(vector))
+	}
+	return inTx(ctx, q, func(q DBTX) error {
+		id, _, err := vs.resolveKey(ctx, q, key, true)
+		if err != nil {
+			return err
+		}
+		if vs.vtAvailable {
+			// vec0 tables do not support INSERT OR REPLACE
+			if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid=?", vs.tableName), id); err != nil {
+				return fmt.Errorf("failed to replace vector: %w", err)
+			}
+		}
+		return vs.insertVector(ctx, q, uint64(id), vector, normalize)
+	})
+}
+
+// GetVectorByKey returns the vector stored under key, if any.
+func (vs *VectorDB) GetVectorByKey(ctx context.Context, key string) ([]float32, bool, error) {
+	return vs.getVectorByKey(ctx, vs.db, key)
+}
+
+func (vs *VectorDB) getVectorByKey(ctx context.Context, q DBTX, key string) ([]float32, bool, error) {
+	id, ok, err := vs.resolveKey(ctx, q, key, false)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var blob []byte
+	err = q.QueryRowContext(ctx, fmt.Sprintf("SELECT embedding FROM %s WHERE rowid=?", vs.tableName), id).Scan(&blob)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get vector: %w", err)
+	}
+	vec, err := vs.decodeVector(blob)
+	if err != nil {
+		return nil, false, err
+	}
+	return vec, true, nil
+}
+
+// DeleteVectorByKey removes the vector stored under key and its key mapping.
+func (vs *VectorDB) DeleteVectorByKey(ctx context.Context, key string) error {
+	return vs.deleteVectorByKey(ctx, vs.db, key)
+}
+
+// deleteVectorByKey is DeleteVectorByKey on q. The vector goes with its key
+// mapping, norm, access time and text as one unit.
+func (vs *VectorDB) deleteVectorByKey(ctx context.Context, q DBTX, key string) error {
+	return inTx(ctx, q, func(q DBTX) error {
+		id, ok, err := vs.resolveKey(ctx, q, key, false)
+		if err != nil || !ok {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid=?", vs.tableName), id); err != nil {
+			return fmt.Errorf("failed to delete vector: %w", err)
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id=?", vs.keysTable), id); err != nil {
+			return fmt.Errorf("failed to delete vector key: %w", err)
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id=?", vs.normsTable), id); err != nil {
+			return fmt.Errorf("failed to delete vector norm: %w", err)
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id=?", vs.accessTable), id); err != nil {
+			return fmt.Errorf("failed to delete vector access time: %w", err)
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key=?", vs.textTable), key); err != nil {
+			return fmt.Errorf("failed to delete vector text: %w", err)
+		}
+		return nil
+	})
+}
+
+// StoreText records the text the vector under key was embedded from.
+func (vs *VectorDB) StoreText(ctx context.Context, key, text string) error {
+	return vs.storeText(ctx, vs.db, key, text)
+}
+
+func (vs *VectorDB) storeText(ctx context.Context, q DBTX, key, text string) error {
+	query := fmt.Sprintf("INSERT INTO %s(key, text) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET text=excluded.text", vs.textTable)
+	if _, err := q.ExecContext(ctx, query, key, text); err != nil {
+		return fmt.Errorf("failed to store vector text: %w", err)
+	}
+	return nil
+}
+
+// inTx runs fn on q as one unit. On a *sql.DB, fn runs in a transaction that
+// commits when fn succeeds; inside an open memory:begin or memory:transaction
+// it runs in a savepoint that is rolled back on failure, leaving the enclosing
+// transaction open.
+func inTx(ctx context.Context, q DBTX, fn func(q DBTX) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		if _, err := q.ExecContext(ctx, "SAVEPOINT memory_unit"); err != nil {
+			return err
+		}
+		if err := fn(q); err != nil {
+			_, _ = q.ExecContext(ctx, "ROLLBACK TO SAVEPOINT memory_unit")
+			_, _ = q.ExecContext(ctx, "RELEASE SAVEPOINT memory_unit")
+			return err
+		}
+		_, err := q.ExecContext(ctx, "RELEASE SAVEPOINT memory_unit")
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteBatchSize bounds the keys bound into one DELETE statement, keeping
+// well under SQLite's host parameter limit.
+const deleteBatchSize = 500
+
+// DeleteVectorsByKeys removes the vectors stored under keys and their key
+// mappings in a single transaction, returning how many were deleted. Unknown
+// keys are ignored.
+func (vs *VectorDB) DeleteVectorsByKeys(ctx context.Context, keys []string) (int64, error) {
+	return vs.deleteVectorsByKeys(ctx, vs.db, keys)
+}
+
+func (vs *VectorDB) deleteVectorsByKeys(ctx context.Context, q DBTX, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	var deleted int64
+	err := inTx(ctx, q, func(tx DBTX) error {
+		deleted = 0
+		return vs.deleteKeyBatches(ctx, tx, keys, &deleted)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// deleteKeyBatches deletes the vectors of keys in batches within tx, adding
+// the number removed to deleted.
+func (vs *VectorDB) deleteKeyBatches(ctx context.Context, tx DBTX, keys []string, deleted *int64) error {
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		batch := keys[start:min(start+deleteBatchSize, len(keys))]
+		args := make([]any, len(batch))
+		for i, key := range batch {
+			args[i] = key
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT id FROM %s WHERE key IN (%s))", vs.tableName, vs.keysTable, placeholders), args...)
+		if err != nil {
+			return fmt.Errorf("failed to delete vectors: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to count deleted vectors: %w", err)
+		}
+		*deleted += n
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE key IN (%s))", vs.normsTable, vs.keysTable, placeholders), args...); err != nil {
+			return fmt.Errorf("failed to delete vector norms: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE key IN (%s))", vs.accessTable, vs.keysTable, placeholders), args...); err != nil {
+			return fmt.Errorf("failed to delete vector access times: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key IN (%s)", vs.keysTable, placeholders), args...); err != nil {
+			return fmt.Errorf("failed to delete vector keys: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key IN (%s)", vs.textTable, placeholders), args...); err != nil {
+			return fmt.Errorf("failed to delete vector texts: %w", err)
+		}
+	}
 	return nil
 }
 
-// SearchSimilarVectors searches for vectors similar to the query vector
+// Truncate removes every vector with its key mapping, stored text, norm and
+// access time in a single transaction, leaving the KV and graph stores of the
+// database untouched.
+func (vs *VectorDB) Truncate(ctx context.Context) error {
+	return vs.truncate(ctx, vs.db)
+}
+
+func (vs *VectorDB) truncate(ctx context.Context, q DBTX) error {
+	err := inTx(ctx, q, func(tx DBTX) error {
+		for _, table := range []string{vs.tableName, vs.keysTable, vs.textTable, vs.normsTable, vs.accessTable} {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", table)); err != nil {
+				return fmt.Errorf("failed to truncate %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	vs.normalized = false
+	return nil
+}
+
+// storedText is a vector key with the text it was embedded from. hasText is
+// false for vectors stored without text (memory:upsertvector).
+type storedText struct {
+	id      int64
+	key     string
+	text    string
+	hasText bool
+}
+
+// storedTexts returns every vector key in key order with its stored text.
+func (vs *VectorDB) storedTexts(ctx context.Context, q DBTX) ([]storedText, error) {
+	query := fmt.Sprintf("SELECT k.id, k.key, t.text FROM %s k LEFT JOIN %s t ON t.key = k.key ORDER BY k.key", vs.keysTable, vs.textTable)
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vector texts: %w", err)
+	}
+	defer rows.Close()
+	var out []storedText
+	for rows.Next() {
+		var st storedText
+		var text sql.NullString
+		if err := rows.Scan(&st.id, &st.key, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan vector text: %w", err)
+		}
+		st.text, st.hasText = text.String, text.Valid
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// replaceVectors overwrites the vectors of existing rowids in q as one
+// unit.
+func (vs *VectorDB) replaceVectors(ctx context.Context, q DBTX, vectors map[int64][]float32) error {
+	return inTx(ctx, q, func(tx DBTX) error {
+		for id, vec := range vectors {
+			if len(vec) != vs.dimensions {
+				return dimensionMismatch(vs.dimensions, len(vec))
+			}
+			if vs.normalize {
+				var err error
+				if vec, err = vs.normalizeVector(ctx, tx, id, vec); err != nil {
+					return err
+				}
+			}
+			// vec0 tables do not support INSERT OR REPLACE
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid=?", vs.tableName), id); err != nil {
+				return fmt.Errorf("failed to replace vector: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(rowid, embedding) VALUES (?, ?)", vs.tableName), id, vs.encodeVector(vec)); err != nil {
+				return fmt.Errorf("failed to insert vector: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// resize drops every stored vector and recreates the vector table for
+// dimensions, recording the new dimension for later opens. Key mappings and
+// texts are kept so the vectors can be rebuilt.
+func (vs *VectorDB) resize(ctx context.Context, q DBTX, dimensions int) error {
+	if _, err := q.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", vs.tableName)); err != nil {
+		return fmt.Errorf("failed to drop vector table: %w", err)
+	}
+	if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", vs.normsTable)); err != nil {
+		return fmt.Errorf("failed to clear vector norms: %w", err)
+	}
+	prev := vs.dimensions
+	vs.dimensions = dimensions
+	if err := vs.saveDimensions(ctx, q); err != nil {
+		vs.dimensions = prev
+		return fmt.Errorf("failed to save vector dimensions: %w", err)
+	}
+	vs.normalized = false
+	return vs.createVectorTable(ctx, q)
+}
+
+// Count returns the number of vectors in the store.
+func (vs *VectorDB) Count(ctx context.Context) (int64, error) {
+	return vs.count(ctx, vs.db)
+}
+
+func (vs *VectorDB) count(ctx context.Context, q DBTX) (int64, error) {
+	var count int64
+	if err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", vs.tableName)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count vectors: %w", err)
+	}
+	return count, nil
+}
+
+// KeysForIDs returns the textual keys of the given rowids in one query.
+// Rowids that were not stored by key are absent from the result.
+func (vs *VectorDB) KeysForIDs(ctx context.Context, ids []int64) (map[int64]string, error) {
+	return vs.keysForIDs(ctx, vs.db, ids)
+}
+
+func (vs *VectorDB) keysForIDs(ctx context.Context, q DBTX, ids []int64) (map[int64]string, error) {
+	keys := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return keys, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := fmt.Sprintf("SELECT id, key FROM %s WHERE id IN (?%s)", vs.keysTable, strings.Repeat(",?", len(ids)-1))
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up vector keys: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return nil, fmt.Errorf("failed to scan vector key: %w", err)
+		}
+		keys[id] = key
+	}
+	return keys, rows.Err()
+}
+
+// resolveKey returns the rowid mapped to key in q. When create is set and
+// the key is unknown, a rowid is allocated from the key's hash; if that rowid
+// already belongs to a different key, the key is rehashed with an attempt
+// suffix. Without create, an unmapped key resolves to its hash, where vectors
+// stored before key mappings existed live, unless another key owns it.
+func (vs *VectorDB) resolveKey(ctx context.Context, q DBTX, key string, create bool) (int64, bool, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE key=?", vs.keysTable), key).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("failed to resolve vector key: %w", err)
+	}
+	if !create {
+		id = int64(vs.keyHash(key))
+		var owner string
+		err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT key FROM %s WHERE id=?", vs.keysTable), id).Scan(&owner)
+		if err == sql.ErrNoRows {
+			return id, true, nil
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to resolve vector key: %w", err)
+		}
+		return 0, false, nil
+	}
+
+	candidate := key
+	for attempt := 0; attempt < maxKeyRehash; attempt++ {
+		if attempt > 0 {
+			candidate = fmt.Sprintf("%s\x00%d", key, attempt)
+		}
+		id = int64(vs.keyHash(candidate))
+		var owner string
+		err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT key FROM %s WHERE id=?", vs.keysTable), id).Scan(&owner)
+		if err == sql.ErrNoRows {
+			if _, err := q.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(id, key) VALUES (?, ?)", vs.keysTable), id, key); err != nil {
+				return 0, false, fmt.Errorf("failed to store vector key: %w", err)
+			}
+			return id, true, nil
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to resolve vector key: %w", err)
+		}
+	}
+	return 0, false, fmt.Errorf("vector key %q collides with existing keys after %d attempts", key, maxKeyRehash)
+}
+
+// SetDistanceFunc replaces the built-in metric used by SearchSimilarVectors
+// with fn, where smaller values rank as more similar. A nil fn restores the
+// built-in metric.
+//
+// A custom function cannot use the vec index: every search reads and decodes
+// all stored vectors and scores them in Go, so cost grows linearly with the
+// store. Searches fail once the store holds more vectors than the brute-force
+// limit (see SetBruteForceLimit) unless force is true.
+func (vs *VectorDB) SetDistanceFunc(fn func(a, b []float32) float64, force bool) {
+	vs.distance = fn
+	vs.forceDistance = force
+}
+
+// SetBruteForceLimit sets the largest store a custom distance function may
+// scan without forcing. A limit <= 0 removes the bound.
+func (vs *VectorDB) SetBruteForceLimit(limit int) {
+	vs.bruteForceLimit = limit
+}
+
+// SetNormalize controls whether vectors are L2-normalized before they are
+// stored. The original norm of each normalized vector is kept alongside it.
+//
+// Once a store holds normalized vectors, searches normalize the query as well
+// and rank by cosine distance (1 - dot product), reported in [0, 2]. Mixing
+// normalized and unnormalized vectors in one store is unsupported: the
+// unnormalized ones rank as if they had unit length.
+func (vs *VectorDB) SetNormalize(normalize bool) {
+	vs.normalize = normalize
+}
+
+// normalizeVector returns vector scaled to unit length and records its
+// original norm under id. Zero vectors cannot be normalized and are returned
+// unchanged with a warning.
+func (vs *VectorDB) normalizeVector(ctx context.Context, q DBTX, id int64, vector []float32) ([]float32, error) {
+	norm := l2Norm(vector)
+	if norm == 0 {
+		slog.WarnContext(ctx, "memory: cannot normalize zero vector, storing it unnormalized", "table", vs.tableName, "id", id)
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id=?", vs.normsTable), id); err != nil {
+			return nil, fmt.Errorf("failed to clear vector norm: %w", err)
+		}
+		return vector, nil
+	}
+	query := fmt.Sprintf("INSERT INTO %s(id, norm) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET norm=excluded.norm", vs.normsTable)
+	if _, err := q.ExecContext(ctx, query, id, norm); err != nil {
+		return nil, fmt.Errorf("failed to store vector norm: %w", err)
+	}
+	vs.normalized = true
+	return scaleVector(vector, 1/norm), nil
+}
+
+// l2Norm returns the Euclidean length of v.
+func l2Norm(v []float32) float64 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	return math.Sqrt(sum)
+}
+
+func scaleVector(v []float32, factor float64) []float32 {
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = float32(float64(f) * factor)
+	}
+	return out
+}
+
+// dotDistance ranks unit vectors by cosine distance, 1 - a·b.
+func dotDistance(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return 1 - dot
+}
+
+// SearchSimilarVectors searches for vectors similar to the query vector.
+// In a capped store, the results count as accessed for EvictLRU.
 func (vs *VectorDB) SearchSimilarVectors(ctx context.Context, queryVector []float32, limit int) ([]VectorResult, error) {
+	return vs.searchSimilarVectors(ctx, vs.db, queryVector, limit)
+}
+
+func (vs *VectorDB) searchSimilarVectors(ctx context.Context, q DBTX, queryVector []float32, limit int) ([]VectorResult, error) {
+	results, err := vs.searchSimilar(ctx, q, queryVector, limit)
+	if err == nil {
+		vs.accessed(ctx, q, results)
+	}
+	return results, err
+}
+
+func (vs *VectorDB) searchSimilar(ctx context.Context, q DBTX, queryVector []float32, limit int) ([]VectorResult, error) {
 	if len(queryVector) != vs.dimensions {
-		return nil, fmt.Errorf("query vector dimension mismatch: expected %d, got %d", vs.dimensions, len(queryVector))
+		return nil, fmt.Errorf("query %w", dimensionMismatch(vs.dimensions, len(queryVector)))
+	}
+
+	if vs.distance != nil {
+		if !vs.forceDistance && vs.bruteForceLimit > 0 {
+			var count int
+			if err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", vs.tableName)).Scan(&count); err != nil {
+				return nil, fmt.Errorf("failed to count vectors: %w", err)
+			}
+			if count > vs.bruteForceLimit {
+				return nil, fmt.Errorf("custom distance search over %d vectors exceeds brute-force limit %d", count, vs.bruteForceLimit)
+			}
+		}
+		return vs.scanSimilar(ctx, q, queryVector, limit, vs.distance)
+	}
+
+	if vs.normalized {
+		if norm := l2Norm(queryVector); norm > 0 {
+			queryVector = scaleVector(queryVector, 1/norm)
+		}
 	}
 
 	if vs.vtAvailable {
@@ -217,7 +823,7 @@ func (vs *VectorDB) SearchSimilarVectors(ctx context.Context, queryVector []floa
 			LIMIT ?
 		`, vs.tableName)
 
-		rows, err := vs.db.QueryContext(ctx, query, queryBytes, limit)
+		rows, err := q.QueryContext(ctx, query, queryBytes, limit)
 		if err != nil {
 			return nil, fmt.Errorf("failed to search vectors: %w", err)
 		}
@@ -231,6 +837,10 @@ func (vs *VectorDB) SearchSimilarVectors(ctx context.Context, queryVector []floa
 				continue
 			}
 
+			if vs.normalized {
+				// For unit vectors |a-b|² = 2 - 2a·b, so this is 1 - a·b
+				distance = distance * distance / 2
+			}
 			results = append(results, VectorResult{
 				ID:       id,
 				Distance: distance,
@@ -240,8 +850,26 @@ func (vs *VectorDB) SearchSimilarVectors(ctx context.Context, queryVector []floa
 		return results, nil
 	}
 
-	// Fallback: brute-force scan using Go distance computation
-	rows, err := vs.db.QueryContext(ctx, fmt.Sprintf("SELECT rowid, embedding FROM %s", vs.tableName))
+	if vs.normalized {
+		return vs.scanSimilar(ctx, q, queryVector, limit, dotDistance)
+	}
+	// Fallback: brute-force scan using Euclidean distance
+	return vs.scanSimilar(ctx, q, queryVector, limit, squaredL2)
+}
+
+// squaredL2 returns the squared Euclidean distance between a and b.
+func squaredL2(a, b []float32) float64 {
+	var d float64
+	for i := range a {
+		dx := float64(a[i]) - float64(b[i])
+		d += dx * dx
+	}
+	return d
+}
+
+// scanSimilar ranks every stored vector against queryVector using dist.
+func (vs *VectorDB) scanSimilar(ctx context.Context, q DBTX, queryVector []float32, limit int, dist func(a, b []float32) float64) ([]VectorResult, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT rowid, embedding FROM %s", vs.tableName))
 	if err != nil {
 		return nil, fmt.Errorf("failed to search vectors (fallback): %w", err)
 	}
@@ -254,17 +882,11 @@ func (vs *VectorDB) SearchSimilarVectors(ctx context.Context, queryVector []floa
 		if err := rows.Scan(&id, &blob); err != nil {
 			continue
 		}
-		vec, err := decodeFloat32Blob(blob)
+		vec, err := vs.decodeVector(blob)
 		if err != nil || len(vec) != vs.dimensions {
 			continue
 		}
-		// Euclidean distance
-		var d float64
-		for i := 0; i < vs.dimensions; i++ {
-			dx := float64(vec[i]) - float64(queryVector[i])
-			d += dx * dx
-		}
-		tmp = append(tmp, struct{ id int64; dist float64 }{id: id, dist: d})
+		tmp = append(tmp, struct{ id int64; dist float64 }{id: id, dist: dist(vec, queryVector)})
 	}
 
 	sort.Slice(tmp, func(i, j int) bool { return tmp[i].dist < tmp[j].dist })
@@ -285,6 +907,17 @@ func (vs *VectorDB) Close() error {
 }
 
 // decodeFloat32Blob decodes a little-endian byte slice into a float32 slice.
+// encodeFloat32Blob converts vector to the little-endian blob stored in the
+// embedding column.
+func encodeFloat32Blob(vector []float32) []byte {
+	b := make([]byte, len(vector)*4) // 4 bytes per float32
+	for i, f := range vector {
+		bits := *(*uint32)(unsafe.Pointer(&f))
+		binary.LittleEndian.PutUint32(b[i*4:], bits)
+	}
+	return b
+}
+
 func decodeFloat32Blob(b []byte) ([]float32, error) {
 	if len(b)%4 != 0 {
 		return nil, fmt.Errorf("invalid vector blob length: %d", len(b))
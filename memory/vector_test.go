@@ -2,7 +2,9 @@ package memory
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"slices"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -340,3 +342,404 @@ func TestVectorStoreConcurrency(t *testing.T) {
 		}
 	})
 }
+
+func TestVectorKeyCollision(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewDB(ctx, ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Skipf("Skipping test - vector extension not available: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewVectorDB(ctx, db, "test_vectors", 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer store.Close()
+
+	// Force every key onto the same first-choice rowid
+	base := store.keyHash
+	store.keyHash = func(key string) uint64 {
+		if key == "alpha" || key == "beta" {
+			return 42
+		}
+		return base(key)
+	}
+
+	if err := store.UpsertVectorByKey(ctx, "alpha", []float32{1, 0}); err != nil {
+		t.Fatalf("upsert alpha: %v", err)
+	}
+	if err := store.UpsertVectorByKey(ctx, "beta", []float32{0, 1}); err != nil {
+		t.Fatalf("upsert beta: %v", err)
+	}
+
+	for key, want := range map[string][]float32{"alpha": {1, 0}, "beta": {0, 1}} {
+		got, ok, err := store.GetVectorByKey(ctx, key)
+		if err != nil || !ok {
+			t.Fatalf("get %s: ok=%v err=%v", key, ok, err)
+		}
+		if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("vector for %s = %v, want %v", key, got, want)
+		}
+	}
+
+	if err := store.DeleteVectorByKey(ctx, "alpha"); err != nil {
+		t.Fatalf("delete alpha: %v", err)
+	}
+	if _, ok, _ := store.GetVectorByKey(ctx, "alpha"); ok {
+		t.Error("expected alpha to be deleted")
+	}
+	if _, ok, _ := store.GetVectorByKey(ctx, "beta"); !ok {
+		t.Error("expected beta to survive deleting alpha")
+	}
+}
+
+func TestVectorCustomDistance(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewDB(ctx, ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Skipf("Skipping test - vector extension not available: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewVectorDB(ctx, db, "custom_vectors", 3)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer store.Close()
+
+	// Identical in the first two dimensions; only the third separates them.
+	vectors := map[uint64][]float32{
+		1: {0, 0, 9},
+		2: {0, 0, 1},
+		3: {0, 0, 5},
+	}
+	for id, v := range vectors {
+		if err := store.InsertVector(ctx, id, v); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+	}
+
+	store.SetDistanceFunc(func(a, b []float32) float64 {
+		return math.Abs(float64(a[2]) - float64(b[2]))
+	}, false)
+
+	results, err := store.SearchSimilarVectors(ctx, []float32{100, -100, 0}, 3)
+	if err != nil {
+		t.Fatalf("Custom distance search failed: %v", err)
+	}
+	want := []int64{2, 3, 1}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(results))
+	}
+	for i, id := range want {
+		if results[i].ID != id {
+			t.Errorf("Result %d: expected ID %d, got %d", i, id, results[i].ID)
+		}
+	}
+
+	t.Run("BruteForceLimit", func(t *testing.T) {
+		store.SetBruteForceLimit(2)
+		if _, err := store.SearchSimilarVectors(ctx, []float32{0, 0, 0}, 1); err == nil {
+			t.Error("Expected error when store exceeds brute-force limit")
+		}
+		store.SetDistanceFunc(store.distance, true)
+		if _, err := store.SearchSimilarVectors(ctx, []float32{0, 0, 0}, 1); err != nil {
+			t.Errorf("Expected forced search to succeed: %v", err)
+		}
+	})
+}
+
+func TestVectorNormalize(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewDB(ctx, ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Skipf("Skipping test - vector extension not available: %v", err)
+	}
+	defer db.Close()
+
+	// "near" points the same way as the query but is far away in Euclidean
+	// terms; "aside" is close but orthogonal.
+	vectors := map[string][]float32{
+		"near":  {10, 1},
+		"aside": {0, 1},
+	}
+	query := []float32{1, 0}
+	search := func(store *VectorDB) []VectorResult {
+		t.Helper()
+		for key, v := range vectors {
+			if err := store.UpsertVectorByKey(ctx, key, v); err != nil {
+				t.Fatalf("Failed to upsert %s: %v", key, err)
+			}
+		}
+		results, err := store.SearchSimilarVectors(ctx, query, 2)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(results))
+		}
+		return results
+	}
+	keyOf := func(store *VectorDB, id int64) string {
+		t.Helper()
+		keys, err := store.KeysForIDs(ctx, []int64{id})
+		if err != nil {
+			t.Fatalf("Failed to look up key: %v", err)
+		}
+		return keys[id]
+	}
+
+	raw, err := NewVectorDB(ctx, db, "raw_vectors", 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	if got := keyOf(raw, search(raw)[0].ID); got != "aside" {
+		t.Errorf("Unnormalized nearest = %s, want aside", got)
+	}
+
+	unit, err := NewVectorDB(ctx, db, "unit_vectors", 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	unit.SetNormalize(true)
+	results := search(unit)
+	if got := keyOf(unit, results[0].ID); got != "near" {
+		t.Errorf("Normalized nearest = %s, want near", got)
+	}
+	wantCos := 10 / math.Sqrt(101)
+	if math.Abs(results[0].Distance-(1-wantCos)) > 1e-6 {
+		t.Errorf("Cosine distance = %f, want %f", results[0].Distance, 1-wantCos)
+	}
+	if math.Abs(results[1].Distance-1) > 1e-6 {
+		t.Errorf("Orthogonal cosine distance = %f, want 1", results[1].Distance)
+	}
+
+	vec, _, err := unit.GetVectorByKey(ctx, "near")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if math.Abs(l2Norm(vec)-1) > 1e-6 {
+		t.Errorf("Stored vector norm = %f, want 1", l2Norm(vec))
+	}
+	var norm float64
+	if err := db.QueryRowContext(ctx, "SELECT norm FROM unit_vectors_norms WHERE id=?", results[0].ID).Scan(&norm); err != nil {
+		t.Fatalf("Failed to read stored norm: %v", err)
+	}
+	if math.Abs(norm-math.Sqrt(101)) > 1e-4 {
+		t.Errorf("Stored norm = %f, want %f", norm, math.Sqrt(101))
+	}
+
+	t.Run("ZeroVector", func(t *testing.T) {
+		if err := unit.UpsertVectorByKey(ctx, "zero", []float32{0, 0}); err != nil {
+			t.Fatalf("Failed to upsert zero vector: %v", err)
+		}
+		vec, ok, err := unit.GetVectorByKey(ctx, "zero")
+		if err != nil || !ok || vec[0] != 0 || vec[1] != 0 {
+			t.Errorf("Zero vector = %v (ok %v, err %v), want stored unchanged", vec, ok, err)
+		}
+	})
+}
+
+func TestVectorEviction(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewDB(ctx, ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Skipf("Skipping test - vector extension not available: %v", err)
+	}
+	defer db.Close()
+
+	has := func(store *VectorDB, key string) bool {
+		t.Helper()
+		_, ok, err := store.GetVectorByKey(ctx, key)
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		return ok
+	}
+
+	t.Run("LRU", func(t *testing.T) {
+		store, err := NewVectorDB(ctx, db, "lru_vectors", 2)
+		if err != nil {
+			t.Fatalf("Failed to create vector store: %v", err)
+		}
+		store.SetEviction(3, EvictLRU)
+		for key, vec := range map[string][]float32{"a": {1, 0}, "b": {0, 1}, "c": {-1, 0}} {
+			if err := store.UpsertVectorByKey(ctx, key, vec); err != nil {
+				t.Fatalf("upsert %s: %v", key, err)
+			}
+			if err := store.StoreText(ctx, key, key); err != nil {
+				t.Fatalf("store text %s: %v", key, err)
+			}
+		}
+		// Touch everything but b, so b is least recently used
+		for _, q := range [][]float32{{1, 0}, {-1, 0}} {
+			if _, err := store.SearchSimilarVectors(ctx, q, 1); err != nil {
+				t.Fatalf("search: %v", err)
+			}
+		}
+		if err := store.UpsertVectorByKey(ctx, "d", []float32{0, -1}); err != nil {
+			t.Fatalf("upsert d: %v", err)
+		}
+
+		if count, _ := store.Count(ctx); count != 3 {
+			t.Errorf("Expected 3 vectors after eviction, got %d", count)
+		}
+		if has(store, "b") {
+			t.Error("Expected least recently used vector b to be evicted")
+		}
+		for _, key := range []string{"a", "c", "d"} {
+			if !has(store, key) {
+				t.Errorf("Expected %s to survive eviction", key)
+			}
+		}
+		texts, err := store.storedTexts(ctx, db)
+		if err != nil {
+			t.Fatalf("stored texts: %v", err)
+		}
+		for _, st := range texts {
+			if st.key == "b" {
+				t.Error("Expected the key and text of b to be evicted with it")
+			}
+		}
+	})
+
+	t.Run("OldestManual", func(t *testing.T) {
+		store, err := NewVectorDB(ctx, db, "oldest_vectors", 2)
+		if err != nil {
+			t.Fatalf("Failed to create vector store: %v", err)
+		}
+		store.SetEviction(4, "")
+		for i, key := range []string{"k0", "k1", "k2", "k3"} {
+			if err := store.UpsertVectorByKey(ctx, key, []float32{float32(i), 1}); err != nil {
+				t.Fatalf("upsert %s: %v", key, err)
+			}
+		}
+		// Searching does not protect k0 under the write-order policy
+		if _, err := store.SearchSimilarVectors(ctx, []float32{0, 1}, 1); err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		store.SetEviction(2, EvictOldest)
+		evicted, err := store.Evict(ctx)
+		if err != nil {
+			t.Fatalf("evict: %v", err)
+		}
+		if evicted != 2 {
+			t.Errorf("Expected 2 vectors evicted, got %d", evicted)
+		}
+		for key, want := range map[string]bool{"k0": false, "k1": false, "k2": true, "k3": true} {
+			if got := has(store, key); got != want {
+				t.Errorf("%s present = %v, want %v", key, got, want)
+			}
+		}
+		if evicted, err := store.Evict(ctx); err != nil || evicted != 0 {
+			t.Errorf("Expected nothing left to evict, got %d, %v", evicted, err)
+		}
+	})
+}
+
+func TestVectorQuantization(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewDB(ctx, ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Skipf("Skipping test - vector extension not available: %v", err)
+	}
+	defer db.Close()
+
+	const dims = 16
+	// Each vector is strong in its own block of four dimensions
+	clustered := func(block int, noise float32) []float32 {
+		v := make([]float32, dims)
+		for i := range v {
+			v[i] = noise * float32(i%3)
+			if i/4 == block {
+				v[i] = 1 - noise*float32(i%4)
+			}
+		}
+		return v
+	}
+	keys := []string{"a", "b", "c", "d"}
+	top1 := func(store *VectorDB) []int64 {
+		t.Helper()
+		var ids []int64
+		for block := range keys {
+			results, err := store.SearchSimilarVectors(ctx, clustered(block, 0.05), 1)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Expected 1 result, got %d", len(results))
+			}
+			ids = append(ids, results[0].ID)
+		}
+		return ids
+	}
+
+	for _, tc := range []struct {
+		quantization Quantization
+		blobSize     int
+	}{
+		{QuantizationInt8, quantHeaderSize + dims},
+		{QuantizationBinary, quantHeaderSize + dims/8},
+	} {
+		t.Run(string(tc.quantization), func(t *testing.T) {
+			store, err := NewVectorDB(ctx, db, "quant_"+string(tc.quantization), dims)
+			if err != nil {
+				t.Fatalf("Failed to create vector store: %v", err)
+			}
+			for block, key := range keys {
+				if err := store.UpsertVectorByKey(ctx, key, clustered(block, 0.01)); err != nil {
+					t.Fatalf("upsert %s: %v", key, err)
+				}
+			}
+			want := top1(store)
+			for block, key := range keys {
+				if id, _, _ := store.resolveKey(ctx, db, key, false); want[block] != id {
+					t.Fatalf("float search for %s returned %d, want %d", key, want[block], id)
+				}
+			}
+
+			// Existing float vectors are converted in place
+			if err := store.SetQuantization(ctx, tc.quantization); err != nil {
+				t.Fatalf("set quantization: %v", err)
+			}
+			var size int
+			if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT length(embedding) FROM %s LIMIT 1", store.tableName)).Scan(&size); err != nil {
+				t.Fatalf("blob size: %v", err)
+			}
+			if size != tc.blobSize {
+				t.Errorf("Expected %d byte quantized vectors, got %d", tc.blobSize, size)
+			}
+			if got := top1(store); !slices.Equal(got, want) {
+				t.Errorf("quantized top-1 = %v, float top-1 = %v", got, want)
+			}
+
+			// New writes are quantized too
+			if err := store.UpsertVectorByKey(ctx, "a", clustered(0, 0.02)); err != nil {
+				t.Fatalf("upsert a: %v", err)
+			}
+			if got := top1(store); !slices.Equal(got, want) {
+				t.Errorf("top-1 after rewrite = %v, want %v", got, want)
+			}
+
+			if err := store.SetQuantization(ctx, QuantizationNone); err != nil {
+				t.Fatalf("clear quantization: %v", err)
+			}
+			if count, err := store.Count(ctx); err != nil || count != int64(len(keys)) {
+				t.Errorf("Expected %d vectors after converting back, got %d, %v", len(keys), count, err)
+			}
+			if got := top1(store); !slices.Equal(got, want) {
+				t.Errorf("top-1 after converting back = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := ParseQuantization("int4"); err == nil {
+		t.Error("Expected an error for an unknown quantization")
+	}
+}
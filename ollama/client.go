@@ -8,11 +8,16 @@ import (
 	"strings"
 
 	"github.com/ollama/ollama/api"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
 )
 
 type Client struct {
 	apiClient *api.Client
-	models    map[ModelName]*Model
+	// compat talks to Ollama's OpenAI-compatible /v1 endpoints, which accept
+	// the Chat Completions tools produced by the openai package.
+	compat openai.Client
+	models map[ModelName]*Model
 }
 
 type ClientOptions struct {
@@ -24,7 +29,8 @@ func NewClient(ctx context.Context, models map[ModelName]*Model, options *Client
 		options = &ClientOptions{}
 	}
 
-	apiClient, err := NewOllamaClient(options.BaseURL)
+	baseURL := ResolveBaseURL(options.BaseURL)
+	apiClient, err := NewOllamaClient(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Ollama client: %w", err)
 	}
@@ -36,7 +42,9 @@ func NewClient(ctx context.Context, models map[ModelName]*Model, options *Client
 
 	return &Client{
 		apiClient: apiClient,
-		models:    maps.Clone(models),
+		// Ollama ignores the API key, but the OpenAI client requires one
+		compat: openai.NewClient(option.WithBaseURL(baseURL+"/v1/"), option.WithAPIKey("ollama")),
+		models: maps.Clone(models),
 	}, nil
 }
 
@@ -71,6 +79,49 @@ func (c *Client) Generate(ctx context.Context, model ModelName, prompt string, s
 	return fullResponse.String(), nil
 }
 
+// GenerateStream streams a completion, calling onChunk with each piece of text
+// as it arrives, and returns the full response. An error from onChunk stops
+// the stream.
+func (c *Client) GenerateStream(ctx context.Context, model ModelName, prompt string, onChunk func(string) error) (string, error) {
+	maybeModel, ok := c.models[model]
+	if !ok {
+		// Dynamically register the model if not found
+		slog.Debug("ollama.client.generateStream: dynamically registering model", "model", model)
+		maybeModel = &Model{
+			Name:   string(model),
+			Stream: true,
+		}
+		c.models[model] = maybeModel
+	}
+
+	stream := true
+	req := &api.GenerateRequest{
+		Model:  maybeModel.Name,
+		Prompt: prompt,
+		Stream: &stream,
+	}
+
+	var fullResponse strings.Builder
+	err := c.apiClient.Generate(ctx, req, func(resp api.GenerateResponse) error {
+		if resp.Response == "" {
+			return nil
+		}
+		fullResponse.WriteString(resp.Response)
+		return onChunk(resp.Response)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return fullResponse.String(), nil
+}
+
+// ChatCompletion calls Ollama's OpenAI-compatible /v1/chat/completions endpoint.
+func (c *Client) ChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	return c.compat.Chat.Completions.New(ctx, params)
+}
+
 func (c *Client) Chat(ctx context.Context, model ModelName, messages []api.Message, stream bool) (*api.ChatResponse, error) {
 	maybeModel, ok := c.models[model]
 	if !ok {
@@ -9,9 +9,11 @@ import (
 	"text/template"
 
 	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/llm"
+	agentopenai "github.com/agentflare-ai/agentml-go/openai"
 	"github.com/agentflare-ai/agentml-go/prompt"
 	"github.com/agentflare-ai/go-xmldom"
-	"github.com/ollama/ollama/api"
+	"github.com/openai/openai-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -28,7 +30,9 @@ const OllamaNamespaceURI = "github.com/agentflare-ai/agentml/ollama"
 //   - model: Specifies the Ollama model to use (e.g., "llama3.2", "codellama")
 //   - prompt: The prompt for AI generation
 //   - location: Data model location where the generated result should be stored
+//     (optional when the snapshot offers send_* tools)
 //   - stream: Whether to use streaming generation (optional, default false)
+//   - onchunk: Event raised for each streamed chunk (optional)
 //   - modelexpr: Dynamic model expression (optional)
 //   - promptexpr: Dynamic prompt expression (optional)
 type Generate struct {
@@ -50,6 +54,11 @@ type Generate struct {
 	// When true, responses are delivered progressively as they are generated.
 	Stream bool `xml:"stream,attr"`
 
+	// OnChunk names an internal event raised for each chunk of a streamed
+	// response, with the text in _event.data.chunk. The full response is
+	// still assigned to Location. It applies only when no tools are offered.
+	OnChunk string `xml:"onchunk,attr"`
+
 	// client is the Ollama client for making API calls
 	client *Client
 }
@@ -77,15 +86,6 @@ func (g *Generate) Execute(ctx context.Context, interpreter agentml.Interpreter)
 		}
 	}
 
-	if g.Location == "" {
-		return &agentml.PlatformError{
-			EventName: "error.execution",
-			Message:   "Generate element missing required 'location' attribute",
-			Data:      map[string]any{"element": "ollama:generate", "line": 0},
-			Cause:     fmt.Errorf("generate element missing required 'location' attribute"),
-		}
-	}
-
 	dataModel := interpreter.DataModel()
 	if dataModel == nil {
 		return &agentml.PlatformError{
@@ -164,26 +164,38 @@ func (g *Generate) Execute(ctx context.Context, interpreter agentml.Interpreter)
 		}
 	}
 
-	// Build system instruction from SCXML snapshot (like Gemini does)
+	// Build system instruction and send_* tools from the SCXML snapshot
 	var systemPrompt string
+	var tools []openai.ChatCompletionToolParam
+	var eventNameMapping map[string]string
 	if doc, err := interpreter.Snapshot(ctx, agentml.SnapshotConfig{ExcludeConfiguration: true, ExcludeData: true}); err == nil {
+		sendFunctions := prompt.BuildSendFunctions(llm.ExtractTransitions(doc))
+		tools, eventNameMapping = agentopenai.ConvertSendFunctions(sendFunctions, false)
+
 		// Prune redundant information from snapshot
 		prompt.PruneSnapshot(doc)
 
-		slog.Debug("ollama.generate.execute: pruned snapshot ready")
+		slog.Debug("ollama.generate.execute: pruned snapshot ready", "tools", len(tools))
 		// Marshal and compress for minimal token usage
 		if b, err2 := xmldom.Marshal(doc); err2 == nil {
 			systemPrompt = prompt.CompressXML(string(b))
 		}
 	}
 
-	// TODO: Build tools from available actions when Actions() method is implemented
-	// For now, tools must be configured separately if needed
-	var ollamaTools []api.Tool
-	_ = ollamaTools  // Unused for now
-	_ = systemPrompt // Unused for now
+	// Without tools the result has nowhere to go but location
+	if len(tools) == 0 && g.Location == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "Generate element missing required 'location' attribute",
+			Data:      map[string]any{"element": "ollama:generate", "line": 0},
+			Cause:     fmt.Errorf("generate element missing required 'location' attribute"),
+		}
+	}
 
-	span.SetAttributes(attribute.String("ollama.prompt_length", fmt.Sprintf("%d", len(finalPrompt))))
+	span.SetAttributes(
+		attribute.String("ollama.prompt_length", fmt.Sprintf("%d", len(finalPrompt))),
+		attribute.Int("ollama.tools", len(tools)),
+	)
 
 	// Get or initialize Ollama client
 	client := g.client
@@ -196,22 +208,19 @@ func (g *Generate) Execute(ctx context.Context, interpreter agentml.Interpreter)
 		}
 	}
 
-	// Use Chat API with tools instead of Generate
-	if len(ollamaTools) > 0 {
-		// Build messages with system prompt and user prompt
-		messages := []api.Message{
-			{
-				Role:    "system",
-				Content: systemPrompt,
-			},
-			{
-				Role:    "user",
-				Content: finalPrompt,
+	var response string
+	switch {
+	case len(tools) > 0:
+		// Use the OpenAI-compatible endpoint so tool calls map onto events
+		// exactly as they do in the openai namespace
+		completion, err := client.ChatCompletion(ctx, openai.ChatCompletionNewParams{
+			Model: modelName,
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(systemPrompt),
+				openai.UserMessage(finalPrompt),
 			},
-		}
-
-		// Call Chat with tools
-		response, err := client.ChatWithTools(ctx, ModelName(modelName), messages, ollamaTools, g.Stream)
+			Tools: tools,
+		})
 		if err != nil {
 			span.RecordError(err)
 			return &agentml.PlatformError{
@@ -222,19 +231,46 @@ func (g *Generate) Execute(ctx context.Context, interpreter agentml.Interpreter)
 			}
 		}
 
-		// Process tool calls
-		if err := processOllamaToolCalls(ctx, interpreter, response); err != nil {
+		if len(completion.Choices) > 0 && len(completion.Choices[0].Message.ToolCalls) > 0 {
+			if err := agentopenai.ProcessToolCalls(ctx, interpreter, completion, eventNameMapping); err != nil {
+				span.RecordError(err)
+				return &agentml.PlatformError{
+					EventName: "error.execution",
+					Message:   fmt.Sprintf("Failed to process tool calls: %v", err),
+					Data:      map[string]any{"element": "ollama:generate", "line": 0},
+					Cause:     err,
+				}
+			}
+			return nil
+		}
+
+		if g.Location == "" {
+			err := fmt.Errorf("model returned no tool calls")
 			span.RecordError(err)
 			return &agentml.PlatformError{
 				EventName: "error.execution",
-				Message:   fmt.Sprintf("Failed to process tool calls: %v", err),
+				Message:   "Ollama model returned no tool calls and no 'location' is set",
 				Data:      map[string]any{"element": "ollama:generate", "line": 0},
 				Cause:     err,
 			}
 		}
-	} else {
-		// Fall back to regular generation without tools
-		response, err := client.Generate(ctx, ModelName(modelName), finalPrompt, g.Stream)
+		if len(completion.Choices) > 0 {
+			response = completion.Choices[0].Message.Content
+		}
+
+	case g.OnChunk != "":
+		// Raise one event per chunk as it arrives
+		index := 0
+		response, err = client.GenerateStream(ctx, ModelName(modelName), finalPrompt, func(chunk string) error {
+			interpreter.Raise(ctx, &agentml.Event{
+				Name: g.OnChunk,
+				Type: agentml.EventTypeInternal,
+				Data: map[string]any{"chunk": chunk, "index": index},
+			})
+			index++
+			return nil
+		})
+		span.SetAttributes(attribute.Int("ollama.chunks", index))
 		if err != nil {
 			span.RecordError(err)
 			return &agentml.PlatformError{
@@ -245,76 +281,30 @@ func (g *Generate) Execute(ctx context.Context, interpreter agentml.Interpreter)
 			}
 		}
 
-		// Store the generated result in the data model
-		if err := dataModel.Assign(ctx, g.Location, response); err != nil {
+	default:
+		response, err = client.Generate(ctx, ModelName(modelName), finalPrompt, g.Stream)
+		if err != nil {
 			span.RecordError(err)
 			return &agentml.PlatformError{
 				EventName: "error.execution",
-				Message:   fmt.Sprintf("Failed to assign result to location '%s': %v", g.Location, err),
+				Message:   fmt.Sprintf("Failed to generate content: %v", err),
 				Data:      map[string]any{"element": "ollama:generate", "line": 0},
 				Cause:     err,
 			}
 		}
 	}
 
-	return nil
-}
-
-// processOllamaToolCalls processes tool calls from Ollama response and sends corresponding events
-func processOllamaToolCalls(ctx context.Context, it agentml.Interpreter, resp *api.ChatResponse) error {
-	if resp == nil {
-		return fmt.Errorf("nil response")
-	}
-
-	if len(resp.Message.ToolCalls) == 0 {
-		return fmt.Errorf("no tool calls in response")
-	}
-
-	for _, toolCall := range resp.Message.ToolCalls {
-		name := toolCall.Function.Name
-		if !strings.HasPrefix(name, "send_") {
-			return fmt.Errorf("unsupported function: %s (only send_* allowed)", name)
-		}
-
-		// Extract event name
-		evName := strings.TrimPrefix(name, "send_")
-
-		// Build event data from arguments
-		var data interface{}
-		if toolCall.Function.Arguments != nil {
-			// Check for nested data or use the whole arguments
-			if d, ok := toolCall.Function.Arguments["data"]; ok {
-				data = d
-			} else if len(toolCall.Function.Arguments) > 0 {
-				// Filter out target and delay if present
-				filtered := make(map[string]interface{})
-				for k, v := range toolCall.Function.Arguments {
-					if k != "target" && k != "delay" {
-						filtered[k] = v
-					}
-				}
-				if len(filtered) > 0 {
-					data = filtered
-				}
+	// Store the generated result in the data model
+	if g.Location != "" {
+		if err := dataModel.Assign(ctx, g.Location, response); err != nil {
+			span.RecordError(err)
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to assign result to location '%s': %v", g.Location, err),
+				Data:      map[string]any{"element": "ollama:generate", "line": 0},
+				Cause:     err,
 			}
 		}
-
-		// Send SCXML external event
-		ev := &agentml.Event{
-			Name: evName,
-			Type: agentml.EventTypeExternal,
-			Data: data,
-		}
-		if target, ok := toolCall.Function.Arguments["target"].(string); ok && target != "" {
-			ev.Origin = target
-		}
-		if delay, ok := toolCall.Function.Arguments["delay"].(string); ok && delay != "" {
-			ev.Delay = delay
-		}
-
-		if err := it.Send(ctx, ev); err != nil {
-			return err
-		}
 	}
 
 	return nil
@@ -461,17 +451,15 @@ func NewGenerate(ctx context.Context, element xmldom.Element) (agentml.Executor,
 	prompt := string(element.GetAttribute("prompt"))
 	location := string(element.GetAttribute("location"))
 	stream := string(element.GetAttribute("stream")) == "true"
+	onChunk := string(element.GetAttribute("onchunk"))
 
 	// Validate required attributes
 	if model == "" {
 		return nil, fmt.Errorf("generate element missing required 'model' attribute")
 	}
 
-	if location == "" {
-		return nil, fmt.Errorf("generate element missing required 'location' attribute")
-	}
-
-	// Note: prompt can be empty if content will come from child elements
+	// Note: location is checked at execution time, once it is known whether
+	// the snapshot offers tools. prompt can be empty if content will come from child elements
 
 	return &Generate{
 		Element:  element,
@@ -479,6 +467,7 @@ func NewGenerate(ctx context.Context, element xmldom.Element) (agentml.Executor,
 		Prompt:   prompt,
 		Location: location,
 		Stream:   stream,
+		OnChunk:  onChunk,
 	}, nil
 }
 
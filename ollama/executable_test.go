@@ -2,9 +2,16 @@ package ollama
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
 )
 
 // Simple compilation test - verify that the package builds correctly
@@ -129,3 +136,211 @@ func TestGenerate_processTemplate(t *testing.T) {
 		}
 	})
 }
+
+type fakeDM struct{ store map[string]any }
+
+func newFakeDM() *fakeDM { return &fakeDM{store: map[string]any{}} }
+
+func (f *fakeDM) Initialize(ctx context.Context, dataElements []agentml.Data) error { return nil }
+func (f *fakeDM) EvaluateValue(ctx context.Context, expression string) (any, error) {
+	if v, ok := f.store[expression]; ok {
+		return v, nil
+	}
+	return expression, nil
+}
+func (f *fakeDM) EvaluateCondition(ctx context.Context, expression string) (bool, error) {
+	return false, nil
+}
+func (f *fakeDM) EvaluateLocation(ctx context.Context, location string) (any, error) {
+	return f.store[location], nil
+}
+func (f *fakeDM) Assign(ctx context.Context, location string, value any) error {
+	f.store[location] = value
+	return nil
+}
+func (f *fakeDM) GetVariable(ctx context.Context, id string) (any, error) { return f.store[id], nil }
+func (f *fakeDM) SetVariable(ctx context.Context, id string, value any) error {
+	f.store[id] = value
+	return nil
+}
+func (f *fakeDM) GetSystemVariable(ctx context.Context, name string) (any, error)     { return nil, nil }
+func (f *fakeDM) SetSystemVariable(ctx context.Context, name string, value any) error { return nil }
+func (f *fakeDM) SetCurrentEvent(ctx context.Context, event any) error                { return nil }
+func (f *fakeDM) ExecuteScript(ctx context.Context, script string) error              { return nil }
+func (f *fakeDM) Clone(ctx context.Context) (agentml.DataModel, error)                { return newFakeDM(), nil }
+func (f *fakeDM) ValidateExpression(ctx context.Context, expression string, exprType agentml.ExpressionType) error {
+	return nil
+}
+
+// fakeInterp is a minimal interpreter. When snapshot is set, Snapshot parses
+// it so generation offers send_* tools.
+type fakeInterp struct {
+	dm       *fakeDM
+	snapshot string
+	sent     []*agentml.Event
+	raised   []*agentml.Event
+}
+
+func (fi *fakeInterp) Handle(ctx context.Context, event *agentml.Event) error { return nil }
+func (fi *fakeInterp) Location(ctx context.Context) (string, error)           { return "", nil }
+func (fi *fakeInterp) Type() string                                           { return "test" }
+func (fi *fakeInterp) Shutdown(ctx context.Context) error                     { return nil }
+func (fi *fakeInterp) SessionID() string                                      { return "" }
+func (fi *fakeInterp) Configuration() []string                                { return nil }
+func (fi *fakeInterp) In(ctx context.Context, stateId string) bool            { return false }
+func (fi *fakeInterp) Raise(ctx context.Context, event *agentml.Event) {
+	fi.raised = append(fi.raised, event)
+}
+func (fi *fakeInterp) Send(ctx context.Context, event *agentml.Event) error {
+	fi.sent = append(fi.sent, event)
+	return nil
+}
+func (fi *fakeInterp) Cancel(ctx context.Context, sendId string) error                  { return nil }
+func (fi *fakeInterp) Log(ctx context.Context, label, message string)                   {}
+func (fi *fakeInterp) Context() context.Context                                         { return context.Background() }
+func (fi *fakeInterp) Clock() agentml.Clock                                             { return nil }
+func (fi *fakeInterp) DataModel() agentml.DataModel                                     { return fi.dm }
+func (fi *fakeInterp) ExecuteElement(ctx context.Context, element xmldom.Element) error { return nil }
+func (fi *fakeInterp) SendMessage(ctx context.Context, data agentml.SendData) error     { return nil }
+func (fi *fakeInterp) ScheduleMessage(ctx context.Context, data agentml.SendData) (string, error) {
+	return "", nil
+}
+func (fi *fakeInterp) InvokedSessions() map[string]agentml.Interpreter { return nil }
+func (fi *fakeInterp) Tracer() agentml.Tracer                          { return nil }
+func (fi *fakeInterp) Snapshot(ctx context.Context, maybeConfig ...agentml.SnapshotConfig) (xmldom.Document, error) {
+	if fi.snapshot == "" {
+		return nil, errors.New("no snapshot")
+	}
+	return xmldom.NewDecoder(strings.NewReader(fi.snapshot)).Decode()
+}
+func (fi *fakeInterp) Root() agentml.Filesystem { return nil }
+func (fi *fakeInterp) AfterFunc(ctx context.Context, fn func()) func() bool {
+	return context.AfterFunc(ctx, fn)
+}
+
+const toolSnapshot = `<agentml xmlns="github.com/agentflare-ai/agentml">
+  <state id="idle">
+    <transition event="user.done" target="idle"/>
+  </state>
+</agentml>`
+
+// fakeOllama serves the minimal /api/generate and /v1/chat/completions
+// endpoints. Streamed generations answer with one NDJSON line per chunk.
+func fakeOllama(t *testing.T, chunks []string, completion string) (*Client, *[]map[string]any) {
+	t.Helper()
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		switch r.URL.Path {
+		case "/api/generate":
+			if stream, _ := body["stream"].(bool); stream {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				for _, c := range chunks {
+					fmt.Fprintf(w, `{"response":%q,"done":false}`+"\n", c)
+				}
+				fmt.Fprintln(w, `{"response":"","done":true}`)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"response":%q,"done":true}`, strings.Join(chunks, ""))
+		case "/v1/chat/completions":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, completion)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(context.Background(), nil, &ClientOptions{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client, &bodies
+}
+
+func handleGenerate(t *testing.T, client *Client, itp *fakeInterp, src string) error {
+	t.Helper()
+	doc, err := xmldom.NewDecoder(strings.NewReader(src)).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ns, err := Loader(&Deps{Client: client})(context.Background(), itp, nil)
+	if err != nil {
+		t.Fatalf("Loader: %v", err)
+	}
+	_, err = ns.Handle(context.Background(), doc.DocumentElement())
+	return err
+}
+
+func TestGenerateAssignsLocation(t *testing.T) {
+	client, bodies := fakeOllama(t, []string{"Hello ", "there"}, "")
+	itp := &fakeInterp{dm: newFakeDM()}
+
+	err := handleGenerate(t, client, itp, `<generate xmlns="github.com/agentflare-ai/agentml/ollama" model="llama3.2" prompt="Say hello" location="greeting"/>`)
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got := itp.dm.store["greeting"]; got != "Hello there" {
+		t.Fatalf("greeting = %v, want %q", got, "Hello there")
+	}
+	if len(*bodies) != 1 || (*bodies)[0]["prompt"] != "Say hello" {
+		t.Fatalf("unexpected requests: %v", *bodies)
+	}
+}
+
+func TestGenerateRequiresLocationWithoutTools(t *testing.T) {
+	client, _ := fakeOllama(t, nil, "")
+	itp := &fakeInterp{dm: newFakeDM()}
+
+	err := handleGenerate(t, client, itp, `<generate xmlns="github.com/agentflare-ai/agentml/ollama" model="llama3.2" prompt="Say hello"/>`)
+	var pe *agentml.PlatformError
+	if !errors.As(err, &pe) || !strings.Contains(pe.Message, "location") {
+		t.Fatalf("expected missing location error, got %v", err)
+	}
+}
+
+func TestGenerateToolCallsUseChatCompletions(t *testing.T) {
+	completion := `{"id":"c1","object":"chat.completion","created":0,"model":"llama3.2","choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"","tool_calls":[{"id":"t1","type":"function","function":{"name":"send_user_done","arguments":"{\"data\":{\"ok\":true}}"}}]}}]}`
+	client, bodies := fakeOllama(t, nil, completion)
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+
+	err := handleGenerate(t, client, itp, `<generate xmlns="github.com/agentflare-ai/agentml/ollama" model="llama3.2" prompt="Finish up"/>`)
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(itp.sent) != 1 || itp.sent[0].Name != "user.done" {
+		t.Fatalf("expected user.done to be sent, got %v", itp.sent)
+	}
+	if data, _ := itp.sent[0].Data.(map[string]any); data["ok"] != true {
+		t.Fatalf("unexpected event data: %v", itp.sent[0].Data)
+	}
+	tools, _ := (*bodies)[0]["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("expected one tool in request, got %v", (*bodies)[0]["tools"])
+	}
+}
+
+func TestGenerateOnChunkRaisesEvents(t *testing.T) {
+	client, _ := fakeOllama(t, []string{"Once ", "upon ", "a time"}, "")
+	itp := &fakeInterp{dm: newFakeDM()}
+
+	err := handleGenerate(t, client, itp, `<generate xmlns="github.com/agentflare-ai/agentml/ollama" model="llama3.2" prompt="Tell a story" location="story" onchunk="story.chunk"/>`)
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(itp.raised) != 3 {
+		t.Fatalf("expected 3 chunk events, got %d", len(itp.raised))
+	}
+	for i, ev := range itp.raised {
+		data := ev.Data.(map[string]any)
+		if ev.Name != "story.chunk" || data["index"] != i {
+			t.Fatalf("unexpected chunk event %d: %s %v", i, ev.Name, data)
+		}
+	}
+	if got := itp.dm.store["story"]; got != "Once upon a time" {
+		t.Fatalf("story = %v, want %q", got, "Once upon a time")
+	}
+}
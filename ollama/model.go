@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
 
 	"github.com/ollama/ollama/api"
 )
@@ -25,6 +27,24 @@ const (
 	Mistral   ModelName = "mistral"
 )
 
+// DefaultBaseURL is the address of a local Ollama server.
+const DefaultBaseURL = "http://localhost:11434"
+
+// ResolveBaseURL returns baseURL, falling back to OLLAMA_HOST and then
+// DefaultBaseURL. Hosts without a scheme, as OLLAMA_HOST usually is, get http://.
+func ResolveBaseURL(baseURL string) string {
+	if baseURL == "" {
+		baseURL = strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	}
+	if baseURL == "" {
+		return DefaultBaseURL
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
 // NewModel creates a new Ollama model configuration
 func NewModel(name ModelName, stream bool) *Model {
 	return &Model{
@@ -35,11 +55,7 @@ func NewModel(name ModelName, stream bool) *Model {
 
 // NewOllamaClient creates a new Ollama client using the official API
 func NewOllamaClient(baseURL string) (*api.Client, error) {
-	if baseURL == "" {
-		baseURL = "http://localhost:11434"
-	}
-
-	parsedURL, err := url.Parse(baseURL)
+	parsedURL, err := url.Parse(ResolveBaseURL(baseURL))
 	if err != nil {
 		return nil, fmt.Errorf("invalid base URL: %w", err)
 	}
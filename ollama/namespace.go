@@ -9,16 +9,27 @@ import (
 )
 
 // Loader returns a NamespaceLoader for the Ollama namespace.
-// It closes over DI deps (Ollama client) and the interpreter.
+// It closes over DI deps (Ollama client) and the interpreter. Without a
+// client it connects to OLLAMA_HOST, or DefaultBaseURL when that is unset.
 func Loader(deps *Deps) agentml.NamespaceLoader {
 	return func(ctx context.Context, itp agentml.Interpreter, doc xmldom.Document) (agentml.Namespace, error) {
-		return &ns{itp: itp, deps: deps}, nil
+		var client *Client
+		if deps != nil {
+			client = deps.Client
+		}
+		if client == nil {
+			var err error
+			if client, err = NewClient(ctx, nil, nil); err != nil {
+				return nil, err
+			}
+		}
+		return &ns{itp: itp, client: client}, nil
 	}
 }
 
 type ns struct {
-	itp  agentml.Interpreter
-	deps *Deps
+	itp    agentml.Interpreter
+	client *Client
 }
 
 var _ agentml.Namespace = (*ns)(nil)
@@ -38,9 +49,7 @@ func (n *ns) Handle(ctx context.Context, el xmldom.Element) (bool, error) {
 			return true, err
 		}
 		g := exec.(*Generate)
-		if n.deps != nil {
-			g.SetClient(n.deps.Client)
-		}
+		g.SetClient(n.client)
 		return true, g.Execute(ctx, n.itp)
 	default:
 		return false, nil
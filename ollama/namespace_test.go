@@ -60,3 +60,18 @@ func TestNamespace_Unload(t *testing.T) {
 		t.Errorf("Unload should not return error, got: %v", err)
 	}
 }
+
+func TestResolveBaseURL(t *testing.T) {
+	t.Setenv("OLLAMA_HOST", "")
+	if got := ResolveBaseURL(""); got != DefaultBaseURL {
+		t.Errorf("default = %q, want %q", got, DefaultBaseURL)
+	}
+
+	t.Setenv("OLLAMA_HOST", "0.0.0.0:11500")
+	if got := ResolveBaseURL(""); got != "http://0.0.0.0:11500" {
+		t.Errorf("OLLAMA_HOST = %q, want http://0.0.0.0:11500", got)
+	}
+	if got := ResolveBaseURL("https://gpu.local/"); got != "https://gpu.local" {
+		t.Errorf("explicit = %q, want https://gpu.local", got)
+	}
+}
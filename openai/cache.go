@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/agentflare-ai/agentml-go/llm"
+)
+
+// DefaultCacheSize is the number of responses kept by the LRU cache that
+// LoaderWithOptions creates when Options.Cache is nil.
+const DefaultCacheSize = 256
+
+// Cache stores generation responses by request key. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	Get(ctx context.Context, key string) (llm.Response, bool)
+	Set(ctx context.Context, key string, resp llm.Response)
+}
+
+// NewLRUCache returns an in-memory Cache holding up to size responses,
+// evicting the least recently used.
+func NewLRUCache(size int) Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &lruCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	resp llm.Response
+}
+
+func (c *lruCache) Get(ctx context.Context, key string) (llm.Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return llm.Response{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).resp, true
+}
+
+func (c *lruCache) Set(ctx context.Context, key string, resp llm.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).resp = resp
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, resp: resp})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// cacheKey hashes everything in req that affects the response. The seed is
+// left out: only temperature 0 generations are cached, and their output does
+// not depend on it.
+func cacheKey(req llm.Request) (string, error) {
+	data, err := json.Marshal(struct {
+		Model            string
+		Messages         []llm.Message
+		Tools            []llm.Tool
+		ToolChoice       llm.ToolChoice
+		MaxOutputTokens  int
+		Reasoning        string
+		Temperature      *float64
+		Stop             []string
+		ReasoningSummary bool
+		Params           map[string]any
+	}{req.Model, req.Messages, req.Tools, req.ToolChoice, req.MaxOutputTokens, req.Reasoning, req.Temperature, req.Stop, req.ReasoningSummary, req.Params})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// promptCacheKey returns the llm.Request.PromptCacheKey for requests whose
+// stable prefix is system, or "" when there is none.
+func promptCacheKey(system string) string {
+	if system == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(system))
+	return "agentml-" + hex.EncodeToString(sum[:8])
+}
+
+// cachingProvider serves repeated requests from cache. Hits are replayed
+// through OnChunk, OnToolCallStart and OnToolCall so callers see the same callbacks they
+// would for a live response. Failed generations are not cached.
+type cachingProvider struct {
+	llm.Provider
+	cache Cache
+}
+
+func (c *cachingProvider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	key, err := cacheKey(req)
+	if err != nil {
+		slog.WarnContext(ctx, "openai: failed to build cache key, skipping cache", "error", err)
+		return c.Provider.Generate(ctx, req)
+	}
+
+	if resp, ok := c.cache.Get(ctx, key); ok {
+		slog.DebugContext(ctx, "openai: cache hit", "model", req.Model)
+		return resp, replayResponse(req, resp)
+	}
+
+	resp, err := c.Provider.Generate(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	c.cache.Set(ctx, key, resp)
+	return resp, nil
+}
@@ -0,0 +1,152 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go"
+)
+
+const (
+	// defaultMaxFetchBytes caps content loaded from external prompt sources.
+	defaultMaxFetchBytes int64 = 1 << 20
+	// defaultFetchTimeout bounds a single URL fetch when the caller's context
+	// has no earlier deadline.
+	defaultFetchTimeout = 10 * time.Second
+)
+
+// errFetchTooLarge is returned when a source exceeds the fetcher's size cap.
+var errFetchTooLarge = errors.New("content exceeds size limit")
+
+// fetcher loads external prompt content through the namespace HTTP client
+// with a size cap, so a slow or oversized source cannot hang or exhaust the
+// process. Local paths are resolved against the interpreter's sandboxed
+// filesystem when one is configured.
+type fetcher struct {
+	client   *http.Client
+	root     agentml.Filesystem
+	maxBytes int64
+	timeout  time.Duration
+}
+
+func newFetcher(client *http.Client, root agentml.Filesystem) *fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &fetcher{client: client, root: root, maxBytes: defaultMaxFetchBytes, timeout: defaultFetchTimeout}
+}
+
+// load reads src, which is either an http(s) URL, a file:// URL or a path.
+func (f *fetcher) load(ctx context.Context, src string) (string, error) {
+	u, err := url.Parse(src)
+	if err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			return f.fetchURL(ctx, src)
+		case "file":
+			return f.readFile(u.Path)
+		}
+	}
+	return f.readFile(src)
+}
+
+func (f *fetcher) fetchURL(ctx context.Context, src string) (string, error) {
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return "", fmt.Errorf("%w: %d > %d bytes", errFetchTooLarge, resp.ContentLength, f.maxBytes)
+	}
+	body, err := readLimited(resp.Body, f.maxBytes)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (f *fetcher) readFile(name string) (string, error) {
+	var (
+		file *os.File
+		err  error
+	)
+	if f.root != nil {
+		file, err = f.root.Open(name)
+	} else {
+		file, err = os.Open(name)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	body, err := readLimited(file, f.maxBytes)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// readLimited reads at most max bytes from r and fails if more remain.
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, fmt.Errorf("%w of %d bytes", errFetchTooLarge, max)
+	}
+	return body, nil
+}
+
+// formatPromptContent applies the light formatting selected by an
+// <openai:prompt type="..."> attribute. "text" (the default) only trims
+// surrounding whitespace; "markdown" also normalizes line endings, strips
+// trailing spaces and collapses runs of blank lines.
+func formatPromptContent(content, contentType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(contentType)) {
+	case "", "text":
+		return strings.TrimSpace(content), nil
+	case "markdown":
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		lines := strings.Split(content, "\n")
+		out := make([]string, 0, len(lines))
+		blank := false
+		for _, line := range lines {
+			line = strings.TrimRight(line, " \t")
+			if line == "" {
+				if blank {
+					continue
+				}
+				blank = true
+			} else {
+				blank = false
+			}
+			out = append(out, line)
+		}
+		return strings.TrimSpace(strings.Join(out, "\n")), nil
+	default:
+		return "", fmt.Errorf("unsupported prompt type %q (want text or markdown)", contentType)
+	}
+}
@@ -0,0 +1,118 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessChildPrompts_Sources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("# Remote\n\n\n\nfrom url   \r\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "context.txt")
+	if err := os.WriteFile(path, []byte("  from file {{.notATemplate}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`">`+
+		`<prompt src="`+path+`"/>`+
+		`<prompt src="`+srv.URL+`/doc.md" type="markdown"/>`+
+		`<prompt>inline</prompt>`+
+		`</generate>`)
+	itp := &fakeInterp{dm: newFakeDM()}
+
+	prompts, err := processChildPrompts(context.Background(), itp, newFetcher(srv.Client(), nil), nil, el)
+	if err != nil {
+		t.Fatalf("processChildPrompts: %v", err)
+	}
+	want := []string{"from file {{.notATemplate}}", "# Remote\n\nfrom url", "inline"}
+	if len(prompts) != len(want) {
+		t.Fatalf("prompts = %q, want %q", prompts, want)
+	}
+	for i := range want {
+		if prompts[i] != want[i] {
+			t.Errorf("prompt[%d] = %q, want %q", i, prompts[i], want[i])
+		}
+	}
+}
+
+func TestProcessChildPrompts_SourceErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name string
+		src  string
+		max  int64
+		is   error
+	}{
+		{name: "too large", src: srv.URL, max: 16, is: errFetchTooLarge},
+		{name: "missing file", src: filepath.Join(t.TempDir(), "missing.txt"), max: defaultMaxFetchBytes, is: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`"><prompt src="`+tt.src+`"/></generate>`)
+			f := newFetcher(srv.Client(), nil)
+			f.maxBytes = tt.max
+			_, err := processChildPrompts(context.Background(), &fakeInterp{dm: newFakeDM()}, f, nil, el)
+			if !errors.Is(err, tt.is) {
+				t.Fatalf("err = %v, want %v", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestProcessTemplate_Fetch(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			_, _ = w.Write([]byte("ok"))
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	f := newFetcher(srv.Client(), nil)
+	f.maxBytes = 16
+	f.timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "within limit", path: "/small", want: "got ok"},
+		{name: "size cap", path: "/large", want: "got "},
+		{name: "timeout", path: "/slow", want: "got "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := processTemplate(context.Background(), f, nil, `got {{fetch "`+srv.URL+tt.path+`"}}`, nil)
+			if err != nil {
+				t.Fatalf("processTemplate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/agentflare-ai/agentml-go/llm"
 	"github.com/agentflare-ai/agentml-go/prompt"
 	"github.com/agentflare-ai/go-xmldom"
 	"github.com/openai/openai-go"
@@ -29,7 +30,7 @@ func TestDynamicToolBuilding_Integration(t *testing.T) {
 	t.Log("=== Testing Dynamic Tool Building from SCXML ===")
 
 	// Step 1: Extract transitions
-	transitions := extractTransitions(doc)
+	transitions := llm.ExtractTransitions(doc)
 	t.Logf("Step 1: Extracted %d transitions", len(transitions))
 
 	expectedTransitionCount := 6 // user.request, system.shutdown, task.complete, task.failed, retry.request, cancel.request
@@ -89,7 +90,7 @@ func TestDynamicToolBuilding_Integration(t *testing.T) {
 	}
 
 	// Step 3: Convert to OpenAI tools with mapping
-	tools, mapping := convertToOpenAIToolsWithMapping(sendFunctions)
+	tools, mapping := convertToOpenAIToolsWithMapping(sendFunctions, false)
 	t.Logf("\nStep 3: Converted to %d OpenAI tools with mapping", len(tools))
 
 	if len(tools) != expectedTransitionCount {
@@ -201,9 +202,9 @@ func TestDynamicToolBuilding_StateTransitions(t *testing.T) {
 			}
 
 			// Extract and build tools
-			transitions := extractTransitions(doc)
+			transitions := llm.ExtractTransitions(doc)
 			sendFunctions := prompt.BuildSendFunctions(transitions)
-			tools, mapping := convertToOpenAIToolsWithMapping(sendFunctions)
+			tools, mapping := convertToOpenAIToolsWithMapping(sendFunctions, false)
 
 			// Verify tool count
 			if len(tools) != len(tt.expectedTools) {
@@ -246,7 +247,7 @@ func TestSchemaAttribute_Detected(t *testing.T) {
 		t.Fatalf("Failed to parse XML: %v", err)
 	}
 
-	transitions := extractTransitions(doc)
+	transitions := llm.ExtractTransitions(doc)
 	if len(transitions) != 2 {
 		t.Fatalf("Expected 2 transitions, got %d", len(transitions))
 	}
@@ -281,7 +282,7 @@ func TestSchemaAttribute_ActualContentParsing(t *testing.T) {
 		t.Fatalf("Failed to parse SCXML: %v", err)
 	}
 
-	transitions := extractTransitions(doc)
+	transitions := llm.ExtractTransitions(doc)
 	sendFunctions := prompt.BuildSendFunctions(transitions)
 
 	t.Log("=== Verifying Schema Content from test_agent.scxml ===")
@@ -452,9 +453,9 @@ func TestOpenAIToolSchemaConversion(t *testing.T) {
 		t.Fatalf("Failed to parse SCXML: %v", err)
 	}
 
-	transitions := extractTransitions(doc)
+	transitions := llm.ExtractTransitions(doc)
 	sendFunctions := prompt.BuildSendFunctions(transitions)
-	tools, mapping := convertToOpenAIToolsWithMapping(sendFunctions)
+	tools, mapping := convertToOpenAIToolsWithMapping(sendFunctions, false)
 
 	t.Log("=== Verifying OpenAI Tool Schema Conversion ===")
 
@@ -667,9 +668,9 @@ func TestOpenAIToolSchemaConversion_ArrayWithoutItems(t *testing.T) {
 		t.Fatalf("Failed to parse XML: %v", err)
 	}
 
-	transitions := extractTransitions(doc)
+	transitions := llm.ExtractTransitions(doc)
 	sendFunctions := prompt.BuildSendFunctions(transitions)
-	tools, _ := convertToOpenAIToolsWithMapping(sendFunctions)
+	tools, _ := convertToOpenAIToolsWithMapping(sendFunctions, false)
 
 	if len(tools) != 1 {
 		t.Fatalf("Expected 1 tool, got %d", len(tools))
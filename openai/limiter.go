@@ -0,0 +1,59 @@
+package openai
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/semaphore"
+)
+
+// generationLimiter bounds the number of generations in flight. Generations
+// over the limit wait for a slot instead of failing.
+type generationLimiter struct {
+	sem        *semaphore.Weighted
+	queueDepth metric.Int64UpDownCounter
+}
+
+// newGenerationLimiter returns a limiter allowing max concurrent
+// generations, or nil (no limit) when max is not positive. Its queue depth is
+// recorded to mp, or to the global MeterProvider when mp is nil.
+func newGenerationLimiter(max int, mp metric.MeterProvider) *generationLimiter {
+	if max <= 0 {
+		return nil
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	queueDepth, err := mp.Meter("openai").Int64UpDownCounter("openai.generate.queue_depth",
+		metric.WithDescription("Generations waiting for a concurrency slot"),
+		metric.WithUnit("{generation}"))
+	if err != nil {
+		slog.Warn("openai: failed to create queue depth metric", "error", err)
+	}
+	return &generationLimiter{sem: semaphore.NewWeighted(int64(max)), queueDepth: queueDepth}
+}
+
+// acquire waits for a slot and returns a func that releases it. It only
+// fails if ctx is done before a slot frees up. A nil limiter never waits.
+func (l *generationLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if !l.sem.TryAcquire(1) {
+		l.addQueued(ctx, 1)
+		err := l.sem.Acquire(ctx, 1)
+		l.addQueued(ctx, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func() { l.sem.Release(1) }, nil
+}
+
+func (l *generationLimiter) addQueued(ctx context.Context, n int64) {
+	if l.queueDepth != nil {
+		l.queueDepth.Add(ctx, n)
+	}
+}
@@ -4,17 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/internal/retry"
+	"github.com/agentflare-ai/agentml-go/llm"
 	"github.com/agentflare-ai/agentml-go/prompt"
 	"github.com/agentflare-ai/go-jsonschema"
 	"github.com/agentflare-ai/go-pipeline"
@@ -24,9 +31,9 @@ import (
 	"github.com/openai/openai-go/packages/param"
 	"github.com/openai/openai-go/packages/ssestream"
 	"github.com/openai/openai-go/responses"
-	"github.com/openai/openai-go/shared"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -36,9 +43,62 @@ const OpenAINamespaceURI = "github.com/agentflare-ai/agentml-go/openai"
 // ToolCallHandler is called when a tool call is complete and ready to process
 type ToolCallHandler func(toolCall openai.ChatCompletionMessageToolCall) error
 
+// Options configures the namespaces created by LoaderWithOptions.
+type Options struct {
+	// MaxConcurrentGenerations bounds the generate calls in flight at once
+	// across every namespace the loader creates. Calls over the limit wait
+	// for a slot. Zero means no limit.
+	MaxConcurrentGenerations int
+
+	// Cache serves generate calls with cache="true". When nil, an in-memory
+	// LRU cache of DefaultCacheSize entries is shared by the loader's
+	// namespaces. A hit replays the cached tool calls, so the events they
+	// send are sent again as if the model had just made them.
+	Cache Cache
+
+	// MeterProvider receives the generation metrics (see MetricGenerations)
+	// and the depth of the MaxConcurrentGenerations queue. When nil, the
+	// global MeterProvider is used.
+	MeterProvider metric.MeterProvider
+
+	// TemplateFuncs are added to the functions available to child
+	// <openai:prompt> templates, alongside the built-in jsonquote, upper,
+	// lower and default, which they may replace. fetch cannot be replaced.
+	// Values must be functions accepted by text/template; the loader
+	// returns an error otherwise.
+	TemplateFuncs template.FuncMap
+
+	// APIKey authenticates requests in place of OPENAI_API_KEY. Without
+	// either, and without OPENAI_BASE_URL naming another server, the loader
+	// still succeeds so dry runs and cache hits work, but generations that
+	// need the API raise error.execution.
+	APIKey string
+}
+
 // Loader returns a NamespaceLoader for the OpenAI namespace.
 func Loader() agentml.NamespaceLoader {
+	return LoaderWithOptions(Options{})
+}
+
+// LoaderWithOptions returns a NamespaceLoader for the OpenAI namespace
+// configured by opts.
+func LoaderWithOptions(opts Options) agentml.NamespaceLoader {
+	limiter := newGenerationLimiter(opts.MaxConcurrentGenerations, opts.MeterProvider)
+	cache := opts.Cache
+	if cache == nil {
+		cache = NewLRUCache(DefaultCacheSize)
+	}
+	metrics := newGenerationMetrics(opts.MeterProvider)
+	funcs := maps.Clone(opts.TemplateFuncs)
 	return func(ctx context.Context, itp agentml.Interpreter, doc xmldom.Document) (agentml.Namespace, error) {
+		if err := checkTemplateFuncs(funcs); err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			if err := hookStateExits(doc); err != nil {
+				return nil, err
+			}
+		}
 		// Create HTTP client with reasonable timeouts
 		httpClient := &http.Client{
 			Timeout: 90 * time.Second,
@@ -50,27 +110,44 @@ func Loader() agentml.NamespaceLoader {
 		}
 
 		// Build client options
-		var opts []option.RequestOption
-		opts = append(opts, option.WithHTTPClient(httpClient))
+		var clientOpts []option.RequestOption
+		clientOpts = append(clientOpts, option.WithHTTPClient(httpClient))
 
-		if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
-			opts = append(opts, option.WithAPIKey(apiKey))
+		apiKey := opts.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		if apiKey != "" {
+			clientOpts = append(clientOpts, option.WithAPIKey(apiKey))
 		}
 
-		if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		baseURL := os.Getenv("OPENAI_BASE_URL")
+		if baseURL != "" {
 			slog.Info("Using custom base URL", "baseURL", baseURL)
-			opts = append(opts, option.WithBaseURL(baseURL))
+			clientOpts = append(clientOpts, option.WithBaseURL(baseURL))
 		}
 
-		client := openai.NewClient(opts...)
-		slog.Info("openai: client created")
-		return &ns{itp: itp, client: client}, nil
+		// Servers other than the OpenAI API may not need a key
+		var provider llm.Provider = noKeyProvider{}
+		if apiKey != "" || baseURL != "" {
+			provider = NewProvider(openai.NewClient(clientOpts...))
+			slog.Info("openai: client created")
+		} else {
+			slog.Warn("openai: OPENAI_API_KEY not set; generations that call the API will fail")
+		}
+		return &ns{itp: itp, provider: provider, httpClient: httpClient, limiter: limiter, cache: cache, metrics: metrics, funcs: funcs}, nil
 	}
 }
 
 type ns struct {
-	itp    agentml.Interpreter
-	client openai.Client
+	itp        agentml.Interpreter
+	provider   llm.Provider
+	httpClient *http.Client
+	limiter    *generationLimiter
+	cache      Cache
+	metrics    *generationMetrics
+	funcs      template.FuncMap
+	scopes     stateScopes
 }
 
 var _ agentml.Namespace = (*ns)(nil)
@@ -87,17 +164,53 @@ func (n *ns) Handle(ctx context.Context, el xmldom.Element) (bool, error) {
 	case "generate":
 		slog.Info("openai: handle generate", "el", el)
 		return true, n.handleGenerate(ctx, el)
+	case stateExitTag:
+		n.scopes.exit(exitedState(el))
+		return true, nil
 	default:
 		return false, nil
 	}
 }
 
+// handleGenerate runs a generation, tied to the state whose <onentry> holds
+// el: exiting that state cancels the call and discards its result, and the
+// element then raises nothing.
 func (n *ns) handleGenerate(ctx context.Context, el xmldom.Element) error {
-	return executeGenerate(ctx, n.itp, n.client, el)
+	state := enclosingState(el)
+	ctx, stop := n.scopes.watch(ctx, state)
+	defer stop()
+	itp := n.itp
+	if state != nil {
+		itp = &scopedInterpreter{Interpreter: n.itp, ctx: ctx}
+	}
+
+	release, err := n.limiter.acquire(ctx)
+	if err != nil {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "Generate was cancelled while waiting for a concurrency slot",
+			Data: map[string]any{
+				"element": "generate",
+			},
+			Cause: err,
+		}
+	}
+	defer release()
+	err = executeGenerate(ctx, itp, n.provider, n.httpClient, n.cache, n.metrics, n.funcs, el)
+	if stateExited(ctx) {
+		stateID, _ := state.(string)
+		slog.InfoContext(ctx, "openai: state exited during generation, discarding result", "state", stateID)
+		return nil
+	}
+	return err
 }
 
-// executeGenerate handles <openai:generate> element execution directly.
-func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, client openai.Client, el xmldom.Element) error {
+// executeGenerate handles <openai:generate> element execution. It builds a
+// provider-neutral request from the element and snapshot and sends it to p,
+// going through cache when the element opts in with deterministic sampling.
+// Each model attempted is recorded to metrics, which may be nil. funcs are
+// added to the functions available to child prompt templates.
+func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, p llm.Provider, httpClient *http.Client, cache Cache, metrics *generationMetrics, funcs template.FuncMap, el xmldom.Element) error {
 	// Extract attributes
 	model := string(el.GetAttribute("model"))
 	modelExpr := string(el.GetAttribute("modelexpr"))
@@ -107,10 +220,62 @@ func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, clien
 	retryStr := string(el.GetAttribute("retry"))
 	reasoning := string(el.GetAttribute("reasoning"))
 	maxOutputTokensStr := string(el.GetAttribute("max-output-tokens"))
-	retry := 3
+	timeoutStr := strings.TrimSpace(string(el.GetAttribute("timeout")))
+	fallbackModelsStr := string(el.GetAttribute("fallback-models"))
+	selectedModelLocation := string(el.GetAttribute("selected-model-location"))
+	usageLocation := string(el.GetAttribute("usage-location"))
+	reasoningLocation := string(el.GetAttribute("reasoning-location"))
+	resultsLocation := string(el.GetAttribute("results-location"))
+	appendCallsTo := strings.TrimSpace(string(el.GetAttribute("append-calls-to")))
+	stop := parseModelList(string(el.GetAttribute("stop")))
+	dryRun, _ := strconv.ParseBool(strings.TrimSpace(string(el.GetAttribute("dry-run"))))
+	maxTurnsStr := string(el.GetAttribute("max-turns"))
+	resultExpr := strings.TrimSpace(string(el.GetAttribute("resultexpr")))
+	strictTargets, _ := strconv.ParseBool(strings.TrimSpace(string(el.GetAttribute("strict-targets"))))
+	jsonRepair, _ := strconv.ParseBool(strings.TrimSpace(string(el.GetAttribute("json-repair"))))
+	useCache, _ := strconv.ParseBool(strings.TrimSpace(string(el.GetAttribute("cache"))))
+	emitProgress, _ := strconv.ParseBool(strings.TrimSpace(string(el.GetAttribute("emit-progress"))))
+	stream := true
+	if v := strings.TrimSpace(string(el.GetAttribute("stream"))); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			stream = b
+		}
+	}
+	toolFilter := prompt.FilterOptions{
+		Include: splitPatterns(string(el.GetAttribute("tools-include"))),
+		Exclude: splitPatterns(string(el.GetAttribute("tools-exclude"))),
+	}
+	maxRetries := 3
 	if retryStr != "" {
 		if r, err := strconv.Atoi(retryStr); err == nil && r >= 0 {
-			retry = r
+			maxRetries = r
+		}
+	}
+
+	maxTurns := 1
+	if maxTurnsStr != "" {
+		if t, err := strconv.Atoi(maxTurnsStr); err == nil && t > 0 {
+			maxTurns = t
+		}
+	}
+
+	var maxFetchBytes int64
+	if v := strings.TrimSpace(string(el.GetAttribute("max-fetch-bytes"))); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			maxFetchBytes = n
+		}
+	}
+
+	// Prompt and response size guards are off unless set
+	var maxPromptBytes, maxResponseBytes int64
+	if v := strings.TrimSpace(string(el.GetAttribute("max-prompt-bytes"))); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			maxPromptBytes = n
+		}
+	}
+	if v := strings.TrimSpace(string(el.GetAttribute("max-response-bytes"))); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			maxResponseBytes = n
 		}
 	}
 
@@ -121,6 +286,63 @@ func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, clien
 		}
 	}
 
+	var temperature *float64
+	if v := strings.TrimSpace(string(el.GetAttribute("temperature"))); v != "" {
+		if t, err := strconv.ParseFloat(v, 64); err == nil && t >= 0 {
+			temperature = &t
+		}
+	}
+
+	var seed *int64
+	if v := strings.TrimSpace(string(el.GetAttribute("seed"))); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			seed = &n
+		}
+	}
+
+	params, err := parseParams(ctx, interpreter, el)
+	if err != nil {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("Invalid openai:params: %v", err),
+			Data:      map[string]any{"element": "openai:generate", "line": 0},
+			Cause:     err,
+		}
+	}
+	if params.temperature != nil {
+		if temperature != nil {
+			err := fmt.Errorf("temperature is set by both the attribute and openai:params")
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   "Generate element sets temperature in both the temperature attribute and openai:params",
+				Data:      map[string]any{"element": "openai:generate", "line": 0, "attribute": "temperature"},
+				Cause:     err,
+			}
+		}
+		temperature = params.temperature
+	}
+	if params.seed != nil {
+		if seed != nil {
+			err := fmt.Errorf("seed is set by both the attribute and openai:params")
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   "Generate element sets seed in both the seed attribute and openai:params",
+				Data:      map[string]any{"element": "openai:generate", "line": 0, "attribute": "seed"},
+				Cause:     err,
+			}
+		}
+		seed = params.seed
+	}
+
+	// Only deterministic generations are safe to replay from cache
+	if useCache && cache != nil {
+		if seed != nil && temperature != nil && *temperature == 0 {
+			p = &cachingProvider{Provider: p, cache: cache}
+		} else {
+			slog.WarnContext(ctx, "openai: cache requires seed and temperature=\"0\", not caching")
+		}
+	}
+
 	if reasoning != "" {
 		slog.InfoContext(ctx, "openai: reasoning effort specified", "reasoning", reasoning)
 	}
@@ -138,6 +360,32 @@ func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, clien
 		}
 	}
 
+	if dryRun && location == "" {
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "Generate element with dry-run requires a 'location' attribute",
+			Data:      map[string]any{"element": "openai:generate", "line": 0, "attribute": "location"},
+			Cause:     fmt.Errorf("dry-run requires location"),
+		}
+	}
+
+	var timeout time.Duration
+	if timeoutStr != "" {
+		d, err := time.ParseDuration(timeoutStr)
+		if err != nil || d <= 0 {
+			if err == nil {
+				err = fmt.Errorf("timeout must be positive, got %q", timeoutStr)
+			}
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Invalid timeout '%s': %v", timeoutStr, err),
+				Data:      map[string]any{"element": "openai:generate", "line": 0, "attribute": "timeout"},
+				Cause:     err,
+			}
+		}
+		timeout = d
+	}
+
 	dataModel := interpreter.DataModel()
 	if dataModel == nil {
 		return &agentml.PlatformError{
@@ -194,7 +442,11 @@ func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, clien
 	}
 
 	// Process child <openai:prompt> elements
-	childPrompts, err := processChildPrompts(ctx, interpreter, el)
+	fetch := newFetcher(httpClient, interpreter.Root())
+	if maxFetchBytes > 0 {
+		fetch.maxBytes = maxFetchBytes
+	}
+	childPrompts, err := processChildPrompts(ctx, interpreter, fetch, funcs, el)
 	if err != nil {
 		span.RecordError(err)
 		return &agentml.PlatformError{
@@ -204,6 +456,16 @@ func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, clien
 			Cause:     err,
 		}
 	}
+	childMessages, err := processChildMessages(ctx, interpreter, fetch, funcs, el)
+	if err != nil {
+		span.RecordError(err)
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   fmt.Sprintf("Failed to process child message elements: %v", err),
+			Data:      map[string]any{"element": "openai:generate", "line": 0},
+			Cause:     err,
+		}
+	}
 
 	finalPrompt := promptText
 	if len(childPrompts) > 0 {
@@ -214,408 +476,783 @@ func executeGenerate(ctx context.Context, interpreter agentml.Interpreter, clien
 		}
 	}
 
-	// Build system instruction from SCXML snapshot
-	var systemPrompt string
-	var openaiTools []openai.ChatCompletionToolParam
+	// Build system instruction from SCXML snapshot. The document structure
+	// goes first and the runtime state after it, so the structure is a
+	// prefix the provider can cache across turns.
+	var systemPrompt, runtimePrompt string
+	var tools []llm.Tool
 	var eventNameMapping map[string]string
 	var sendFunctions []prompt.SendFunction
 
 	if doc, err := interpreter.Snapshot(ctx, agentml.SnapshotConfig{ExcludeData: true}); err == nil {
-		transitions := extractTransitions(doc)
-		sendFunctions = prompt.BuildSendFunctions(transitions)
-		openaiTools, eventNameMapping = convertToOpenAIToolsWithMapping(sendFunctions)
+		transitions := llm.ExtractTransitions(doc)
+		sendFunctions, err = prompt.FilterSendFunctions(prompt.BuildSendFunctions(transitions), toolFilter)
+		if err != nil {
+			span.RecordError(err)
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Invalid tools-include/tools-exclude: %v", err),
+				Data:      map[string]any{"element": "openai:generate", "line": 0},
+				Cause:     err,
+			}
+		}
+		tools = llm.BuildTools(sendFunctions, strictTargets)
+		eventNameMapping = llm.ToolMapping(tools)
 		prompt.PruneSnapshot(doc)
+		runtimeDoc, err := prompt.SplitSnapshot(doc)
+		if err != nil {
+			span.RecordError(err)
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to split runtime snapshot: %v", err),
+				Data:      map[string]any{"element": "openai:generate", "line": 0},
+				Cause:     err,
+			}
+		}
 
 		if b, err2 := xmldom.MarshalIndentWithOptions(doc, "", "  ", true); err2 == nil {
 			systemPrompt = string(b)
 		}
+		if runtimeDoc != nil {
+			if b, err2 := xmldom.MarshalIndentWithOptions(runtimeDoc, "", "  ", true); err2 == nil {
+				runtimePrompt = string(b)
+			}
+		}
 	}
 
-	messages := []openai.ChatCompletionMessageParamUnion{
-		openai.SystemMessage(systemPrompt),
-		openai.UserMessage(finalPrompt),
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: systemPrompt}}
+	if runtimePrompt != "" {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: runtimePrompt})
 	}
+	// Few-shot turns from <openai:message> follow the snapshot; the prompt
+	// is the final user turn unless the messages supply it
+	messages = append(messages, childMessages...)
+	if finalPrompt != "" || len(childMessages) == 0 {
+		messages = append(messages, llm.Message{Role: llm.RoleUser, Content: finalPrompt})
+	}
+	cacheKey := promptCacheKey(systemPrompt)
 
 	// Determine tool choice based on whether location is provided
-	toolChoice := responses.ToolChoiceOptionsAuto
+	toolChoice := llm.ToolChoiceAuto
 	if location == "" {
 		// When location is omitted, force tool calling for event-based execution
-		toolChoice = responses.ToolChoiceOptionsRequired
+		toolChoice = llm.ToolChoiceRequired
 	}
 
-	// Handle non-tool case (simple chat) - only when location is provided
-	if len(openaiTools) == 0 {
-
-		// Simple chat without tools
-		if reasoning != "" {
-			slog.InfoContext(ctx, "openai: calling Responses API with reasoning", "model", modelName, "reasoning", reasoning)
-		}
-
-		// Convert messages to input items for Responses API
-		inputItems := convertMessagesToInputItems(messages)
-
-		params := responses.ResponseNewParams{
-			Model: shared.ResponsesModel(modelName),
-			Input: responses.ResponseNewParamsInputUnion{OfInputItemList: inputItems},
-		}
-
-		// Add reasoning configuration if specified
-		if reasoning != "" {
-			params.Reasoning = shared.ReasoningParam{
-				Effort: shared.ReasoningEffort(reasoning),
-			}
-		}
-
-		// Add max output tokens if specified
-		if maxOutputTokens != nil {
-			params.MaxOutputTokens = param.NewOpt(int64(*maxOutputTokens))
-		}
+	var maxTokens int
+	if maxOutputTokens != nil {
+		maxTokens = *maxOutputTokens
+	}
 
-		response, err := client.Responses.New(ctx, params)
-		if err != nil {
+	// Dry run: hand the assembled request to the document instead of the API
+	if dryRun {
+		plan := buildDryRunPlan(modelName, strings.TrimSpace(systemPrompt+"\n"+runtimePrompt), childMessages, finalPrompt, chatTools(tools), toolChoice)
+		span.SetAttributes(
+			attribute.Bool("openai.dry_run", true),
+			attribute.Int("openai.estimated_tokens", plan["estimatedTokens"].(int)),
+		)
+		slog.InfoContext(ctx, "openai: dry run, skipping API call",
+			"model", modelName,
+			"num_tools", len(tools),
+			"estimated_tokens", plan["estimatedTokens"])
+		if err := dataModel.Assign(ctx, location, plan); err != nil {
 			span.RecordError(err)
 			return &agentml.PlatformError{
 				EventName: "error.execution",
-				Message:   fmt.Sprintf("Failed to generate content: %v", err),
+				Message:   fmt.Sprintf("Failed to assign dry-run plan to location '%s': %v", location, err),
 				Data:      map[string]any{"element": "openai:generate", "line": 0},
 				Cause:     err,
 			}
 		}
+		return nil
+	}
 
-		// Extract content from the Response structure
-		var content string
-		if len(response.Output) > 0 {
-			for _, output := range response.Output {
-				if output.Type == "message" {
-					message := output.AsMessage()
-					if message.Role == "assistant" && len(message.Content) > 0 {
-						// Extract text from the first content item
-						for _, contentItem := range message.Content {
-							if contentItem.Type == "output_text" {
-								content = contentItem.Text
-								break
-							}
-						}
-					}
-					break
-				}
-			}
-		}
-
-		// Log reasoning content if present (for o1 models in Responses API)
-		for _, output := range response.Output {
-			if output.Type == "reasoning" {
-				reasoningItem := output.AsReasoning()
-				if reasoningItem.Summary != nil {
-					for _, summary := range reasoningItem.Summary {
-						if summary.Text != "" {
-							slog.InfoContext(ctx, "openai: reasoning content received", "reasoning_length", len(summary.Text))
-							if slog.Default().Enabled(ctx, slog.LevelDebug) {
-								slog.DebugContext(ctx, "openai: reasoning content", "reasoning", summary.Text)
-							}
-						}
-					}
-				}
-			}
+	// Refuse prompts the provider would reject rather than pay a round trip
+	if maxPromptBytes > 0 {
+		var promptBytes int64
+		for _, m := range messages {
+			promptBytes += int64(len(m.Content))
 		}
-
-		if err := dataModel.Assign(ctx, location, content); err != nil {
+		if promptBytes > maxPromptBytes {
+			err := fmt.Errorf("prompt is %d bytes, exceeding max-prompt-bytes %d", promptBytes, maxPromptBytes)
 			span.RecordError(err)
 			return &agentml.PlatformError{
 				EventName: "error.execution",
-				Message:   fmt.Sprintf("Failed to assign result to location '%s': %v", location, err),
-				Data:      map[string]any{"element": "openai:generate", "line": 0},
-				Cause:     err,
+				Message:   fmt.Sprintf("Prompt too large: %v", err),
+				Data: map[string]any{
+					"element":        "openai:generate",
+					"line":           0,
+					"attribute":      "max-prompt-bytes",
+					"promptBytes":    promptBytes,
+					"maxPromptBytes": maxPromptBytes,
+				},
+				Cause: err,
 			}
 		}
-		return nil
 	}
 
-	// Tool-based execution - use streaming with pipeline validation
-	slog.InfoContext(ctx, "Starting streaming generation with tool calls",
-		"model", modelName,
-		"num_tools", len(openaiTools),
-		"max_retries", retry)
-
-	// Build tool schemas for validation
-	toolSchemas := make(map[string]*jsonschema.Schema)
-	for _, sendFunc := range sendFunctions {
-		if sendFunc.Schema != nil {
-			toolSchemas[sendFunc.EventName] = sendFunc.Schema
+	// Bound provider calls by the element timeout. Tool execution keeps the
+	// parent context so events sent to the interpreter are not cancelled.
+	apiCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		apiCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		span.SetAttributes(attribute.String("openai.timeout", timeout.String()))
+	}
+
+	// usage totals the provider calls of the model being generated against,
+	// reasoningParts collects their reasoning summaries and toolResults the
+	// outcome of each tool call dispatched
+	var usage llm.Usage
+	var reasoningParts []string
+	var toolResults []any
+	recordResponse := func(modelName string, r llm.Response) {
+		metrics.recordUsage(ctx, modelName, r.Usage)
+		usage.InputTokens += r.Usage.InputTokens
+		usage.OutputTokens += r.Usage.OutputTokens
+		usage.CachedInputTokens += r.Usage.CachedInputTokens
+		if r.Reasoning != "" {
+			reasoningParts = append(reasoningParts, r.Reasoning)
 		}
 	}
 
-	// Create pipeline context
-	pctx := &StreamingPipelineContext{
-		Interpreter: interpreter,
-		ToolSchemas: toolSchemas,
-		NameMapping: eventNameMapping,
-		MaxRetries:  retry,
-		RetryCount:  0,
-	}
-
-	conversationMessages := make([]openai.ChatCompletionMessageParamUnion, len(messages))
-	copy(conversationMessages, messages)
+	// generate runs the request against a single model; it is retried
+	// against each fallback model when the provider is unavailable.
+	generate := func(modelName string) error {
+		usage = llm.Usage{}
+		reasoningParts = nil
+		toolResults = []any{}
+		// Handle non-tool case (simple chat) - only when location is provided
+		if len(tools) == 0 {
+			if reasoning != "" {
+				slog.InfoContext(ctx, "openai: calling Responses API with reasoning", "model", modelName, "reasoning", reasoning)
+			}
 
-	// Retry loop for handling validation errors
-	for retryNum := 0; retryNum < retry; retryNum++ {
-		pctx.RetryCount = retryNum
+			response, err := p.Generate(apiCtx, llm.Request{
+				Model:            modelName,
+				Messages:         messages,
+				MaxOutputTokens:  maxTokens,
+				Reasoning:        reasoning,
+				Temperature:      temperature,
+				Seed:             seed,
+				PromptCacheKey:   cacheKey,
+				Stop:             stop,
+				Params:           params.extra,
+				ReasoningSummary: reasoningLocation != "",
+			})
+			recordResponse(modelName, response)
+			if err != nil {
+				span.RecordError(err)
+				if timeoutErr := timeoutError(apiCtx, timeout, err); timeoutErr != nil {
+					return timeoutErr
+				}
+				return &agentml.PlatformError{
+					EventName: "error.execution",
+					Message:   fmt.Sprintf("Failed to generate content: %v", err),
+					Data:      map[string]any{"element": "openai:generate", "line": 0},
+					Cause:     err,
+				}
+			}
+			content := truncateResponse(ctx, response.Content, maxResponseBytes)
 
-		logAttrs := []any{
-			"retry_num", retryNum,
-			"model", modelName,
-			"num_tools", len(openaiTools),
-			"tool_choice", string(toolChoice),
-		}
-		if reasoning != "" {
-			logAttrs = append(logAttrs, "reasoning", reasoning)
-		}
-		if maxOutputTokens != nil {
-			logAttrs = append(logAttrs, "max_output_tokens", *maxOutputTokens)
+			if err := dataModel.Assign(ctx, location, content); err != nil {
+				span.RecordError(err)
+				return &agentml.PlatformError{
+					EventName: "error.execution",
+					Message:   fmt.Sprintf("Failed to assign result to location '%s': %v", location, err),
+					Data:      map[string]any{"element": "openai:generate", "line": 0},
+					Cause:     err,
+				}
+			}
+			return nil
 		}
-		slog.InfoContext(ctx, "📡 Calling OpenAI streaming API", logAttrs...)
 
-		// Debug log the messages and tools being sent
-		slog.DebugContext(ctx, "OpenAI API request details",
+		// Tool-based execution - streamed unless stream="false", with
+		// pipeline validation of each tool call either way
+		slog.InfoContext(ctx, "Starting generation with tool calls",
 			"model", modelName,
-			"num_messages", len(conversationMessages),
-			"messages", conversationMessages,
-			"num_tools", len(openaiTools),
-			"tools", openaiTools,
-			"tool_name_mapping", eventNameMapping)
-
-		// Convert messages to input items for Responses API
-		inputItems := convertMessagesToInputItems(conversationMessages)
-
-		// Convert ChatCompletionToolParam to ToolUnionParam for Responses API
-		responseTools := convertChatToolsToResponseTools(openaiTools)
-
-		streamParams := responses.ResponseNewParams{
-			Model: shared.ResponsesModel(modelName),
-			Input: responses.ResponseNewParamsInputUnion{OfInputItemList: inputItems},
-			Tools: responseTools,
-			ToolChoice: responses.ResponseNewParamsToolChoiceUnion{
-				OfToolChoiceMode: param.NewOpt(toolChoice),
-			},
-		}
-
-		// Add reasoning configuration if specified
-		if reasoning != "" {
-			streamParams.Reasoning = shared.ReasoningParam{
-				Effort: shared.ReasoningEffort(reasoning),
+			"num_tools", len(tools),
+			"max_retries", maxRetries,
+			"stream", stream)
+
+		// Build tool schemas for validation
+		toolSchemas := make(map[string]*jsonschema.Schema)
+		for _, sendFunc := range sendFunctions {
+			if sendFunc.Schema != nil {
+				toolSchemas[sendFunc.EventName] = sendFunc.Schema
 			}
 		}
 
-		// Add max output tokens if specified
-		if maxOutputTokens != nil {
-			streamParams.MaxOutputTokens = param.NewOpt(int64(*maxOutputTokens))
+		// Create pipeline context
+		pctx := &StreamingPipelineContext{
+			Interpreter: interpreter,
+			ToolSchemas: toolSchemas,
+			NameMapping: eventNameMapping,
+			MaxRetries:  maxRetries,
+			RetryCount:  0,
+			JSONRepair:  jsonRepair,
 		}
 
-		// Track tool calls for error reporting
-		var processedToolCalls []*StreamingToolCall
-		var streamError error
-
-		// Create handler that processes each tool call immediately as it arrives
-		handler := func(tc openai.ChatCompletionMessageToolCall) error {
-			streamingTC := &StreamingToolCall{
-				Index:        len(processedToolCalls),
-				ID:           tc.ID,
-				Type:         string(tc.Type),
-				FunctionName: tc.Function.Name,
-				Arguments:    tc.Function.Arguments,
-			}
-			processedToolCalls = append(processedToolCalls, streamingTC)
-
-			slog.InfoContext(ctx, "🔍 Processing tool call immediately",
-				"function", tc.Function.Name,
-				"arguments_length", len(tc.Function.Arguments))
-
-			// Process through validation pipeline immediately
-			writer := &ToolCallWriter{}
-			p := pipeline.New(ctx,
-				jsonDecoderStage,
-				createParallelValidatorStage(pctx),
-				createToolExecutionStage(pctx),
-			)
-
-			if err := p.Process(ctx, writer, streamingTC); err != nil {
-				// Check if validation error
-				if len(writer.Errors) > 0 {
-					streamError = &CorrectionNeededError{Errors: writer.Errors}
-				} else {
-					streamError = err
-				}
-				return err // This will interrupt the stream
-			}
+		conversationMessages := make([]llm.Message, len(messages))
+		copy(conversationMessages, messages)
+
+		// Later turns let the model stop calling tools
+		turnToolChoice := toolChoice
+		turn := 1
+
+		// Each turn gets maxRetries attempts. A rejected tool call is fed back
+		// to the model with its validation errors and the turn is retried;
+		// any other failure ends the generation.
+		for {
+			var processedToolCalls []*StreamingToolCall
+			retryNum := -1
+			correction := retry.Policy{
+				Name:     "openai.generate.correction",
+				Attempts: maxRetries,
+				Retryable: func(err error) bool {
+					_, ok := err.(*CorrectionNeededError)
+					return ok
+				},
+				OnRetry: func(attempt int, err error, _ time.Duration) {
+					corrErr := err.(*CorrectionNeededError)
+					slog.WarnContext(ctx, "⚠️  RETRYING GENERATION - Sending correction feedback to LLM",
+						"retry_num", retryNum,
+						"num_errors", len(corrErr.Errors),
+						"retries_remaining", maxRetries-attempt)
+
+					slog.DebugContext(ctx, "Building correction messages for LLM",
+						"num_errors", len(corrErr.Errors))
+
+					// Build assistant message with the tool calls that failed
+					var failedCalls []llm.ToolCall
+					for _, valErr := range corrErr.Errors {
+						tc := valErr.ToolCall
+						failedCalls = append(failedCalls, llm.ToolCall{
+							ID:        tc.ID,
+							Name:      tc.FunctionName,
+							Arguments: tc.Arguments,
+						})
+					}
+					conversationMessages = append(conversationMessages, llm.Message{
+						Role:      llm.RoleAssistant,
+						ToolCalls: failedCalls,
+					})
 
-			slog.InfoContext(ctx, "✅ Tool call validated and executed",
-				"function", tc.Function.Name)
-			return nil
-		}
+					// Every call needs a matching output; report the rejection
+					for _, valErr := range corrErr.Errors {
+						output, _ := json.Marshal(map[string]any{"status": "rejected", "errors": valErr.Errors})
+						conversationMessages = append(conversationMessages, llm.Message{
+							Role:       llm.RoleTool,
+							Content:    string(output),
+							ToolCallID: valErr.ToolCall.ID,
+						})
+					}
 
-		// Stream and process tool calls with Harmony parameter for tool use
-		slog.InfoContext(ctx, "🎯 Adding Harmony parameter for tool use", "Harmony", "None", "tool_choice", "auto")
+					// Build correction message using the CorrectionStage logic
+					correctionStage := CreateCorrectionStage(pctx)
+					var correctionMessages []string
+					for _, valErr := range corrErr.Errors {
+						if corrMsg, err := correctionStage(ctx, valErr); err == nil {
+							correctionMessages = append(correctionMessages, corrMsg)
+						}
+					}
 
-		stream := client.Responses.NewStreaming(ctx, streamParams)
-		err = processStreamingResponse(ctx, stream, handler)
+					// Add user message with all corrections
+					correctionText := strings.Join(correctionMessages, "\n\n")
+					conversationMessages = append(conversationMessages, llm.Message{Role: llm.RoleUser, Content: correctionText})
 
-		// Use streamError if it was set by handler
-		if err != nil && streamError != nil {
-			err = streamError
-		}
+					slog.DebugContext(ctx, "📤 Sending correction prompt to LLM",
+						"correction_length", len(correctionText),
+						"will_retry", true)
 
-		if err != nil && streamError == nil {
-			// Stream error (not validation error)
-			span.RecordError(err)
-			return &agentml.PlatformError{
-				EventName: "error.execution",
-				Message:   fmt.Sprintf("Failed to complete streaming generation: %v", err),
-				Data:      map[string]any{"element": "openai:generate", "line": 0},
-				Cause:     err,
+				},
 			}
-		}
-
-		slog.InfoContext(ctx, "📥 Stream complete",
-			"num_processed", len(processedToolCalls))
-
-		// Check if correction is needed
-		if corrErr, ok := err.(*CorrectionNeededError); ok {
-			// Validation failed - retry if we have retries left
-			if retryNum < retry-1 {
-				slog.WarnContext(ctx, "⚠️  RETRYING GENERATION - Sending correction feedback to LLM",
+			err := retry.Do(ctx, correction, func(context.Context) error {
+				retryNum++
+				pctx.RetryCount = retryNum
+				logAttrs := []any{
 					"retry_num", retryNum,
-					"num_errors", len(corrErr.Errors),
-					"retries_remaining", retry-retryNum-1)
-
-				slog.DebugContext(ctx, "Building correction messages for LLM",
-					"num_errors", len(corrErr.Errors))
-
-				// Build assistant message with the tool calls that failed
-				var toolCallParams []openai.ChatCompletionMessageToolCallParam
-				for _, valErr := range corrErr.Errors {
-					tc := valErr.ToolCall
-					toolCallParams = append(toolCallParams, openai.ChatCompletionMessageToolCallParam{
-						ID: tc.ID,
-						// Type field will default to "function" automatically
-						Function: openai.ChatCompletionMessageToolCallFunctionParam{
-							Name:      tc.FunctionName,
-							Arguments: tc.Arguments,
-						},
-					})
+					"model", modelName,
+					"num_tools", len(tools),
+					"tool_choice", string(turnToolChoice),
+					"turn", turn,
+					"stream", stream,
+				}
+				if reasoning != "" {
+					logAttrs = append(logAttrs, "reasoning", reasoning)
+				}
+				if maxOutputTokens != nil {
+					logAttrs = append(logAttrs, "max_output_tokens", *maxOutputTokens)
 				}
+				slog.InfoContext(ctx, "📡 Calling OpenAI API", logAttrs...)
+
+				// Debug log the messages and tools being sent
+				slog.DebugContext(ctx, "OpenAI API request details",
+					"model", modelName,
+					"num_messages", len(conversationMessages),
+					"messages", conversationMessages,
+					"num_tools", len(tools),
+					"tools", tools,
+					"tool_name_mapping", eventNameMapping)
+
+				// Track tool calls for error reporting
+				processedToolCalls = nil
+				var streamError error
+
+				// Create handler that processes each tool call immediately as it arrives
+				handler := func(tc llm.ToolCall) error {
+					if emitProgress {
+						raiseToolCallProgress(ctx, interpreter, EventToolCallCompleted, tc, eventNameMapping)
+					}
+					streamingTC := &StreamingToolCall{
+						Index:        len(processedToolCalls),
+						ID:           tc.ID,
+						Type:         "function",
+						FunctionName: tc.Name,
+						Arguments:    tc.Arguments,
+					}
+					processedToolCalls = append(processedToolCalls, streamingTC)
+
+					slog.InfoContext(ctx, "🔍 Processing tool call immediately",
+						"function", tc.Name,
+						"arguments_length", len(tc.Arguments))
+
+					// Process through validation pipeline immediately
+					writer := &ToolCallWriter{}
+					p := pipeline.New(ctx,
+						createJSONRepairStage(pctx),
+						jsonDecoderStage,
+						createParallelValidatorStage(pctx),
+						createToolExecutionStage(pctx),
+					)
+
+					if err := p.Process(ctx, writer, streamingTC); err != nil {
+						// Check if validation error
+						if len(writer.Errors) > 0 {
+							streamError = &CorrectionNeededError{Errors: writer.Errors}
+						} else {
+							streamError = err
+						}
+						toolResults = append(toolResults, toolCallResult(streamingTC, eventNameMapping, streamError))
+						return err // This will interrupt the stream
+					}
+					toolResults = append(toolResults, toolCallResult(streamingTC, eventNameMapping, nil))
+					if appendCallsTo != "" {
+						if err := appendToolCall(ctx, dataModel, appendCallsTo, streamingTC, eventNameMapping, retryNum); err != nil {
+							slog.WarnContext(ctx, "openai: failed to append tool call", "location", appendCallsTo, "error", err)
+						}
+					}
 
-				assistantMsg := openai.ChatCompletionAssistantMessageParam{
-					// Role field will default to "assistant" automatically
-					ToolCalls: toolCallParams,
-					// Content is omitted when we have tool calls
+					slog.InfoContext(ctx, "✅ Tool call validated and executed",
+						"function", tc.Name)
+					return nil
 				}
-				// Convert to union type
-				conversationMessages = append(conversationMessages, openai.ChatCompletionMessageParamUnion{
-					OfAssistant: &assistantMsg,
-				})
 
-				// Build correction message using the CorrectionStage logic
-				correctionStage := CreateCorrectionStage(pctx)
-				var correctionMessages []string
-				for _, valErr := range corrErr.Errors {
-					if corrMsg, err := correctionStage(ctx, valErr); err == nil {
-						correctionMessages = append(correctionMessages, corrMsg)
+				var onStart func(llm.ToolCall)
+				if emitProgress {
+					onStart = func(tc llm.ToolCall) {
+						raiseToolCallProgress(ctx, interpreter, EventToolCallStarted, tc, eventNameMapping)
 					}
 				}
 
-				// Add user message with all corrections
-				correctionText := strings.Join(correctionMessages, "\n\n")
-				conversationMessages = append(conversationMessages, openai.UserMessage(correctionText))
+				// Stream and process tool calls with Harmony parameter for tool use
+				slog.InfoContext(ctx, "🎯 Adding Harmony parameter for tool use", "Harmony", "None", "tool_choice", "auto")
+
+				response, err := p.Generate(apiCtx, llm.Request{
+					Model:            modelName,
+					Messages:         conversationMessages,
+					Tools:            tools,
+					ToolChoice:       turnToolChoice,
+					MaxOutputTokens:  maxTokens,
+					Reasoning:        reasoning,
+					Temperature:      temperature,
+					Seed:             seed,
+					PromptCacheKey:   cacheKey,
+					Stop:             stop,
+					Params:           params.extra,
+					OnToolCall:       handler,
+					OnToolCallStart:  onStart,
+					ReasoningSummary: reasoningLocation != "",
+					DisableStreaming: !stream,
+				})
+				recordResponse(modelName, response)
+
+				// Use streamError if it was set by handler
+				if err != nil && streamError != nil {
+					err = streamError
+				}
+
+				if err != nil && streamError == nil {
+					// Stream error (not validation error)
+					span.RecordError(err)
+					if timeoutErr := timeoutError(apiCtx, timeout, err); timeoutErr != nil {
+						return timeoutErr
+					}
+					return &agentml.PlatformError{
+						EventName: "error.execution",
+						Message:   fmt.Sprintf("Failed to complete streaming generation: %v", err),
+						Data:      map[string]any{"element": "openai:generate", "line": 0},
+						Cause:     err,
+					}
+				}
 
-				slog.DebugContext(ctx, "📤 Sending correction prompt to LLM",
-					"correction_length", len(correctionText),
-					"will_retry", true)
+				slog.InfoContext(ctx, "📥 Stream complete",
+					"num_processed", len(processedToolCalls))
 
-				continue // Retry
-			} else {
+				if _, ok := err.(*CorrectionNeededError); ok {
+					return err
+				}
+				if err != nil {
+					// Other error (e.g., JSON decode error, execution error)
+					span.RecordError(err)
+					return &agentml.PlatformError{
+						EventName: "error.execution",
+						Message:   fmt.Sprintf("Failed to process streaming tool calls: %v", err),
+						Data:      map[string]any{"element": "openai:generate", "line": 0},
+						Cause:     err,
+					}
+				}
+				return nil
+			})
+			if _, ok := err.(*CorrectionNeededError); ok {
 				// Max retries reached
 				slog.ErrorContext(ctx, "❌ GENERATION FAILED - Max retries reached",
-					"max_retries", retry,
+					"max_retries", maxRetries,
 					"final_error", err)
 				span.RecordError(err)
 				return &agentml.PlatformError{
 					EventName: "error.execution",
-					Message:   fmt.Sprintf("Tool call validation failed after %d retries: %v", retry, err),
+					Message:   fmt.Sprintf("Tool call validation failed after %d retries: %v", maxRetries, err),
 					Data:      map[string]any{"element": "openai:generate", "line": 0},
 					Cause:     err,
 				}
 			}
-		} else if err != nil {
-			// Other error (e.g., JSON decode error, execution error)
+			if err != nil {
+				return err
+			}
+
+			if turn < maxTurns && len(processedToolCalls) > 0 {
+				// Feed the outcome of each tool call back and let the model continue
+				slog.InfoContext(ctx, "🔁 Feeding tool results back to LLM",
+					"turn", turn,
+					"max_turns", maxTurns,
+					"num_tool_calls", len(processedToolCalls))
+				conversationMessages = append(conversationMessages,
+					toolResultMessages(ctx, interpreter, resultExpr, processedToolCalls, eventNameMapping)...)
+				turnToolChoice = llm.ToolChoiceAuto
+				turn++
+				continue
+			}
+
+			// Success!
+			slog.InfoContext(ctx, "✅ GENERATION SUCCESSFUL - All tool calls validated and executed",
+				"num_tool_calls", len(processedToolCalls),
+				"retry_num", retryNum,
+				"turns", turn)
+			span.SetAttributes(attribute.Int("openai.turns", turn))
+			return nil
+		}
+	}
+
+	// Each fallback model is one attempt; unavailable models move on to
+	// the next without waiting.
+	candidates := append([]string{modelName}, parseModelList(fallbackModelsStr)...)
+	var selected string
+	policy := retry.Policy{
+		Name:      "openai.generate",
+		Attempts:  len(candidates),
+		Retryable: func(err error) bool { return apiCtx.Err() == nil && isRetryableProviderError(err) },
+		OnRetry: func(attempt int, err error, _ time.Duration) {
+			slog.WarnContext(ctx, "⚠️  Model unavailable, falling back",
+				"model", candidates[attempt-1],
+				"fallback", candidates[attempt],
+				"error", err)
+		},
+	}
+	attempt := 0
+	err = retry.Do(ctx, policy, func(context.Context) error {
+		candidate := candidates[attempt]
+		attempt++
+		start := time.Now()
+		err := generate(candidate)
+		metrics.recordGeneration(ctx, candidate, start, err)
+		if err == nil {
+			selected = candidate
+		}
+		return err
+	})
+	// Results are assigned even when validation retries run out, so the
+	// document can see which calls were rejected
+	if resultsLocation != "" && len(tools) > 0 && toolResults != nil {
+		if assignErr := dataModel.Assign(ctx, resultsLocation, toolResults); assignErr != nil && err == nil {
+			span.RecordError(assignErr)
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to assign tool results to location '%s': %v", resultsLocation, assignErr),
+				Data:      map[string]any{"element": "openai:generate", "line": 0},
+				Cause:     assignErr,
+			}
+		}
+	}
+	if errors.Is(err, errAPIKeyNotConfigured) {
+		span.RecordError(err)
+		return &agentml.PlatformError{
+			EventName: "error.execution",
+			Message:   "OpenAI API key not configured; set OPENAI_API_KEY",
+			Data:      map[string]any{"element": "openai:generate", "line": 0},
+			Cause:     errAPIKeyNotConfigured,
+		}
+	}
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(
+		attribute.String("openai.selected_model", selected),
+		attribute.Int64("openai.cached_tokens", usage.CachedInputTokens),
+	)
+	if usageLocation != "" {
+		report := map[string]any{
+			"inputTokens":  usage.InputTokens,
+			"outputTokens": usage.OutputTokens,
+			"cachedTokens": usage.CachedInputTokens,
+			"cacheHit":     usage.CachedInputTokens > 0,
+		}
+		if err := dataModel.Assign(ctx, usageLocation, report); err != nil {
+			span.RecordError(err)
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to assign usage to location '%s': %v", usageLocation, err),
+				Data:      map[string]any{"element": "openai:generate", "line": 0},
+				Cause:     err,
+			}
+		}
+	}
+	if reasoningLocation != "" {
+		if err := dataModel.Assign(ctx, reasoningLocation, strings.Join(reasoningParts, "\n\n")); err != nil {
 			span.RecordError(err)
 			return &agentml.PlatformError{
 				EventName: "error.execution",
-				Message:   fmt.Sprintf("Failed to process streaming tool calls: %v", err),
+				Message:   fmt.Sprintf("Failed to assign reasoning to location '%s': %v", reasoningLocation, err),
 				Data:      map[string]any{"element": "openai:generate", "line": 0},
 				Cause:     err,
 			}
 		}
+	}
+	if selectedModelLocation != "" {
+		if err := dataModel.Assign(ctx, selectedModelLocation, selected); err != nil {
+			span.RecordError(err)
+			return &agentml.PlatformError{
+				EventName: "error.execution",
+				Message:   fmt.Sprintf("Failed to assign selected model to location '%s': %v", selectedModelLocation, err),
+				Data:      map[string]any{"element": "openai:generate", "line": 0},
+				Cause:     err,
+			}
+		}
+	}
+	return nil
+}
 
-		// Success!
-		slog.InfoContext(ctx, "✅ GENERATION SUCCESSFUL - All tool calls validated and executed",
-			"num_tool_calls", len(processedToolCalls),
-			"retry_num", retryNum)
-		return nil
+// truncateResponse cuts content to at most limit bytes, on a UTF-8
+// boundary, and appends a marker giving the original size. A limit of zero
+// or less leaves content unchanged.
+func truncateResponse(ctx context.Context, content string, limit int64) string {
+	if limit <= 0 || int64(len(content)) <= limit {
+		return content
 	}
+	cut := int(limit)
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	slog.WarnContext(ctx, "openai: response exceeds max-response-bytes, truncating",
+		"bytes", len(content), "max_response_bytes", limit)
+	return content[:cut] + fmt.Sprintf("\n[truncated: %d of %d bytes]", cut, len(content))
+}
 
-	// Should not reach here
+// parseModelList splits a comma-separated model list, dropping empty entries.
+func parseModelList(s string) []string {
+	var models []string
+	for _, m := range strings.Split(s, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// isRetryableProviderError reports whether err means the model is overloaded
+// or unavailable, so the request may be retried against a fallback model.
+// Validation failures and element timeouts are not retryable.
+func isRetryableProviderError(err error) bool {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+			return true
+		}
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// timeoutError returns an error.execution PlatformError flagged with
+// "timeout" when err was caused by the element timeout expiring, or nil
+// otherwise. The flag lets documents transition to a fallback.
+func timeoutError(apiCtx context.Context, timeout time.Duration, err error) error {
+	if timeout <= 0 || !errors.Is(apiCtx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
 	return &agentml.PlatformError{
 		EventName: "error.execution",
-		Message:   "Unexpected end of retry loop",
-		Data:      map[string]any{"element": "openai:generate", "line": 0},
-		Cause:     fmt.Errorf("unexpected end of retry loop"),
+		Message:   fmt.Sprintf("Generation timed out after %s: %v", timeout, err),
+		Data: map[string]any{
+			"element": "openai:generate",
+			"line":    0,
+			"timeout": true,
+			"after":   timeout.String(),
+		},
+		Cause: err,
 	}
 }
 
-// convertMessagesToInputItems converts ChatCompletion messages to Response input items
-func convertMessagesToInputItems(messages []openai.ChatCompletionMessageParamUnion) []responses.ResponseInputItemUnionParam {
-	var inputItems []responses.ResponseInputItemUnionParam
+// toolResultMessages builds the assistant tool-call message and one tool
+// result message per call, reporting the event that was sent, the
+// interpreter configuration and, when resultExpr is set, its value.
+func toolResultMessages(ctx context.Context, interpreter agentml.Interpreter, resultExpr string, toolCalls []*StreamingToolCall, nameMapping map[string]string) []llm.Message {
+	calls := make([]llm.ToolCall, 0, len(toolCalls))
+	for _, tc := range toolCalls {
+		calls = append(calls, llm.ToolCall{ID: tc.ID, Name: tc.FunctionName, Arguments: tc.Arguments})
+	}
+	messages := []llm.Message{{Role: llm.RoleAssistant, ToolCalls: calls}}
 
-	for _, msg := range messages {
-		var role string
-		var content responses.EasyInputMessageContentUnionParam
-
-		// Extract role and content from message
-		if msg.OfUser != nil {
-			role = "user"
-			content.OfString = param.NewOpt(msg.OfUser.Content.OfString.Value)
-		} else if msg.OfAssistant != nil {
-			role = "assistant"
-			content.OfString = param.NewOpt(msg.OfAssistant.Content.OfString.Value)
-		} else if msg.OfSystem != nil {
-			role = "system"
-			content.OfString = param.NewOpt(msg.OfSystem.Content.OfString.Value)
-		} else if msg.OfDeveloper != nil {
-			role = "developer"
-			content.OfString = param.NewOpt(msg.OfDeveloper.Content.OfString.Value)
-		} else {
-			continue // Skip unknown message types
+	for _, tc := range toolCalls {
+		eventName := nameMapping[tc.FunctionName]
+		if eventName == "" {
+			eventName = tc.FunctionName
+		}
+		result := map[string]any{
+			"status":        "sent",
+			"event":         eventName,
+			"configuration": interpreter.Configuration(),
 		}
+		if resultExpr != "" {
+			if dm := interpreter.DataModel(); dm != nil {
+				if v, err := dm.EvaluateValue(ctx, resultExpr); err != nil {
+					slog.WarnContext(ctx, "openai: failed to evaluate resultexpr", "expr", resultExpr, "error", err)
+				} else {
+					result["result"] = v
+				}
+			}
+		}
+		b, err := json.Marshal(result)
+		if err != nil {
+			b = []byte(fmt.Sprintf(`{"status":"sent","event":%q}`, eventName))
+		}
+		messages = append(messages, llm.Message{Role: llm.RoleTool, Content: string(b), ToolCallID: tc.ID})
+	}
+	return messages
+}
 
-		inputItem := responses.EasyInputMessageParam{
-			Role:    responses.EasyInputMessageRole(role),
-			Content: content,
+// toolCallResult summarizes a dispatched tool call for results-location:
+// the event it maps to, whether it was validated and sent, and otherwise why
+// not.
+func toolCallResult(tc *StreamingToolCall, nameMapping map[string]string, err error) map[string]any {
+	eventName := nameMapping[tc.FunctionName]
+	if eventName == "" {
+		eventName = tc.FunctionName
+	}
+	result := map[string]any{"event": eventName, "accepted": err == nil}
+	var corrErr *CorrectionNeededError
+	switch {
+	case errors.As(err, &corrErr):
+		var msgs []string
+		for _, valErr := range corrErr.Errors {
+			msgs = append(msgs, valErr.Errors...)
 		}
+		result["error"] = strings.Join(msgs, "; ")
+	case err != nil:
+		result["error"] = err.Error()
+	}
+	return result
+}
 
-		inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
-			OfMessage: &inputItem,
-		})
+// appendToolCall appends a validated tool call to the array at location for
+// append-calls-to, as {event, arguments, retry}. The array is read back each
+// time, so calls from earlier retries, turns and fallback models are kept.
+func appendToolCall(ctx context.Context, dataModel agentml.DataModel, location string, tc *StreamingToolCall, nameMapping map[string]string, retryNum int) error {
+	eventName := nameMapping[tc.FunctionName]
+	if eventName == "" {
+		eventName = tc.FunctionName
+	}
+	var arguments any
+	if err := json.Unmarshal([]byte(tc.Arguments), &arguments); err != nil {
+		arguments = tc.Arguments
+	}
+	current, _ := dataModel.GetVariable(ctx, location)
+	calls, _ := current.([]any)
+	calls = append(slices.Clone(calls), map[string]any{
+		"event":     eventName,
+		"arguments": arguments,
+		"retry":     retryNum,
+	})
+	return dataModel.SetVariable(ctx, location, calls)
+}
+
+// convertMessagesToInputItems converts messages to Responses API input items.
+// Tool calls and their results map to function call items.
+func convertMessagesToInputItems(messages []llm.Message) []responses.ResponseInputItemUnionParam {
+	var inputItems []responses.ResponseInputItemUnionParam
+
+	for _, msg := range messages {
+		switch {
+		case msg.Role == llm.RoleAssistant && len(msg.ToolCalls) > 0:
+			for _, tc := range msg.ToolCalls {
+				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
+					OfFunctionCall: &responses.ResponseFunctionToolCallParam{
+						CallID:    tc.ID,
+						Name:      tc.Name,
+						Arguments: tc.Arguments,
+					},
+				})
+			}
+		case msg.Role == llm.RoleTool:
+			inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
+				OfFunctionCallOutput: &responses.ResponseInputItemFunctionCallOutputParam{
+					CallID: msg.ToolCallID,
+					Output: msg.Content,
+				},
+			})
+		default:
+			inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
+				OfMessage: &responses.EasyInputMessageParam{
+					Role:    responses.EasyInputMessageRole(msg.Role),
+					Content: responses.EasyInputMessageContentUnionParam{OfString: param.NewOpt(msg.Content)},
+				},
+			})
+		}
 	}
 
 	return inputItems
 }
 
-// processStreamingResponse handles streaming Response events and tool calls
-func processStreamingResponse(ctx context.Context, stream *ssestream.Stream[responses.ResponseStreamEventUnion], handler ToolCallHandler) error {
+// processStreamingResponse handles streaming Response events, passing each
+// tool call to onStart when it begins and to handler once complete, each
+// text delta to onText and the completed response, with its token usage and
+// reasoning summaries, to onCompleted. onStart, onText and onCompleted may be
+// nil.
+func processStreamingResponse(ctx context.Context, stream *ssestream.Stream[responses.ResponseStreamEventUnion], handler ToolCallHandler, onStart func(openai.ChatCompletionMessageToolCall), onText func(string) error, onCompleted func(responses.Response)) error {
 	// Track tool calls as they stream
 	toolCallMap := make(map[string]*openai.ChatCompletionMessageToolCall)
+	// Argument deltas reference the output item, not the call, so map item
+	// ids to call ids and buffer the deltas per call until the item is done
+	itemCalls := make(map[string]string)
+	argBuffers := make(map[string]*strings.Builder)
 
 	for stream.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		event := stream.Current()
 
 		// Handle different event types
@@ -635,11 +1272,17 @@ func processStreamingResponse(ctx context.Context, stream *ssestream.Stream[resp
 					},
 				}
 				toolCallMap[functionCall.CallID] = tc
+				if functionCall.ID != "" {
+					itemCalls[functionCall.ID] = functionCall.CallID
+				}
 
 				slog.Debug("Tool call started",
 					"call_id", functionCall.CallID,
 					"function", functionCall.Name,
 					"arguments_length", len(functionCall.Arguments))
+				if onStart != nil {
+					onStart(*tc)
+				}
 			}
 
 		case "response.output_item.done":
@@ -650,10 +1293,20 @@ func processStreamingResponse(ctx context.Context, stream *ssestream.Stream[resp
 				functionCall := item.AsFunctionCall()
 				// Function call completed
 				if tc, exists := toolCallMap[functionCall.CallID]; exists {
+					// Prefer the streamed deltas; without any, the done item
+					// carries the complete arguments
+					if buf, ok := argBuffers[functionCall.CallID]; ok {
+						tc.Function.Arguments = buf.String()
+					} else if functionCall.Arguments != "" {
+						tc.Function.Arguments = functionCall.Arguments
+					}
+					delete(toolCallMap, functionCall.CallID)
+					delete(argBuffers, functionCall.CallID)
+
 					slog.Debug("Tool call complete, processing immediately",
 						"call_id", functionCall.CallID,
 						"function", functionCall.Name,
-						"arguments_length", len(functionCall.Arguments))
+						"arguments_length", len(tc.Function.Arguments))
 
 					// Call handler immediately - if it returns error, interrupt stream
 					if err := handler(*tc); err != nil {
@@ -664,6 +1317,21 @@ func processStreamingResponse(ctx context.Context, stream *ssestream.Stream[resp
 					}
 				}
 			}
+		case "response.function_call_arguments.delta":
+			// Partial tool call arguments
+			argsDelta := event.AsResponseFunctionCallArgumentsDelta()
+			callID, ok := itemCalls[argsDelta.ItemID]
+			if !ok {
+				slog.Debug("Arguments delta for unknown item", "item_id", argsDelta.ItemID)
+				continue
+			}
+			buf, ok := argBuffers[callID]
+			if !ok {
+				buf = &strings.Builder{}
+				argBuffers[callID] = buf
+			}
+			buf.WriteString(argsDelta.Delta)
+
 		case "response.reasoning_text.delta":
 			// Reasoning text delta
 			reasoningTextDelta := event.AsResponseReasoningSummaryTextDelta()
@@ -677,12 +1345,20 @@ func processStreamingResponse(ctx context.Context, stream *ssestream.Stream[resp
 			slog.Debug("Text output delta",
 				"content_index", textDelta.ContentIndex,
 				"text_length", len(textDelta.Delta))
+			if onText != nil {
+				if err := onText(textDelta.Delta); err != nil {
+					return err
+				}
+			}
 
 		case "response.completed":
 			// Response is complete
+			completed := event.AsResponseCompleted()
 			slog.Debug("Response completed")
-			slog.Debug("Response", "response", event.AsResponseCompleted())
-			// Could handle final processing here if needed
+			slog.Debug("Response", "response", completed)
+			if onCompleted != nil {
+				onCompleted(completed.Response)
+			}
 
 		default:
 			// Log other events for debugging
@@ -725,8 +1401,10 @@ func evaluatePrompt(ctx context.Context, interpreter agentml.Interpreter, prompt
 	return fmt.Sprintf("%v", result), nil
 }
 
-// processChildPrompts processes child <openai:prompt> elements as Go templates.
-func processChildPrompts(ctx context.Context, interpreter agentml.Interpreter, el xmldom.Element) ([]string, error) {
+// processChildPrompts processes child <openai:prompt> elements as Go templates
+// with the built-in functions and funcs, or loads them from their src file or
+// URL.
+func processChildPrompts(ctx context.Context, interpreter agentml.Interpreter, fetch *fetcher, funcs template.FuncMap, el xmldom.Element) ([]string, error) {
 	var prompts []string
 
 	children := el.ChildNodes()
@@ -751,24 +1429,39 @@ func processChildPrompts(ctx context.Context, interpreter agentml.Interpreter, e
 		namespaceURI := element.NamespaceURI()
 
 		if string(localName) == "prompt" && (string(namespaceURI) == OpenAINamespaceURI || string(namespaceURI) == "") {
+			contentType := string(element.GetAttribute("type"))
+
+			// External sources are included verbatim (after formatting), never
+			// evaluated or templated.
+			if src := strings.TrimSpace(string(element.GetAttribute("src"))); src != "" {
+				content, err := fetch.load(ctx, src)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load prompt src %q: %w", src, err)
+				}
+				content, err = formatPromptContent(content, contentType)
+				if err != nil {
+					return nil, err
+				}
+				if content != "" {
+					prompts = append(prompts, content)
+				}
+				continue
+			}
+
 			promptContent := string(element.TextContent())
 			promptContent = strings.TrimSpace(promptContent)
 			if promptContent == "" {
 				continue
 			}
 
-			if dataModel != nil && (strings.HasPrefix(promptContent, "`") || strings.Contains(promptContent, "${")) {
-				result, err := dataModel.EvaluateValue(ctx, promptContent)
-				if err != nil {
-					slog.Warn("failed to evaluate prompt through data model", "error", err)
-				} else if str, ok := result.(string); ok {
-					promptContent = str
-				}
+			processedPrompt, err := renderPromptText(ctx, dataModel, fetch, funcs, promptContent, templateData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process template in prompt element: %w", err)
 			}
 
-			processedPrompt, err := processTemplate(promptContent, templateData)
+			processedPrompt, err = formatPromptContent(processedPrompt, contentType)
 			if err != nil {
-				return nil, fmt.Errorf("failed to process template in prompt element: %w", err)
+				return nil, err
 			}
 
 			prompts = append(prompts, processedPrompt)
@@ -778,253 +1471,115 @@ func processChildPrompts(ctx context.Context, interpreter agentml.Interpreter, e
 	return prompts, nil
 }
 
-// processTemplate processes a text string as a Go template with the given data.
-func processTemplate(templateText string, data map[string]any) (string, error) {
-	if !strings.Contains(templateText, "{{") {
-		return templateText, nil
-	}
-
-	funcMap := template.FuncMap{
-		"fetch": func(url string) string {
-			resp, err := http.Get(url)
-			if err != nil {
-				slog.Warn("fetch function failed", "url", url, "error", err)
-				return ""
-			}
-			defer resp.Body.Close()
+// processChildMessages renders the child <openai:message> elements of el, in
+// document order, into messages with their role. Bodies are evaluated and
+// templated like <openai:prompt> content; empty bodies are skipped.
+func processChildMessages(ctx context.Context, interpreter agentml.Interpreter, fetch *fetcher, funcs template.FuncMap, el xmldom.Element) ([]llm.Message, error) {
+	var messages []llm.Message
 
-			if resp.StatusCode != http.StatusOK {
-				slog.Warn("fetch function received non-200 status", "url", url, "status", resp.Status)
-				return ""
-			}
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				slog.Warn("fetch function failed to read response", "url", url, "error", err)
-				return ""
-			}
-
-			return string(body)
-		},
-	}
-
-	tmpl, err := template.New("prompt").Funcs(funcMap).Parse(templateText)
-	if err != nil {
-		return templateText, nil
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return templateText, nil
-	}
-
-	return buf.String(), nil
-}
-func extractTransitions(doc xmldom.Document) []xmldom.Element {
-	if doc == nil {
-		return nil
-	}
-
-	root := doc.DocumentElement()
-	if root == nil {
-		return nil
+	dataModel := interpreter.DataModel()
+	var templateData map[string]any
+	if dataModel != nil {
+		templateData = make(map[string]any)
 	}
 
-	var transitions []xmldom.Element
-
-	// Look for runtime:snapshot/runtime:actions/runtime:send/runtime:transition elements
-	// These are already scoped to the current state configuration
-	runtimeTransitions := root.GetElementsByTagNameNS(agentml.RuntimeNamespaceURI, "transition")
-	for i := uint(0); i < runtimeTransitions.Length(); i++ {
-		if elem, ok := runtimeTransitions.Item(i).(xmldom.Element); ok {
-			// Only include transitions that are under runtime:send (external events)
-			// Walk up the parent chain to verify this is under runtime:send
-			parent := elem.ParentNode()
-			if parent != nil {
-				if parentElem, ok := parent.(xmldom.Element); ok {
-					if string(parentElem.LocalName()) == "send" &&
-						parentElem.NamespaceURI() == xmldom.DOMString(agentml.RuntimeNamespaceURI) {
-						transitions = append(transitions, elem)
-					}
-				}
-			}
+	children := el.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		element, ok := children.Item(i).(xmldom.Element)
+		if !ok {
+			continue
+		}
+		if string(element.LocalName()) != "message" || (string(element.NamespaceURI()) != OpenAINamespaceURI && string(element.NamespaceURI()) != "") {
+			continue
 		}
-	}
 
-	// For testing and compatibility, also extract regular transition elements
-	// and runtime:send elements if no runtime transitions were found
-	if len(transitions) == 0 {
-		regularTransitions := root.GetElementsByTagName("transition")
-		for i := uint(0); i < regularTransitions.Length(); i++ {
-			if elem, ok := regularTransitions.Item(i).(xmldom.Element); ok {
-				transitions = append(transitions, elem)
-			}
+		role := llm.Role(strings.TrimSpace(string(element.GetAttribute("role"))))
+		switch role {
+		case llm.RoleSystem, llm.RoleUser, llm.RoleAssistant:
+		default:
+			return nil, fmt.Errorf("message role must be system, user or assistant, got %q", role)
 		}
 
-		// Also include runtime:send elements as they represent available events
-		runtimeSends := root.GetElementsByTagName("send")
-		for i := uint(0); i < runtimeSends.Length(); i++ {
-			if elem, ok := runtimeSends.Item(i).(xmldom.Element); ok {
-				transitions = append(transitions, elem)
-			}
+		content := strings.TrimSpace(string(element.TextContent()))
+		if content == "" {
+			continue
 		}
+		content, err := renderPromptText(ctx, dataModel, fetch, funcs, content, templateData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process template in %s message: %w", role, err)
+		}
+		messages = append(messages, llm.Message{Role: role, Content: content})
 	}
 
-	return transitions
+	return messages, nil
 }
 
-func sanitizeFunctionName(name string) string {
-	result := make([]byte, 0, len(name))
-	for i := 0; i < len(name); i++ {
-		c := name[i]
-		// Allow alphanumeric, underscore, and hyphen
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
-			result = append(result, c)
-		} else {
-			// Replace invalid characters with underscore
-			result = append(result, '_')
+// renderPromptText evaluates content through the data model when it is a
+// template literal or interpolates with ${...}, then processes it as a Go
+// template. Failed evaluations are logged and the text is used as written.
+func renderPromptText(ctx context.Context, dataModel agentml.DataModel, fetch *fetcher, funcs template.FuncMap, content string, templateData map[string]any) (string, error) {
+	if dataModel != nil && (strings.HasPrefix(content, "`") || strings.Contains(content, "${")) {
+		result, err := dataModel.EvaluateValue(ctx, content)
+		if err != nil {
+			slog.Warn("failed to evaluate prompt through data model", "error", err)
+		} else if str, ok := result.(string); ok {
+			content = str
 		}
 	}
-	return string(result)
+	return processTemplate(ctx, fetch, funcs, content, templateData)
 }
 
-func schemaToMap(schema *jsonschema.Schema) map[string]any {
-	if schema == nil {
-		return map[string]any{"type": "object"}
-	}
-
-	result := map[string]any{}
-
-	// Add type (convert jsonschema.JSONType to string)
-	typeStr := string(schema.Type)
-	if typeStr != "" {
-		result["type"] = typeStr
-	}
-
-	// Add description
-	if schema.Description != "" {
-		result["description"] = schema.Description
-	}
-
-	// Add properties recursively
-	if len(schema.Properties) > 0 {
-		props := make(map[string]any)
-		for key, propSchema := range schema.Properties {
-			props[key] = schemaToMap(propSchema)
-		}
-		result["properties"] = props
-	}
-
-	// Add required fields
-	if len(schema.Required) > 0 {
-		result["required"] = schema.Required
-	}
-
-	// Add items for arrays (OpenAI requires this for array types)
-	if typeStr == "array" {
-		if schema.Items != nil {
-			result["items"] = schemaToMap(schema.Items)
-		} else {
-			// OpenAI requires items for array types - provide a generic object fallback
-			result["items"] = map[string]any{"type": "object"}
-		}
+// processTemplate processes a text string as a Go template with the given data.
+// Besides the built-in functions and extra, the fetch function loads a URL
+// through fetch, returning an empty string and logging when the request fails
+// or exceeds the size limit.
+func processTemplate(ctx context.Context, fetch *fetcher, extra template.FuncMap, templateText string, data map[string]any) (string, error) {
+	if !strings.Contains(templateText, "{{") {
+		return templateText, nil
 	}
 
-	// Add enum values
-	if len(schema.Enum) > 0 {
-		result["enum"] = schema.Enum
-	}
+	funcMap := templateFuncs(ctx, fetch, extra)
 
-	// Add format
-	if schema.Format != "" {
-		result["format"] = schema.Format
+	tmpl, err := template.New("prompt").Funcs(funcMap).Parse(templateText)
+	if err != nil {
+		return templateText, nil
 	}
 
-	// Add validation constraints
-	if schema.MinLength != nil && *schema.MinLength > 0 {
-		result["minLength"] = *schema.MinLength
-	}
-	if schema.MaxLength != nil && *schema.MaxLength > 0 {
-		result["maxLength"] = *schema.MaxLength
-	}
-	if schema.Minimum != nil {
-		result["minimum"] = schema.Minimum
-	}
-	if schema.Maximum != nil {
-		result["maximum"] = schema.Maximum
-	}
-	if schema.MinItems != nil && *schema.MinItems > 0 {
-		result["minItems"] = *schema.MinItems
-	}
-	if schema.MaxItems != nil && *schema.MaxItems > 0 {
-		result["maxItems"] = *schema.MaxItems
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return templateText, nil
 	}
 
-	return result
+	return buf.String(), nil
 }
 
-func convertToOpenAIToolsWithMapping(sendFunctions []prompt.SendFunction) ([]openai.ChatCompletionToolParam, map[string]string) {
-	var tools []openai.ChatCompletionToolParam
-	mapping := make(map[string]string)
-
-	for _, fn := range sendFunctions {
-		// Sanitize function name for OpenAI (dots are not allowed)
-		sanitizedName := sanitizeFunctionName(fn.Name)
-
-		// Use the original event name from the SendFunction
-		mapping[sanitizedName] = fn.EventName
-
-		// Build parameter schema for OpenAI
-		parameters := map[string]any{
-			"type":       "object",
-			"properties": map[string]any{},
-		}
-
-		// Add target and delay as optional parameters for all send events
-		if props, ok := parameters["properties"].(map[string]any); ok {
-			props["target"] = map[string]any{
-				"type":        "string",
-				"description": "Target destination for the event (optional)",
-			}
-			props["delay"] = map[string]any{
-				"type":        "string",
-				"description": "Delay before sending the event in CSS2 format (optional)",
-			}
-
-			// Add data property if the schema has properties
-			if fn.Schema != nil && len(fn.Schema.Properties) > 0 {
-				// Use the actual parsed schema from the data property
-				if dataSchema, hasData := fn.Schema.Properties["data"]; hasData {
-					// Convert the jsonschema.Schema to map[string]any for OpenAI
-					props["data"] = schemaToMap(dataSchema)
-				} else {
-					// Fallback to generic object if no data property
-					props["data"] = map[string]any{
-						"type":        "object",
-						"description": "Event-specific data payload",
-					}
-				}
-			}
-		}
+// splitPatterns splits a comma- or space-separated list of event patterns.
+func splitPatterns(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+}
 
-		// Create the function tool
-		tool := openai.ChatCompletionToolParam{
-			// Type field will default to "function" automatically
-			Function: shared.FunctionDefinitionParam{
-				Name:        sanitizedName,
-				Description: param.NewOpt(fn.Description),
-				Parameters:  shared.FunctionParameters(parameters),
-			},
-		}
+// convertToOpenAIToolsWithMapping builds one function tool per send function
+// and maps sanitized tool names back to event names. With strictTargets, each
+// tool's target parameter is restricted to the event's transition targets.
+func convertToOpenAIToolsWithMapping(sendFunctions []prompt.SendFunction, strictTargets bool) ([]openai.ChatCompletionToolParam, map[string]string) {
+	tools := llm.BuildTools(sendFunctions, strictTargets)
+	return chatTools(tools), llm.ToolMapping(tools)
+}
 
-		tools = append(tools, tool)
-	}
+// ConvertSendFunctions converts send functions into Chat Completions tools,
+// returning the tools and a map from tool name to event name. It lets other
+// OpenAI-compatible backends reuse this package's tool conversion.
+func ConvertSendFunctions(sendFunctions []prompt.SendFunction, strictTargets bool) ([]openai.ChatCompletionToolParam, map[string]string) {
+	return convertToOpenAIToolsWithMapping(sendFunctions, strictTargets)
+}
 
-	return tools, mapping
+// ProcessToolCalls sends one event per send_* tool call in a Chat Completions
+// response, resolving tool names through the mapping from ConvertSendFunctions.
+func ProcessToolCalls(ctx context.Context, it agentml.Interpreter, resp *openai.ChatCompletion, eventNameMapping map[string]string) error {
+	return processOpenAIToolCalls(ctx, it, resp, eventNameMapping)
 }
 
 func processOpenAIToolCalls(ctx context.Context, it agentml.Interpreter, resp *openai.ChatCompletion, eventNameMapping map[string]string) error {
-	slog.Info("processOpenAIToolCalls: starting")
 	if resp == nil {
 		return fmt.Errorf("nil response")
 	}
@@ -1039,119 +1594,11 @@ func processOpenAIToolCalls(ctx context.Context, it agentml.Interpreter, resp *o
 	}
 
 	slog.Info("processOpenAIToolCalls: processing tool calls", "count", len(choice.Message.ToolCalls))
-	for i, toolCall := range choice.Message.ToolCalls {
-		slog.Info("processOpenAIToolCalls: processing tool call", "index", i, "function", toolCall.Function.Name)
-		// Type is always "function" in current OpenAI API, no need to check
-
-		sanitizedName := toolCall.Function.Name
-		if !strings.HasPrefix(sanitizedName, "send_") {
-			return fmt.Errorf("unsupported function: %s (only send_* allowed)", sanitizedName)
-		}
-
-		// Map sanitized function name back to original event name
-		var evName string
-		slog.Info("processOpenAIToolCalls: looking up event", "sanitizedName", sanitizedName, "mappingExists", eventNameMapping != nil)
-		if eventNameMapping != nil {
-			if originalName, ok := eventNameMapping[sanitizedName]; ok {
-				evName = originalName
-				slog.Info("processOpenAIToolCalls: found in mapping", "sanitized", sanitizedName, "original", evName)
-			} else {
-				slog.Info("processOpenAIToolCalls: not found in mapping, using fallback", "sanitizedName", sanitizedName, "mappingKeys", eventNameMapping)
-				// Fallback: extract from sanitized name and convert underscores to dots
-				evName = strings.TrimPrefix(sanitizedName, "send_")
-				evName = strings.ReplaceAll(evName, "_", ".")
-				slog.Debug("openai.processToolCalls: no mapping found, using fallback", "sanitized", sanitizedName, "extracted", evName)
-			}
-		} else {
-			// No mapping provided, use sanitized name directly and convert underscores to dots
-			evName = strings.TrimPrefix(sanitizedName, "send_")
-			evName = strings.ReplaceAll(evName, "_", ".")
-			slog.Debug("openai.processToolCalls: no mapping provided, using sanitized name", "sanitized", sanitizedName, "extracted", evName)
-		}
-
-		// Parse arguments
-		var arguments map[string]any
-		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); err != nil {
-			return fmt.Errorf("failed to parse tool call arguments: %w", err)
-		}
-
-		slog.Info("processOpenAIToolCalls: sending event to interpreter", "event", evName)
-		// Use the handleSendCall helper for consistency
-		if err := handleSendCall(ctx, it, evName, arguments); err != nil {
-			slog.Error("processOpenAIToolCalls: handleSendCall failed", "error", err)
-			return err
-		}
-		slog.Info("processOpenAIToolCalls: event sent successfully", "event", evName)
+	calls := make([]llm.ToolCall, 0, len(choice.Message.ToolCalls))
+	for _, tc := range choice.Message.ToolCalls {
+		calls = append(calls, llm.ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
 	}
-
-	slog.Info("processOpenAIToolCalls: all tool calls processed")
-	return nil
-}
-
-func handleSendCall(ctx context.Context, it agentml.Interpreter, eventName string, args map[string]any) error {
-	// Build event data from arguments
-	var data any
-	if d, ok := args["data"]; ok {
-		data = d
-	} else if len(args) > 0 {
-		// Filter out target and delay if present
-		filtered := make(map[string]any)
-		for k, v := range args {
-			if k != "target" && k != "delay" {
-				filtered[k] = v
-			}
-		}
-		if len(filtered) > 0 {
-			data = filtered
-		}
-	}
-
-	target, _ := args["target"].(string)
-	delay, _ := args["delay"].(string)
-	ev := &agentml.Event{
-		Name: eventName,
-		Type: agentml.EventTypeExternal,
-		Data: data,
-	}
-	if target != "" {
-		ev.Origin = target
-	}
-	if delay != "" {
-		// Normalize delay format and convert zero delays to empty string (immediate send)
-		normalizedDelay := normalizeDelay(delay)
-		if normalizedDelay != delay {
-			slog.WarnContext(ctx, "Normalized delay format",
-				"original", delay, "normalized", normalizedDelay)
-		}
-		if normalizedDelay != "" {
-			ev.Delay = normalizedDelay
-		}
-		// If normalizedDelay is empty, ev.Delay remains unset (immediate send)
-	}
-	return it.Send(ctx, ev)
-}
-
-func normalizeDelay(delay string) string {
-	delay = strings.TrimSpace(delay)
-
-	// Handle empty or zero delays - these should be immediate sends
-	if delay == "" || delay == "0" || delay == "0s" || delay == "0ms" {
-		return "" // Empty string means immediate send
-	}
-
-	// Handle ISO 8601 zero duration cases
-	if delay == "PT0S" || delay == "P0D" {
-		return "" // Empty string means immediate send
-	}
-
-	// For ISO 8601 durations, try to convert them
-	if strings.HasPrefix(delay, "P") {
-		// This would be the place to add full ISO 8601 to CSS2 conversion
-		// For now, just handle the zero cases above
-		return delay // Keep as-is if we can't convert
-	}
-
-	return delay // Return normalized delay
+	return llm.DispatchToolCalls(ctx, it, calls, eventNameMapping)
 }
 
 // validateToolCalls validates tool call arguments against their schemas.
@@ -1159,7 +1606,7 @@ func validateToolCalls(sendFunctions []prompt.SendFunction, toolCalls []openai.C
 	validationErrors := make(map[string][]string)
 	schemaMap := make(map[string]*jsonschema.Schema)
 	for _, fn := range sendFunctions {
-		sanitizedName := sanitizeFunctionName(fn.Name)
+		sanitizedName := llm.SanitizeName(fn.Name)
 		schemaMap[sanitizedName] = fn.Schema
 	}
 	for _, toolCall := range toolCalls {
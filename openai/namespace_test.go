@@ -0,0 +1,1506 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/llm"
+	"github.com/agentflare-ai/go-xmldom"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+type fakeDM struct{ store map[string]any }
+
+func newFakeDM() *fakeDM { return &fakeDM{store: map[string]any{}} }
+
+func (f *fakeDM) Initialize(ctx context.Context, dataElements []agentml.Data) error { return nil }
+func (f *fakeDM) EvaluateValue(ctx context.Context, expression string) (any, error) {
+	if v, ok := f.store[expression]; ok {
+		return v, nil
+	}
+	return expression, nil
+}
+func (f *fakeDM) EvaluateCondition(ctx context.Context, expression string) (bool, error) {
+	return false, nil
+}
+func (f *fakeDM) EvaluateLocation(ctx context.Context, location string) (any, error) {
+	return f.store[location], nil
+}
+func (f *fakeDM) Assign(ctx context.Context, location string, value any) error {
+	f.store[location] = value
+	return nil
+}
+func (f *fakeDM) GetVariable(ctx context.Context, id string) (any, error) { return f.store[id], nil }
+func (f *fakeDM) SetVariable(ctx context.Context, id string, value any) error {
+	f.store[id] = value
+	return nil
+}
+func (f *fakeDM) GetSystemVariable(ctx context.Context, name string) (any, error)     { return nil, nil }
+func (f *fakeDM) SetSystemVariable(ctx context.Context, name string, value any) error { return nil }
+func (f *fakeDM) SetCurrentEvent(ctx context.Context, event any) error                { return nil }
+func (f *fakeDM) ExecuteScript(ctx context.Context, script string) error              { return nil }
+func (f *fakeDM) Clone(ctx context.Context) (agentml.DataModel, error)                { return newFakeDM(), nil }
+func (f *fakeDM) ValidateExpression(ctx context.Context, expression string, exprType agentml.ExpressionType) error {
+	return nil
+}
+
+// fakeInterp is a minimal interpreter. When snapshot is set, Snapshot parses
+// it so generation takes the tool-calling (streaming) path.
+type fakeInterp struct {
+	dm       *fakeDM
+	snapshot string
+	sent     []*agentml.Event
+	raised   []*agentml.Event
+}
+
+func (fi *fakeInterp) Handle(ctx context.Context, event *agentml.Event) error { return nil }
+func (fi *fakeInterp) Location(ctx context.Context) (string, error)           { return "", nil }
+func (fi *fakeInterp) Type() string                                           { return "test" }
+func (fi *fakeInterp) Shutdown(ctx context.Context) error                     { return nil }
+func (fi *fakeInterp) SessionID() string                                      { return "" }
+func (fi *fakeInterp) Configuration() []string                                { return nil }
+func (fi *fakeInterp) In(ctx context.Context, stateId string) bool            { return false }
+func (fi *fakeInterp) Raise(ctx context.Context, event *agentml.Event) {
+	fi.raised = append(fi.raised, event)
+}
+func (fi *fakeInterp) Send(ctx context.Context, event *agentml.Event) error {
+	fi.sent = append(fi.sent, event)
+	return nil
+}
+func (fi *fakeInterp) Cancel(ctx context.Context, sendId string) error                  { return nil }
+func (fi *fakeInterp) Log(ctx context.Context, label, message string)                   {}
+func (fi *fakeInterp) Context() context.Context                                         { return context.Background() }
+func (fi *fakeInterp) Clock() agentml.Clock                                             { return nil }
+func (fi *fakeInterp) DataModel() agentml.DataModel                                     { return fi.dm }
+func (fi *fakeInterp) ExecuteElement(ctx context.Context, element xmldom.Element) error { return nil }
+func (fi *fakeInterp) SendMessage(ctx context.Context, data agentml.SendData) error     { return nil }
+func (fi *fakeInterp) ScheduleMessage(ctx context.Context, data agentml.SendData) (string, error) {
+	return "", nil
+}
+func (fi *fakeInterp) InvokedSessions() map[string]agentml.Interpreter { return nil }
+func (fi *fakeInterp) Tracer() agentml.Tracer                          { return nil }
+func (fi *fakeInterp) Snapshot(ctx context.Context, maybeConfig ...agentml.SnapshotConfig) (xmldom.Document, error) {
+	if fi.snapshot == "" {
+		return nil, errors.New("no snapshot")
+	}
+	return xmldom.NewDecoder(strings.NewReader(fi.snapshot)).Decode()
+}
+func (fi *fakeInterp) Root() agentml.Filesystem { return nil }
+func (fi *fakeInterp) AfterFunc(ctx context.Context, fn func()) func() bool {
+	return context.AfterFunc(ctx, fn)
+}
+
+const toolSnapshot = `<agentml xmlns="github.com/agentflare-ai/agentml">
+  <state id="idle">
+    <transition event="user.done" target="idle"/>
+  </state>
+</agentml>`
+
+func parseElement(t *testing.T, src string) xmldom.Element {
+	t.Helper()
+	doc, err := xmldom.NewDecoder(strings.NewReader(src)).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return doc.DocumentElement()
+}
+
+// newTestClient returns a client pointed at srv with SDK retries disabled so
+// each generate issues exactly one request per attempt.
+func newTestClient(srv *httptest.Server) openai.Client {
+	return openai.NewClient(
+		option.WithBaseURL(srv.URL+"/"),
+		option.WithAPIKey("test"),
+		option.WithMaxRetries(0),
+	)
+}
+
+// slowServer never answers until the test finishes.
+func slowServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	return srv
+}
+
+func TestGenerateTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		location string
+	}{
+		{name: "non-streaming", location: ` location="out"`},
+		{name: "streaming", snapshot: toolSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := slowServer(t)
+			itp := &fakeInterp{dm: newFakeDM(), snapshot: tt.snapshot}
+			el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" timeout="50ms"`+tt.location+`/>`)
+
+			start := time.Now()
+			err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Fatalf("generate did not honor timeout, took %s", elapsed)
+			}
+			var perr *agentml.PlatformError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected PlatformError, got %T: %v", err, err)
+			}
+			if perr.EventName != "error.execution" {
+				t.Errorf("event = %q, want error.execution", perr.EventName)
+			}
+			if perr.Data["timeout"] != true {
+				t.Errorf("expected timeout flag in data, got %v", perr.Data)
+			}
+		})
+	}
+}
+
+func TestGenerateInvalidTimeout(t *testing.T) {
+	itp := &fakeInterp{dm: newFakeDM()}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out" timeout="soon"/>`)
+	err := executeGenerate(context.Background(), itp, NewProvider(openai.NewClient()), nil, nil, nil, nil, el)
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected PlatformError, got %T: %v", err, err)
+	}
+	if perr.Data["attribute"] != "timeout" {
+		t.Errorf("expected attribute=timeout, got %v", perr.Data)
+	}
+}
+
+// modelServer answers the Responses API, failing with status for every model
+// in failing and returning text for any other model. Requested models are
+// recorded in order.
+func modelServer(t *testing.T, status int, failing ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requested = append(requested, body.Model)
+		w.Header().Set("Content-Type", "application/json")
+		if slices.Contains(failing, body.Model) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"error":{"message":"unavailable","type":"server_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","model":"` + body.Model + `","output":[` +
+			`{"type":"message","id":"msg_1","role":"assistant","status":"completed",` +
+			`"content":[{"type":"output_text","text":"hello from ` + body.Model + `","annotations":[]}]}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requested
+}
+
+func TestGenerateFallbackModels(t *testing.T) {
+	srv, requested := modelServer(t, http.StatusTooManyRequests, "primary")
+	itp := &fakeInterp{dm: newFakeDM()}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="primary" fallback-models="backup, other"`+
+		` prompt="hi" location="out" selected-model-location="chosen"/>`)
+
+	if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if want := []string{"primary", "backup"}; !slices.Equal(*requested, want) {
+		t.Errorf("requested models = %v, want %v", *requested, want)
+	}
+	if got := itp.dm.store["out"]; got != "hello from backup" {
+		t.Errorf("out = %v", got)
+	}
+	if got := itp.dm.store["chosen"]; got != "backup" {
+		t.Errorf("chosen = %v, want backup", got)
+	}
+}
+
+func TestGenerateFallbackModels_NonRetryable(t *testing.T) {
+	srv, requested := modelServer(t, http.StatusBadRequest, "primary")
+	itp := &fakeInterp{dm: newFakeDM()}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="primary" fallback-models="backup"`+
+		` prompt="hi" location="out"/>`)
+
+	if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err == nil {
+		t.Fatal("expected error for non-retryable failure")
+	}
+	if want := []string{"primary"}; !slices.Equal(*requested, want) {
+		t.Errorf("requested models = %v, want %v", *requested, want)
+	}
+}
+
+func TestGeneratePromptTooLarge(t *testing.T) {
+	srv, requested := modelServer(t, http.StatusOK)
+	itp := &fakeInterp{dm: newFakeDM()}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="primary" prompt="`+strings.Repeat("x", 200)+`"`+
+		` location="out" max-prompt-bytes="100"/>`)
+
+	err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el)
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || perr.EventName != "error.execution" {
+		t.Fatalf("err = %v, want error.execution", err)
+	}
+	if got, _ := perr.Data["promptBytes"].(int64); got < 200 {
+		t.Errorf("promptBytes = %v, want at least 200", perr.Data["promptBytes"])
+	}
+	if got := perr.Data["maxPromptBytes"]; got != int64(100) {
+		t.Errorf("maxPromptBytes = %v, want 100", got)
+	}
+	if len(*requested) != 0 {
+		t.Errorf("requested models = %v, want no API call", *requested)
+	}
+}
+
+func TestGenerateResponseTruncated(t *testing.T) {
+	srv, _ := modelServer(t, http.StatusOK)
+	itp := &fakeInterp{dm: newFakeDM()}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="primary" prompt="hi"`+
+		` location="out" max-response-bytes="5"/>`)
+
+	if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got, want := itp.dm.store["out"], "hello\n[truncated: 5 of 18 bytes]"; got != want {
+		t.Errorf("out = %q, want %q", got, want)
+	}
+	// Cuts fall back to the last whole character
+	if got, want := truncateResponse(context.Background(), "héllo", 2), "h\n[truncated: 1 of 6 bytes]"; got != want {
+		t.Errorf("truncateResponse = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateDryRun(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="route this" location="plan" dry-run="true"/>`)
+	if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no HTTP calls, got %d", calls)
+	}
+
+	plan, ok := itp.dm.store["plan"].(map[string]any)
+	if !ok {
+		t.Fatalf("plan = %T, want map", itp.dm.store["plan"])
+	}
+	if plan["model"] != "gpt-test" {
+		t.Errorf("model = %v", plan["model"])
+	}
+	messages := plan["messages"].([]any)
+	if len(messages) != 2 {
+		t.Fatalf("expected system and user messages, got %d", len(messages))
+	}
+	if user := messages[1].(map[string]any)["content"]; user != "route this" {
+		t.Errorf("user content = %v", user)
+	}
+	if system := messages[0].(map[string]any)["content"].(string); !strings.Contains(system, "user.done") {
+		t.Errorf("system prompt missing pruned snapshot: %q", system)
+	}
+	if tools := plan["tools"].([]any); len(tools) != 1 {
+		t.Errorf("expected 1 tool, got %d", len(tools))
+	}
+	if tokens := plan["estimatedTokens"].(int); tokens <= 0 {
+		t.Errorf("estimatedTokens = %d", tokens)
+	}
+}
+
+func TestGenerateToolFilter(t *testing.T) {
+	snapshot := `<agentml xmlns="github.com/agentflare-ai/agentml">
+  <state id="idle">
+    <transition event="user.done" target="idle"/>
+    <transition event="user.cancel" target="idle"/>
+    <transition event="admin.reset" target="idle"/>
+  </state>
+</agentml>`
+	tests := []struct {
+		name  string
+		attrs string
+		want  []string
+	}{
+		{"include", `tools-include="user.*"`, []string{"send_user_done", "send_user_cancel"}},
+		{"exclude", `tools-exclude="user.cancel, admin.*"`, []string{"send_user_done"}},
+		{"none", ``, []string{"send_user_done", "send_user_cancel", "send_admin_reset"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itp := &fakeInterp{dm: newFakeDM(), snapshot: snapshot}
+			el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="route" location="plan" dry-run="true" `+tt.attrs+`/>`)
+			if err := executeGenerate(context.Background(), itp, NewProvider(openai.NewClient()), nil, nil, nil, nil, el); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			var got []string
+			for _, tool := range itp.dm.store["plan"].(map[string]any)["tools"].([]any) {
+				got = append(got, tool.(map[string]any)["function"].(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tools = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: snapshot}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="route" location="plan" dry-run="true" tools-include="user.["/>`)
+	var pe *agentml.PlatformError
+	if err := executeGenerate(context.Background(), itp, NewProvider(openai.NewClient()), nil, nil, nil, nil, el); !errors.As(err, &pe) {
+		t.Fatalf("expected PlatformError for malformed pattern, got %v", err)
+	}
+}
+
+func TestGenerateStrictTargets(t *testing.T) {
+	snapshot := `<agentml xmlns="github.com/agentflare-ai/agentml">
+  <state id="idle">
+    <transition event="user.route" target="billing"/>
+    <transition event="user.route" target="support billing"/>
+    <transition event="user.done" target="idle"/>
+  </state>
+  <state id="billing"/>
+  <state id="support"/>
+</agentml>`
+	targetSchema := func(t *testing.T, strict string) map[string]map[string]any {
+		t.Helper()
+		itp := &fakeInterp{dm: newFakeDM(), snapshot: snapshot}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="route" location="plan" dry-run="true" strict-targets="`+strict+`"/>`)
+		if err := executeGenerate(context.Background(), itp, NewProvider(openai.NewClient()), nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		out := map[string]map[string]any{}
+		for _, tool := range itp.dm.store["plan"].(map[string]any)["tools"].([]any) {
+			fn := tool.(map[string]any)["function"].(map[string]any)
+			props := fn["parameters"].(map[string]any)["properties"].(map[string]any)
+			out[fn["name"].(string)] = props["target"].(map[string]any)
+		}
+		return out
+	}
+	enumOf := func(target map[string]any) []string {
+		var out []string
+		for _, v := range target["enum"].([]any) {
+			out = append(out, v.(string))
+		}
+		return out
+	}
+
+	strict := targetSchema(t, "true")
+	if got, want := enumOf(strict["send_user_route"]), []string{"billing", "support"}; !slices.Equal(got, want) {
+		t.Errorf("send_user_route enum = %v, want %v", got, want)
+	}
+	if got, want := enumOf(strict["send_user_done"]), []string{"idle"}; !slices.Equal(got, want) {
+		t.Errorf("send_user_done enum = %v, want %v", got, want)
+	}
+	for name, target := range targetSchema(t, "false") {
+		if _, ok := target["enum"]; ok {
+			t.Errorf("%s: expected no enum without strict-targets, got %v", name, target["enum"])
+		}
+	}
+}
+
+// streamServer answers streaming Responses requests. respond receives the
+// 1-based request number and returns whether to emit a send_user_done tool
+// call (otherwise a text-only response). Request bodies are recorded.
+func streamServer(t *testing.T, respond func(n int) bool) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		n := len(bodies)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		write := func(data string) {
+			_, _ = w.Write([]byte("data: " + data + "\n\n"))
+		}
+		if respond(n) {
+			callID := fmt.Sprintf("call_%d", n)
+			item := `{"type":"function_call","id":"fc_` + callID + `","call_id":"` + callID + `","name":"send_user_done","arguments":"{}","status":"completed"}`
+			write(`{"type":"response.output_item.added","output_index":0,"sequence_number":1,"item":` + item + `}`)
+			write(`{"type":"response.output_item.done","output_index":0,"sequence_number":2,"item":` + item + `}`)
+		} else {
+			write(`{"type":"response.output_text.delta","output_index":0,"content_index":0,"item_id":"msg_1","sequence_number":1,"delta":"done"}`)
+		}
+		write(`{"type":"response.completed","sequence_number":3,"response":{"id":"resp_1","object":"response","output":[]}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func TestGenerateMaxTurns(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTurns  string
+		respond   func(n int) bool
+		wantCalls int
+		wantSent  int
+	}{
+		{name: "single turn by default", respond: func(int) bool { return true }, wantCalls: 1, wantSent: 1},
+		{name: "bounded by max-turns", maxTurns: ` max-turns="3"`, respond: func(int) bool { return true }, wantCalls: 3, wantSent: 3},
+		{name: "stops when model stops calling tools", maxTurns: ` max-turns="5"`, respond: func(n int) bool { return n == 1 }, wantCalls: 2, wantSent: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bodies := streamServer(t, tt.respond)
+			itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+			el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="go"`+tt.maxTurns+`/>`)
+
+			if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if len(*bodies) != tt.wantCalls {
+				t.Fatalf("API calls = %d, want %d", len(*bodies), tt.wantCalls)
+			}
+			if len(itp.sent) != tt.wantSent {
+				t.Errorf("events sent = %d, want %d", len(itp.sent), tt.wantSent)
+			}
+			for i, body := range (*bodies)[1:] {
+				if !hasFunctionCallOutput(body, fmt.Sprintf("call_%d", i+1)) {
+					t.Errorf("request %d missing tool result for call_%d", i+2, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateCorrectionRetriesRunOut(t *testing.T) {
+	// Every response has malformed arguments
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","status":"completed","output":[{"type":"function_call","id":"fc_1","call_id":"call_1","name":"send_user_done","arguments":"{\"data\":","status":"completed"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="go" stream="false" retry="2"/>`)
+	err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el)
+	var correction *CorrectionNeededError
+	if !errors.As(err, &correction) {
+		t.Fatalf("generate = %v, want a correction error once retries run out", err)
+	}
+	if calls != 2 {
+		t.Errorf("API calls = %d, want 2", calls)
+	}
+	if len(itp.sent) != 0 {
+		t.Errorf("events sent = %d, want none", len(itp.sent))
+	}
+}
+
+func TestGenerateWithoutStreaming(t *testing.T) {
+	// The first response has malformed arguments; the correction is
+	// answered with two valid calls in one response
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		call := func(id, args string) string {
+			return `{"type":"function_call","id":"fc_` + id + `","call_id":"` + id + `","name":"send_user_done","arguments":` + strconv.Quote(args) + `,"status":"completed"}`
+		}
+		output := call("call_1", `{"data":`)
+		if len(bodies) > 1 {
+			output = call("call_2", `{"data":{"n":1}}`) + "," + call("call_3", `{"data":{"n":2}}`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","status":"completed","output":[` + output + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="go" stream="false"/>`)
+	if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("API calls = %d, want 2", len(bodies))
+	}
+	for i, body := range bodies {
+		if body["stream"] == true {
+			t.Errorf("request %d was streamed", i+1)
+		}
+	}
+	var rejected bool
+	for _, item := range bodies[1]["input"].([]any) {
+		m, _ := item.(map[string]any)
+		if m["type"] == "function_call_output" && m["call_id"] == "call_1" {
+			rejected = strings.Contains(m["output"].(string), `"rejected"`)
+		}
+	}
+	if !rejected {
+		t.Error("correction request does not reject call_1")
+	}
+	if len(itp.sent) != 2 {
+		t.Fatalf("events sent = %d, want 2", len(itp.sent))
+	}
+	for i, ev := range itp.sent {
+		if data, _ := ev.Data.(map[string]any); ev.Name != "user.done" || data["n"] != float64(i+1) {
+			t.Errorf("event %d = %s %v, want user.done with n=%d", i, ev.Name, ev.Data, i+1)
+		}
+	}
+}
+
+func TestGenerateResultsLocation(t *testing.T) {
+	// One valid call and one for an event the document has no transition
+	// for; the correction is answered without further calls
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		output := ""
+		if calls == 1 {
+			output = `{"type":"function_call","id":"fc_1","call_id":"call_1","name":"send_user_done","arguments":"{\"data\":{}}","status":"completed"},` +
+				`{"type":"function_call","id":"fc_2","call_id":"call_2","name":"send_user_missing","arguments":"{}","status":"completed"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","status":"completed","output":[` + output + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	dm := newFakeDM()
+	itp := &fakeInterp{dm: dm, snapshot: toolSnapshot}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="go" stream="false" results-location="results"/>`)
+	if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("API calls = %d, want 2", calls)
+	}
+	if len(itp.sent) != 1 || itp.sent[0].Name != "user.done" {
+		t.Fatalf("sent = %v, want only user.done", itp.sent)
+	}
+	results, ok := dm.store["results"].([]any)
+	if !ok || len(results) != 2 {
+		t.Fatalf("results = %#v, want two entries", dm.store["results"])
+	}
+	if got := results[0].(map[string]any); got["event"] != "user.done" || got["accepted"] != true || got["error"] != nil {
+		t.Errorf("results[0] = %v, want accepted user.done", got)
+	}
+	got := results[1].(map[string]any)
+	if got["event"] != "send_user_missing" || got["accepted"] != false {
+		t.Errorf("results[1] = %v, want rejected send_user_missing", got)
+	}
+	if msg, _ := got["error"].(string); !strings.Contains(msg, "no schema found") {
+		t.Errorf("results[1] error = %q, want a missing schema error", msg)
+	}
+}
+
+func TestGenerateAppendCallsTo(t *testing.T) {
+	dm := newFakeDM()
+	dm.store["transcript"] = []any{map[string]any{"event": "earlier"}}
+	var before int
+	p := &fakeProvider{respond: func(n int) llm.Response {
+		if n == 1 {
+			return llm.Response{ToolCalls: []llm.ToolCall{
+				{ID: "call_1", Name: "send_user_done", Arguments: `{"data":{"step":1}}`},
+				{ID: "call_2", Name: "send_user_missing", Arguments: `{}`},
+			}}
+		}
+		before = len(dm.store["transcript"].([]any))
+		return llm.Response{ToolCalls: []llm.ToolCall{
+			{ID: "call_3", Name: "send_user_done", Arguments: `{"data":{"step":2}}`},
+		}}
+	}}
+	itp := &fakeInterp{dm: dm, snapshot: toolSnapshot}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="go" append-calls-to="transcript"/>`)
+	if err := executeGenerate(context.Background(), itp, p, nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(p.requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(p.requests))
+	}
+	if before != 2 {
+		t.Errorf("transcript before the retry = %d entries, want 2", before)
+	}
+	transcript, _ := dm.store["transcript"].([]any)
+	if len(transcript) != 3 {
+		t.Fatalf("transcript = %#v, want the earlier entry and two validated calls", dm.store["transcript"])
+	}
+	for i, wantRetry := range []int{0, 1} {
+		got := transcript[i+1].(map[string]any)
+		args, _ := got["arguments"].(map[string]any)
+		data, _ := args["data"].(map[string]any)
+		if got["event"] != "user.done" || got["retry"] != wantRetry || data["step"] != float64(i+1) {
+			t.Errorf("transcript[%d] = %v, want user.done step %d on retry %d", i+1, got, i+1, wantRetry)
+		}
+	}
+}
+
+func hasFunctionCallOutput(body map[string]any, callID string) bool {
+	input, _ := body["input"].([]any)
+	for _, item := range input {
+		m, _ := item.(map[string]any)
+		if m["type"] == "function_call_output" && m["call_id"] == callID {
+			return strings.Contains(m["output"].(string), `"event":"user.done"`)
+		}
+	}
+	return false
+}
+
+// fakeProvider records each request and answers from respond, invoking the
+// request's OnToolCall for every scripted tool call.
+type fakeProvider struct {
+	requests []llm.Request
+	respond  func(n int) llm.Response
+}
+
+func (f *fakeProvider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	f.requests = append(f.requests, req)
+	resp := f.respond(len(f.requests))
+	for _, call := range resp.ToolCalls {
+		if req.OnToolCall != nil {
+			if err := req.OnToolCall(call); err != nil {
+				return resp, err
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeProvider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestGenerateChildMessages(t *testing.T) {
+	p := &fakeProvider{respond: func(int) llm.Response { return llm.Response{Content: "10"} }}
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: `<agentml xmlns="github.com/agentflare-ai/agentml"><state id="idle"/></agentml>`}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" location="out" prompt="What is 5+5?">
+  <message role="system">Answer with a number only.</message>
+  <message role="user">What is 2+2?</message>
+  <message role="assistant">{{if true}}4{{end}}</message>
+</generate>`)
+	if err := executeGenerate(context.Background(), itp, p, nil, nil, nil, nil, el); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(p.requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(p.requests))
+	}
+	messages := p.requests[0].Messages
+	if len(messages) != 5 {
+		t.Fatalf("messages = %+v, want snapshot, three examples and the prompt", messages)
+	}
+	if messages[0].Role != llm.RoleSystem || !strings.Contains(messages[0].Content, `id="idle"`) {
+		t.Errorf("messages[0] = %+v, want the snapshot system message", messages[0])
+	}
+	want := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Answer with a number only."},
+		{Role: llm.RoleUser, Content: "What is 2+2?"},
+		{Role: llm.RoleAssistant, Content: "4"},
+		{Role: llm.RoleUser, Content: "What is 5+5?"},
+	}
+	for i, w := range want {
+		if got := messages[i+1]; got.Role != w.Role || got.Content != w.Content {
+			t.Errorf("messages[%d] = %s %q, want %s %q", i+1, got.Role, got.Content, w.Role, w.Content)
+		}
+	}
+
+	el = parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" location="out">
+  <message role="narrator">Once upon a time</message>
+</generate>`)
+	var perr *agentml.PlatformError
+	if err := executeGenerate(context.Background(), itp, p, nil, nil, nil, nil, el); !errors.As(err, &perr) || !strings.Contains(perr.Message, "narrator") {
+		t.Errorf("err = %v, want an invalid role error", err)
+	}
+}
+
+func TestGenerateWithFakeProvider(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		p := &fakeProvider{respond: func(int) llm.Response { return llm.Response{Content: "42"} }}
+		itp := &fakeInterp{dm: newFakeDM()}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="meaning of life" location="answer" max-output-tokens="64"/>`)
+		if err := executeGenerate(context.Background(), itp, p, nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		if got := itp.dm.store["answer"]; got != "42" {
+			t.Fatalf("answer = %v, want 42", got)
+		}
+		req := p.requests[0]
+		if req.Model != "gpt-test" || req.MaxOutputTokens != 64 || len(req.Tools) != 0 {
+			t.Fatalf("unexpected request: %+v", req)
+		}
+		if len(req.Messages) != 2 || req.Messages[0].Role != llm.RoleSystem || req.Messages[1].Content != "meaning of life" {
+			t.Fatalf("unexpected messages: %+v", req.Messages)
+		}
+	})
+
+	t.Run("tools", func(t *testing.T) {
+		p := &fakeProvider{respond: func(int) llm.Response {
+			return llm.Response{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "send_user_done", Arguments: `{"data":{"ok":true}}`}}}
+		}}
+		itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="finish"/>`)
+		if err := executeGenerate(context.Background(), itp, p, nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		req := p.requests[0]
+		if req.ToolChoice != llm.ToolChoiceRequired || len(req.Tools) != 1 || req.Tools[0].EventName != "user.done" {
+			t.Fatalf("unexpected request tools: %+v", req)
+		}
+		if len(itp.sent) != 1 || itp.sent[0].Name != "user.done" {
+			t.Fatalf("expected user.done to be sent, got %v", itp.sent)
+		}
+	})
+}
+
+func TestStreamingToolCallArgumentDeltas(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		write := func(data string) {
+			_, _ = w.Write([]byte("data: " + data + "\n\n"))
+		}
+		// The arguments only arrive as deltas; the added and done items carry none
+		item := `{"type":"function_call","id":"fc_1","call_id":"call_1","name":"send_user_done","arguments":"","status":"in_progress"}`
+		write(`{"type":"response.output_item.added","output_index":0,"sequence_number":1,"item":` + item + `}`)
+		for i, delta := range []string{`{\"data\":{\"na`, `me\":\"Ada\"},`, `\"target\":\"#parent\"}`} {
+			write(fmt.Sprintf(`{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":0,"sequence_number":%d,"delta":"%s"}`, i+2, delta))
+		}
+		write(`{"type":"response.output_item.done","output_index":0,"sequence_number":5,"item":` + item + `}`)
+		write(`{"type":"response.completed","sequence_number":6,"response":{"id":"resp_1","object":"response","output":[]}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	var calls []llm.ToolCall
+	_, err := NewProvider(newTestClient(srv)).Generate(context.Background(), llm.Request{
+		Model:    "gpt-test",
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}},
+		Tools:    []llm.Tool{{Name: "send_user_done", EventName: "user.done"}},
+		OnToolCall: func(call llm.ToolCall) error {
+			calls = append(calls, call)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(calls))
+	}
+	if want := `{"data":{"name":"Ada"},"target":"#parent"}`; calls[0].Arguments != want {
+		t.Errorf("arguments = %q, want %q", calls[0].Arguments, want)
+	}
+}
+
+func TestGenerateEmitProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		write := func(data string) {
+			_, _ = w.Write([]byte("data: " + data + "\n\n"))
+		}
+		seq := 0
+		for _, callID := range []string{"call_1", "call_2"} {
+			item := `{"type":"function_call","id":"fc_` + callID + `","call_id":"` + callID + `","name":"send_user_done","arguments":"","status":"in_progress"}`
+			seq++
+			write(fmt.Sprintf(`{"type":"response.output_item.added","output_index":0,"sequence_number":%d,"item":%s}`, seq, item))
+			seq++
+			write(fmt.Sprintf(`{"type":"response.function_call_arguments.delta","item_id":"fc_%s","output_index":0,"sequence_number":%d,"delta":"{}"}`, callID, seq))
+			seq++
+			write(fmt.Sprintf(`{"type":"response.output_item.done","output_index":0,"sequence_number":%d,"item":%s}`, seq, item))
+		}
+		write(`{"type":"response.completed","sequence_number":99,"response":{"id":"resp_1","object":"response","output":[]}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	generate := func(t *testing.T, attrs string) *fakeInterp {
+		t.Helper()
+		itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="go"`+attrs+`/>`)
+		if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		if len(itp.sent) != 2 {
+			t.Fatalf("events sent = %d, want 2", len(itp.sent))
+		}
+		return itp
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		if itp := generate(t, ""); len(itp.raised) != 0 {
+			t.Errorf("expected no progress events, got %d", len(itp.raised))
+		}
+	})
+
+	t.Run("ordered events", func(t *testing.T) {
+		itp := generate(t, ` emit-progress="true"`)
+		want := []struct{ name, id string }{
+			{EventToolCallStarted, "call_1"},
+			{EventToolCallCompleted, "call_1"},
+			{EventToolCallStarted, "call_2"},
+			{EventToolCallCompleted, "call_2"},
+		}
+		if len(itp.raised) != len(want) {
+			t.Fatalf("raised %d events, want %d", len(itp.raised), len(want))
+		}
+		for i, w := range want {
+			ev := itp.raised[i]
+			data, _ := ev.Data.(map[string]any)
+			if ev.Name != w.name || ev.Type != agentml.EventTypeInternal || data["id"] != w.id {
+				t.Errorf("event %d = %s %v %v, want internal %s for %s", i, ev.Name, ev.Type, data, w.name, w.id)
+			}
+			if data["name"] != "send_user_done" || data["event"] != "user.done" {
+				t.Errorf("event %d data = %v, want send_user_done mapped to user.done", i, data)
+			}
+		}
+	})
+}
+
+// concurrencyProvider records the most generations it saw in flight at once.
+type concurrencyProvider struct {
+	inFlight, maxInFlight atomic.Int32
+}
+
+func (p *concurrencyProvider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		peak := p.maxInFlight.Load()
+		if n <= peak || p.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return llm.Response{Content: "ok"}, nil
+}
+
+func (p *concurrencyProvider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestGenerateWithoutAPIKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_BASE_URL", "")
+	dm := newFakeDM()
+	loaded, err := Loader()(context.Background(), &fakeInterp{dm: dm}, nil)
+	if err != nil {
+		t.Fatalf("load without an API key: %v", err)
+	}
+
+	_, err = loaded.Handle(context.Background(), parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out"/>`))
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || perr.EventName != "error.execution" || !strings.Contains(perr.Message, "OpenAI API key not configured") {
+		t.Fatalf("err = %v, want an API key not configured error", err)
+	}
+	if _, ok := dm.store["out"]; ok {
+		t.Errorf("out = %v, want nothing assigned", dm.store["out"])
+	}
+
+	_, err = loaded.Handle(context.Background(), parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="plan" dry-run="true"/>`))
+	if err != nil {
+		t.Fatalf("dry run without an API key: %v", err)
+	}
+	if _, ok := dm.store["plan"]; !ok {
+		t.Error("dry run assigned no plan")
+	}
+
+	loaded, err = LoaderWithOptions(Options{APIKey: "injected"})(context.Background(), &fakeInterp{dm: dm}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, ok := loaded.(*ns).provider.(noKeyProvider); ok {
+		t.Error("provider ignores the injected API key")
+	}
+}
+
+func TestMaxConcurrentGenerations(t *testing.T) {
+	const limit, total = 2, 8
+	loader := LoaderWithOptions(Options{MaxConcurrentGenerations: limit})
+	p := &concurrencyProvider{}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+	for i := 0; i < total; i++ {
+		// Separate namespaces from one loader share its limit
+		loaded, err := loader(context.Background(), &fakeInterp{dm: newFakeDM()}, nil)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		inst := loaded.(*ns)
+		inst.provider = p
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out"/>`)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := inst.Handle(context.Background(), el)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+	}
+	if peak := p.maxInFlight.Load(); peak > limit {
+		t.Fatalf("max in-flight generations = %d, want <= %d", peak, limit)
+	}
+}
+
+func TestMaxConcurrentGenerations_CancelWhileQueued(t *testing.T) {
+	meter := newRecordingMeter()
+	lim := newGenerationLimiter(1, recordingProvider{meter: meter})
+	release, err := lim.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n := &ns{itp: &fakeInterp{dm: newFakeDM()}, provider: &concurrencyProvider{}, limiter: lim}
+	err = n.handleGenerate(ctx, parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out"/>`))
+	var perr *agentml.PlatformError
+	if !errors.As(err, &perr) || perr.EventName != "error.execution" {
+		t.Fatalf("expected error.execution while queued, got %v", err)
+	}
+	if got := meter.added["openai.generate.queue_depth"]; !slices.Equal(got, []int64{1, -1}) {
+		t.Errorf("queue depth changes = %v, want [1 -1] on the configured meter", got)
+	}
+}
+
+// stateExitProvider exits the state on its first call, then waits for the
+// generation to be cancelled before returning a late response.
+type stateExitProvider struct {
+	exit      func()
+	cancelled atomic.Bool
+}
+
+func (p *stateExitProvider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	p.exit()
+	select {
+	case <-ctx.Done():
+		p.cancelled.Store(true)
+	case <-time.After(2 * time.Second):
+	}
+	return llm.Response{Content: "late"}, nil
+}
+
+func (p *stateExitProvider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestGenerateCancelledOnStateExit(t *testing.T) {
+	// A state without an id is tracked by its element.
+	for _, state := range []string{`<state id="thinking">`, `<state>`} {
+		t.Run(state, func(t *testing.T) {
+			itp := &fakeInterp{dm: newFakeDM()}
+			p := &stateExitProvider{}
+			n := &ns{itp: itp, provider: p}
+			doc, err := xmldom.NewDecoder(strings.NewReader(`<agentml xmlns="github.com/agentflare-ai/agentml">
+  ` + state + `
+    <onentry>
+      <generate xmlns="` + OpenAINamespaceURI + `" model="gpt-test" prompt="hi" location="out"/>
+    </onentry>
+  </state>
+</agentml>`)).Decode()
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			// Hooking twice, as when a snapshot is reloaded, adds one hook.
+			for range 2 {
+				if err := hookStateExits(doc); err != nil {
+					t.Fatalf("hook: %v", err)
+				}
+			}
+			hooks := doc.DocumentElement().GetElementsByTagNameNS(OpenAINamespaceURI, stateExitTag)
+			if hooks.Length() != 1 {
+				t.Fatalf("got %d state-exit hooks, want 1", hooks.Length())
+			}
+			hook := hooks.Item(0).(xmldom.Element)
+			el := doc.DocumentElement().GetElementsByTagNameNS(OpenAINamespaceURI, "generate").Item(0).(xmldom.Element)
+			if got, want := exitedState(hook), enclosingState(el); got == nil || got != want {
+				t.Fatalf("hook exits state %v, want %v", got, want)
+			}
+			// The interpreter runs the state's <onexit> while the call is in flight.
+			p.exit = func() {
+				if ok, err := n.Handle(context.Background(), hook); !ok || err != nil {
+					t.Errorf("state-exit: ok=%v err=%v", ok, err)
+				}
+			}
+
+			if err := n.handleGenerate(context.Background(), el); err != nil {
+				t.Fatalf("generate: %v, want nil after state exit", err)
+			}
+			if !p.cancelled.Load() {
+				t.Error("provider context was not cancelled when the state exited")
+			}
+			if _, ok := itp.dm.store["out"]; ok {
+				t.Errorf("out = %v, want no assignment after state exit", itp.dm.store["out"])
+			}
+			if len(itp.sent) != 0 || len(itp.raised) != 0 {
+				t.Errorf("sent = %v, raised = %v, want no events after state exit", itp.sent, itp.raised)
+			}
+		})
+	}
+}
+
+func TestGenerateCache(t *testing.T) {
+	generate := func(t *testing.T, p llm.Provider, cache Cache, itp *fakeInterp, attrs string) {
+		t.Helper()
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi"`+attrs+`/>`)
+		if err := executeGenerate(context.Background(), itp, p, nil, cache, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+	}
+
+	t.Run("hit skips the provider", func(t *testing.T) {
+		p := &fakeProvider{respond: func(n int) llm.Response { return llm.Response{Content: fmt.Sprintf("answer %d", n)} }}
+		cache := NewLRUCache(8)
+		itp := &fakeInterp{dm: newFakeDM()}
+		generate(t, p, cache, itp, ` location="first" cache="true" seed="7" temperature="0"`)
+		generate(t, p, cache, itp, ` location="second" cache="true" seed="7" temperature="0"`)
+		if len(p.requests) != 1 {
+			t.Fatalf("provider called %d times, want 1", len(p.requests))
+		}
+		if itp.dm.store["second"] != "answer 1" {
+			t.Errorf("second = %v, want cached answer 1", itp.dm.store["second"])
+		}
+
+		// The seed does not change a temperature 0 response
+		generate(t, p, cache, itp, ` location="third" cache="true" seed="8" temperature="0"`)
+		if len(p.requests) != 1 {
+			t.Fatalf("provider called %d times after seed change, want 1", len(p.requests))
+		}
+		if itp.dm.store["third"] != "answer 1" {
+			t.Errorf("third = %v, want cached answer 1", itp.dm.store["third"])
+		}
+
+		// Other sampling parameters still make a different request
+		generate(t, p, cache, itp, ` location="fourth" cache="true" seed="7" temperature="0" max-output-tokens="5"`)
+		if len(p.requests) != 2 {
+			t.Fatalf("provider called %d times after max-output-tokens change, want 2", len(p.requests))
+		}
+	})
+
+	t.Run("non-deterministic sampling is not cached", func(t *testing.T) {
+		for _, attrs := range []string{
+			` location="out" cache="true" temperature="0"`,
+			` location="out" cache="true" seed="7" temperature="0.7"`,
+			` location="out" seed="7" temperature="0"`,
+		} {
+			p := &fakeProvider{respond: func(int) llm.Response { return llm.Response{Content: "ok"} }}
+			cache := NewLRUCache(8)
+			itp := &fakeInterp{dm: newFakeDM()}
+			generate(t, p, cache, itp, attrs)
+			generate(t, p, cache, itp, attrs)
+			if len(p.requests) != 2 {
+				t.Errorf("%s: provider called %d times, want 2", attrs, len(p.requests))
+			}
+		}
+	})
+
+	t.Run("tool calls are replayed", func(t *testing.T) {
+		p := &fakeProvider{respond: func(int) llm.Response {
+			return llm.Response{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "send_user_done", Arguments: `{}`}}}
+		}}
+		cache := NewLRUCache(8)
+		itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+		generate(t, p, cache, itp, ` cache="true" seed="1" temperature="0"`)
+		generate(t, p, cache, itp, ` cache="true" seed="1" temperature="0"`)
+		if len(p.requests) != 1 {
+			t.Fatalf("provider called %d times, want 1", len(p.requests))
+		}
+		if len(itp.sent) != 2 {
+			t.Fatalf("expected the cached tool call to send user.done again, got %v", itp.sent)
+		}
+	})
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2)
+	cache.Set(ctx, "a", llm.Response{Content: "a"})
+	cache.Set(ctx, "b", llm.Response{Content: "b"})
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", llm.Response{Content: "c"})
+	if _, ok := cache.Get(ctx, "b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(ctx, key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+}
+
+// recordingMeter captures the generation measurements, keyed by instrument
+// name and attributes.
+type recordingMeter struct {
+	noop.Meter
+	counts  map[string]int64
+	samples map[string]int
+	// added lists the changes to each up-down counter in order.
+	added map[string][]int64
+}
+
+func newRecordingMeter() *recordingMeter {
+	return &recordingMeter{counts: map[string]int64{}, samples: map[string]int{}, added: map[string][]int64{}}
+}
+
+func (m *recordingMeter) Int64UpDownCounter(name string, _ ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	return recordingUpDownCounter{m: m, name: name}, nil
+}
+
+func (m *recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return recordingCounter{m: m, name: name}, nil
+}
+
+func (m *recordingMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return recordingHistogram{m: m, name: name}, nil
+}
+
+func measurementKey(name string, attrs attribute.Set) string {
+	key := name
+	for _, kv := range attrs.ToSlice() {
+		key += " " + string(kv.Key) + "=" + kv.Value.Emit()
+	}
+	return key
+}
+
+type recordingCounter struct {
+	noop.Int64Counter
+	m    *recordingMeter
+	name string
+}
+
+func (c recordingCounter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	c.m.counts[measurementKey(c.name, metric.NewAddConfig(opts).Attributes())] += incr
+}
+
+type recordingUpDownCounter struct {
+	noop.Int64UpDownCounter
+	m    *recordingMeter
+	name string
+}
+
+func (c recordingUpDownCounter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	c.m.added[c.name] = append(c.m.added[c.name], incr)
+}
+
+type recordingHistogram struct {
+	noop.Float64Histogram
+	m    *recordingMeter
+	name string
+}
+
+func (h recordingHistogram) Record(ctx context.Context, value float64, opts ...metric.RecordOption) {
+	h.m.samples[measurementKey(h.name, metric.NewRecordConfig(opts).Attributes())]++
+}
+
+type recordingProvider struct {
+	noop.MeterProvider
+	meter *recordingMeter
+}
+
+func (p recordingProvider) Meter(string, ...metric.MeterOption) metric.Meter { return p.meter }
+
+func TestGenerationMetrics(t *testing.T) {
+	meter := newRecordingMeter()
+	metrics := newGenerationMetrics(recordingProvider{meter: meter})
+
+	p := &fakeProvider{respond: func(int) llm.Response {
+		return llm.Response{Content: "42", Usage: llm.Usage{InputTokens: 12, OutputTokens: 3}}
+	}}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="answer"/>`)
+	for range 2 {
+		if err := executeGenerate(context.Background(), &fakeInterp{dm: newFakeDM()}, p, nil, nil, metrics, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+	}
+	if got := meter.counts[MetricGenerations+" model=gpt-test outcome=success"]; got != 2 {
+		t.Errorf("success generations = %d, want 2 (counts %v)", got, meter.counts)
+	}
+	if got := meter.samples[MetricGenerationDuration+" model=gpt-test outcome=success"]; got != 2 {
+		t.Errorf("duration samples = %d, want 2", got)
+	}
+	if got := meter.counts[MetricInputTokens+" model=gpt-test"]; got != 24 {
+		t.Errorf("input tokens = %d, want 24", got)
+	}
+	if got := meter.counts[MetricOutputTokens+" model=gpt-test"]; got != 6 {
+		t.Errorf("output tokens = %d, want 6", got)
+	}
+
+	// Tool calls that never validate are counted as validation failures
+	bad := &fakeProvider{respond: func(int) llm.Response {
+		return llm.Response{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "send_user_done", Arguments: `not json`}}}
+	}}
+	itp := &fakeInterp{dm: newFakeDM(), snapshot: toolSnapshot}
+	el = parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="finish" retry="1"/>`)
+	if err := executeGenerate(context.Background(), itp, bad, nil, nil, metrics, nil, el); err == nil {
+		t.Fatal("expected validation error")
+	}
+	if got := meter.counts[MetricGenerations+" model=gpt-test outcome=validation_failure"]; got != 1 {
+		t.Errorf("validation failures = %d, want 1 (counts %v)", got, meter.counts)
+	}
+}
+
+func TestGeneratePromptCaching(t *testing.T) {
+	snapshot := func(active string) string {
+		return `<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:runtime="` + agentml.RuntimeNamespaceURI + `">
+  <runtime:configuration><runtime:state id="` + active + `"/></runtime:configuration>
+  <state id="idle">
+    <transition event="user.done" target="idle"/>
+  </state>
+</agentml>`
+	}
+
+	t.Run("stable prefix is separate", func(t *testing.T) {
+		p := &fakeProvider{respond: func(int) llm.Response { return llm.Response{Content: "ok"} }}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out"/>`)
+		for _, active := range []string{"idle", "busy"} {
+			itp := &fakeInterp{dm: newFakeDM(), snapshot: snapshot(active)}
+			if err := executeGenerate(context.Background(), itp, p, nil, nil, nil, nil, el); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+		}
+
+		first, second := p.requests[0], p.requests[1]
+		if len(first.Messages) != 3 || first.Messages[1].Role != llm.RoleSystem || first.Messages[2].Role != llm.RoleUser {
+			t.Fatalf("expected stable system, runtime system and user messages, got %+v", first.Messages)
+		}
+		stable, runtime := first.Messages[0].Content, first.Messages[1].Content
+		if !strings.Contains(stable, `<state id="idle">`) || strings.Contains(stable, "configuration") {
+			t.Errorf("stable prefix should hold only the document structure:\n%s", stable)
+		}
+		if !strings.Contains(runtime, "configuration") || strings.Contains(runtime, "transition") {
+			t.Errorf("runtime block should hold only the runtime state:\n%s", runtime)
+		}
+		if second.Messages[0].Content != stable {
+			t.Errorf("stable prefix changed with the runtime state:\n%s", second.Messages[0].Content)
+		}
+		if first.PromptCacheKey == "" || first.PromptCacheKey != second.PromptCacheKey {
+			t.Errorf("prompt cache keys = %q, %q; want equal and non-empty", first.PromptCacheKey, second.PromptCacheKey)
+		}
+	})
+
+	t.Run("cached tokens are reported", func(t *testing.T) {
+		var body map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","model":"gpt-test","output":[` +
+				`{"type":"message","id":"msg_1","role":"assistant","status":"completed",` +
+				`"content":[{"type":"output_text","text":"ok","annotations":[]}]}],` +
+				`"usage":{"input_tokens":2048,"input_tokens_details":{"cached_tokens":1536},` +
+				`"output_tokens":5,"output_tokens_details":{"reasoning_tokens":0},"total_tokens":2053}}`))
+		}))
+		t.Cleanup(srv.Close)
+
+		// Without transitions there are no tools, so the response is not streamed
+		itp := &fakeInterp{dm: newFakeDM(), snapshot: `<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:runtime="` + agentml.RuntimeNamespaceURI + `">
+  <runtime:configuration><runtime:state id="idle"/></runtime:configuration>
+  <state id="idle"/>
+</agentml>`}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out" usage-location="usage"/>`)
+		if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		if key, _ := body["prompt_cache_key"].(string); key == "" {
+			t.Errorf("expected prompt_cache_key in request, got %v", body["prompt_cache_key"])
+		}
+		usage, _ := itp.dm.store["usage"].(map[string]any)
+		if usage["cachedTokens"] != int64(1536) || usage["cacheHit"] != true || usage["inputTokens"] != int64(2048) {
+			t.Errorf("usage = %v, want 1536 cached of 2048 input tokens", usage)
+		}
+	})
+}
+
+func TestGenerateReasoningAndStop(t *testing.T) {
+	const reasoningItem = `{"type":"reasoning","id":"rs_1","summary":[` +
+		`{"type":"summary_text","text":"Compared the options."},` +
+		`{"type":"summary_text","text":"Picked the shorter one."}]}`
+	const wantReasoning = "Compared the options.\n\nPicked the shorter one."
+
+	// server answers both paths with a reasoning item, recording request bodies
+	server := func(t *testing.T) (*httptest.Server, *[]map[string]any) {
+		t.Helper()
+		var bodies []map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+			message := `{"type":"message","id":"msg_1","role":"assistant","status":"completed",` +
+				`"content":[{"type":"output_text","text":"done","annotations":[]}]}`
+			if body["stream"] != true {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","output":[` + reasoningItem + `,` + message + `]}`))
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			write := func(data string) {
+				_, _ = w.Write([]byte("data: " + data + "\n\n"))
+			}
+			write(`{"type":"response.output_text.delta","output_index":1,"content_index":0,"item_id":"msg_1","sequence_number":1,"delta":"done"}`)
+			write(`{"type":"response.completed","sequence_number":2,"response":{"id":"resp_1","object":"response","output":[` + reasoningItem + `]}}`)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &bodies
+	}
+
+	tests := []struct {
+		name     string
+		snapshot string
+		attrs    string
+	}{
+		{name: "non-streaming", attrs: ` location="out"`},
+		{name: "streaming", snapshot: toolSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bodies := server(t)
+			itp := &fakeInterp{dm: newFakeDM(), snapshot: tt.snapshot}
+			el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="o4-mini" prompt="choose"`+
+				` reasoning-location="why" stop="END, ###"`+tt.attrs+`/>`)
+			if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if got := itp.dm.store["why"]; got != wantReasoning {
+				t.Errorf("reasoning = %q, want %q", got, wantReasoning)
+			}
+			body := (*bodies)[0]
+			if stop, _ := body["stop"].([]any); !slices.Equal(stop, []any{"END", "###"}) {
+				t.Errorf("stop = %v, want [END ###]", body["stop"])
+			}
+			if reasoning, _ := body["reasoning"].(map[string]any); reasoning["summary"] != "auto" {
+				t.Errorf("reasoning = %v, want summary auto", body["reasoning"])
+			}
+		})
+	}
+
+	t.Run("omitted when unset", func(t *testing.T) {
+		srv, bodies := server(t)
+		itp := &fakeInterp{dm: newFakeDM()}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="choose" location="out"/>`)
+		if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		body := (*bodies)[0]
+		if _, ok := body["stop"]; ok {
+			t.Errorf("unexpected stop in request: %v", body["stop"])
+		}
+		if _, ok := body["reasoning"]; ok {
+			t.Errorf("unexpected reasoning in request: %v", body["reasoning"])
+		}
+	})
+}
+
+func TestGenerateParams(t *testing.T) {
+	// server records request bodies and answers with a plain message
+	server := func(t *testing.T) (*httptest.Server, *[]map[string]any) {
+		t.Helper()
+		var bodies []map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","output":[` +
+				`{"type":"message","id":"msg_1","role":"assistant","status":"completed",` +
+				`"content":[{"type":"output_text","text":"done","annotations":[]}]}]}`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &bodies
+	}
+
+	t.Run("merged into request", func(t *testing.T) {
+		srv, bodies := server(t)
+		dm := newFakeDM()
+		dm.store["sampling"] = map[string]any{"top_p": 0.9, "seed": 7}
+		itp := &fakeInterp{dm: dm}
+		el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out">`+
+			`<params>{"temperature": 0.2, "logit_bias": {"50256": -100}, "top_p": 0.5}</params>`+
+			`<params expr="sampling"/>`+
+			`</generate>`)
+
+		p := fakeProvider{respond: func(int) llm.Response { return llm.Response{Content: "done"} }}
+		if err := executeGenerate(context.Background(), itp, &p, nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		req := p.requests[0]
+		if req.Temperature == nil || *req.Temperature != 0.2 {
+			t.Errorf("temperature = %v, want 0.2", req.Temperature)
+		}
+		if req.Seed == nil || *req.Seed != 7 {
+			t.Errorf("seed = %v, want 7", req.Seed)
+		}
+		if req.Params["top_p"] != 0.9 {
+			t.Errorf("top_p = %v, want 0.9 from the later params", req.Params["top_p"])
+		}
+		if _, ok := req.Params["temperature"]; ok {
+			t.Errorf("temperature forwarded as an extra param: %v", req.Params)
+		}
+
+		if err := executeGenerate(context.Background(), itp, NewProvider(newTestClient(srv)), nil, nil, nil, nil, el); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		body := (*bodies)[0]
+		if body["temperature"] != 0.2 || body["top_p"] != 0.9 {
+			t.Errorf("body temperature = %v, top_p = %v, want 0.2, 0.9", body["temperature"], body["top_p"])
+		}
+		if bias, _ := body["logit_bias"].(map[string]any); bias["50256"] != float64(-100) {
+			t.Errorf("logit_bias = %v, want 50256: -100", body["logit_bias"])
+		}
+		if _, ok := body["seed"]; ok {
+			t.Errorf("seed sent to the Responses API: %v", body["seed"])
+		}
+	})
+
+	tests := []struct {
+		name      string
+		attrs     string
+		params    string
+		attribute string
+	}{
+		{name: "temperature conflict", attrs: ` temperature="0.7"`, params: `{"temperature": 0.2}`, attribute: "temperature"},
+		{name: "seed conflict", attrs: ` seed="1"`, params: `{"seed": 2}`, attribute: "seed"},
+		{name: "managed key", params: `{"stop": ["END"]}`},
+		{name: "not an object", params: `[1, 2]`},
+		{name: "fractional seed", params: `{"seed": 1.5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itp := &fakeInterp{dm: newFakeDM()}
+			el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`" model="gpt-test" prompt="hi" location="out"`+tt.attrs+`>`+
+				`<params>`+tt.params+`</params></generate>`)
+			var p fakeProvider
+			err := executeGenerate(context.Background(), itp, &p, nil, nil, nil, nil, el)
+			var perr *agentml.PlatformError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected PlatformError, got %T: %v", err, err)
+			}
+			if tt.attribute != "" && perr.Data["attribute"] != tt.attribute {
+				t.Errorf("attribute = %v, want %s", perr.Data["attribute"], tt.attribute)
+			}
+			if len(p.requests) != 0 {
+				t.Errorf("provider called %d times, want 0", len(p.requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// managedParams are request fields openai:generate builds itself, so
+// <openai:params> may not set them, mapped to the attribute that controls
+// each one, if any.
+var managedParams = map[string]string{
+	"model":             "model",
+	"input":             "prompt",
+	"tools":             "",
+	"tool_choice":       "",
+	"stream":            "stream",
+	"max_output_tokens": "max-output-tokens",
+	"reasoning":         "reasoning",
+	"stop":              "stop",
+	"prompt_cache_key":  "",
+}
+
+// generationParams holds the parameters of the <openai:params> children of
+// a generate element. temperature and seed map onto the request fields of
+// the same name; the remaining keys are sent with the request as written.
+type generationParams struct {
+	temperature *float64
+	seed        *int64
+	extra       map[string]any
+}
+
+// parseParams merges the <openai:params> children of el in document order.
+// A child's body is a JSON object, or its expr attribute is evaluated to one
+// against the data model.
+func parseParams(ctx context.Context, interpreter agentml.Interpreter, el xmldom.Element) (generationParams, error) {
+	var params generationParams
+	children := el.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		element, ok := children.Item(i).(xmldom.Element)
+		if !ok {
+			continue
+		}
+		if string(element.LocalName()) != "params" || (string(element.NamespaceURI()) != OpenAINamespaceURI && string(element.NamespaceURI()) != "") {
+			continue
+		}
+
+		values, err := paramsObject(ctx, interpreter, element)
+		if err != nil {
+			return params, err
+		}
+		for key, value := range values {
+			if attr, ok := managedParams[key]; ok {
+				if attr != "" {
+					return params, fmt.Errorf("params cannot set %q; use the %s attribute", key, attr)
+				}
+				return params, fmt.Errorf("params cannot set %q; it is set by openai:generate", key)
+			}
+			switch key {
+			case "temperature":
+				t, ok := value.(float64)
+				if !ok || t < 0 {
+					return params, fmt.Errorf("params temperature must be a non-negative number, got %v", value)
+				}
+				params.temperature = &t
+			case "seed":
+				n, ok := value.(float64)
+				if !ok || n != math.Trunc(n) {
+					return params, fmt.Errorf("params seed must be an integer, got %v", value)
+				}
+				seed := int64(n)
+				params.seed = &seed
+			default:
+				if params.extra == nil {
+					params.extra = map[string]any{}
+				}
+				params.extra[key] = value
+			}
+		}
+	}
+	return params, nil
+}
+
+// paramsObject returns the object an <openai:params> element carries. JSON
+// numbers are decoded as float64, and values from expr are normalized the
+// same way by a JSON round trip.
+func paramsObject(ctx context.Context, interpreter agentml.Interpreter, element xmldom.Element) (map[string]any, error) {
+	var data []byte
+	if expr := strings.TrimSpace(string(element.GetAttribute("expr"))); expr != "" {
+		dataModel := interpreter.DataModel()
+		if dataModel == nil {
+			return nil, fmt.Errorf("params expr requires a data model")
+		}
+		value, err := dataModel.EvaluateValue(ctx, expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate params expr %q: %w", expr, err)
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return nil, fmt.Errorf("params expr %q: %w", expr, err)
+		}
+	} else {
+		text := strings.TrimSpace(string(element.TextContent()))
+		if text == "" {
+			return nil, nil
+		}
+		data = []byte(text)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil || values == nil {
+		return nil, fmt.Errorf("params must be a JSON object: %s", strings.TrimSpace(string(data)))
+	}
+	return values, nil
+}
@@ -0,0 +1,267 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go/llm"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/openai/openai-go/responses"
+	"github.com/openai/openai-go/shared"
+)
+
+// provider adapts an OpenAI client to llm.Provider using the Responses API.
+// Requests with tools or streaming callbacks are streamed unless they set
+// DisableStreaming; others are not.
+type provider struct {
+	client openai.Client
+}
+
+// errAPIKeyNotConfigured is returned by noKeyProvider.
+var errAPIKeyNotConfigured = errors.New("openai: API key not configured")
+
+// noKeyProvider stands in for the provider when the loader finds no API key,
+// so generations fail before any request instead of with a 401. Dry runs and
+// cache hits never reach it.
+type noKeyProvider struct{}
+
+func (noKeyProvider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	return llm.Response{}, errAPIKeyNotConfigured
+}
+
+func (noKeyProvider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	return nil, errAPIKeyNotConfigured
+}
+
+// NewProvider returns an llm.Provider backed by client.
+func NewProvider(client openai.Client) llm.Provider {
+	return &provider{client: client}
+}
+
+func (p *provider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	params := responses.ResponseNewParams{
+		Model: shared.ResponsesModel(req.Model),
+		Input: responses.ResponseNewParamsInputUnion{OfInputItemList: convertMessagesToInputItems(req.Messages)},
+	}
+	if req.Reasoning != "" {
+		params.Reasoning = shared.ReasoningParam{
+			Effort: shared.ReasoningEffort(req.Reasoning),
+		}
+	}
+	if req.MaxOutputTokens > 0 {
+		params.MaxOutputTokens = param.NewOpt(int64(req.MaxOutputTokens))
+	}
+	// The Responses API has no seed parameter, so req.Seed is ignored
+	if req.Temperature != nil {
+		params.Temperature = param.NewOpt(*req.Temperature)
+	}
+	if req.PromptCacheKey != "" {
+		params.PromptCacheKey = param.NewOpt(req.PromptCacheKey)
+	}
+	if req.ReasoningSummary {
+		params.Reasoning.Summary = shared.ReasoningSummaryAuto
+	}
+	// ResponseNewParams has no stop field, so it is set on the request body
+	var opts []option.RequestOption
+	if len(req.Stop) > 0 {
+		opts = append(opts, option.WithJSONSet("stop", req.Stop))
+	}
+	for key, value := range req.Params {
+		opts = append(opts, option.WithJSONSet(key, value))
+	}
+
+	if len(req.Tools) > 0 {
+		params.Tools = convertChatToolsToResponseTools(chatTools(req.Tools))
+		if req.ToolChoice != "" {
+			params.ToolChoice = responses.ResponseNewParamsToolChoiceUnion{
+				OfToolChoiceMode: param.NewOpt(responses.ToolChoiceOptions(req.ToolChoice)),
+			}
+		}
+	}
+
+	if req.DisableStreaming || (len(req.Tools) == 0 && req.OnToolCall == nil && req.OnChunk == nil) {
+		response, err := p.client.Responses.New(ctx, params, opts...)
+		if err != nil {
+			return llm.Response{}, err
+		}
+		logReasoning(ctx, response)
+		resp := llm.Response{
+			Content:    outputText(response),
+			ToolCalls:  functionCalls(response),
+			StopReason: string(response.Status),
+			Usage:      convertUsage(response.Usage),
+			Reasoning:  reasoningSummary(response),
+		}
+		return resp, replayResponse(req, resp)
+	}
+
+	var resp llm.Response
+	handler := func(tc openai.ChatCompletionMessageToolCall) error {
+		call := llm.ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments}
+		resp.ToolCalls = append(resp.ToolCalls, call)
+		if req.OnToolCall != nil {
+			return req.OnToolCall(call)
+		}
+		return nil
+	}
+	onText := func(text string) error {
+		resp.Content += text
+		if req.OnChunk != nil {
+			return req.OnChunk(text)
+		}
+		return nil
+	}
+
+	stream := p.client.Responses.NewStreaming(ctx, params, opts...)
+	onCompleted := func(response responses.Response) {
+		resp.Usage = convertUsage(response.Usage)
+		resp.Reasoning = reasoningSummary(&response)
+	}
+	var onStart func(openai.ChatCompletionMessageToolCall)
+	if req.OnToolCallStart != nil {
+		onStart = func(tc openai.ChatCompletionMessageToolCall) {
+			req.OnToolCallStart(llm.ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+		}
+	}
+	err := processStreamingResponse(ctx, stream, handler, onStart, onText, onCompleted)
+	if closeErr := stream.Close(); closeErr != nil {
+		slog.DebugContext(ctx, "openai: failed to close stream", "error", closeErr)
+	}
+	return resp, err
+}
+
+func (p *provider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	res, err := p.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Model: openai.EmbeddingModel(model),
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: input},
+	})
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(res.Data))
+	for i, d := range res.Data {
+		v := make([]float32, len(d.Embedding))
+		for j, f := range d.Embedding {
+			v[j] = float32(f)
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// convertUsage converts Responses API token usage, including the input
+// tokens served from the prompt cache.
+func convertUsage(usage responses.ResponseUsage) llm.Usage {
+	return llm.Usage{
+		InputTokens:       usage.InputTokens,
+		OutputTokens:      usage.OutputTokens,
+		CachedInputTokens: usage.InputTokensDetails.CachedTokens,
+	}
+}
+
+// functionCalls returns the function calls in response, in output order.
+func functionCalls(response *responses.Response) []llm.ToolCall {
+	var calls []llm.ToolCall
+	for _, output := range response.Output {
+		if output.Type != "function_call" {
+			continue
+		}
+		fc := output.AsFunctionCall()
+		calls = append(calls, llm.ToolCall{ID: fc.CallID, Name: fc.Name, Arguments: fc.Arguments})
+	}
+	return calls
+}
+
+// replayResponse passes a complete response through the callbacks a
+// streamed one would have reached, stopping at the first error.
+func replayResponse(req llm.Request, resp llm.Response) error {
+	if req.OnChunk != nil && resp.Content != "" {
+		if err := req.OnChunk(resp.Content); err != nil {
+			return err
+		}
+	}
+	for _, call := range resp.ToolCalls {
+		if req.OnToolCallStart != nil {
+			req.OnToolCallStart(llm.ToolCall{ID: call.ID, Name: call.Name})
+		}
+		if req.OnToolCall != nil {
+			if err := req.OnToolCall(call); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// outputText returns the text of the first assistant message in response.
+func outputText(response *responses.Response) string {
+	for _, output := range response.Output {
+		if output.Type != "message" {
+			continue
+		}
+		message := output.AsMessage()
+		if message.Role == "assistant" {
+			for _, contentItem := range message.Content {
+				if contentItem.Type == "output_text" {
+					return contentItem.Text
+				}
+			}
+		}
+		break
+	}
+	return ""
+}
+
+// reasoningSummary joins the reasoning summaries in response, separated by
+// blank lines.
+func reasoningSummary(response *responses.Response) string {
+	var parts []string
+	for _, output := range response.Output {
+		if output.Type != "reasoning" {
+			continue
+		}
+		for _, summary := range output.AsReasoning().Summary {
+			if summary.Text != "" {
+				parts = append(parts, summary.Text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// logReasoning logs reasoning summaries returned by reasoning models.
+func logReasoning(ctx context.Context, response *responses.Response) {
+	for _, output := range response.Output {
+		if output.Type != "reasoning" {
+			continue
+		}
+		for _, summary := range output.AsReasoning().Summary {
+			if summary.Text != "" {
+				slog.InfoContext(ctx, "openai: reasoning content received", "reasoning_length", len(summary.Text))
+				if slog.Default().Enabled(ctx, slog.LevelDebug) {
+					slog.DebugContext(ctx, "openai: reasoning content", "reasoning", summary.Text)
+				}
+			}
+		}
+	}
+}
+
+// chatTools converts shared tools to Chat Completions function tools.
+func chatTools(tools []llm.Tool) []openai.ChatCompletionToolParam {
+	params := make([]openai.ChatCompletionToolParam, 0, len(tools))
+	for _, t := range tools {
+		params = append(params, openai.ChatCompletionToolParam{
+			// Type field will default to "function" automatically
+			Function: shared.FunctionDefinitionParam{
+				Name:        t.Name,
+				Description: param.NewOpt(t.Description),
+				Parameters:  shared.FunctionParameters(t.Parameters),
+			},
+		})
+	}
+	return params
+}
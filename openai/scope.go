@@ -0,0 +1,236 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// errStateExited is the cancellation cause of a generation whose state was
+// exited while it was in flight.
+var errStateExited = errors.New("openai: state exited during generation")
+
+// stateExitTag is the element the loader adds to the <onexit> of every state
+// that generates on entry. The interpreter runs it when the state is exited,
+// which cancels the state's in-flight generations. prompt.PruneSnapshot and
+// prompt.SnapshotDiff strip it, so it never reaches a model.
+const stateExitTag = "state-exit"
+
+// enclosingState returns the key of the state whose <onentry> contains el, or
+// nil when el runs elsewhere, such as in a transition or <onexit>, where the
+// state is not active for the generation to be tied to.
+func enclosingState(el xmldom.Element) any {
+	if state := enclosingStateElement(el); state != nil {
+		return stateKey(state)
+	}
+	return nil
+}
+
+// stateKey identifies state in stateScopes: by its id, or by the element
+// itself for a state without one.
+func stateKey(state xmldom.Element) any {
+	if id := strings.TrimSpace(string(state.GetAttribute("id"))); id != "" {
+		return id
+	}
+	return state
+}
+
+// enclosingStateElement returns the state or parallel whose <onentry>
+// contains el, or nil.
+func enclosingStateElement(el xmldom.Element) xmldom.Element {
+	for node := el.ParentNode(); node != nil; node = node.ParentNode() {
+		switch string(node.LocalName()) {
+		case "onentry":
+			parent, ok := node.ParentNode().(xmldom.Element)
+			if !ok {
+				return nil
+			}
+			if tag := string(parent.LocalName()); tag != "state" && tag != "parallel" {
+				return nil
+			}
+			return parent
+		case "onexit", "transition", "state", "parallel", "final", "scxml", "agentml":
+			return nil
+		}
+	}
+	return nil
+}
+
+// hookStateExits puts an <openai:state-exit> first in the <onexit> of each
+// state whose <onentry> holds an <openai:generate>, adding the <onexit> when
+// the state has none. States already hooked, as in a reloaded snapshot, are
+// left alone.
+func hookStateExits(doc xmldom.Document) error {
+	hooked := map[xmldom.Element]bool{}
+	generates := doc.GetElementsByTagNameNS(OpenAINamespaceURI, "generate")
+	for i := uint(0); i < generates.Length(); i++ {
+		el, ok := generates.Item(i).(xmldom.Element)
+		if !ok {
+			continue
+		}
+		state := enclosingStateElement(el)
+		if state == nil || hooked[state] {
+			continue
+		}
+		hooked[state] = true
+		id := strings.TrimSpace(string(state.GetAttribute("id")))
+
+		var onexit xmldom.Element
+		for child := state.FirstElementChild(); child != nil; child = child.NextElementSibling() {
+			if child.LocalName() == "onexit" && child.NamespaceURI() == state.NamespaceURI() {
+				onexit = child
+				break
+			}
+		}
+		if onexit == nil {
+			created, err := doc.CreateElementNS(state.NamespaceURI(), qualifiedName(state.Prefix(), "onexit"))
+			if err != nil {
+				return fmt.Errorf("openai: failed to add onexit to state %q: %w", id, err)
+			}
+			if _, err := state.AppendChild(created); err != nil {
+				return fmt.Errorf("openai: failed to add onexit to state %q: %w", id, err)
+			}
+			onexit = created
+		}
+		if first := onexit.FirstElementChild(); first != nil && first.NamespaceURI() == OpenAINamespaceURI && first.LocalName() == stateExitTag {
+			continue
+		}
+		hook, err := doc.CreateElementNS(OpenAINamespaceURI, qualifiedName(el.Prefix(), stateExitTag))
+		if err != nil {
+			return fmt.Errorf("openai: failed to hook exit of state %q: %w", id, err)
+		}
+		if _, err := onexit.InsertBefore(hook, onexit.FirstChild()); err != nil {
+			return fmt.Errorf("openai: failed to hook exit of state %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func qualifiedName(prefix xmldom.DOMString, local string) xmldom.DOMString {
+	if prefix == "" {
+		return xmldom.DOMString(local)
+	}
+	return prefix + ":" + xmldom.DOMString(local)
+}
+
+// stateScopes tracks the in-flight generations of each state, keyed by
+// stateKey, so the state's <openai:state-exit> can cancel them.
+type stateScopes struct {
+	mu      sync.Mutex
+	running map[any]map[*stateScope]struct{}
+}
+
+type stateScope struct {
+	cancel context.CancelCauseFunc
+}
+
+// watch returns a context that is cancelled with errStateExited once the
+// state keyed by stateID is exited, or when ctx is, and a function that stops
+// watching. When stateID is nil, ctx is returned unwatched.
+func (s *stateScopes) watch(ctx context.Context, stateID any) (context.Context, func()) {
+	if stateID == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	scope := &stateScope{cancel: cancel}
+	s.mu.Lock()
+	if s.running == nil {
+		s.running = map[any]map[*stateScope]struct{}{}
+	}
+	if s.running[stateID] == nil {
+		s.running[stateID] = map[*stateScope]struct{}{}
+	}
+	s.running[stateID][scope] = struct{}{}
+	s.mu.Unlock()
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.running[stateID], scope)
+		if len(s.running[stateID]) == 0 {
+			delete(s.running, stateID)
+		}
+		s.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// exit cancels the generations running in the state keyed by stateID.
+func (s *stateScopes) exit(stateID any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for scope := range s.running[stateID] {
+		scope.cancel(errStateExited)
+	}
+}
+
+// exitedState returns the key of the state whose <onexit> holds el, or nil.
+func exitedState(el xmldom.Element) any {
+	onexit, ok := el.ParentNode().(xmldom.Element)
+	if !ok || onexit.LocalName() != "onexit" {
+		return nil
+	}
+	state, ok := onexit.ParentNode().(xmldom.Element)
+	if !ok {
+		return nil
+	}
+	return stateKey(state)
+}
+
+// stateExited reports whether ctx was cancelled because its state exited.
+func stateExited(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errStateExited)
+}
+
+// scopedInterpreter drops the assignments and events of a generation whose
+// state has exited, so a response that arrives late cannot write into the
+// state that replaced it.
+type scopedInterpreter struct {
+	agentml.Interpreter
+	ctx context.Context
+}
+
+func (s *scopedInterpreter) Raise(ctx context.Context, event *agentml.Event) {
+	if stateExited(s.ctx) {
+		return
+	}
+	s.Interpreter.Raise(ctx, event)
+}
+
+func (s *scopedInterpreter) Send(ctx context.Context, event *agentml.Event) error {
+	if stateExited(s.ctx) {
+		return nil
+	}
+	return s.Interpreter.Send(ctx, event)
+}
+
+func (s *scopedInterpreter) DataModel() agentml.DataModel {
+	dm := s.Interpreter.DataModel()
+	if dm == nil {
+		return nil
+	}
+	return &scopedDataModel{DataModel: dm, ctx: s.ctx}
+}
+
+// scopedDataModel is the data model of a scopedInterpreter.
+type scopedDataModel struct {
+	agentml.DataModel
+	ctx context.Context
+}
+
+func (s *scopedDataModel) Assign(ctx context.Context, location string, value any) error {
+	if stateExited(s.ctx) {
+		return nil
+	}
+	return s.DataModel.Assign(ctx, location, value)
+}
+
+func (s *scopedDataModel) SetVariable(ctx context.Context, id string, value any) error {
+	if stateExited(s.ctx) {
+		return nil
+	}
+	return s.DataModel.SetVariable(ctx, id, value)
+}
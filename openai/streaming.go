@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/agentml-go/llm"
 	"github.com/agentflare-ai/go-jsonschema"
 	"github.com/agentflare-ai/go-pipeline"
 	"go.opentelemetry.io/otel"
@@ -36,6 +37,33 @@ type StreamingPipelineContext struct {
 	NameMapping map[string]string // Maps sanitized names to original event names
 	MaxRetries  int
 	RetryCount  int
+	// JSONRepair lets near-valid arguments be fixed up before decoding
+	JSONRepair bool
+}
+
+// Internal events raised for tool-call progress when openai:generate sets
+// emit-progress="true". Their data holds the call id, the function name and
+// the event the call maps to.
+const (
+	// EventToolCallStarted is raised when the model starts emitting a tool
+	// call, before its arguments arrive.
+	EventToolCallStarted = "openai.toolcall.started"
+	// EventToolCallCompleted is raised when a tool call's arguments are
+	// complete, before they are validated and the event is sent.
+	EventToolCallCompleted = "openai.toolcall.completed"
+)
+
+// raiseToolCallProgress raises the progress event name for tc.
+func raiseToolCallProgress(ctx context.Context, it agentml.Interpreter, name string, tc llm.ToolCall, nameMapping map[string]string) {
+	event := nameMapping[tc.Name]
+	if event == "" {
+		event = tc.Name
+	}
+	it.Raise(ctx, &agentml.Event{
+		Name: name,
+		Type: agentml.EventTypeInternal,
+		Data: map[string]any{"id": tc.ID, "name": tc.Name, "event": event},
+	})
 }
 
 // ToolCallWriter accumulates validation results
@@ -43,6 +71,105 @@ type ToolCallWriter struct {
 	Errors []ValidationError
 }
 
+// createJSONRepairStage creates a pipeline stage that applies light-touch
+// fixes to arguments that fail to decode, so trivial mistakes don't cost a
+// correction round trip. Valid arguments, and repairs that still don't
+// decode, are passed on unchanged.
+func createJSONRepairStage(pctx *StreamingPipelineContext) pipeline.Pipe[context.Context, *ToolCallWriter, *StreamingToolCall] {
+	return func(ctx context.Context, w *ToolCallWriter, input *StreamingToolCall, next pipeline.NextPipe[context.Context, *ToolCallWriter, *StreamingToolCall]) error {
+		if !pctx.JSONRepair || json.Valid([]byte(input.Arguments)) {
+			return next(ctx, w, input)
+		}
+
+		repaired := repairJSON(input.Arguments)
+		if json.Valid([]byte(repaired)) {
+			slog.InfoContext(ctx, "Repaired tool call JSON",
+				"function", input.FunctionName,
+				"original_length", len(input.Arguments),
+				"repaired_length", len(repaired))
+			input.Arguments = repaired
+		} else {
+			slog.DebugContext(ctx, "Tool call JSON could not be repaired",
+				"function", input.FunctionName)
+		}
+		return next(ctx, w, input)
+	}
+}
+
+// smartQuotes maps typographic double quotes to ASCII ones
+var smartQuotes = strings.NewReplacer("\u201c", `"`, "\u201d", `"`, "\u201e", `"`)
+
+// repairJSON fixes common model mistakes in s: smart quotes, raw newlines and
+// tabs inside strings, trailing commas, and output truncated before its
+// strings, arrays and objects were closed. The result may still be invalid.
+func repairJSON(s string) string {
+	s = smartQuotes.Replace(s)
+
+	out := make([]byte, 0, len(s)+8)
+	var closers []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			case c == '\n':
+				out = append(out, `\n`...)
+				continue
+			case c == '\r':
+				out = append(out, `\r`...)
+				continue
+			case c == '\t':
+				out = append(out, `\t`...)
+				continue
+			}
+			out = append(out, c)
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			closers = append(closers, '}')
+		case '[':
+			closers = append(closers, ']')
+		case '}', ']':
+			out = trimTrailingComma(out)
+			if len(closers) > 0 {
+				closers = closers[:len(closers)-1]
+			}
+		}
+		out = append(out, c)
+	}
+
+	// Close whatever the truncation left open
+	if inString {
+		if escaped {
+			out = out[:len(out)-1]
+		}
+		out = append(out, '"')
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		out = append(trimTrailingComma(out), closers[i])
+	}
+	return string(out)
+}
+
+// trimTrailingComma drops trailing whitespace and a single trailing comma
+func trimTrailingComma(b []byte) []byte {
+	trimmed := bytes.TrimRight(b, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+		return trimmed[:len(trimmed)-1]
+	}
+	return b
+}
+
 // jsonDecoderStage is a pipeline stage that decodes and validates JSON arguments
 func jsonDecoderStage(ctx context.Context, w *ToolCallWriter, input *StreamingToolCall, next pipeline.NextPipe[context.Context, *ToolCallWriter, *StreamingToolCall]) error {
 	ctx, span := otel.Tracer("openai.streaming").Start(ctx, "JSONDecoder")
@@ -275,8 +402,9 @@ func ProcessStreamingToolCalls(ctx context.Context, pctx *StreamingPipelineConte
 
 	slog.InfoContext(ctx, "Processing streaming tool calls", "count", len(toolCalls))
 
-	// Build the pipeline: Decoder → ParallelValidator → Execution
+	// Build the pipeline: Repair → Decoder → ParallelValidator → Execution
 	p := pipeline.New(ctx,
+		createJSONRepairStage(pctx),
 		jsonDecoderStage,
 		createParallelValidatorStage(pctx),
 		createToolExecutionStage(pctx),
@@ -0,0 +1,79 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonschema"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"trailing commas", `{"a":[1,2,],"b":{"c":true,},}`, `{"a":[1,2],"b":{"c":true}}`},
+		{"smart quotes", "{\u201cname\u201d:\u201cAda\u201d}", `{"name":"Ada"}`},
+		{"raw newline in string", "{\"text\":\"line one\nline two\"}", `{"text":"line one\nline two"}`},
+		{"truncated", `{"data":{"items":["a","b`, `{"data":{"items":["a","b"]}}`},
+		{"truncated after comma", `{"a":1,`, `{"a":1}`},
+		{"commas inside strings", `{"a":"x,]"}`, `{"a":"x,]"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := repairJSON(tt.in)
+			if got != tt.want {
+				t.Errorf("repairJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("repaired JSON is invalid: %q", got)
+			}
+		})
+	}
+}
+
+func TestProcessStreamingToolCalls_JSONRepair(t *testing.T) {
+	pctx := func(itp *fakeInterp, repair bool) *StreamingPipelineContext {
+		return &StreamingPipelineContext{
+			Interpreter: itp,
+			ToolSchemas: map[string]*jsonschema.Schema{"user.done": {}},
+			NameMapping: map[string]string{"send_user_done": "user.done"},
+			JSONRepair:  repair,
+		}
+	}
+	malformed := func() []*StreamingToolCall {
+		return []*StreamingToolCall{{FunctionName: "send_user_done", Arguments: `{"data":{"ok":true,},`}}
+	}
+
+	// Without repair the malformed arguments need a correction round trip
+	itp := &fakeInterp{dm: newFakeDM()}
+	err := ProcessStreamingToolCalls(context.Background(), pctx(itp, false), malformed())
+	var correction *CorrectionNeededError
+	if !errors.As(err, &correction) {
+		t.Fatalf("expected CorrectionNeededError without repair, got %v", err)
+	}
+
+	itp = &fakeInterp{dm: newFakeDM()}
+	calls := malformed()
+	err = ProcessStreamingToolCalls(context.Background(), pctx(itp, true), calls)
+	if err != nil {
+		t.Fatalf("expected repaired call to succeed, got %v", err)
+	}
+	if len(itp.sent) != 1 || itp.sent[0].Name != "user.done" {
+		t.Fatalf("expected one user.done event, got %+v", itp.sent)
+	}
+	if calls[0].Arguments != `{"data":{"ok":true}}` {
+		t.Errorf("arguments = %q, want repaired JSON", calls[0].Arguments)
+	}
+
+	// Repairs that still don't decode fall through to correction
+	itp = &fakeInterp{dm: newFakeDM()}
+	broken := []*StreamingToolCall{{FunctionName: "send_user_done", Arguments: `{"data": nope}`}}
+	err = ProcessStreamingToolCalls(context.Background(), pctx(itp, true), broken)
+	if !errors.As(err, &correction) {
+		t.Fatalf("expected CorrectionNeededError for unrepairable JSON, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// builtinTemplateFuncs are available to every child <openai:prompt> template.
+// They are pure, so they are safe however a document uses them.
+var builtinTemplateFuncs = template.FuncMap{
+	"jsonquote": jsonQuote,
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"default":   defaultValue,
+}
+
+// templateFuncs returns the functions for one template: the built-ins, then
+// extra, then fetch bound to fetch and ctx. extra may replace a built-in but
+// never fetch, so the fetcher's size and time limits always apply.
+func templateFuncs(ctx context.Context, fetch *fetcher, extra template.FuncMap) template.FuncMap {
+	funcs := make(template.FuncMap, len(builtinTemplateFuncs)+len(extra)+1)
+	for name, fn := range builtinTemplateFuncs {
+		funcs[name] = fn
+	}
+	for name, fn := range extra {
+		funcs[name] = fn
+	}
+	funcs["fetch"] = func(url string) string {
+		body, err := fetch.fetchURL(ctx, url)
+		if err != nil {
+			slog.WarnContext(ctx, "fetch function failed", "url", url, "error", err)
+			return ""
+		}
+		return body
+	}
+	return funcs
+}
+
+// checkTemplateFuncs reports the error text/template would panic with when
+// funcs holds a value that is not a usable template function.
+func checkTemplateFuncs(funcs template.FuncMap) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("openai: invalid template function: %v", r)
+		}
+	}()
+	template.New("").Funcs(funcs)
+	return nil
+}
+
+// jsonQuote encodes v as JSON, so a string becomes a quoted, escaped literal
+// that can be embedded in a JSON prompt.
+func jsonQuote(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// defaultValue returns value unless it is empty (nil, a zero value, or an
+// empty string, slice or map), in which case it returns def. The argument
+// order matches pipelines such as {{.name | default "friend"}}.
+func defaultValue(def, value any) any {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value
+}
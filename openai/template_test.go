@@ -0,0 +1,72 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestProcessChildPrompts_TemplateFuncs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fetched"))
+	}))
+	t.Cleanup(srv.Close)
+
+	funcs := template.FuncMap{
+		"shout": func(s string) string { return strings.ToUpper(s) + "!" },
+		"fetch": func(string) string { return "replaced" },
+	}
+	el := parseElement(t, `<generate xmlns="`+OpenAINamespaceURI+`">`+
+		`<prompt>{{shout "hello"}} {{lower "MiXeD"}} {{"" | default "friend"}} {{"set" | default "friend"}}</prompt>`+
+		`<prompt>{"q": {{jsonquote "say \"hi\""}}}</prompt>`+
+		`<prompt>{{fetch "`+srv.URL+`"}}</prompt>`+
+		`</generate>`)
+
+	prompts, err := processChildPrompts(context.Background(), &fakeInterp{dm: newFakeDM()}, newFetcher(srv.Client(), nil), funcs, el)
+	if err != nil {
+		t.Fatalf("processChildPrompts: %v", err)
+	}
+	want := []string{`HELLO! mixed friend set`, `{"q": "say \"hi\""}`, "fetched"}
+	if len(prompts) != len(want) {
+		t.Fatalf("prompts = %q, want %q", prompts, want)
+	}
+	for i := range want {
+		if prompts[i] != want[i] {
+			t.Errorf("prompt[%d] = %q, want %q", i, prompts[i], want[i])
+		}
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "nil", value: nil, want: "def"},
+		{name: "empty string", value: "", want: "def"},
+		{name: "zero", value: 0, want: "def"},
+		{name: "empty slice", value: []any{}, want: "def"},
+		{name: "empty map", value: map[string]any{}, want: "def"},
+		{name: "false", value: false, want: "def"},
+		{name: "string", value: "x", want: "x"},
+		{name: "number", value: 3, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultValue("def", tt.value); got != tt.want {
+				t.Errorf("defaultValue(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoaderRejectsInvalidTemplateFuncs(t *testing.T) {
+	loader := LoaderWithOptions(Options{TemplateFuncs: template.FuncMap{"bad": 42}})
+	if _, err := loader(context.Background(), &fakeInterp{dm: newFakeDM()}, nil); err == nil {
+		t.Fatal("expected an error for a non-function template func")
+	}
+}
@@ -0,0 +1,62 @@
+package openai
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/agentflare-ai/agentml-go/llm"
+	"github.com/openai/openai-go"
+)
+
+// charsPerToken is the rough average used by estimateTokens. It matches the
+// commonly cited ratio for English text with OpenAI tokenizers.
+const charsPerToken = 4
+
+// estimateTokens returns an approximate token count for text. It is meant
+// for cost estimates and guards, not for exact accounting.
+func estimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + charsPerToken - 1) / charsPerToken
+}
+
+// buildDryRunPlan describes the request executeGenerate would send, in a
+// shape that can be stored in the data model. examples are the
+// <openai:message> turns placed between the system and user messages; the
+// user message is left out when it is empty and examples carry the turns.
+func buildDryRunPlan(model, system string, examples []llm.Message, user string, tools []openai.ChatCompletionToolParam, toolChoice llm.ToolChoice) map[string]any {
+	toolDefs := make([]any, 0, len(tools))
+	toolTokens := 0
+	for _, tool := range tools {
+		b, err := json.Marshal(tool)
+		if err != nil {
+			continue
+		}
+		toolTokens += estimateTokens(string(b))
+		var def map[string]any
+		if err := json.Unmarshal(b, &def); err == nil {
+			toolDefs = append(toolDefs, def)
+		}
+	}
+
+	messages := []any{map[string]any{"role": "system", "content": system}}
+	messageTokens := estimateTokens(system)
+	for _, m := range examples {
+		messages = append(messages, map[string]any{"role": string(m.Role), "content": m.Content})
+		messageTokens += estimateTokens(m.Content)
+	}
+	if user != "" || len(examples) == 0 {
+		messages = append(messages, map[string]any{"role": "user", "content": user})
+		messageTokens += estimateTokens(user)
+	}
+
+	return map[string]any{
+		"model":           model,
+		"messages":        messages,
+		"tools":           toolDefs,
+		"toolChoice":      string(toolChoice),
+		"estimatedTokens": messageTokens + toolTokens,
+	}
+}
@@ -0,0 +1,64 @@
+// Command eventschema prints the events an SCXML document accepts as a JSON
+// object mapping each event name to the schema of its parameters.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/agentflare-ai/agentml-go/prompt"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run prints the event schemas of the file named in args and returns the
+// process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("eventschema", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: eventschema <scxml-file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+
+	xmlFile := fs.Arg(0)
+	xmlData, err := os.ReadFile(xmlFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to read XML file: %v\n", err)
+		return 1
+	}
+	doc, err := xmldom.NewDecoderFromBytes(xmlData).Decode()
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to parse XML: %v\n", err)
+		return 1
+	}
+
+	var transitions []xmldom.Element
+	nodes := doc.DocumentElement().GetElementsByTagName("transition")
+	for i := uint(0); i < nodes.Length(); i++ {
+		if elem, ok := nodes.Item(i).(xmldom.Element); ok {
+			transitions = append(transitions, elem)
+		}
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(prompt.ExportEventSchemas(transitions)); err != nil {
+		fmt.Fprintf(stderr, "Failed to encode schemas: %v\n", err)
+		return 1
+	}
+	return 0
+}
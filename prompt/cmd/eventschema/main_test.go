@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_PrintsEventSchemas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.scxml")
+	xml := `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="s">` +
+		`<transition event="user.message" target="s" schema='{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}'/>` +
+		`</state></scxml>`
+	if err := os.WriteFile(path, []byte(xml), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d, stderr:\n%s", code, stderr.String())
+	}
+	var schemas map[string]struct {
+		Type       string `json:"type"`
+		Properties map[string]struct {
+			Required []string `json:"required"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(stdout.String()), &schemas); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout.String())
+	}
+	got, ok := schemas["user.message"]
+	if !ok || got.Type != "object" {
+		t.Fatalf("expected an object schema for user.message, got:\n%s", stdout.String())
+	}
+	if req := got.Properties["data"].Required; len(req) != 1 || req[0] != "text" {
+		t.Errorf("data required = %v, want [text]", req)
+	}
+}
+
+func TestRun_MissingFile(t *testing.T) {
+	var stdout, stderr strings.Builder
+	if code := run([]string{filepath.Join(t.TempDir(), "missing.scxml")}, &stdout, &stderr); code == 0 {
+		t.Fatal("exit code = 0 for a missing file, want non-zero")
+	}
+}
@@ -0,0 +1,166 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/agentflare-ai/agentml-go"
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// SnapshotDiff returns a compact document describing how the runtime
+// snapshot curr differs from prev, so a model that has already seen prev
+// only needs the changes:
+//
+//	<runtime:diff xmlns:runtime="...">
+//	  <runtime:entered id="b"/>
+//	  <runtime:exited id="a"/>
+//	  <runtime:send>
+//	    <runtime:transition event="next" target="c"/>
+//	  </runtime:send>
+//	</runtime:diff>
+//
+// Active states are the ids listed under runtime:configuration. Entered and
+// exited states are in document order. Newly available transitions are the
+// runtime:transition elements of curr that prev did not offer, grouped under
+// a copy of their parent (runtime:send or runtime:raise) so the diff can be
+// read like a snapshot, without the <openai:state-exit> hooks PruneSnapshot
+// also strips. A nil prev diffs against an empty snapshot.
+func SnapshotDiff(prev, curr xmldom.Document) (xmldom.Document, error) {
+	if curr == nil || curr.DocumentElement() == nil {
+		return nil, errors.New("prompt: current snapshot is empty")
+	}
+
+	diff, err := xmldom.NewDOMImplementation().CreateDocument(xmldom.DOMString(agentml.RuntimeNamespaceURI), "runtime:diff", nil)
+	if err != nil {
+		return nil, fmt.Errorf("prompt: failed to create diff document: %w", err)
+	}
+	root := diff.DocumentElement()
+	if err := root.SetAttribute("xmlns:runtime", xmldom.DOMString(agentml.RuntimeNamespaceURI)); err != nil {
+		return nil, fmt.Errorf("prompt: failed to declare runtime namespace: %w", err)
+	}
+
+	prevStates, currStates := activeStates(prev), activeStates(curr)
+	for _, id := range currStates {
+		if !slices.Contains(prevStates, id) {
+			if err := appendRuntimeElement(diff, root, "entered", id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, id := range prevStates {
+		if !slices.Contains(currStates, id) {
+			if err := appendRuntimeElement(diff, root, "exited", id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range runtimeTransitions(prev) {
+		seen[transitionKey(t)] = true
+	}
+	groups := make(map[string]xmldom.Element)
+	for _, t := range runtimeTransitions(curr) {
+		if seen[transitionKey(t)] {
+			continue
+		}
+		parentName := "send"
+		if parent, ok := t.ParentNode().(xmldom.Element); ok {
+			parentName = string(parent.LocalName())
+		}
+		group, ok := groups[parentName]
+		if !ok {
+			group, err = diff.CreateElementNS(xmldom.DOMString(agentml.RuntimeNamespaceURI), xmldom.DOMString("runtime:"+parentName))
+			if err != nil {
+				return nil, fmt.Errorf("prompt: failed to create %s group: %w", parentName, err)
+			}
+			if _, err := root.AppendChild(group); err != nil {
+				return nil, fmt.Errorf("prompt: failed to append %s group: %w", parentName, err)
+			}
+			groups[parentName] = group
+		}
+		imported, err := diff.ImportNode(t, true)
+		if err != nil {
+			return nil, fmt.Errorf("prompt: failed to copy transition: %w", err)
+		}
+		if _, err := group.AppendChild(imported); err != nil {
+			return nil, fmt.Errorf("prompt: failed to append transition: %w", err)
+		}
+	}
+	removeStateExitHooks(root)
+
+	return diff, nil
+}
+
+// activeStates returns the state ids listed under runtime:configuration
+func activeStates(doc xmldom.Document) []string {
+	if doc == nil || doc.DocumentElement() == nil {
+		return nil
+	}
+	var ids []string
+	configs := doc.DocumentElement().GetElementsByTagNameNS(agentml.RuntimeNamespaceURI, "configuration")
+	for i := uint(0); i < configs.Length(); i++ {
+		config, ok := configs.Item(i).(xmldom.Element)
+		if !ok {
+			continue
+		}
+		children := config.Children()
+		for j := uint(0); j < children.Length(); j++ {
+			if id := string(children.Item(j).GetAttribute("id")); id != "" && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// runtimeTransitions returns the runtime:transition elements of doc
+func runtimeTransitions(doc xmldom.Document) []xmldom.Element {
+	if doc == nil || doc.DocumentElement() == nil {
+		return nil
+	}
+	var out []xmldom.Element
+	list := doc.DocumentElement().GetElementsByTagNameNS(agentml.RuntimeNamespaceURI, "transition")
+	for i := uint(0); i < list.Length(); i++ {
+		if elem, ok := list.Item(i).(xmldom.Element); ok {
+			out = append(out, elem)
+		}
+	}
+	return out
+}
+
+// transitionKey identifies a transition by its parent and attributes
+func transitionKey(t xmldom.Element) string {
+	var attrs []string
+	nodes := t.Attributes()
+	for i := uint(0); i < nodes.Length(); i++ {
+		if attr := nodes.Item(i); attr != nil {
+			attrs = append(attrs, string(attr.NodeName())+"="+string(attr.NodeValue()))
+		}
+	}
+	sort.Strings(attrs)
+	parent := ""
+	if p, ok := t.ParentNode().(xmldom.Element); ok {
+		parent = string(p.LocalName())
+	}
+	return parent + "|" + strings.Join(attrs, "|")
+}
+
+// appendRuntimeElement appends <runtime:name id="id"/> to parent
+func appendRuntimeElement(doc xmldom.Document, parent xmldom.Element, name, id string) error {
+	elem, err := doc.CreateElementNS(xmldom.DOMString(agentml.RuntimeNamespaceURI), xmldom.DOMString("runtime:"+name))
+	if err != nil {
+		return fmt.Errorf("prompt: failed to create %s element: %w", name, err)
+	}
+	if err := elem.SetAttribute("id", xmldom.DOMString(id)); err != nil {
+		return fmt.Errorf("prompt: failed to set %s id: %w", name, err)
+	}
+	if _, err := parent.AppendChild(elem); err != nil {
+		return fmt.Errorf("prompt: failed to append %s element: %w", name, err)
+	}
+	return nil
+}
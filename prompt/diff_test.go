@@ -0,0 +1,102 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func snapshotWith(t *testing.T, active, transitions string) xmldom.Document {
+	t.Helper()
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:runtime="github.com/agentflare-ai/agentmlx">
+  <state id="idle"/>
+  <state id="working"/>
+  <runtime:configuration>` + active + `</runtime:configuration>
+  <runtime:send>` + transitions + `</runtime:send>
+</agentml>`)).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return doc
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	prev := snapshotWith(t,
+		`<runtime:state id="main"/><runtime:state id="idle"/>`,
+		`<runtime:transition events="user.start" target="working"/>`)
+	curr := snapshotWith(t,
+		`<runtime:state id="main"/><runtime:state id="working"/>`,
+		`<runtime:transition events="user.start" target="working"/><runtime:transition events="user.stop" target="idle"/>`)
+
+	diff, err := SnapshotDiff(prev, curr)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	root := diff.DocumentElement()
+	if string(root.LocalName()) != "diff" {
+		t.Fatalf("root = %s, want diff", root.LocalName())
+	}
+
+	var got []string
+	children := root.Children()
+	for i := uint(0); i < children.Length(); i++ {
+		child := children.Item(i)
+		switch name := string(child.LocalName()); name {
+		case "entered", "exited":
+			got = append(got, name+":"+string(child.GetAttribute("id")))
+		case "send":
+			transitions := child.Children()
+			for j := uint(0); j < transitions.Length(); j++ {
+				got = append(got, "send:"+string(transitions.Item(j).GetAttribute("events")))
+			}
+		default:
+			t.Errorf("unexpected element %s", name)
+		}
+	}
+	want := []string{"entered:working", "exited:idle", "send:user.stop"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("diff = %v, want %v", got, want)
+	}
+
+	b, err := xmldom.Marshal(diff)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(b), `xmlns:runtime="github.com/agentflare-ai/agentmlx"`) {
+		t.Errorf("expected runtime namespace declaration, got %s", b)
+	}
+}
+
+func TestSnapshotDiff_Unchanged(t *testing.T) {
+	snap := func() xmldom.Document {
+		return snapshotWith(t, `<runtime:state id="idle"/>`, `<runtime:transition events="user.start" target="working"/>`)
+	}
+	diff, err := SnapshotDiff(snap(), snap())
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if n := diff.DocumentElement().Children().Length(); n != 0 {
+		t.Fatalf("expected an empty diff, got %d children", n)
+	}
+
+	if _, err := SnapshotDiff(snap(), nil); err == nil {
+		t.Error("expected an error for a nil current snapshot")
+	}
+}
+
+func TestSnapshotDiff_StripsStateExitHooks(t *testing.T) {
+	curr := snapshotWith(t, `<runtime:state id="idle"/>`,
+		`<runtime:transition events="user.start" target="working"><onexit><state-exit xmlns="github.com/agentflare-ai/agentml-go/openai"/></onexit></runtime:transition>`)
+	diff, err := SnapshotDiff(nil, curr)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	root := diff.DocumentElement()
+	if hooks := root.GetElementsByTagNameNS(openAINamespaceURI, stateExitHook); hooks.Length() != 0 {
+		t.Errorf("diff kept %d state-exit hooks", hooks.Length())
+	}
+	if root.GetElementsByTagName("onexit").Length() != 0 {
+		t.Errorf("diff kept the emptied onexit")
+	}
+}
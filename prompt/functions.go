@@ -2,6 +2,9 @@ package prompt
 
 import (
 	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
 	"strings"
 
 	"github.com/agentflare-ai/go-jsonschema"
@@ -14,6 +17,9 @@ type SendFunction struct {
 	EventName   string // Original event name before sanitization
 	Description string
 	Schema      *jsonschema.Schema
+	// Targets lists the distinct target state ids of the transitions that
+	// handle this event, in document order.
+	Targets []string
 }
 
 // BuildSendFunctions builds function declarations for send events from available transitions.
@@ -21,7 +27,7 @@ type SendFunction struct {
 // consistent function declarations for state machine event sending.
 func BuildSendFunctions(transitions []xmldom.Element) []SendFunction {
 	var functions []SendFunction
-	seen := map[string]struct{}{}
+	seen := map[string]int{}
 
 	for _, t := range transitions {
 		// Get the event attribute value as a string (not iterate over its characters)
@@ -37,44 +43,136 @@ func BuildSendFunctions(transitions []xmldom.Element) []SendFunction {
 		if strings.Contains(eventName, " ") {
 			eventName = strings.Split(eventName, " ")[0]
 		}
-		if _, ok := seen[eventName]; ok {
-			continue
-		}
-
-		// Create schema for this event
-		ps := &jsonschema.Schema{
-			Type:       jsonschema.TypeObject,
-			Properties: map[string]*jsonschema.Schema{},
-		}
-
-		// Attach event-specific data schema if present
-		if schemaAttr := string(t.GetAttribute("schema")); schemaAttr != "" {
-			// Parse the JSON schema from the attribute
-			var dataSchema jsonschema.Schema
-			if err := json.Unmarshal([]byte(schemaAttr), &dataSchema); err == nil {
-				// Use the parsed schema as the data property
-				ps.Properties["data"] = &dataSchema
-				// If the data schema has required fields, mark "data" as required at the top level
-				if len(dataSchema.Required) > 0 {
-					if ps.Required == nil {
-						ps.Required = []string{}
-					}
-					ps.Required = append(ps.Required, "data")
+		targets := transitionTargets(t)
+		if i, ok := seen[eventName]; ok {
+			for _, target := range targets {
+				if !slices.Contains(functions[i].Targets, target) {
+					functions[i].Targets = append(functions[i].Targets, target)
 				}
-			} else {
-				// If parsing fails, use a generic object schema as fallback
-				ps.Properties["data"] = &jsonschema.Schema{Type: jsonschema.TypeObject}
 			}
+			continue
 		}
 
 		functions = append(functions, SendFunction{
 			Name:        "send_" + strings.ReplaceAll(eventName, ".", "_"),
 			EventName:   eventName,
 			Description: "Send event '" + eventName + "' through the SCXML interpreter",
-			Schema:      ps,
+			Schema:      transitionSchema(t),
+			Targets:     targets,
 		})
-		seen[eventName] = struct{}{}
+		seen[eventName] = len(functions) - 1
 	}
 
 	return functions
 }
+
+// ExportEventSchemas maps each event handled by transitions to the schema of
+// its send function, documenting the events a document accepts. Every event
+// of a transition listing several is exported; events handled by several
+// transitions use the schema of the first.
+func ExportEventSchemas(transitions []xmldom.Element) map[string]*jsonschema.Schema {
+	schemas := map[string]*jsonschema.Schema{}
+	for _, t := range transitions {
+		events := string(t.GetAttribute("event"))
+		if events == "" {
+			events = string(t.GetAttribute("events"))
+		}
+		for _, event := range strings.Fields(events) {
+			if _, ok := schemas[event]; !ok {
+				schemas[event] = transitionSchema(t)
+			}
+		}
+	}
+	return schemas
+}
+
+// transitionSchema builds the send function schema for a transition, with
+// its schema attribute, if any, as the data property.
+func transitionSchema(t xmldom.Element) *jsonschema.Schema {
+	ps := &jsonschema.Schema{
+		Type:       jsonschema.TypeObject,
+		Properties: map[string]*jsonschema.Schema{},
+	}
+
+	// Attach event-specific data schema if present
+	if schemaAttr := string(t.GetAttribute("schema")); schemaAttr != "" {
+		// Parse the JSON schema from the attribute
+		var dataSchema jsonschema.Schema
+		if err := json.Unmarshal([]byte(schemaAttr), &dataSchema); err == nil {
+			// Use the parsed schema as the data property
+			ps.Properties["data"] = &dataSchema
+			// If the data schema has required fields, mark "data" as required at the top level
+			if len(dataSchema.Required) > 0 {
+				if ps.Required == nil {
+					ps.Required = []string{}
+				}
+				ps.Required = append(ps.Required, "data")
+			}
+		} else {
+			// If parsing fails, use a generic object schema as fallback
+			ps.Properties["data"] = &jsonschema.Schema{Type: jsonschema.TypeObject}
+		}
+	}
+	return ps
+}
+
+// transitionTargets returns the distinct ids in a transition's target (or
+// runtime "targets") attribute.
+func transitionTargets(t xmldom.Element) []string {
+	attr := string(t.GetAttribute("target"))
+	if attr == "" {
+		attr = string(t.GetAttribute("targets"))
+	}
+	var targets []string
+	for _, id := range strings.Fields(attr) {
+		if !slices.Contains(targets, id) {
+			targets = append(targets, id)
+		}
+	}
+	return targets
+}
+
+// FilterOptions scopes which send functions are offered to a model.
+type FilterOptions struct {
+	// Include keeps only functions whose event name matches one of these glob
+	// patterns (path.Match syntax, e.g. "user.*"). Empty keeps all.
+	Include []string
+	// Exclude drops functions whose event name matches one of these patterns.
+	// Exclusion wins over inclusion.
+	Exclude []string
+	// Max caps the number of functions returned; zero means no cap.
+	Max int
+}
+
+// FilterSendFunctions returns the functions in fns selected by opts, in their
+// original order. It fails if any pattern is malformed.
+func FilterSendFunctions(fns []SendFunction, opts FilterOptions) ([]SendFunction, error) {
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid event pattern %q: %w", p, err)
+		}
+	}
+	out := make([]SendFunction, 0, len(fns))
+	for _, fn := range fns {
+		if opts.Max > 0 && len(out) >= opts.Max {
+			break
+		}
+		if len(opts.Include) > 0 && !matchAny(opts.Include, fn.EventName) {
+			continue
+		}
+		if matchAny(opts.Exclude, fn.EventName) {
+			continue
+		}
+		out = append(out, fn)
+	}
+	return out, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
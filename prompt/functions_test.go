@@ -631,3 +631,138 @@ func TestBuildSendFunctions_SchemaPreservesAllJSONSchemaFeatures(t *testing.T) {
 		t.Fatalf("Expected 2 required fields, got %d", len(dataSchema.Required))
 	}
 }
+
+func TestFilterSendFunctions(t *testing.T) {
+	fns := []SendFunction{
+		{Name: "send_user_request", EventName: "user.request"},
+		{Name: "send_user_cancel", EventName: "user.cancel"},
+		{Name: "send_system_error", EventName: "system.error"},
+		{Name: "send_done", EventName: "done"},
+	}
+	names := func(fns []SendFunction) string {
+		var out []string
+		for _, fn := range fns {
+			out = append(out, fn.EventName)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name     string
+		opts     FilterOptions
+		expected string
+	}{
+		{"No options keeps all", FilterOptions{}, "user.request,user.cancel,system.error,done"},
+		{"Include glob", FilterOptions{Include: []string{"user.*"}}, "user.request,user.cancel"},
+		{"Include exact and glob", FilterOptions{Include: []string{"done", "system.*"}}, "system.error,done"},
+		{"Exclude glob", FilterOptions{Exclude: []string{"user.*"}}, "system.error,done"},
+		{"Exclude wins over include", FilterOptions{Include: []string{"user.*"}, Exclude: []string{"*.cancel"}}, "user.request"},
+		{"Single character wildcard", FilterOptions{Include: []string{"d?ne"}}, "done"},
+		{"Max caps count", FilterOptions{Max: 2}, "user.request,user.cancel"},
+		{"Max applies after filtering", FilterOptions{Exclude: []string{"user.request"}, Max: 2}, "user.cancel,system.error"},
+		{"No matches", FilterOptions{Include: []string{"admin.*"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterSendFunctions(fns, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if names(got) != tt.expected {
+				t.Errorf("Expected [%s], got [%s]", tt.expected, names(got))
+			}
+		})
+	}
+
+	t.Run("Invalid pattern", func(t *testing.T) {
+		if _, err := FilterSendFunctions(fns, FilterOptions{Include: []string{"user.["}}); err == nil {
+			t.Error("Expected error for malformed pattern")
+		}
+	})
+}
+
+func TestBuildSendFunctions_Targets(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0">
+	<state id="s1">
+		<transition event="user.route" target="billing"/>
+		<transition event="user.route" target="support billing"/>
+		<transition event="user.stay"/>
+	</state>
+</scxml>`
+
+	doc, err := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	transitions := doc.DocumentElement().GetElementsByTagName("transition")
+	var transitionElements []xmldom.Element
+	for i := uint(0); i < transitions.Length(); i++ {
+		if elem, ok := transitions.Item(i).(xmldom.Element); ok {
+			transitionElements = append(transitionElements, elem)
+		}
+	}
+
+	functions := BuildSendFunctions(transitionElements)
+	if len(functions) != 2 {
+		t.Fatalf("Expected 2 functions, got %d", len(functions))
+	}
+	if got := strings.Join(functions[0].Targets, ","); got != "billing,support" {
+		t.Errorf("Expected user.route targets [billing,support], got [%s]", got)
+	}
+	if len(functions[1].Targets) != 0 {
+		t.Errorf("Expected no targets for targetless transition, got %v", functions[1].Targets)
+	}
+}
+
+func TestExportEventSchemas(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0">
+	<state id="s1">
+		<transition event="order.place" target="s2" schema='{"type":"object","properties":{"sku":{"type":"string"},"quantity":{"type":"integer","minimum":1}},"required":["sku"]}'/>
+		<transition event="cancel" target="s1"/>
+	</state>
+	<state id="s2">
+		<transition event="order.place" target="s2"/>
+		<transition event="order.ship  order.refund" target="s1" schema='{"type":"object","required":["id"]}'/>
+	</state>
+</scxml>`
+	doc, err := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var transitions []xmldom.Element
+	nodes := doc.DocumentElement().GetElementsByTagName("transition")
+	for i := uint(0); i < nodes.Length(); i++ {
+		transitions = append(transitions, nodes.Item(i).(xmldom.Element))
+	}
+
+	schemas := ExportEventSchemas(transitions)
+	if len(schemas) != 4 {
+		t.Fatalf("expected schemas for order.place, cancel, order.ship and order.refund, got %v", schemas)
+	}
+	for _, event := range []string{"order.ship", "order.refund"} {
+		if s := schemas[event]; s == nil || len(s.Required) != 1 || s.Required[0] != "data" {
+			t.Errorf("%s schema = %+v, want the shared transition's schema requiring data", event, s)
+		}
+	}
+
+	order := schemas["order.place"]
+	if order == nil || order.Type != jsonschema.TypeObject || len(order.Required) != 1 || order.Required[0] != "data" {
+		t.Fatalf("order.place schema = %+v, want an object requiring data", order)
+	}
+	data := order.Properties["data"]
+	if data == nil || len(data.Required) != 1 || data.Required[0] != "sku" {
+		t.Fatalf("order.place data schema = %+v, want sku required", data)
+	}
+	if sku := data.Properties["sku"]; sku == nil || sku.Type != jsonschema.TypeString {
+		t.Errorf("sku schema = %+v, want a string", sku)
+	}
+	if qty := data.Properties["quantity"]; qty == nil || qty.Type != jsonschema.TypeInteger {
+		t.Errorf("quantity schema = %+v, want an integer", qty)
+	}
+
+	if cancel := schemas["cancel"]; cancel == nil || len(cancel.Properties) != 0 {
+		t.Errorf("cancel schema = %+v, want an object without data", cancel)
+	}
+}
@@ -1,6 +1,7 @@
 package prompt
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/agentflare-ai/agentml-go"
@@ -13,6 +14,7 @@ import (
 // - event:schema attributes (since they're in the function declarations)
 // - All action/executable content elements while preserving state structure
 // - runtime:actions section (since transitions are converted to LLM tools/functions)
+// - <openai:state-exit> hooks the openai loader adds, and the <onexit> left empty without them
 func PruneSnapshot(doc xmldom.Document) {
 	if doc == nil {
 		return
@@ -23,6 +25,10 @@ func PruneSnapshot(doc xmldom.Document) {
 		return
 	}
 
+	// Remove loader-added markup, including any under runtime:* elements,
+	// which are otherwise kept whole
+	removeStateExitHooks(root)
+
 	// Remove the static <datamodel> element since we have runtime:datamodel
 	datamodels := root.GetElementsByTagName("datamodel")
 	for i := uint(0); i < datamodels.Length(); i++ {
@@ -57,6 +63,54 @@ func PruneSnapshot(doc xmldom.Document) {
 	stripActionElements(root)
 }
 
+// The openai loader adds an <openai:state-exit> to the start of the <onexit>
+// of each state that generates on entry, creating the <onexit> when the
+// state has none. Neither is the author's markup.
+const (
+	openAINamespaceURI = "github.com/agentflare-ai/agentml-go/openai"
+	stateExitHook      = "state-exit"
+)
+
+// removeStateExitHooks removes the <openai:state-exit> hooks under root, and
+// the <onexit> elements that hold nothing else.
+func removeStateExitHooks(root xmldom.Element) {
+	hooks := root.GetElementsByTagNameNS(openAINamespaceURI, stateExitHook)
+	var found []xmldom.Element
+	for i := uint(0); i < hooks.Length(); i++ {
+		if hook, ok := hooks.Item(i).(xmldom.Element); ok {
+			found = append(found, hook)
+		}
+	}
+	for _, hook := range found {
+		parent, ok := hook.ParentNode().(xmldom.Element)
+		if !ok {
+			continue
+		}
+		parent.RemoveChild(hook)
+		if string(parent.LocalName()) == "onexit" && isEmpty(parent) {
+			if grandparent := parent.ParentNode(); grandparent != nil {
+				grandparent.RemoveChild(parent)
+			}
+		}
+	}
+}
+
+// isEmpty reports whether elem has no child elements or non-whitespace text.
+func isEmpty(elem xmldom.Element) bool {
+	children := elem.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		switch child := children.Item(i); child.NodeType() {
+		case xmldom.ELEMENT_NODE:
+			return false
+		case xmldom.TEXT_NODE, xmldom.CDATA_SECTION_NODE:
+			if strings.TrimSpace(string(child.NodeValue())) != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 var (
 	// Define elements that should be removed (executable content and action elements)
 	removeElements = map[string]bool{
@@ -179,3 +233,47 @@ func CompressXML(xml string) string {
 
 	return result
 }
+
+// SplitSnapshot moves the runtime:* children of the snapshot root (active
+// configuration, data model values, available transitions) out of doc and
+// into a new <runtime:snapshot> document, which it returns. What is left in doc
+// is the document structure, which only changes when the document does, so
+// it can be sent first as a stable, cacheable prompt prefix. The returned
+// document is nil when doc has no runtime children.
+func SplitSnapshot(doc xmldom.Document) (xmldom.Document, error) {
+	if doc == nil || doc.DocumentElement() == nil {
+		return nil, nil
+	}
+	root := doc.DocumentElement()
+
+	var runtimeChildren []xmldom.Element
+	children := root.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		if elem, ok := children.Item(i).(xmldom.Element); ok && elem.NamespaceURI() == xmldom.DOMString(agentml.RuntimeNamespaceURI) {
+			runtimeChildren = append(runtimeChildren, elem)
+		}
+	}
+	if len(runtimeChildren) == 0 {
+		return nil, nil
+	}
+
+	snapshot, err := xmldom.NewDOMImplementation().CreateDocument(xmldom.DOMString(agentml.RuntimeNamespaceURI), "runtime:snapshot", nil)
+	if err != nil {
+		return nil, fmt.Errorf("prompt: failed to create runtime snapshot document: %w", err)
+	}
+	snapshotRoot := snapshot.DocumentElement()
+	if err := snapshotRoot.SetAttribute("xmlns:runtime", xmldom.DOMString(agentml.RuntimeNamespaceURI)); err != nil {
+		return nil, fmt.Errorf("prompt: failed to declare runtime namespace: %w", err)
+	}
+	for _, elem := range runtimeChildren {
+		imported, err := snapshot.ImportNode(elem, true)
+		if err != nil {
+			return nil, fmt.Errorf("prompt: failed to copy %s: %w", elem.LocalName(), err)
+		}
+		if _, err := snapshotRoot.AppendChild(imported); err != nil {
+			return nil, fmt.Errorf("prompt: failed to append %s: %w", elem.LocalName(), err)
+		}
+		root.RemoveChild(elem)
+	}
+	return snapshot, nil
+}
@@ -261,3 +261,36 @@ func elementExistsRecursive(elem xmldom.Element, localName, namespace string) bo
 	}
 	return false
 }
+
+func TestRemoveStateExitHooks(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<agentml xmlns="github.com/agentflare-ai/agentml" xmlns:openai="github.com/agentflare-ai/agentml-go/openai">
+  <state id="added">
+    <onexit><openai:state-exit/></onexit>
+  </state>
+  <state id="authored">
+    <onexit>
+      <openai:state-exit/>
+      <log label="bye"/>
+    </onexit>
+  </state>
+</agentml>`)).Decode()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	root := doc.DocumentElement()
+	removeStateExitHooks(root)
+
+	if hooks := root.GetElementsByTagNameNS(openAINamespaceURI, stateExitHook); hooks.Length() != 0 {
+		t.Errorf("%d state-exit hooks left", hooks.Length())
+	}
+	onexits := root.GetElementsByTagName("onexit")
+	if onexits.Length() != 1 {
+		t.Fatalf("got %d onexit elements, want only the authored one", onexits.Length())
+	}
+	if parent := onexits.Item(0).ParentNode().(xmldom.Element); parent.GetAttribute("id") != "authored" {
+		t.Errorf("kept the onexit of %q, want authored", parent.GetAttribute("id"))
+	}
+	if root.GetElementsByTagName("log").Length() != 1 {
+		t.Errorf("authored onexit content was removed")
+	}
+}
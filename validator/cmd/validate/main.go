@@ -2,58 +2,93 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 
-	"github.com/agentflare-ai/agentmlx/validator"
+	"github.com/agentflare-ai/agentml-go/validator"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: validate <scxml-file>")
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run validates the file named in args and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	werror := fs.Bool("Werror", false, "treat warnings as errors")
+	stats := fs.Bool("stats", false, "print document statistics after validation")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: validate [-Werror] [-stats] <scxml-file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
 	}
 
-	xmlFile := os.Args[1]
+	xmlFile := fs.Arg(0)
 
 	// Read XML file
 	xmlData, err := os.ReadFile(xmlFile)
 	if err != nil {
-		log.Fatalf("Failed to read XML file: %v", err)
+		fmt.Fprintf(stderr, "Failed to read XML file: %v\n", err)
+		return 1
 	}
 
 	// Create validator
 	v := validator.New(validator.Config{
-		SourceName: xmlFile,
+		SourceName:       xmlFile,
+		WarningsAsErrors: *werror,
 	})
 
 	// Validate
 	ctx := context.Background()
-	result, _, err := v.ValidateString(ctx, string(xmlData))
+	result, doc, err := v.ValidateString(ctx, string(xmlData))
 	if err != nil {
-		log.Fatalf("Validation error: %v", err)
+		fmt.Fprintf(stderr, "Validation error: %v\n", err)
+		return 1
 	}
 
+	code := report(xmlFile, string(xmlData), result, stdout, stderr)
+	if *stats {
+		fmt.Fprintln(stdout)
+		if err := validator.Stats(doc).Print(stdout); err != nil {
+			fmt.Fprintf(stderr, "Failed to print statistics: %v\n", err)
+			return 1
+		}
+	}
+	return code
+}
+
+// report prints the validation result and returns the exit code it implies
+func report(xmlFile, source string, result validator.Result, stdout, stderr io.Writer) int {
 	// Print results
 	if len(result.Diagnostics) == 0 {
-		fmt.Printf("✅ %s is valid!\n", xmlFile)
-		os.Exit(0)
+		fmt.Fprintf(stdout, "✅ %s is valid!\n", xmlFile)
+		return 0
 	}
 
 	// Print diagnostics
-	reporter := validator.NewPrettyReporter(os.Stdout, validator.PrettyConfig{
+	reporter := validator.NewPrettyReporter(stdout, validator.PrettyConfig{
 		Color:           true,
 		ShowFullElement: false,
 		ContextBefore:   1,
 		ContextAfter:    1,
 	})
 
-	if err := reporter.Print(xmlFile, string(xmlData), result.Diagnostics); err != nil {
-		log.Fatalf("Failed to print diagnostics: %v", err)
+	if err := reporter.Print(xmlFile, source, result.Diagnostics); err != nil {
+		fmt.Fprintf(stderr, "Failed to print diagnostics: %v\n", err)
+		return 1
 	}
 
 	if result.HasErrors() {
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
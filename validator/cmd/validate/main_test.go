@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_WerrorFailsOnWarnings(t *testing.T) {
+	// An <invoke> without a source only produces a warning
+	path := filepath.Join(t.TempDir(), "warn.scxml")
+	xml := `<scxml version="1.0"><state id="s"><invoke type="scxml"/></state></scxml>`
+	if err := os.WriteFile(path, []byte(xml), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	run([]string{path}, &stdout, &stderr)
+	if !strings.Contains(stdout.String(), "WARNING[W318]") {
+		t.Fatalf("expected W318 warning without -Werror, got:\n%s%s", stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-Werror", path}, &stdout, &stderr); code == 0 {
+		t.Fatalf("exit code with -Werror = 0, want non-zero\n%s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "ERROR[W318]") || !strings.Contains(stdout.String(), "promoted from warning") {
+		t.Errorf("expected W318 to be reported as a promoted error, got:\n%s", stdout.String())
+	}
+}
+
+func TestRun_Stats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.scxml")
+	xml := `<scxml version="1.0" initial="a"><state id="a"><transition event="go" target="b"/></state><final id="b"/></scxml>`
+	if err := os.WriteFile(path, []byte(xml), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	run([]string{path}, &stdout, &stderr)
+	if strings.Contains(stdout.String(), "Transitions:") {
+		t.Fatalf("expected no statistics without -stats, got:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	run([]string{"-stats", path}, &stdout, &stderr)
+	for _, line := range []string{"States:      1", "Finals:      1", "Transitions: 1", "Regions:     a (state), b (final)"} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected %q with -stats, got:\n%s%s", line, stdout.String(), stderr.String())
+		}
+	}
+}
@@ -69,6 +69,9 @@ func (r *PrettyReporter) Print(sourceName string, source string, diags []Diagnos
 		r.lastDiagAttribute = d.Attribute
 		loc := locationString(file, d.Position.Line, d.Position.Column)
 		head := fmt.Sprintf("%s: %s[%s] %s", loc, strings.ToUpper(string(d.Severity)), d.Code, d.Message)
+		if d.OriginalSeverity != "" && d.OriginalSeverity != d.Severity {
+			head += fmt.Sprintf(" (promoted from %s)", d.OriginalSeverity)
+		}
 		fmt.Fprintln(r.w, r.styleHeader(head, d.Severity))
 		// Code frame (only if we have a line number)
 		if d.Position.Line > 0 {
@@ -78,6 +81,13 @@ func (r *PrettyReporter) Print(sourceName string, source string, diags []Diagnos
 		for _, h := range d.Hints {
 			fmt.Fprintln(r.w, r.styleHint("  hint: "+h))
 		}
+		if d.DocURL != "" {
+			fmt.Fprintln(r.w, r.styleHint("  docs: "+d.DocURL))
+		}
+		// Diagnostics merged from other rules at the same position
+		for _, m := range d.Merged {
+			fmt.Fprintf(r.w, "  also: %s[%s] %s\n", strings.ToUpper(string(m.Severity)), m.Code, m.Message)
+		}
 		// Related with inline frames
 		for _, rel := range d.Related {
 			rloc := locationString(nonEmpty(rel.Position.File, file), rel.Position.Line, rel.Position.Column)
@@ -14,6 +14,53 @@ type SemanticRule interface {
 	Validate(doc xmldom.Document, config Config) []Diagnostic
 }
 
+// ContextRule is an optional extension of SemanticRule for rules that look
+// up elements by id or scan the whole document. The validator builds one
+// RuleContext per run and calls ValidateContext instead of Validate, so such
+// rules don't each re-walk the tree.
+type ContextRule interface {
+	SemanticRule
+
+	// ValidateContext checks the rule against the shared per-run state
+	ValidateContext(rc *RuleContext, config Config) []Diagnostic
+}
+
+// RuleContext is the per-run state shared by ContextRule implementations.
+type RuleContext struct {
+	Doc  xmldom.Document
+	Root xmldom.Element
+	// Elements lists Root and all its descendants in document order
+	Elements []xmldom.Element
+	// IDs maps each id attribute value to its element
+	IDs map[string]xmldom.Element
+}
+
+// NewRuleContext walks doc once, collecting its elements and ids.
+func NewRuleContext(doc xmldom.Document) *RuleContext {
+	rc := &RuleContext{Doc: doc, IDs: make(map[string]xmldom.Element)}
+	if doc == nil {
+		return rc
+	}
+	rc.Root = doc.DocumentElement()
+	if rc.Root == nil {
+		return rc
+	}
+	walkElements(rc.Root, func(elem xmldom.Element) {
+		rc.Elements = append(rc.Elements, elem)
+		if id := string(elem.GetAttribute("id")); id != "" {
+			rc.IDs[id] = elem
+		}
+	})
+	return rc
+}
+
+// each calls fn for every element in document order, like walkElements
+func (rc *RuleContext) each(fn func(xmldom.Element)) {
+	for _, elem := range rc.Elements {
+		fn(elem)
+	}
+}
+
 // DefaultSemanticRules returns the standard SCXML 1.0 semantic validators.
 // These rules enforce constraints from the SCXML specification that cannot
 // be expressed in XSD schemas alone.
@@ -22,6 +69,7 @@ func DefaultSemanticRules() []SemanticRule {
 		// Format/Token validation
 		&IDTokenRule{},
 		&EventDescriptorRule{},
+		&MisplacedTransitionRule{},
 
 		// Mutual exclusion (XOR constraints)
 		&ParamNameAndXorRule{},
@@ -29,7 +77,15 @@ func DefaultSemanticRules() []SemanticRule {
 		&SendContentEventExclusionRule{},
 		&SendNamelistContentExclusionRule{},
 		&InvokeSrcExclusivityRule{},
+		&InvokeAttributesRule{},
+		&InvokeSourceRule{},
 		&DonedataContentParamExclusionRule{},
+		&ContentExprBodyExclusionRule{},
+
+		// Cross-reference rules
+		&InvokeTargetRule{},
+		&ContractEventRule{},
+		&NamespacedExecutablePlacementRule{},
 
 		// Cardinality constraints
 		&InitialOneTransitionRule{},
@@ -38,12 +94,18 @@ func DefaultSemanticRules() []SemanticRule {
 		&InitialTransitionConstraintsRule{},
 		&InitialTargetDescendantRule{},
 		&HistoryShallowTargetRule{},
+		&HistoryDefaultTransitionRule{},
 		&TransitionAtLeastOneRule{},
 		&StateInitialConflictRule{},
 		&StateInitialAtomicRule{},
+		&InternalTransitionScopeRule{},
 
 		// Liveness / Reachability rules
 		&StateDeadlockRule{},
 		&UnconditionalTransitionCycleRule{},
+		&ParallelFinalRule{},
+
+		// Data model rules (opt-in)
+		&LocationDeclaredRule{},
 	}
 }
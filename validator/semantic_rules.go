@@ -2,9 +2,11 @@ package validator
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 
+	"github.com/agentflare-ai/agentml-go/internal/memoryspec"
 	"github.com/agentflare-ai/go-xmldom"
 )
 
@@ -30,7 +32,7 @@ func (r *IDTokenRule) Validate(doc xmldom.Document, config Config) []Diagnostic
 	walkElements(root, func(elem xmldom.Element) {
 		if id := string(elem.GetAttribute("id")); id != "" {
 			if !ncnamePattern.MatchString(id) {
-				line, col, off := elem.Position()
+				line, col, off := attributePosition(elem, "id", 0)
 				diags = append(diags, Diagnostic{
 					Severity: SeverityError,
 					Code:     "E301",
@@ -75,10 +77,14 @@ func (r *EventDescriptorRule) Validate(doc xmldom.Document, config Config) []Dia
 	walkElements(root, func(elem xmldom.Element) {
 		if string(elem.LocalName()) == "transition" {
 			if event := string(elem.GetAttribute("event")); event != "" {
+				// Track where each token starts within the value
+				cursor := 0
 				tokens := strings.Fields(event)
 				for _, token := range tokens {
+					start := cursor + strings.Index(event[cursor:], token)
+					cursor = start + len(token)
 					if !eventTokenPattern.MatchString(token) || strings.Contains(token, ",") {
-						line, col, off := elem.Position()
+						line, col, off := attributePosition(elem, "event", start)
 						diags = append(diags, Diagnostic{
 							Severity: SeverityError,
 							Code:     "E302",
@@ -105,6 +111,62 @@ func (r *EventDescriptorRule) Validate(doc xmldom.Document, config Config) []Dia
 	return diags
 }
 
+// MisplacedTransitionRule validates <transition> only appears directly inside
+// a state, parallel, final, initial or history element
+type MisplacedTransitionRule struct{}
+
+func (r *MisplacedTransitionRule) Name() string { return "E306" }
+
+func (r *MisplacedTransitionRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	var diags []Diagnostic
+	root := doc.DocumentElement()
+	if root == nil {
+		return diags
+	}
+
+	allowedParents := map[string]bool{
+		"state":    true,
+		"parallel": true,
+		"final":    true,
+		"initial":  true,
+		"history":  true,
+	}
+
+	walkElements(root, func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "transition" {
+			return
+		}
+		parent, ok := elem.ParentNode().(xmldom.Element)
+		if !ok {
+			return
+		}
+		parentName := string(parent.LocalName())
+		if allowedParents[parentName] {
+			return
+		}
+
+		line, col, off := elem.Position()
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError,
+			Code:     "E306",
+			Message:  fmt.Sprintf("<transition> is not allowed inside <%s>", parentName),
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag: "transition",
+			Hints: []string{
+				"Move the <transition> directly under its <state> or <parallel>",
+				"To change state from executable content, use <raise> or <send> with a matching transition",
+			},
+		})
+	})
+
+	return diags
+}
+
 // ============================================================================
 // Mutual Exclusion Rules (E310-E319)
 // ============================================================================
@@ -431,6 +493,408 @@ func (r *DonedataContentParamExclusionRule) Validate(doc xmldom.Document, config
 	return diags
 }
 
+// InvokeAttributesRule validates <invoke> type/typeexpr and id/idlocation are
+// mutually exclusive. The src/srcexpr conflict itself is reported by E314.
+type InvokeAttributesRule struct{}
+
+func (r *InvokeAttributesRule) Name() string { return "E317" }
+
+func (r *InvokeAttributesRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	var diags []Diagnostic
+	root := doc.DocumentElement()
+	if root == nil {
+		return diags
+	}
+
+	walkElements(root, func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "invoke" {
+			return
+		}
+		line, col, off := elem.Position()
+		pos := Position{
+			File:   config.SourceName,
+			Line:   line,
+			Column: col,
+			Offset: off,
+		}
+
+		if elem.GetAttribute("type") != "" && elem.GetAttribute("typeexpr") != "" {
+			diags = append(diags, Diagnostic{
+				Severity:  SeverityError,
+				Code:      "E317",
+				Message:   "<invoke> cannot have both 'type' and 'typeexpr' attributes",
+				Position:  pos,
+				Tag:       "invoke",
+				Attribute: "type",
+				Hints: []string{
+					"Use either 'type' for a literal URI OR 'typeexpr' for a computed URI",
+				},
+			})
+		}
+
+		if elem.GetAttribute("id") != "" && elem.GetAttribute("idlocation") != "" {
+			diags = append(diags, Diagnostic{
+				Severity:  SeverityError,
+				Code:      "E317",
+				Message:   "<invoke> cannot have both 'id' and 'idlocation' attributes",
+				Position:  pos,
+				Tag:       "invoke",
+				Attribute: "id",
+				Hints: []string{
+					"Use 'id' for a fixed invoke id OR 'idlocation' to store a generated one",
+				},
+			})
+		}
+
+	})
+
+	return diags
+}
+
+// InvokeSourceRule warns when an <invoke> names no service to run: it has no
+// src, srcexpr or inline <content>.
+type InvokeSourceRule struct{}
+
+func (r *InvokeSourceRule) Name() string { return "W318" }
+
+func (r *InvokeSourceRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	var diags []Diagnostic
+	root := doc.DocumentElement()
+	if root == nil {
+		return diags
+	}
+
+	walkElements(root, func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "invoke" {
+			return
+		}
+		hasSrc := elem.GetAttribute("src") != "" || elem.GetAttribute("srcexpr") != ""
+		if !hasSrc && !elementHasChild(elem, "content") {
+			line, col, off := elem.Position()
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "W318",
+				Message:  "<invoke> has no 'src', 'srcexpr' or inline <content>",
+				Position: Position{
+					File:   config.SourceName,
+					Line:   line,
+					Column: col,
+					Offset: off,
+				},
+				Tag:       "invoke",
+				Attribute: "src",
+				Hints: []string{
+					"Add 'src' or 'srcexpr' to name the service, or inline it with <content>",
+				},
+			})
+		}
+	})
+
+	return diags
+}
+
+// ContentExprBodyExclusionRule validates <content> cannot have both an expr
+// attribute and inline child content
+type ContentExprBodyExclusionRule struct{}
+
+func (r *ContentExprBodyExclusionRule) Name() string { return "E318" }
+
+func (r *ContentExprBodyExclusionRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	var diags []Diagnostic
+	root := doc.DocumentElement()
+	if root == nil {
+		return diags
+	}
+
+	walkElements(root, func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "content" {
+			return
+		}
+		if elem.GetAttribute("expr") == "" || !hasInlineBody(elem) {
+			return
+		}
+		line, col, off := elem.Position()
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError,
+			Code:     "E318",
+			Message:  "<content> cannot have both an 'expr' attribute and inline content",
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag:       "content",
+			Attribute: "expr",
+			Hints: []string{
+				"Use either 'expr' to compute the payload OR inline child content, not both",
+			},
+		})
+	})
+
+	return diags
+}
+
+// InvokeTargetRule warns when a <send> target of the form #_<invokeid> names
+// no <invoke> with that id. The reserved #_internal, #_parent and
+// #_scxml_<sessionid> targets are accepted. Invokes using idlocation have ids
+// only known at runtime and are ignored, as are computed targetexpr values.
+type InvokeTargetRule struct{}
+
+func (r *InvokeTargetRule) Name() string { return "W315" }
+
+func (r *InvokeTargetRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *InvokeTargetRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	invokeIDs := map[string]struct{}{}
+	rc.each(func(elem xmldom.Element) {
+		if string(elem.LocalName()) == "invoke" {
+			if id := string(elem.GetAttribute("id")); id != "" {
+				invokeIDs[id] = struct{}{}
+			}
+		}
+	})
+
+	var diags []Diagnostic
+	rc.each(func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "send" {
+			return
+		}
+		target := strings.TrimSpace(string(elem.GetAttribute("target")))
+		name, ok := strings.CutPrefix(target, "#_")
+		if !ok || name == "" || name == "internal" || name == "parent" || strings.HasPrefix(name, "scxml_") {
+			return
+		}
+		if _, ok := invokeIDs[name]; ok {
+			return
+		}
+		hints := []string{
+			fmt.Sprintf("Give the <invoke> to send to id=\"%s\"", name),
+		}
+		if near := nearestIDs(name, invokeIDs, 1, 2); len(near) > 0 {
+			hints = append([]string{fmt.Sprintf("Did you mean '#_%s'?", near[0])}, hints...)
+		}
+		line, col, off := attributePosition(elem, "target", 0)
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "W315",
+			Message:  fmt.Sprintf("<send> target '%s' does not match any <invoke> id", target),
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag:       "send",
+			Attribute: "target",
+			Hints:     hints,
+		})
+	})
+
+	return diags
+}
+
+// ContractEventRule warns when a <transition> event token or a <send> event
+// is not covered by Config.AllowedEvents. Entries match exactly, or by
+// prefix when they end in ".*"; a transition descriptor is also covered when
+// it would match an allowed event. Platform events (done.*, error.*), events
+// the document raises itself, sends to #_internal and eventexpr values are
+// not checked. The rule only runs when Config.AllowedEvents is set.
+type ContractEventRule struct{}
+
+func (r *ContractEventRule) Name() string { return "W316" }
+
+func (r *ContractEventRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *ContractEventRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	if len(config.AllowedEvents) == 0 {
+		return nil
+	}
+
+	raised := map[string]bool{}
+	rc.each(func(elem xmldom.Element) {
+		if string(elem.LocalName()) == "raise" {
+			raised[string(elem.GetAttribute("event"))] = true
+		}
+	})
+	exempt := func(event string) bool {
+		return raised[event] || event == "done" || event == "error" ||
+			strings.HasPrefix(event, "done.") || strings.HasPrefix(event, "error.")
+	}
+
+	var diags []Diagnostic
+	report := func(elem xmldom.Element, tag, event string) {
+		line, col, off := attributePosition(elem, "event", 0)
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "W316",
+			Message:  fmt.Sprintf("<%s> event '%s' is not in the allowed event contract", tag, event),
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag:       tag,
+			Attribute: "event",
+			Hints: []string{
+				"Add the event to the contract or correct its name",
+			},
+		})
+	}
+
+	rc.each(func(elem xmldom.Element) {
+		switch tag := string(elem.LocalName()); tag {
+		case "transition":
+			for _, token := range strings.Fields(string(elem.GetAttribute("event"))) {
+				descriptor := strings.TrimSuffix(strings.TrimSuffix(token, "*"), ".")
+				if descriptor == "" || exempt(descriptor) || contractCovers(config.AllowedEvents, descriptor, true) {
+					continue
+				}
+				report(elem, tag, token)
+			}
+		case "send":
+			event := strings.TrimSpace(string(elem.GetAttribute("event")))
+			if event == "" || strings.TrimSpace(string(elem.GetAttribute("target"))) == "#_internal" {
+				return
+			}
+			if exempt(event) || contractCovers(config.AllowedEvents, event, false) {
+				return
+			}
+			report(elem, tag, event)
+		}
+	})
+
+	return diags
+}
+
+// contractCovers reports whether an allowed entry matches event. With
+// descriptor set, event is a transition descriptor, which also counts as
+// covered when it is a prefix of an allowed entry.
+func contractCovers(allowed []string, event string, descriptor bool) bool {
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" || entry == event {
+			return true
+		}
+		base, wildcard := strings.CutSuffix(entry, ".*")
+		if wildcard && (event == base || strings.HasPrefix(event, base+".")) {
+			return true
+		}
+		if descriptor && strings.HasPrefix(base, event+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// executableElements lists the executable elements of the extension
+// namespaces shipped with agentml-go, by namespace URI.
+var executableElements = map[string]map[string]bool{
+	"github.com/agentflare-ai/agentml-go/openai":    {"generate": true},
+	"github.com/agentflare-ai/agentml-go/anthropic": {"generate": true},
+	"github.com/agentflare-ai/agentml/ollama":       {"generate": true},
+	memoryspec.NamespaceURI:                         setOf(memoryspec.Executable...),
+}
+
+// executableContainers lists the elements whose children run as executable
+// content: the SCXML containers, and extension elements that run their
+// children, keyed by namespace URI.
+var (
+	executableContainers = setOf("onentry", "onexit", "transition", "if", "foreach", "finalize")
+
+	extensionContainers = map[string]map[string]bool{
+		memoryspec.NamespaceURI: setOf(memoryspec.Containers...),
+	}
+)
+
+// extensionTag names an element of a known extension namespace by the
+// namespace's last path segment, its conventional prefix, e.g.
+// "openai:generate". Elements of other namespaces keep their local name.
+func extensionTag(elem xmldom.Element) string {
+	ns := string(elem.NamespaceURI())
+	if executableElements[ns] == nil {
+		return string(elem.LocalName())
+	}
+	return path.Base(ns) + ":" + string(elem.LocalName())
+}
+
+func setOf(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// NamespacedExecutablePlacementRule warns when a known extension executable,
+// such as <openai:generate>, is placed outside executable content, for
+// example directly under <scxml> or a <state>, where it never runs. Parents
+// from other namespaces may run their children in ways the validator cannot
+// know, so they are not checked.
+type NamespacedExecutablePlacementRule struct{}
+
+func (r *NamespacedExecutablePlacementRule) Name() string { return "W317" }
+
+func (r *NamespacedExecutablePlacementRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *NamespacedExecutablePlacementRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	if rc.Root == nil {
+		return nil
+	}
+	coreNS := string(rc.Root.NamespaceURI())
+
+	var diags []Diagnostic
+	rc.each(func(elem xmldom.Element) {
+		if !executableElements[string(elem.NamespaceURI())][string(elem.LocalName())] {
+			return
+		}
+		parent, ok := elem.ParentNode().(xmldom.Element)
+		if !ok {
+			return
+		}
+		parentNS, parentName := string(parent.NamespaceURI()), string(parent.LocalName())
+		var allowed bool
+		switch {
+		case extensionContainers[parentNS] != nil:
+			allowed = extensionContainers[parentNS][parentName]
+		case parentNS == coreNS || parentNS == "":
+			allowed = executableContainers[parentName]
+		case executableElements[parentNS] == nil:
+			return
+		}
+		if allowed {
+			return
+		}
+
+		tag := extensionTag(elem)
+		line, col, off := elem.Position()
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "W317",
+			Message:  fmt.Sprintf("<%s> is not executable content inside <%s> and will never run", tag, extensionTag(parent)),
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag: string(elem.LocalName()),
+			Hints: []string{
+				fmt.Sprintf("Move <%s> into an <onentry>, <onexit> or <transition>", tag),
+			},
+		})
+	})
+
+	return diags
+}
+
 // ============================================================================
 // Cardinality Rules (E320-E329)
 // ============================================================================
@@ -557,16 +1021,14 @@ type InitialTargetDescendantRule struct{}
 func (r *InitialTargetDescendantRule) Name() string { return "E331" }
 
 func (r *InitialTargetDescendantRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
-	var diags []Diagnostic
-	root := doc.DocumentElement()
-	if root == nil {
-		return diags
-	}
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
 
-	// Build ID map
-	idMap := buildIDMap(root)
+func (r *InitialTargetDescendantRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	var diags []Diagnostic
+	idMap := rc.IDs
 
-	walkElements(root, func(elem xmldom.Element) {
+	rc.each(func(elem xmldom.Element) {
 		if string(elem.LocalName()) == "initial" {
 			// Find parent state
 			parent := elem.ParentNode()
@@ -624,16 +1086,14 @@ type HistoryShallowTargetRule struct{}
 func (r *HistoryShallowTargetRule) Name() string { return "E332" }
 
 func (r *HistoryShallowTargetRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
-	var diags []Diagnostic
-	root := doc.DocumentElement()
-	if root == nil {
-		return diags
-	}
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
 
-	// Build ID map
-	idMap := buildIDMap(root)
+func (r *HistoryShallowTargetRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	var diags []Diagnostic
+	idMap := rc.IDs
 
-	walkElements(root, func(elem xmldom.Element) {
+	rc.each(func(elem xmldom.Element) {
 		if string(elem.LocalName()) == "history" {
 			historyType := string(elem.GetAttribute("type"))
 			if historyType == "" {
@@ -695,6 +1155,67 @@ func (r *HistoryShallowTargetRule) Validate(doc xmldom.Document, config Config)
 	return diags
 }
 
+// HistoryDefaultTransitionRule checks that each <history> has exactly one
+// <transition> giving its default target. Without one, entering the history
+// before its parent state has ever been active has nowhere to go, so a
+// missing default is a warning; more than one is ambiguous and an error.
+type HistoryDefaultTransitionRule struct{}
+
+func (r *HistoryDefaultTransitionRule) Name() string { return "W333" }
+
+func (r *HistoryDefaultTransitionRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *HistoryDefaultTransitionRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	var diags []Diagnostic
+
+	rc.each(func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "history" {
+			return
+		}
+
+		transitions := 0
+		children := elem.Children()
+		for i := uint(0); i < children.Length(); i++ {
+			if child := children.Item(i); child != nil && string(child.LocalName()) == "transition" {
+				transitions++
+			}
+		}
+		if transitions == 1 {
+			return
+		}
+
+		historyID := string(elem.GetAttribute("id"))
+		line, col, off := elem.Position()
+		diag := Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "W333",
+			Message:  fmt.Sprintf("History '%s' has no default <transition>, so it has no target until its parent has been active", historyID),
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag: "history",
+			Hints: []string{
+				"Add a <transition target=\"...\"/> naming the state to enter the first time",
+			},
+		}
+		if transitions > 1 {
+			diag.Severity = SeverityError
+			diag.Message = fmt.Sprintf("History '%s' has %d <transition> children; it must have at most one default transition", historyID, transitions)
+			diag.Hints = []string{
+				"Keep a single <transition> giving the default target",
+			}
+		}
+		diags = append(diags, diag)
+	})
+
+	return diags
+}
+
 // TransitionAtLeastOneRule validates transition must specify event/cond/target
 type TransitionAtLeastOneRule struct{}
 
@@ -844,6 +1365,66 @@ func (r *StateInitialAtomicRule) Validate(doc xmldom.Document, config Config) []
 	return diags
 }
 
+// InternalTransitionScopeRule validates that a type="internal" transition
+// with a target only targets proper descendants of its source state, since
+// leaving the source would exit it
+type InternalTransitionScopeRule struct{}
+
+func (r *InternalTransitionScopeRule) Name() string { return "E336" }
+
+func (r *InternalTransitionScopeRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *InternalTransitionScopeRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	var diags []Diagnostic
+	idMap := rc.IDs
+
+	rc.each(func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "transition" || string(elem.GetAttribute("type")) != "internal" {
+			return
+		}
+		source := elem.ParentNode()
+		if source == nil {
+			return
+		}
+		if tag := string(source.LocalName()); tag != "state" && tag != "parallel" {
+			return
+		}
+		sourceID := string(source.(xmldom.Element).GetAttribute("id"))
+
+		for _, target := range strings.Fields(string(elem.GetAttribute("target"))) {
+			targetElem, exists := idMap[target]
+			if !exists {
+				continue // IDREF validation will catch this
+			}
+			if isDescendantOf(targetElem, source) {
+				continue
+			}
+			line, col, off := elem.Position()
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError,
+				Code:     "E336",
+				Message:  fmt.Sprintf("Internal transition target '%s' is not a descendant of source state '%s'", target, sourceID),
+				Position: Position{
+					File:   config.SourceName,
+					Line:   line,
+					Column: col,
+					Offset: off,
+				},
+				Tag:       "transition",
+				Attribute: "target",
+				Hints: []string{
+					"An internal transition must not exit its source state, so it can only target the source's descendants",
+					"Remove type=\"internal\" or target a child of the source state",
+				},
+			})
+		}
+	})
+
+	return diags
+}
+
 // ============================================================================
 // Liveness / Reachability Rules (E340-E349)
 // ============================================================================
@@ -953,15 +1534,13 @@ type UnconditionalTransitionCycleRule struct{}
 func (r *UnconditionalTransitionCycleRule) Name() string { return "E341" }
 
 func (r *UnconditionalTransitionCycleRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
-	var diags []Diagnostic
-	root := doc.DocumentElement()
-	if root == nil {
-		return diags
-	}
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
 
-	// Build ID map and transition graph
-	idMap := buildIDMap(root)
-	transitionGraph := buildUnconditionalTransitionGraph(root)
+func (r *UnconditionalTransitionCycleRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	var diags []Diagnostic
+	idMap := rc.IDs
+	transitionGraph := buildUnconditionalTransitionGraph(rc)
 
 	// For each state, check if following unconditional transitions leads to a cycle
 	for stateID := range transitionGraph {
@@ -1000,10 +1579,10 @@ func (r *UnconditionalTransitionCycleRule) Validate(doc xmldom.Document, config
 }
 
 // buildUnconditionalTransitionGraph builds a graph of states connected by unconditional transitions
-func buildUnconditionalTransitionGraph(root xmldom.Element) map[string][]string {
+func buildUnconditionalTransitionGraph(rc *RuleContext) map[string][]string {
 	graph := make(map[string][]string)
 
-	walkElements(root, func(elem xmldom.Element) {
+	rc.each(func(elem xmldom.Element) {
 		if string(elem.LocalName()) != "transition" {
 			return
 		}
@@ -1076,6 +1655,161 @@ func formatCyclePath(path []string) string {
 	return strings.Join(path, " → ")
 }
 
+// ParallelFinalRule warns about <parallel> regions that contain no <final>.
+// A parallel only completes once every region reaches a final state, so when
+// some regions have one, a region without one keeps the parallel from ever
+// completing. Parallels with no finals at all are left alone, since they are
+// usually exited by transitions rather than completion.
+type ParallelFinalRule struct{}
+
+func (r *ParallelFinalRule) Name() string { return "W344" }
+
+func (r *ParallelFinalRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *ParallelFinalRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	var diags []Diagnostic
+
+	rc.each(func(elem xmldom.Element) {
+		if string(elem.LocalName()) != "parallel" {
+			return
+		}
+
+		var regions, missing []xmldom.Element
+		children := elem.Children()
+		for i := uint(0); i < children.Length(); i++ {
+			child := children.Item(i)
+			if child == nil {
+				continue
+			}
+			if tag := string(child.LocalName()); tag != "state" && tag != "parallel" {
+				continue
+			}
+			regions = append(regions, child)
+			if !hasDescendant(child, "final") {
+				missing = append(missing, child)
+			}
+		}
+		if len(missing) == 0 || len(missing) == len(regions) {
+			return
+		}
+
+		parallelID := string(elem.GetAttribute("id"))
+		for _, region := range missing {
+			regionID := string(region.GetAttribute("id"))
+			line, col, off := region.Position()
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "W344",
+				Message:  fmt.Sprintf("Region '%s' of parallel '%s' has no <final> state, so the parallel can never complete", regionID, parallelID),
+				Position: Position{
+					File:   config.SourceName,
+					Line:   line,
+					Column: col,
+					Offset: off,
+				},
+				Tag: string(region.LocalName()),
+				Hints: []string{
+					"Add a <final> state to this region so done.state." + parallelID + " can be raised",
+					"Or leave the parallel with an explicit transition instead of relying on completion",
+				},
+			})
+		}
+	})
+
+	return diags
+}
+
+// LocationDeclaredRule warns when a location attribute names data that is
+// never declared. Declared names are <data> ids, <param> names and <foreach>
+// item/index variables anywhere in the document; member access such as
+// user.address.city is checked by its root identifier. System variables
+// (_event, _sessionid, ...) are always accepted. Locations can also be
+// created by scripts the validator cannot see, so the rule only runs when
+// Config.CheckLocations is set.
+type LocationDeclaredRule struct{}
+
+func (r *LocationDeclaredRule) Name() string { return "W351" }
+
+func (r *LocationDeclaredRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.ValidateContext(NewRuleContext(doc), config)
+}
+
+func (r *LocationDeclaredRule) ValidateContext(rc *RuleContext, config Config) []Diagnostic {
+	if !config.CheckLocations {
+		return nil
+	}
+
+	declared := map[string]bool{}
+	rc.each(func(elem xmldom.Element) {
+		switch string(elem.LocalName()) {
+		case "data":
+			declared[string(elem.GetAttribute("id"))] = true
+		case "param":
+			declared[string(elem.GetAttribute("name"))] = true
+		case "foreach":
+			declared[string(elem.GetAttribute("item"))] = true
+			declared[string(elem.GetAttribute("index"))] = true
+		}
+	})
+
+	// Attributes holding a location, by element
+	locationAttrs := map[string]string{
+		"assign": "location",
+		"param":  "location",
+		"send":   "idlocation",
+		"invoke": "idlocation",
+	}
+
+	var diags []Diagnostic
+	rc.each(func(elem xmldom.Element) {
+		tag := string(elem.LocalName())
+		attr, ok := locationAttrs[tag]
+		if !ok {
+			return
+		}
+		location := strings.TrimSpace(string(elem.GetAttribute(xmldom.DOMString(attr))))
+		root := locationRoot(location)
+		if root == "" || strings.HasPrefix(root, "_") || declared[root] {
+			return
+		}
+		message := fmt.Sprintf("<%s> %s '%s' is not declared in the data model", tag, attr, root)
+		if root != location {
+			message = fmt.Sprintf("<%s> %s '%s' refers to '%s', which is not declared in the data model", tag, attr, location, root)
+		}
+		line, col, off := attributePosition(elem, attr, 0)
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "W351",
+			Message:  message,
+			Position: Position{
+				File:   config.SourceName,
+				Line:   line,
+				Column: col,
+				Offset: off,
+			},
+			Tag:       tag,
+			Attribute: attr,
+			Hints: []string{
+				fmt.Sprintf("Declare it with <data id=\"%s\"/> in a <datamodel>", root),
+			},
+		})
+	})
+
+	return diags
+}
+
+// locationRoot returns the leading identifier of a location expression, so
+// "user.address[0]" yields "user"
+func locationRoot(location string) string {
+	end := strings.IndexAny(location, ".[ ")
+	if end < 0 {
+		return location
+	}
+	return location[:end]
+}
+
 // ============================================================================
 // Helper Functions
 // ============================================================================
@@ -1094,6 +1828,42 @@ func walkElements(elem xmldom.Element, fn func(xmldom.Element)) {
 	}
 }
 
+// attributePosition returns the position of byte index of attrName's value on
+// elem. The value is taken to start right after name=" and is walked up to
+// index, so a token on a later line of a multi-line value gets its own line
+// and column. It falls back to the start of the attribute when the value holds
+// characters that may have been written as references, whose source length is
+// unknown, and to the element position when xmldom has no position for the
+// attribute.
+func attributePosition(elem xmldom.Element, attrName string, index int) (line, col int, off int64) {
+	attr := elem.GetAttributeNode(xmldom.DOMString(attrName))
+	if attr == nil {
+		return elem.Position()
+	}
+	line, col, off = attr.Position()
+	if line <= 0 {
+		return elem.Position()
+	}
+	value := string(attr.Value())
+	if index < 0 || index > len(value) || strings.ContainsAny(value, "&<>\"'") {
+		return line, col, off
+	}
+	// Skip past name="
+	n := len(attr.NodeName()) + 2
+	col += n
+	off += int64(n)
+	for i := 0; i < index; i++ {
+		if value[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+		off++
+	}
+	return line, col, off
+}
+
 // elementHasChild checks if element has a child with the given tag name
 func elementHasChild(elem xmldom.Element, childName string) bool {
 	children := elem.Children()
@@ -1107,6 +1877,38 @@ func elementHasChild(elem xmldom.Element, childName string) bool {
 	return false
 }
 
+// hasInlineBody reports whether elem has child elements or non-whitespace
+// text; comments do not count
+func hasInlineBody(elem xmldom.Element) bool {
+	children := elem.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		child := children.Item(i)
+		if child == nil {
+			continue
+		}
+		switch child.NodeType() {
+		case xmldom.ELEMENT_NODE:
+			return true
+		case xmldom.TEXT_NODE, xmldom.CDATA_SECTION_NODE:
+			if strings.TrimSpace(string(child.NodeValue())) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasDescendant checks if elem has a descendant with the given tag name
+func hasDescendant(elem xmldom.Element, name string) bool {
+	found := false
+	walkElements(elem, func(e xmldom.Element) {
+		if e != elem && string(e.LocalName()) == name {
+			found = true
+		}
+	})
+	return found
+}
+
 // countChildElements counts children with the given tag name
 func countChildElements(elem xmldom.Element, childName string) int {
 	count := 0
@@ -1121,17 +1923,6 @@ func countChildElements(elem xmldom.Element, childName string) int {
 	return count
 }
 
-// buildIDMap creates a map of id -> element
-func buildIDMap(root xmldom.Element) map[string]xmldom.Element {
-	idMap := make(map[string]xmldom.Element)
-	walkElements(root, func(elem xmldom.Element) {
-		if id := string(elem.GetAttribute("id")); id != "" {
-			idMap[id] = elem
-		}
-	})
-	return idMap
-}
-
 // isDescendantOf checks if elem is a descendant of ancestor
 func isDescendantOf(elem xmldom.Node, ancestor xmldom.Node) bool {
 	current := elem.ParentNode()
@@ -0,0 +1,102 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+// DocumentStats summarizes the structure of a document, giving reviewers a
+// quick sense of its size and complexity.
+type DocumentStats struct {
+	States      int
+	Parallels   int
+	Finals      int
+	Transitions int
+	Invokes     int
+	// MaxDepth is the deepest nesting of state, parallel and final
+	// elements; a top-level state has depth 1.
+	MaxDepth int
+	// Regions lists the top-level state, parallel and final children of
+	// the root in document order.
+	Regions []Region
+}
+
+// Region is a top-level state of a document.
+type Region struct {
+	// Tag is the element name: state, parallel or final.
+	Tag string
+	// ID is the region's id, empty when it has none.
+	ID string
+}
+
+// Stats counts the states, parallels, finals, transitions and invokes of
+// doc and measures its state nesting depth.
+func Stats(doc xmldom.Document) DocumentStats {
+	var stats DocumentStats
+	if doc == nil || doc.DocumentElement() == nil {
+		return stats
+	}
+
+	var visit func(elem xmldom.Element, depth int)
+	visit = func(elem xmldom.Element, depth int) {
+		tag := string(elem.LocalName())
+		switch tag {
+		case "state":
+			stats.States++
+		case "parallel":
+			stats.Parallels++
+		case "final":
+			stats.Finals++
+		case "transition":
+			stats.Transitions++
+		case "invoke":
+			stats.Invokes++
+		}
+		if isStateElement(tag) {
+			depth++
+			stats.MaxDepth = max(stats.MaxDepth, depth)
+		}
+		children := elem.Children()
+		for i := uint(0); i < children.Length(); i++ {
+			if child := children.Item(i); child != nil {
+				visit(child, depth)
+			}
+		}
+	}
+	root := doc.DocumentElement()
+	visit(root, 0)
+
+	children := root.Children()
+	for i := uint(0); i < children.Length(); i++ {
+		child := children.Item(i)
+		if child == nil {
+			continue
+		}
+		if tag := string(child.LocalName()); isStateElement(tag) {
+			stats.Regions = append(stats.Regions, Region{Tag: tag, ID: string(child.GetAttribute("id"))})
+		}
+	}
+	return stats
+}
+
+func isStateElement(tag string) bool {
+	return tag == "state" || tag == "parallel" || tag == "final"
+}
+
+// Print writes the statistics to w, one line per figure.
+func (s DocumentStats) Print(w io.Writer) error {
+	regions := make([]string, len(s.Regions))
+	for i, r := range s.Regions {
+		if r.ID == "" {
+			regions[i] = "<" + r.Tag + ">"
+		} else {
+			regions[i] = r.ID + " (" + r.Tag + ")"
+		}
+	}
+	_, err := fmt.Fprintf(w, "States:      %d\nParallels:   %d\nFinals:      %d\nTransitions: %d\nInvokes:     %d\nMax depth:   %d\nRegions:     %s\n",
+		s.States, s.Parallels, s.Finals, s.Transitions, s.Invokes, s.MaxDepth, strings.Join(regions, ", "))
+	return err
+}
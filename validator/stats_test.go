@@ -0,0 +1,73 @@
+package validator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
+)
+
+func TestStats(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="idle">
+  <state id="idle">
+    <transition event="start" target="work"/>
+  </state>
+  <parallel id="work">
+    <state id="fetch">
+      <invoke id="fetcher" src="fetch.scxml"/>
+      <state id="fetching">
+        <transition event="done" target="fetched"/>
+      </state>
+      <final id="fetched"/>
+    </state>
+    <state id="render">
+      <transition event="rendered" target="end"/>
+    </state>
+  </parallel>
+  <final id="end"/>
+</scxml>`
+	doc, err := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	got := Stats(doc)
+	want := DocumentStats{
+		States:      4,
+		Parallels:   1,
+		Finals:      2,
+		Transitions: 3,
+		Invokes:     1,
+		MaxDepth:    3,
+		Regions: []Region{
+			{Tag: "state", ID: "idle"},
+			{Tag: "parallel", ID: "work"},
+			{Tag: "final", ID: "end"},
+		},
+	}
+	if got.States != want.States || got.Parallels != want.Parallels || got.Finals != want.Finals ||
+		got.Transitions != want.Transitions || got.Invokes != want.Invokes || got.MaxDepth != want.MaxDepth {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	if !slices.Equal(got.Regions, want.Regions) {
+		t.Errorf("Regions = %+v, want %+v", got.Regions, want.Regions)
+	}
+
+	var out strings.Builder
+	if err := got.Print(&out); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	for _, line := range []string{"States:      4", "Max depth:   3", "Regions:     idle (state), work (parallel), end (final)"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in output, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestStatsNilDocument(t *testing.T) {
+	if got := Stats(nil); got.States != 0 || got.MaxDepth != 0 || got.Regions != nil {
+		t.Errorf("Stats(nil) = %+v, want zero", got)
+	}
+}
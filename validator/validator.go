@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -58,6 +59,18 @@ type Diagnostic struct {
 	SpecRef   string    `json:"spec_ref,omitempty"`
 	Hints     []string  `json:"hints,omitempty"`
 	Related   []Related `json:"related,omitempty"`
+
+	// DocURL links to the documentation of Code, set only when
+	// Config.DocBaseURL is configured.
+	DocURL string `json:"doc_url,omitempty"`
+
+	// OriginalSeverity is the severity a rule reported, set only when Strict
+	// or WarningsAsErrors promoted the diagnostic to an error.
+	OriginalSeverity Severity `json:"original_severity,omitempty"`
+
+	// Merged holds the diagnostics other rules reported at the same
+	// position, collapsed into this one when Config.MergeRelated is set.
+	Merged []Diagnostic `json:"merged,omitempty"`
 }
 
 // Result is the aggregate validation result
@@ -92,6 +105,29 @@ type Config struct {
 	DataModel  string // Optional datamodel context (ecmascript, xpath, null, starlark)
 	SourceName string // Optional source name for reporting
 
+	// WarningsAsErrors promotes every warning to an error once validation
+	// finishes, including warnings from recursively invoked files.
+	WarningsAsErrors bool
+
+	// MergeRelated collapses diagnostics that different rules report at the
+	// same position into one entry, keeping the most severe as the primary
+	// diagnostic and the rest in its Merged field. Exact duplicates (same
+	// code, position and attribute) are always removed.
+	MergeRelated bool
+
+	// DocBaseURL, when set, fills each diagnostic's DocURL with
+	// <DocBaseURL>/<Code>, e.g. https://example.com/rules/E301.
+	DocBaseURL string
+
+	// AllowedEvents is the contract of events the document may send and
+	// handle. When set, W316 warns about transition and send events it
+	// does not cover. Entries ending in ".*" match by prefix.
+	AllowedEvents []string
+
+	// CheckLocations enables W351, which warns when an assign, param, send
+	// or invoke location refers to data that is never declared.
+	CheckLocations bool
+
 	// RecursiveInvoke enables recursive validation of invoked SCXML files.
 	// When true, the validator will attempt to load and validate any SCXML files
 	// referenced in <invoke type="scxml" src="..."> elements.
@@ -205,8 +241,17 @@ func (v *Validator) ValidateDocument(ctx context.Context, doc xmldom.Document, s
 		rules = DefaultSemanticRules()
 	}
 
+	var rc *RuleContext
 	for _, rule := range rules {
-		semanticDiags := rule.Validate(doc, v.config)
+		var semanticDiags []Diagnostic
+		if cr, ok := rule.(ContextRule); ok {
+			if rc == nil {
+				rc = NewRuleContext(doc)
+			}
+			semanticDiags = cr.ValidateContext(rc, v.config)
+		} else {
+			semanticDiags = rule.Validate(doc, v.config)
+		}
 		diagnostics = append(diagnostics, semanticDiags...)
 	}
 
@@ -216,11 +261,7 @@ func (v *Validator) ValidateDocument(ctx context.Context, doc xmldom.Document, s
 
 	// If strict, escalate selected warnings to errors
 	if v.config.Strict {
-		for i := range res.Diagnostics {
-			if res.Diagnostics[i].Severity == SeverityWarning {
-				res.Diagnostics[i].Severity = SeverityError
-			}
-		}
+		promoteWarnings(res.Diagnostics)
 	}
 
 	// Recursively validate invoked SCXML files if enabled
@@ -229,9 +270,131 @@ func (v *Validator) ValidateDocument(ctx context.Context, doc xmldom.Document, s
 		res.Add(invokedDiags...)
 	}
 
+	res.Diagnostics = dedupeDiagnostics(res.Diagnostics)
+	if v.config.MergeRelated {
+		res.Diagnostics = mergeRelated(res.Diagnostics)
+	}
+
+	if v.config.WarningsAsErrors {
+		promoteWarnings(res.Diagnostics)
+	}
+	if v.config.DocBaseURL != "" {
+		linkDocs(res.Diagnostics, v.config.DocBaseURL)
+	}
+
 	return res
 }
 
+// severityRank orders severities from least to most severe
+func severityRank(s Severity) int {
+	switch s {
+	case SeverityError:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// dedupeDiagnostics drops diagnostics repeating the code, position,
+// attribute and message of an earlier one, so distinct findings on one
+// attribute (one per token, say) survive. The survivor keeps the most severe
+// severity and gains any hints it was missing.
+func dedupeDiagnostics(diags []Diagnostic) []Diagnostic {
+	type key struct {
+		code      string
+		position  Position
+		attribute string
+		message   string
+	}
+	seen := make(map[key]int, len(diags))
+	out := diags[:0:0]
+	for _, d := range diags {
+		k := key{d.Code, d.Position, d.Attribute, d.Message}
+		i, ok := seen[k]
+		if !ok {
+			seen[k] = len(out)
+			out = append(out, d)
+			continue
+		}
+		if severityRank(d.Severity) > severityRank(out[i].Severity) {
+			out[i].Severity = d.Severity
+			out[i].OriginalSeverity = d.OriginalSeverity
+		}
+		for _, h := range d.Hints {
+			if !slices.Contains(out[i].Hints, h) {
+				out[i].Hints = append(out[i].Hints, h)
+			}
+		}
+	}
+	return out
+}
+
+// mergeRelated collapses diagnostics sharing a position into the most severe
+// of them (the first on ties), which lists the others in Merged. Diagnostics
+// without a position are unrelated and kept as they are.
+func mergeRelated(diags []Diagnostic) []Diagnostic {
+	// unplaced is the index of a diagnostic without a position, giving it a
+	// group of its own; it is -1 for every positioned diagnostic.
+	type key struct {
+		position Position
+		unplaced int
+	}
+	groups := make(map[key][]Diagnostic, len(diags))
+	var order []key
+	for i, d := range diags {
+		k := key{d.Position, -1}
+		if d.Position.Line == 0 {
+			k.unplaced = i
+		}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], d)
+	}
+	out := make([]Diagnostic, 0, len(order))
+	for _, k := range order {
+		group := groups[k]
+		primary := 0
+		for i, d := range group {
+			if severityRank(d.Severity) > severityRank(group[primary].Severity) {
+				primary = i
+			}
+		}
+		merged := group[primary]
+		for i, d := range group {
+			if i != primary {
+				merged.Merged = append(merged.Merged, d)
+			}
+		}
+		out = append(out, merged)
+	}
+	return out
+}
+
+// promoteWarnings turns warnings into errors, keeping the original severity
+func promoteWarnings(diags []Diagnostic) {
+	for i := range diags {
+		if diags[i].Severity == SeverityWarning {
+			diags[i].OriginalSeverity = SeverityWarning
+			diags[i].Severity = SeverityError
+		}
+		promoteWarnings(diags[i].Merged)
+	}
+}
+
+// linkDocs sets the DocURL of diagnostics with a code to base/<code>
+func linkDocs(diags []Diagnostic, base string) {
+	base = strings.TrimRight(base, "/")
+	for i := range diags {
+		if diags[i].Code != "" {
+			diags[i].DocURL = base + "/" + diags[i].Code
+		}
+		linkDocs(diags[i].Merged, base)
+	}
+}
+
 // validateInvokedSCXML recursively validates SCXML files referenced in invoke elements
 func (v *Validator) validateInvokedSCXML(ctx context.Context, doc xmldom.Document) []Diagnostic {
 	if doc == nil {
@@ -2,9 +2,13 @@ package validator
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/agentflare-ai/go-xmldom"
 )
 
 func TestValidator_BasicRootChecks(t *testing.T) {
@@ -186,6 +190,96 @@ func TestInvalidIDToken(t *testing.T) {
 	}
 }
 
+func TestFormatRules_PointAtAttributeValue(t *testing.T) {
+	xml := "<scxml version=\"1.0\" initial=\"_s\">\n" +
+		"  <state id=\"_s\">\n" +
+		"    <transition event=\"ok a,b\" target=\"_s\"/>\n" +
+		"  </state>\n" +
+		"  <state  id=\"1bad\"/>\n" +
+		"</scxml>"
+	v := New(Config{})
+	res, _, err := v.ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	want := map[string]Position{
+		// value of id="1bad"
+		"E301": {Line: 5, Column: 15},
+		// token a,b inside event="ok a,b"
+		"E302": {Line: 3, Column: 27},
+	}
+	for _, d := range res.Diagnostics {
+		w, ok := want[d.Code]
+		if !ok {
+			continue
+		}
+		if d.Position.Line != w.Line || d.Position.Column != w.Column {
+			t.Errorf("%s at %d:%d, want %d:%d", d.Code, d.Position.Line, d.Position.Column, w.Line, w.Column)
+		}
+		lines := strings.Split(xml, "\n")
+		if got := lines[d.Position.Line-1][d.Position.Column-1:]; !strings.HasPrefix(got, map[string]string{"E301": "1bad", "E302": "a,b"}[d.Code]) {
+			t.Errorf("%s column points at %q", d.Code, got)
+		}
+		if int(d.Position.Offset) >= len(xml) || xml[d.Position.Offset] != lines[d.Position.Line-1][d.Position.Column-1] {
+			t.Errorf("%s offset %d does not match its column", d.Code, d.Position.Offset)
+		}
+		delete(want, d.Code)
+	}
+	if len(want) > 0 {
+		t.Fatalf("missing diagnostics %v, got: %+v", want, res.Diagnostics)
+	}
+}
+
+func TestAttributePosition_WalksValue(t *testing.T) {
+	xml := "<scxml version=\"1.0\">\n" +
+		"  <state id=\"s\">\n" +
+		"    <transition event=\"ok\n      a,b\" target=\"s\"/>\n" +
+		"    <transition event=\"x&amp;y a,b\" target=\"s\"/>\n" +
+		"  </state>\n" +
+		"</scxml>"
+	res, _, err := New(Config{}).ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var got []Position
+	for _, d := range res.Diagnostics {
+		if d.Code == "E302" {
+			got = append(got, d.Position)
+		}
+	}
+	// a,b on the second line of the first value; the attribute start of the
+	// second, whose value was written with a reference
+	want := []Position{{Line: 4, Column: 7, Offset: 71}, {Line: 5, Column: 17, Offset: 105}}
+	if len(got) != 3 {
+		t.Fatalf("expected three E302, got: %+v", res.Diagnostics)
+	}
+	for i, w := range want {
+		if got[i].Line != w.Line || got[i].Column != w.Column || got[i].Offset != w.Offset {
+			t.Errorf("E302 #%d at %d:%d@%d, want %d:%d@%d", i, got[i].Line, got[i].Column, got[i].Offset, w.Line, w.Column, w.Offset)
+		}
+	}
+	if xml[want[0].Offset:want[0].Offset+3] != "a,b" || xml[want[1].Offset:want[1].Offset+5] != "event" {
+		t.Errorf("offsets point at %q and %q", xml[want[0].Offset:], xml[want[1].Offset:])
+	}
+}
+
+func TestAttributePosition_FallsBackToElement(t *testing.T) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(`<scxml/>`)).Decode()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	// Elements built through the DOM have no source positions
+	elem, err := doc.CreateElement("state")
+	if err != nil {
+		t.Fatalf("create element: %v", err)
+	}
+	elem.SetAttribute("id", "s")
+	wantLine, wantCol, wantOff := elem.Position()
+	if line, col, off := attributePosition(elem, "id", 0); line != wantLine || col != wantCol || off != wantOff {
+		t.Fatalf("attributePosition = %d:%d@%d, want element position %d:%d@%d", line, col, off, wantLine, wantCol, wantOff)
+	}
+}
+
 func TestInitialElement_MustHaveOneTransition(t *testing.T) {
 	xml := `<?xml version="1.0"?>
 <scxml version="1.0">
@@ -326,6 +420,53 @@ func TestHistory_DeepAllowsDescendant(t *testing.T) {
 	}
 }
 
+func TestHistory_DefaultTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		transitions string
+		severity    Severity
+	}{
+		{"none", ``, SeverityWarning},
+		{"one", `<transition target="a"/>`, ""},
+		{"two", `<transition target="a"/><transition target="b"/>`, SeverityError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="p">
+  <state id="p">
+    <state id="a"/>
+    <state id="b"/>
+    <history id="h">` + tt.transitions + `</history>
+  </state>
+</scxml>`
+			v := New(Config{})
+			res, _, err := v.ValidateString(context.Background(), xml)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			var found []Diagnostic
+			for _, d := range res.Diagnostics {
+				if d.Code == "W333" {
+					found = append(found, d)
+				}
+			}
+			if tt.severity == "" {
+				if len(found) != 0 {
+					t.Fatalf("unexpected W333 for a single default transition: %+v", found)
+				}
+				return
+			}
+			if len(found) != 1 {
+				t.Fatalf("expected one W333, got: %+v", res.Diagnostics)
+			}
+			if found[0].Severity != tt.severity || found[0].Tag != "history" || found[0].Position.Line != 6 {
+				t.Fatalf("expected W333 %s at the history element, got: %+v", tt.severity, found[0])
+			}
+		})
+	}
+}
+
 func TestOnentry_InvalidChild(t *testing.T) {
 	t.Skip("SCXML content model validation - XSD handles this structurally")
 	xml := `<?xml version="1.0"?>
@@ -380,6 +521,43 @@ func TestTransition_EventDescriptorValidation(t *testing.T) {
 	}
 }
 
+func TestTransition_MisplacedInOnentry(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="s">
+  <state id="s">
+    <onentry>
+      <transition event="go" target="t"/>
+    </onentry>
+    <transition event="go" target="t"/>
+  </state>
+  <state id="t">
+    <initial><transition target="t1"/></initial>
+    <history id="h"><transition target="t1"/></history>
+    <state id="t1"/>
+  </state>
+</scxml>`
+	v := New(Config{})
+	res, _, err := v.ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var found []Diagnostic
+	for _, d := range res.Diagnostics {
+		if d.Code == "E306" {
+			found = append(found, d)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("expected one E306 for transition inside onentry, got: %+v", res.Diagnostics)
+	}
+	if found[0].Tag != "transition" || !strings.Contains(found[0].Message, "<onentry>") {
+		t.Fatalf("expected E306 at the transition naming <onentry>, got: %+v", found[0])
+	}
+	if found[0].Position.Line != 5 {
+		t.Fatalf("expected E306 on line 5, got line %d", found[0].Position.Line)
+	}
+}
+
 func TestFinal_DisallowIllegalChildren(t *testing.T) {
 	t.Skip("SCXML content model validation - XSD handles this structurally")
 	xml := `<?xml version="1.0"?>
@@ -440,6 +618,32 @@ func TestDonedata_ContentXorParam(t *testing.T) {
 	}
 }
 
+func TestContent_ExprBodyExclusion(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"expr only", `<content expr="payload"/>`, false},
+		{"body only", `<content>{"ok": true}</content>`, false},
+		{"expr and comment", `<content expr="payload"><!-- computed --></content>`, false},
+		{"expr and text", `<content expr="payload">{"ok": true}</content>`, true},
+		{"expr and element", `<content expr="payload"><data/></content>`, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			xml := `<scxml version="1.0"><state id="s"><onentry><send event="e">` + tc.content + `</send></onentry></state></scxml>`
+			res, _, err := New(Config{}).ValidateString(context.Background(), xml)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			if got := hasCode(res.Diagnostics, "E318"); got != tc.want {
+				t.Fatalf("E318 reported = %v, want %v: %+v", got, tc.want, res.Diagnostics)
+			}
+		})
+	}
+}
+
 func TestCancel_ExactlyOne(t *testing.T) {
 	xml := `<scxml version="1.0"><state id="s"><onentry><cancel/></onentry></state></scxml>`
 	v := New(Config{})
@@ -513,6 +717,68 @@ func TestInvoke_SrcExclusivity(t *testing.T) {
 	}
 }
 
+func TestInvoke_Attributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		invoke    string
+		attribute string
+		code      string
+		severity  Severity
+	}{
+		{"type with typeexpr", `<invoke type="scxml" typeexpr="t" src="a"/>`, "type", "E317", SeverityError},
+		{"id with idlocation", `<invoke id="i" idlocation="loc" src="a"/>`, "id", "E317", SeverityError},
+		{"no source", `<invoke type="scxml"/>`, "src", "W318", SeverityWarning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xml := `<scxml version="1.0"><state id="s">` + tt.invoke + `</state></scxml>`
+			v := New(Config{})
+			res, _, err := v.ValidateString(context.Background(), xml)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			var found []Diagnostic
+			for _, d := range res.Diagnostics {
+				if d.Code == "E317" || d.Code == "W318" {
+					found = append(found, d)
+				}
+			}
+			if len(found) != 1 {
+				t.Fatalf("expected one %s, got: %+v", tt.code, res.Diagnostics)
+			}
+			if found[0].Code != tt.code || found[0].Attribute != tt.attribute || found[0].Severity != tt.severity || found[0].Tag != "invoke" {
+				t.Fatalf("unexpected %s diagnostic: %+v", tt.code, found[0])
+			}
+		})
+	}
+}
+
+func TestInvoke_AttributesComposeWithSrcExclusivity(t *testing.T) {
+	xml := `<scxml version="1.0">
+  <state id="s">
+    <invoke src="a" srcexpr="b"/>
+    <invoke><content><scxml version="1.0"/></content></invoke>
+  </state>
+</scxml>`
+	v := New(Config{})
+	res, _, err := v.ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var e314 int
+	for _, d := range res.Diagnostics {
+		switch d.Code {
+		case "E314":
+			e314++
+		case "E317", "W318":
+			t.Errorf("unexpected %s for invoke with a source: %+v", d.Code, d)
+		}
+	}
+	if e314 != 1 {
+		t.Fatalf("expected exactly one E314, got: %+v", res.Diagnostics)
+	}
+}
+
 func TestState_IllegalChild(t *testing.T) {
 	t.Skip("SCXML content model validation - XSD handles this structurally")
 	xml := `<scxml version="1.0"><state id="s"><bogus/></state></scxml>`
@@ -569,6 +835,32 @@ func TestState_InitialAttrOnAtomic(t *testing.T) {
 	}
 }
 
+func TestTransition_InternalTargetOutsideSource(t *testing.T) {
+	xml := `<scxml version="1.0" initial="s">
+  <state id="s" initial="a">
+    <transition event="e" type="internal" target="b"/>
+    <transition event="f" type="internal" target="sibling"/>
+    <state id="a"/>
+    <state id="b"/>
+  </state>
+  <state id="sibling"/>
+</scxml>`
+	v := New(Config{})
+	res, _, err := v.ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var found []Diagnostic
+	for _, d := range res.Diagnostics {
+		if d.Code == "E336" {
+			found = append(found, d)
+		}
+	}
+	if len(found) != 1 || !strings.Contains(found[0].Message, "'sibling'") || found[0].Position.Line != 4 {
+		t.Fatalf("expected one E336 for the internal transition to the sibling, got: %+v", found)
+	}
+}
+
 func TestSpecialTargets_NoWarning(t *testing.T) {
 	// Special targets like #_parent, #_internal should not trigger E205 errors
 	tests := []struct {
@@ -605,6 +897,313 @@ func TestSpecialTargets_NoWarning(t *testing.T) {
 	}
 }
 
+func TestParallel_RegionWithoutFinal(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="p">
+  <parallel id="p">
+    <state id="upload" initial="sending">
+      <state id="sending"><transition event="sent" target="uploaded"/></state>
+      <final id="uploaded"/>
+    </state>
+    <state id="progress" initial="tick">
+      <state id="tick"><transition event="tick" target="tick"/></state>
+    </state>
+    <transition event="done.state.p" target="end"/>
+  </parallel>
+  <final id="end"/>
+</scxml>`
+	v := New(Config{})
+	res, _, err := v.ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var found []Diagnostic
+	for _, d := range res.Diagnostics {
+		if d.Code == "W344" {
+			found = append(found, d)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("expected one W344 for the region without a final, got: %+v", res.Diagnostics)
+	}
+	if found[0].Severity != SeverityWarning || !strings.Contains(found[0].Message, "'progress'") {
+		t.Fatalf("expected W344 warning naming region 'progress', got: %+v", found[0])
+	}
+}
+
+func TestParallel_NoFinalsNoWarning(t *testing.T) {
+	xml := `<scxml version="1.0"><parallel id="p"><state id="a"/><state id="b"/></parallel></scxml>`
+	v := New(Config{})
+	res, _, err := v.ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if hasCode(res.Diagnostics, "W344") {
+		t.Fatalf("unexpected W344 for parallel without any finals: %+v", res.Diagnostics)
+	}
+}
+
+func TestWarningsAsErrors_PromotesWarnings(t *testing.T) {
+	xml := `<scxml version="1.0"><state id="s"><invoke type="scxml"/></state></scxml>`
+	w318 := func(cfg Config) Diagnostic {
+		t.Helper()
+		res, _, err := New(cfg).ValidateString(context.Background(), xml)
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		for _, d := range res.Diagnostics {
+			if d.Code == "W318" {
+				return d
+			}
+		}
+		t.Fatalf("expected W318, got: %+v", res.Diagnostics)
+		return Diagnostic{}
+	}
+
+	if d := w318(Config{}); d.Severity != SeverityWarning || d.OriginalSeverity != "" {
+		t.Fatalf("expected plain warning, got: %+v", d)
+	}
+	if d := w318(Config{WarningsAsErrors: true}); d.Severity != SeverityError || d.OriginalSeverity != SeverityWarning {
+		t.Fatalf("expected error promoted from warning, got: %+v", d)
+	}
+}
+
+func TestDocBaseURL_LinksDiagnostics(t *testing.T) {
+	xml := `<scxml version="1.0"><state id="s"><invoke type="scxml"/></state></scxml>`
+	w318 := func(cfg Config) Diagnostic {
+		t.Helper()
+		res, _, err := New(cfg).ValidateString(context.Background(), xml)
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		for _, d := range res.Diagnostics {
+			if d.Code == "W318" {
+				return d
+			}
+		}
+		t.Fatalf("expected W318, got: %+v", res.Diagnostics)
+		return Diagnostic{}
+	}
+
+	if d := w318(Config{}); d.DocURL != "" {
+		t.Fatalf("expected no doc URL without a base, got: %q", d.DocURL)
+	}
+	d := w318(Config{DocBaseURL: "https://example.com/rules/"})
+	if d.DocURL != "https://example.com/rules/W318" {
+		t.Fatalf("expected doc URL for W318, got: %q", d.DocURL)
+	}
+
+	var sb strings.Builder
+	if err := NewPrettyReporter(&sb).Print("test.scxml", xml, []Diagnostic{d}); err != nil {
+		t.Fatalf("pretty print error: %v", err)
+	}
+	if !strings.Contains(sb.String(), "docs: https://example.com/rules/W318") {
+		t.Fatalf("expected doc URL in pretty output, got: %s", sb.String())
+	}
+	sb.Reset()
+	if err := NewJSONReporter(&sb).Print(Result{Diagnostics: []Diagnostic{d}}); err != nil {
+		t.Fatalf("json print error: %v", err)
+	}
+	if !strings.Contains(sb.String(), `"doc_url": "https://example.com/rules/W318"`) {
+		t.Fatalf("expected doc_url in JSON output, got: %s", sb.String())
+	}
+}
+
+// largeDocument builds a document with n compound states, each with an
+// initial, a history and two children.
+func largeDocument(n int) string {
+	var sb strings.Builder
+	sb.WriteString(`<scxml version="1.0" initial="c0">`)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("c%d", i)
+		fmt.Fprintf(&sb, `<state id="%s">`, id)
+		fmt.Fprintf(&sb, `<initial><transition target="%s_a"/></initial>`, id)
+		fmt.Fprintf(&sb, `<history id="%s_h"><transition target="%s_b"/></history>`, id, id)
+		fmt.Fprintf(&sb, `<state id="%s_a"><transition event="next" target="%s_b"/></state>`, id, id)
+		fmt.Fprintf(&sb, `<state id="%s_b"><transition event="next" target="c%d"/></state>`, id, (i+1)%n)
+		sb.WriteString(`</state>`)
+	}
+	sb.WriteString(`</scxml>`)
+	return sb.String()
+}
+
+// BenchmarkSemanticRules compares running the default rules on their own,
+// where each id-based rule walks the tree for its id map and again for its
+// checks, against sharing one RuleContext across the run.
+func BenchmarkSemanticRules(b *testing.B) {
+	doc, err := xmldom.NewDecoder(strings.NewReader(largeDocument(500))).Decode()
+	if err != nil {
+		b.Fatalf("parse error: %v", err)
+	}
+	rules := DefaultSemanticRules()
+
+	b.Run("per-rule", func(b *testing.B) {
+		for b.Loop() {
+			for _, rule := range rules {
+				rule.Validate(doc, Config{})
+			}
+		}
+	})
+	b.Run("shared", func(b *testing.B) {
+		for b.Loop() {
+			rc := NewRuleContext(doc)
+			for _, rule := range rules {
+				if cr, ok := rule.(ContextRule); ok {
+					cr.ValidateContext(rc, Config{})
+				} else {
+					rule.Validate(doc, Config{})
+				}
+			}
+		}
+	})
+}
+
+func TestLocationDeclared(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="s">
+  <datamodel>
+    <data id="user"/>
+    <data id="count" expr="0"/>
+  </datamodel>
+  <state id="s">
+    <onentry>
+      <assign location="user.address.city" expr="'Oslo'"/>
+      <assign location="count" expr="count + 1"/>
+      <assign location="_event.data" expr="1"/>
+      <assign location="totl" expr="1"/>
+      <send event="go" idlocation="sendId"/>
+    </onentry>
+  </state>
+</scxml>`
+
+	t.Run("opt-in", func(t *testing.T) {
+		res, _, err := New(Config{}).ValidateString(context.Background(), xml)
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		if hasCode(res.Diagnostics, "W351") {
+			t.Fatalf("expected no W351 without CheckLocations, got: %+v", res.Diagnostics)
+		}
+	})
+
+	t.Run("undeclared targets", func(t *testing.T) {
+		res, _, err := New(Config{CheckLocations: true}).ValidateString(context.Background(), xml)
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		var found []Diagnostic
+		for _, d := range res.Diagnostics {
+			if d.Code == "W351" {
+				found = append(found, d)
+			}
+		}
+		if len(found) != 2 {
+			t.Fatalf("expected W351 for totl and sendId, got: %+v", found)
+		}
+		if found[0].Severity != SeverityWarning || !strings.Contains(found[0].Message, "'totl'") || found[0].Position.Line != 12 {
+			t.Errorf("expected warning for totl on line 12, got: %+v", found[0])
+		}
+		if found[1].Attribute != "idlocation" || !strings.Contains(found[1].Message, "'sendId'") {
+			t.Errorf("expected warning for send idlocation sendId, got: %+v", found[1])
+		}
+	})
+}
+
+func TestInvokeTarget(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="s">
+  <state id="s">
+    <invoke id="worker" src="worker.scxml"/>
+    <invoke idlocation="dynamicId" src="other.scxml"/>
+    <onentry>
+      <send event="a" target="#_worker"/>
+      <send event="b" target="#_parent"/>
+      <send event="c" target="#_internal"/>
+      <send event="d" target="#_scxml_abc"/>
+      <send event="e" targetexpr="'#_' + dynamicId"/>
+      <send event="f" target="#_wroker"/>
+      <send event="g" target="#_missing"/>
+    </onentry>
+  </state>
+</scxml>`
+
+	res, _, err := New(Config{}).ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var found []Diagnostic
+	for _, d := range res.Diagnostics {
+		if d.Code == "W315" {
+			found = append(found, d)
+		}
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected W315 for #_wroker and #_missing, got: %+v", found)
+	}
+	if found[0].Severity != SeverityWarning || !strings.Contains(found[0].Message, "'#_wroker'") || found[0].Position.Line != 12 {
+		t.Errorf("expected warning for #_wroker on line 12, got: %+v", found[0])
+	}
+	if len(found[0].Hints) == 0 || !strings.Contains(found[0].Hints[0], "'#_worker'") {
+		t.Errorf("expected a suggestion of #_worker, got: %+v", found[0].Hints)
+	}
+	if !strings.Contains(found[1].Message, "'#_missing'") || strings.Contains(found[1].Hints[0], "Did you mean") {
+		t.Errorf("expected warning without suggestion for #_missing, got: %+v", found[1])
+	}
+}
+
+func TestContractEvents(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="s">
+  <state id="s">
+    <onentry>
+      <send event="order.created"/>
+      <send event="order.cancelled.byUser"/>
+      <send event="ping"/>
+      <send event="pign"/>
+      <send eventexpr="dynamicEvent"/>
+      <send event="local" target="#_internal"/>
+      <raise event="tick"/>
+    </onentry>
+    <transition event="ping tick done.state.s error.execution" target="s"/>
+    <transition event="order.*" target="s"/>
+    <transition event="order" target="s"/>
+    <transition event="payment.failed *" target="s"/>
+  </state>
+</scxml>`
+
+	w316 := func(cfg Config) []Diagnostic {
+		t.Helper()
+		res, _, err := New(cfg).ValidateString(context.Background(), xml)
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		var found []Diagnostic
+		for _, d := range res.Diagnostics {
+			if d.Code == "W316" {
+				found = append(found, d)
+			}
+		}
+		return found
+	}
+
+	if found := w316(Config{}); len(found) != 0 {
+		t.Fatalf("expected no W316 without AllowedEvents, got: %+v", found)
+	}
+	found := w316(Config{AllowedEvents: []string{"order.*", "ping"}})
+	if len(found) != 2 {
+		t.Fatalf("expected W316 for pign and payment.failed, got: %+v", found)
+	}
+	if found[0].Tag != "send" || !strings.Contains(found[0].Message, "'pign'") || found[0].Position.Line != 8 {
+		t.Errorf("expected warning for send pign on line 8, got: %+v", found[0])
+	}
+	if found[1].Tag != "transition" || !strings.Contains(found[1].Message, "'payment.failed'") {
+		t.Errorf("expected warning for transition payment.failed, got: %+v", found[1])
+	}
+	if found := w316(Config{AllowedEvents: []string{"order.created", "order.cancelled.byUser", "ping", "pign", "payment.failed"}}); len(found) != 0 {
+		t.Fatalf("expected exact matches to cover every event, got: %+v", found)
+	}
+}
+
 // helper
 func hasCode(diags []Diagnostic, code string) bool {
 	for _, d := range diags {
@@ -614,3 +1213,179 @@ func hasCode(diags []Diagnostic, code string) bool {
 	}
 	return false
 }
+
+// stubRule reports the diagnostics returned by diags.
+type stubRule struct {
+	code  string
+	diags func(doc xmldom.Document) []Diagnostic
+}
+
+func (r stubRule) Name() string { return r.code }
+func (r stubRule) Validate(doc xmldom.Document, config Config) []Diagnostic {
+	return r.diags(doc)
+}
+
+func TestDiagnosticDeduplication(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="a">
+  <state id="a">
+    <transition event="go" target="a"/>
+  </state>
+</scxml>`
+	at := func(doc xmldom.Document, severity Severity, code, hint string) Diagnostic {
+		state := doc.DocumentElement().Children().Item(0)
+		line, col, off := state.Position()
+		return Diagnostic{
+			Severity:  severity,
+			Code:      code,
+			Message:   code + " at state a",
+			Position:  Position{Line: line, Column: col, Offset: off},
+			Tag:       "state",
+			Attribute: "id",
+			Hints:     []string{hint},
+		}
+	}
+	rules := []SemanticRule{
+		stubRule{"E900", func(doc xmldom.Document) []Diagnostic {
+			return []Diagnostic{at(doc, SeverityWarning, "E900", "first"), at(doc, SeverityError, "E900", "second")}
+		}},
+		stubRule{"E900", func(doc xmldom.Document) []Diagnostic {
+			return []Diagnostic{at(doc, SeverityWarning, "E900", "first")}
+		}},
+		stubRule{"W901", func(doc xmldom.Document) []Diagnostic {
+			return []Diagnostic{at(doc, SeverityWarning, "W901", "other")}
+		}},
+	}
+	codes := func(diags []Diagnostic) []Diagnostic {
+		var out []Diagnostic
+		for _, d := range diags {
+			if d.Code == "E900" || d.Code == "W901" {
+				out = append(out, d)
+			}
+		}
+		return out
+	}
+
+	res, _, err := New(Config{SemanticRules: rules}).ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	got := codes(res.Diagnostics)
+	if len(got) != 2 || got[0].Code != "E900" || got[1].Code != "W901" {
+		t.Fatalf("expected E900 and W901 once each, got: %+v", got)
+	}
+	if got[0].Severity != SeverityError || !slices.Equal(got[0].Hints, []string{"first", "second"}) {
+		t.Fatalf("expected deduplicated E900 to keep the error severity and both hints, got: %+v", got[0])
+	}
+
+	res, _, err = New(Config{SemanticRules: rules, MergeRelated: true}).ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	got = codes(res.Diagnostics)
+	if len(got) != 1 || got[0].Code != "E900" || got[0].Severity != SeverityError {
+		t.Fatalf("expected a single merged E900 error, got: %+v", got)
+	}
+	if len(got[0].Merged) != 1 || got[0].Merged[0].Code != "W901" {
+		t.Fatalf("expected W901 merged into E900, got: %+v", got[0].Merged)
+	}
+}
+
+func TestDiagnosticDeduplicationKeepsTokens(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<scxml version="1.0" initial="p">
+  <state id="p">
+    <transition event="foo bar" type="internal" target="x y"/>
+  </state>
+  <state id="x"/>
+  <state id="y"/>
+</scxml>`
+	res, _, err := New(Config{AllowedEvents: []string{"baz"}}).ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	count := map[string]int{}
+	for _, d := range res.Diagnostics {
+		count[d.Code]++
+	}
+	if count["W316"] != 2 {
+		t.Errorf("expected W316 for both event tokens, got %d: %+v", count["W316"], res.Diagnostics)
+	}
+	if count["E336"] != 2 {
+		t.Errorf("expected E336 for both targets, got %d: %+v", count["E336"], res.Diagnostics)
+	}
+
+	unplaced := stubRule{"E902", func(doc xmldom.Document) []Diagnostic {
+		return []Diagnostic{
+			{Severity: SeverityError, Code: "E902", Message: "no position"},
+			{Severity: SeverityWarning, Code: "W903", Message: "no position either"},
+		}
+	}}
+	res, _, err = New(Config{SemanticRules: []SemanticRule{unplaced}, MergeRelated: true}).ValidateString(context.Background(), xml)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var got []string
+	for _, d := range res.Diagnostics {
+		if d.Code == "E902" || d.Code == "W903" {
+			if len(d.Merged) != 0 {
+				t.Errorf("%s merged unrelated diagnostics without a position: %+v", d.Code, d.Merged)
+			}
+			got = append(got, d.Code)
+		}
+	}
+	if !slices.Equal(got, []string{"E902", "W903"}) {
+		t.Fatalf("expected E902 and W903 kept apart, got %v", got)
+	}
+}
+
+func TestNamespacedExecutablePlacement(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<agentml xmlns="github.com/agentflare-ai/agentml" version="1.0" initial="s"
+  xmlns:openai="github.com/agentflare-ai/agentml-go/openai"
+  xmlns:memory="github.com/agentflare-ai/agentml-go/memory"
+  xmlns:custom="example.com/custom">
+  <openai:generate model="gpt-4o" prompt="lost"/>
+  <state id="s">
+    <onentry>
+      <openai:generate model="gpt-4o" prompt="runs"/>
+      <if cond="true">
+        <memory:put key="k" value="v"/>
+      </if>
+      <memory:transaction>
+        <memory:get key="k" location="v"/>
+      </memory:transaction>
+      <custom:batch>
+        <openai:generate model="gpt-4o" prompt="custom"/>
+      </custom:batch>
+    </onentry>
+    <memory:put key="k" value="lost"/>
+    <transition event="go" target="s">
+      <openai:generate model="gpt-4o" prompt="runs"/>
+    </transition>
+    <invoke type="scxml" src="child.scxml">
+      <finalize>
+        <memory:put key="k" value="runs"/>
+      </finalize>
+    </invoke>
+  </state>
+</agentml>`
+	doc, err := xmldom.NewDecoder(strings.NewReader(xml)).Decode()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	diags := (&NamespacedExecutablePlacementRule{}).Validate(doc, Config{})
+	if len(diags) != 2 {
+		t.Fatalf("expected W317 for the generate under <agentml> and the put under <state>, got: %+v", diags)
+	}
+	if d := diags[0]; d.Code != "W317" || d.Severity != SeverityWarning || !strings.Contains(d.Message, "<openai:generate>") {
+		t.Errorf("unexpected diagnostic for the misplaced generate: %+v", d)
+	}
+	if !strings.Contains(diags[0].Message, "<agentml>") {
+		t.Errorf("message should name the parent, got %q", diags[0].Message)
+	}
+	if d := diags[1]; d.Tag != "put" || !strings.Contains(d.Message, "<memory:put>") || !strings.Contains(d.Message, "<state>") {
+		t.Errorf("unexpected diagnostic for the misplaced put: %+v", d)
+	}
+}